@@ -0,0 +1,193 @@
+// Package admin provides an authenticated HTTP API to control a Runner at runtime from operations tooling.
+//
+//	http.Handle("/debug/admin/", http.StripPrefix("/debug/admin", admin.Handler(appmetrics.Default(), token)))
+//
+// Requests must send the token as `Authorization: Bearer <token>`. The endpoints are:
+//
+//	GET  /status                        the runner state and the states of the collectors and sinks
+//	GET  /sinks                         the sinks of the registered collectors and their last errors
+//	POST /collect                       collect and deliver a snapshot now, keyed runtime.<key> and system.<key>
+//	POST /profile?name=debug            switch the profile
+//	POST /interval?value=5s             change the collection interval
+//	POST /probes?name=system.net&enabled=false
+//	                                    enable or disable a probe
+//	GET  /pprof/profile?seconds=10      capture a CPU profile
+//	GET  /pprof/{heap,goroutine,...}    capture a runtime profile
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/smallnest/go-app-metrics/status"
+)
+
+// RunnerStatus represents the state of a Runner.
+type RunnerStatus struct {
+	Profile       string          `json:"profile"`
+	Interval      time.Duration   `json:"interval"`
+	Probes        map[string]bool `json:"probes"`
+	LastCollect   time.Time       `json:"last_collect"`
+	HandlerPanics int64           `json:"handler_panics"`
+	Collectors    []status.Status `json:"collectors"`
+}
+
+// Handler returns the admin API of r. All requests are rejected if token is empty.
+func Handler(r *appmetrics.Runner, token string) http.Handler {
+	a := &api{runner: r, token: token}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", a.status)
+	mux.HandleFunc("/sinks", a.sinks)
+	mux.HandleFunc("/collect", a.post(a.collect))
+	mux.HandleFunc("/profile", a.post(a.profile))
+	mux.HandleFunc("/interval", a.post(a.interval))
+	mux.HandleFunc("/probes", a.post(a.probes))
+	mux.HandleFunc("/pprof/", a.pprof)
+	return a.auth(mux)
+}
+
+type api struct {
+	runner *appmetrics.Runner
+	token  string
+}
+
+func (a *api) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *api) post(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+func (a *api) runnerStatus() RunnerStatus {
+	s := RunnerStatus{
+		Profile:       a.runner.Profile(),
+		Interval:      a.runner.Interval(),
+		Probes:        a.runner.EnabledProbes(),
+		HandlerPanics: a.runner.HandlerPanics(),
+		Collectors:    status.All(),
+	}
+	if snap := a.runner.Latest(); snap != nil {
+		s.LastCollect = snap.Time
+	}
+	return s
+}
+
+func (a *api) status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, a.runnerStatus())
+}
+
+func (a *api) sinks(w http.ResponseWriter, r *http.Request) {
+	sinks := []status.Sink{}
+	for _, s := range status.All() {
+		sinks = append(sinks, s.Sinks...)
+	}
+	writeJSON(w, sinks)
+}
+
+func (a *api) collect(w http.ResponseWriter, r *http.Request) {
+	snap := a.runner.Collect()
+	// prefixed like the points of package sink, so keys existing in both, like mem.total, don't collide
+	values := make(map[string]interface{})
+	for k, v := range snap.Runtime.Values() {
+		values["runtime."+k] = v
+	}
+	for k, v := range snap.System.Values() {
+		values["system."+k] = v
+	}
+	writeJSON(w, values)
+}
+
+func (a *api) profile(w http.ResponseWriter, r *http.Request) {
+	if err := a.runner.SetProfile(r.FormValue("name")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, a.runnerStatus())
+}
+
+func (a *api) interval(w http.ResponseWriter, r *http.Request) {
+	d, err := time.ParseDuration(r.FormValue("value"))
+	if err != nil || d <= 0 {
+		http.Error(w, "invalid interval", http.StatusBadRequest)
+		return
+	}
+	a.runner.SetInterval(d)
+	writeJSON(w, a.runnerStatus())
+}
+
+func (a *api) probes(w http.ResponseWriter, r *http.Request) {
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		http.Error(w, "invalid enabled", http.StatusBadRequest)
+		return
+	}
+	if err := a.runner.SetProbe(r.FormValue("name"), enabled); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, a.runnerStatus())
+}
+
+func (a *api) pprof(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/pprof/")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if name == "profile" {
+		sec, err := strconv.ParseInt(r.FormValue("seconds"), 10, 64)
+		if sec <= 0 || err != nil {
+			sec = 30
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := pprof.StartCPUProfile(w); err != nil {
+			w.Header().Del("Content-Type")
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		select {
+		case <-time.After(time.Duration(sec) * time.Second):
+		case <-r.Context().Done():
+		}
+		pprof.StopCPUProfile()
+		return
+	}
+
+	p := pprof.Lookup(name)
+	if p == nil {
+		http.Error(w, "unknown profile", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	p.WriteTo(w, 0)
+}
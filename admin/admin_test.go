@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func do(h http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuth(t *testing.T) {
+	h := Handler(appmetrics.NewRunner(nil), "secret")
+	assert.Equal(t, http.StatusUnauthorized, do(h, "GET", "/status", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(h, "GET", "/status", "wrong").Code)
+	assert.Equal(t, http.StatusOK, do(h, "GET", "/status", "secret").Code)
+
+	h = Handler(appmetrics.NewRunner(nil), "")
+	assert.Equal(t, http.StatusUnauthorized, do(h, "GET", "/status", "").Code)
+}
+
+func TestControl(t *testing.T) {
+	runner := appmetrics.NewRunner(nil)
+	h := Handler(runner, "secret")
+
+	assert.Equal(t, http.StatusMethodNotAllowed, do(h, "GET", "/collect", "secret").Code)
+	w := do(h, "POST", "/collect", "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"runtime.cpu.goroutines"`)
+	assert.Contains(t, w.Body.String(), `"runtime.mem.total"`)
+	assert.Contains(t, w.Body.String(), `"system.mem.total"`)
+	assert.NotNil(t, runner.Latest())
+
+	assert.Equal(t, http.StatusOK, do(h, "POST", "/profile?name=dev", "secret").Code)
+	assert.Equal(t, "dev", runner.Profile())
+	assert.Equal(t, http.StatusBadRequest, do(h, "POST", "/profile?name=nope", "secret").Code)
+
+	assert.Equal(t, http.StatusOK, do(h, "POST", "/interval?value=5s", "secret").Code)
+	assert.Equal(t, 5*time.Second, runner.Interval())
+	assert.Equal(t, http.StatusBadRequest, do(h, "POST", "/interval?value=-1s", "secret").Code)
+
+	w = do(h, "POST", "/probes?name=system.net&enabled=true", "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var s RunnerStatus
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &s))
+	assert.True(t, s.Probes["system.net"])
+	assert.Equal(t, http.StatusBadRequest, do(h, "POST", "/probes?name=nope&enabled=true", "secret").Code)
+
+	assert.Equal(t, http.StatusOK, do(h, "GET", "/sinks", "secret").Code)
+	assert.Equal(t, http.StatusOK, do(h, "GET", "/pprof/heap", "secret").Code)
+	assert.Equal(t, http.StatusNotFound, do(h, "GET", "/pprof/nope", "secret").Code)
+}
@@ -0,0 +1,156 @@
+// Package baseline provides method to persist a baseline of metrics and compare current metrics against it.
+//
+// It is designed to be used after a good deploy: save a baseline, then after a canary period
+// compare the current metrics with it and report the ones which deviate too much.
+package baseline
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/value"
+)
+
+// Baseline represents a snapshot of metrics which are treated as normal behavior.
+type Baseline struct {
+	CreatedAt time.Time          `json:"created_at"`
+	Values    map[string]float64 `json:"values"`
+}
+
+// New creates a Baseline from one or more Values() results, such as the ones of
+// rmetric.RuntimeStats and system.SystemStats. Non-numeric values are ignored.
+func New(values ...map[string]interface{}) *Baseline {
+	b := &Baseline{
+		CreatedAt: time.Now(),
+		Values:    make(map[string]float64),
+	}
+	for _, vs := range values {
+		for k, v := range value.Floats(vs) {
+			b.Values[k] = v
+		}
+	}
+	return b
+}
+
+// Load reads a baseline saved by Save from file.
+func Load(file string) (*Baseline, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Save writes the baseline to file in json format.
+func (b *Baseline) Save(file string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o644)
+}
+
+// Deviation represents a metric whose current value deviates from the baseline.
+type Deviation struct {
+	Key      string  `json:"key"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	// Ratio is the relative change, i.e. |current - baseline| / |baseline|.
+	// It is +Inf if the baseline is zero and the current value is not, which is encoded as null in JSON.
+	Ratio float64 `json:"ratio"`
+}
+
+// deviationJSON is the JSON encoding of a Deviation, whose Ratio is null if it is +Inf.
+type deviationJSON struct {
+	Key      string   `json:"key"`
+	Baseline float64  `json:"baseline"`
+	Current  float64  `json:"current"`
+	Ratio    *float64 `json:"ratio"`
+}
+
+// MarshalJSON encodes d with the Ratio of a zero baseline as null, as JSON has no infinity.
+func (d Deviation) MarshalJSON() ([]byte, error) {
+	v := deviationJSON{Key: d.Key, Baseline: d.Baseline, Current: d.Current}
+	if !math.IsInf(d.Ratio, 0) {
+		v.Ratio = &d.Ratio
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a Deviation encoded by MarshalJSON.
+func (d *Deviation) UnmarshalJSON(data []byte) error {
+	var v deviationJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*d = Deviation{Key: v.Key, Baseline: v.Baseline, Current: v.Current, Ratio: math.Inf(1)}
+	if v.Ratio != nil {
+		d.Ratio = *v.Ratio
+	}
+	return nil
+}
+
+// Comparator compares current metrics against a baseline.
+type Comparator struct {
+	// MaxRatio is the allowed relative change of metrics which are not in Ratios.
+	// Zero means these metrics are not compared.
+	MaxRatio float64
+
+	// Ratios configures the allowed relative change per metric key.
+	Ratios map[string]float64
+}
+
+// Compare returns the metrics of values which deviate from b beyond the configured ratios,
+// sorted by key. Metrics which are not in both b and values are ignored.
+func (c *Comparator) Compare(b *Baseline, values ...map[string]interface{}) []Deviation {
+	var deviations []Deviation
+	for _, vs := range values {
+		for k, cur := range value.Floats(vs) {
+			base, ok := b.Values[k]
+			if !ok {
+				continue
+			}
+
+			maxRatio, ok := c.Ratios[k]
+			if !ok {
+				maxRatio = c.MaxRatio
+			}
+			if maxRatio <= 0 {
+				continue
+			}
+
+			ratio := relativeChange(base, cur)
+			if ratio > maxRatio {
+				deviations = append(deviations, Deviation{
+					Key:      k,
+					Baseline: base,
+					Current:  cur,
+					Ratio:    ratio,
+				})
+			}
+		}
+	}
+
+	sort.Slice(deviations, func(i, j int) bool {
+		return deviations[i].Key < deviations[j].Key
+	})
+	return deviations
+}
+
+func relativeChange(base, cur float64) float64 {
+	if base == 0 {
+		if cur == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(cur-base) / math.Abs(base)
+}
@@ -0,0 +1,61 @@
+package baseline
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveLoad(t *testing.T) {
+	b := New(map[string]interface{}{
+		"cpu.goroutines": int64(10),
+		"mem.total":      uint64(1024),
+		"ignored":        "x",
+	})
+
+	file := filepath.Join(t.TempDir(), "baseline.json")
+	assert.Nil(t, b.Save(file))
+
+	b2, err := Load(file)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float64{"cpu.goroutines": 10, "mem.total": 1024}, b2.Values)
+}
+
+func TestCompare(t *testing.T) {
+	b := New(map[string]interface{}{
+		"cpu.goroutines": int64(10),
+		"mem.alloc":      int64(100),
+		"mem.gc.count":   int64(0),
+		"load.load1":     1.0,
+	})
+
+	c := &Comparator{
+		MaxRatio: 0.5,
+		Ratios:   map[string]float64{"mem.alloc": 2},
+	}
+	deviations := c.Compare(b, map[string]interface{}{
+		"cpu.goroutines": int64(20),
+		"mem.alloc":      int64(250),
+		"mem.gc.count":   int64(3),
+		"load.load1":     1.2,
+		"mem.unknown":    int64(1),
+	})
+
+	assert.Len(t, deviations, 2)
+	assert.Equal(t, "cpu.goroutines", deviations[0].Key)
+	assert.Equal(t, 1.0, deviations[0].Ratio)
+	assert.Equal(t, "mem.gc.count", deviations[1].Key)
+	assert.True(t, math.IsInf(deviations[1].Ratio, 1))
+
+	data, err := json.Marshal(deviations)
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"key":"cpu.goroutines","baseline":10,"current":20,"ratio":1},`+
+		`{"key":"mem.gc.count","baseline":0,"current":3,"ratio":null}]`, string(data))
+	var decoded []Deviation
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, deviations[0], decoded[0])
+	assert.True(t, math.IsInf(decoded[1].Ratio, 1))
+}
@@ -0,0 +1,153 @@
+// Package bench provides method to convert go benchmark results into metrics,
+// so benchmark trends can be tracked with the same infrastructure as runtime and system metrics.
+package bench
+
+import (
+	"bufio"
+	"io"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Result represents the result of a benchmark.
+type Result struct {
+	// Name is the name of the benchmark without the "Benchmark" prefix and the GOMAXPROCS suffix.
+	Name  string
+	Procs int
+	N     int
+
+	// Metrics contains all measurements keyed by unit, such as "ns/op", "B/op", "allocs/op",
+	// "MB/s" and the custom units reported by b.ReportMetric.
+	Metrics map[string]float64
+}
+
+// FromBenchmarkResult converts the result of testing.Benchmark into a Result.
+func FromBenchmarkResult(name string, r testing.BenchmarkResult) Result {
+	res := Result{
+		Name:    name,
+		Procs:   1,
+		N:       r.N,
+		Metrics: map[string]float64{"ns/op": float64(r.NsPerOp())},
+	}
+	if r.MemAllocs > 0 || r.MemBytes > 0 {
+		res.Metrics["B/op"] = float64(r.AllocedBytesPerOp())
+		res.Metrics["allocs/op"] = float64(r.AllocsPerOp())
+	}
+	if r.Bytes > 0 && r.T > 0 {
+		res.Metrics["MB/s"] = float64(r.Bytes) * float64(r.N) / 1e6 / r.T.Seconds()
+	}
+	for unit, v := range r.Extra {
+		res.Metrics[unit] = v
+	}
+	return res
+}
+
+// Parse parses the output of `go test -bench`. Lines which are not benchmark results are ignored.
+func Parse(r io.Reader) ([]Result, error) {
+	var results []Result
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if res, ok := parseLine(scanner.Text()); ok {
+			results = append(results, res)
+		}
+	}
+	return results, scanner.Err()
+}
+
+func parseLine(line string) (Result, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || len(fields)%2 != 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+		return Result{}, false
+	}
+
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Result{}, false
+	}
+
+	res := Result{
+		Name:    strings.TrimPrefix(fields[0], "Benchmark"),
+		Procs:   1,
+		N:       n,
+		Metrics: make(map[string]float64),
+	}
+	if i := strings.LastIndexByte(res.Name, '-'); i > 0 {
+		if procs, err := strconv.Atoi(res.Name[i+1:]); err == nil {
+			res.Name = res.Name[:i]
+			res.Procs = procs
+		}
+	}
+
+	for i := 2; i < len(fields); i += 2 {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return Result{}, false
+		}
+		res.Metrics[fields[i+1]] = v
+	}
+	return res, true
+}
+
+// Values returns metrics which you can write into TSDB, keyed as bench.<name>.<unit>,
+// e.g. bench.Encode.ns_per_op.
+func (r *Result) Values() map[string]interface{} {
+	values := map[string]interface{}{
+		"bench." + r.Name + ".n": int64(r.N),
+	}
+	for unit, v := range r.Metrics {
+		values["bench."+r.Name+"."+unitName(unit)] = v
+	}
+	return values
+}
+
+// Tags returns the tags of the result, revision is added as git.revision if it is not empty.
+func (r *Result) Tags(revision string) map[string]string {
+	tags := map[string]string{
+		"bench.procs": strconv.Itoa(r.Procs),
+	}
+	if revision != "" {
+		tags["git.revision"] = revision
+	}
+	return tags
+}
+
+// Revision returns the vcs revision stamped into the running binary, or empty if it is unknown.
+func Revision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// unitTokens are the names of the tokens of units, other tokens are kept as is.
+var unitTokens = map[string]string{"B": "bytes"}
+
+// unitName returns the unit as a key segment, e.g. B/op becomes bytes_per_op. Only whole tokens
+// are renamed, so a custom unit like GB/s becomes gb_per_s.
+func unitName(unit string) string {
+	var b strings.Builder
+	for _, per := range strings.Split(unit, "/") {
+		if b.Len() > 0 {
+			b.WriteString("_per_")
+		}
+		for i, token := range strings.Fields(per) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			if name, ok := unitTokens[token]; ok {
+				token = name
+			}
+			b.WriteString(token)
+		}
+	}
+	return strings.ToLower(b.String())
+}
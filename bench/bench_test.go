@@ -0,0 +1,71 @@
+package bench
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const output = `goos: linux
+goarch: amd64
+pkg: github.com/smallnest/go-app-metrics/rmetric
+BenchmarkOnce-8   	  123456	      9876 ns/op	     512 B/op	       3 allocs/op
+BenchmarkEncode   	    1000	   1000000 ns/op	  12.50 MB/s	       7.000 items/op
+PASS
+ok  	github.com/smallnest/go-app-metrics/rmetric	2.345s
+`
+
+func TestParse(t *testing.T) {
+	results, err := Parse(strings.NewReader(output))
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+
+	assert.Equal(t, "Once", results[0].Name)
+	assert.Equal(t, 8, results[0].Procs)
+	assert.Equal(t, 123456, results[0].N)
+	assert.Equal(t, map[string]interface{}{
+		"bench.Once.n":             int64(123456),
+		"bench.Once.ns_per_op":     9876.0,
+		"bench.Once.bytes_per_op":  512.0,
+		"bench.Once.allocs_per_op": 3.0,
+	}, results[0].Values())
+
+	assert.Equal(t, "Encode", results[1].Name)
+	assert.Equal(t, 1, results[1].Procs)
+	values := results[1].Values()
+	assert.Equal(t, 12.5, values["bench.Encode.mb_per_s"])
+	assert.Equal(t, 7.0, values["bench.Encode.items_per_op"])
+
+	assert.Equal(t, map[string]string{"bench.procs": "8", "git.revision": "abc"}, results[0].Tags("abc"))
+}
+
+func TestUnitName(t *testing.T) {
+	for unit, want := range map[string]string{
+		"ns/op":      "ns_per_op",
+		"B/op":       "bytes_per_op",
+		"MB/s":       "mb_per_s",
+		"GB/s":       "gb_per_s",
+		"Bytes/op":   "bytes_per_op",
+		"B/Batch":    "bytes_per_batch",
+		"cache hits": "cache_hits",
+	} {
+		assert.Equal(t, want, unitName(unit), unit)
+	}
+}
+
+var sink []byte
+
+func TestFromBenchmarkResult(t *testing.T) {
+	r := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sink = make([]byte, 16)
+		}
+	})
+
+	res := FromBenchmarkResult("Make", r)
+	values := res.Values()
+	assert.Contains(t, values, "bench.Make.ns_per_op")
+	assert.Contains(t, values, "bench.Make.allocs_per_op")
+}
@@ -0,0 +1,159 @@
+// Package breaker provides a bridge for circuit breaker libraries to report the states and
+// trips of breakers, tagged by breaker name.
+//
+// For sony/gobreaker, report the state changes from the settings:
+//
+//	b := breaker.New()
+//	st := gobreaker.Settings{
+//		Name: "users",
+//		OnStateChange: func(name string, from, to gobreaker.State) {
+//			b.OnStateChange(name, from, to)
+//		},
+//	}
+//
+// For afex/hystrix-go, which has no state change callback, poll the circuits before collecting:
+//
+//	c, _, _ := hystrix.GetCircuit("users")
+//	b.SetOpen("users", c.IsOpen())
+package breaker
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+// States of a circuit breaker, the values are exported as breaker.<name>.state.
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return fmt.Sprintf("unknown state: %d", int(s))
+	}
+}
+
+// ParseState parses the name of a state, such as "closed", "half-open" or "half_open", and "open".
+func ParseState(s string) (State, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "closed":
+		return Closed, true
+	case "half-open", "half_open", "halfopen":
+		return HalfOpen, true
+	case "open":
+		return Open, true
+	default:
+		return Closed, false
+	}
+}
+
+// breakerStat is the state and the cumulative counters of a breaker.
+type breakerStat struct {
+	state       State
+	trips       int64
+	transitions int64
+}
+
+// Breakers records the states of circuit breakers. It is safe for use from multiple go routines.
+type Breakers struct {
+	mu       sync.Mutex
+	breakers map[string]*breakerStat
+}
+
+// New creates Breakers without breakers.
+func New() *Breakers {
+	return &Breakers{breakers: make(map[string]*breakerStat)}
+}
+
+// SetState records the current state of the breaker name. A change into Open counts as a trip.
+func (b *Breakers) SetState(name string, s State) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stat, ok := b.breakers[name]
+	if !ok {
+		stat = &breakerStat{}
+		b.breakers[name] = stat
+	}
+	if stat.state == s {
+		return
+	}
+	stat.state = s
+	stat.transitions++
+	if s == Open {
+		stat.trips++
+	}
+}
+
+// SetOpen records whether the breaker name is open, for libraries which only report an open flag.
+func (b *Breakers) SetOpen(name string, open bool) {
+	s := Closed
+	if open {
+		s = Open
+	}
+	b.SetState(name, s)
+}
+
+// OnStateChange records a state change reported by a library whose states format as
+// "closed", "half-open" and "open", like gobreaker.State. Unknown states are ignored.
+func (b *Breakers) OnStateChange(name string, from, to fmt.Stringer) {
+	if s, ok := ParseState(to.String()); ok {
+		b.SetState(name, s)
+	}
+}
+
+// Stats returns the current stats of the breakers keyed by name.
+func (b *Breakers) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := BreakerStats{Breakers: make(map[string]BreakerStat, len(b.breakers))}
+	for name, stat := range b.breakers {
+		stats.Breakers[name] = BreakerStat{
+			State:       stat.state,
+			Trips:       stat.trips,
+			Transitions: stat.transitions,
+		}
+	}
+	return stats
+}
+
+// BreakerStats represents the stats of circuit breakers keyed by name.
+type BreakerStats struct {
+	Breakers map[string]BreakerStat
+}
+
+// BreakerStat represents the stats of a circuit breaker.
+type BreakerStat struct {
+	State State
+	// Trips is the cumulative number of changes into Open.
+	Trips int64
+	// Transitions is the cumulative number of state changes.
+	Transitions int64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as breaker.<name>.<metric>.
+// breaker.<name>.state is 0 if closed, 1 if half-open and 2 if open.
+func (s *BreakerStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Breakers)*3)
+	for name, stat := range s.Breakers {
+		prefix := "breaker." + name + "."
+		values[prefix+"state"] = int64(stat.State)
+		values[prefix+"trips"] = stat.Trips
+		values[prefix+"transitions"] = stat.Transitions
+	}
+	return values
+}
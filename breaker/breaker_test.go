@@ -0,0 +1,44 @@
+package breaker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// libState mimics the state type of a circuit breaker library.
+type libState string
+
+func (s libState) String() string { return string(s) }
+
+func TestBreakers(t *testing.T) {
+	b := New()
+	b.OnStateChange("users", libState("closed"), libState("open"))
+	b.OnStateChange("users", libState("open"), libState("half-open"))
+	b.OnStateChange("users", libState("half-open"), libState("open"))
+	b.OnStateChange("users", libState("open"), libState("bogus"))
+	b.SetOpen("orders", false)
+	b.SetOpen("orders", false)
+
+	stats := b.Stats()
+	assert.Equal(t, Open, stats.Breakers["users"].State)
+	assert.Equal(t, int64(2), stats.Breakers["users"].Trips)
+	assert.Equal(t, int64(3), stats.Breakers["users"].Transitions)
+	assert.Equal(t, Closed, stats.Breakers["orders"].State)
+	assert.Equal(t, int64(0), stats.Breakers["orders"].Transitions)
+
+	values := stats.Values()
+	assert.Equal(t, int64(2), values["breaker.users.state"])
+	assert.Equal(t, int64(2), values["breaker.users.trips"])
+	assert.Equal(t, int64(0), values["breaker.orders.state"])
+}
+
+func TestParseState(t *testing.T) {
+	s, ok := ParseState("Half_Open")
+	assert.True(t, ok)
+	assert.Equal(t, HalfOpen, s)
+	assert.Equal(t, "half-open", s.String())
+
+	_, ok = ParseState("broken")
+	assert.False(t, ok)
+}
@@ -0,0 +1,129 @@
+// Package cache provides instrumentation of caches: hit/miss counters, evictions, size and fill ratio.
+//
+//	c := cache.New("users", 10000)
+//	c.SizeFunc = lru.Len
+//
+//	v, ok := lru.Get(key)
+//	c.Record(ok)
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Cache instruments a cache. It is safe for use from multiple go routines.
+type Cache struct {
+	// SizeFunc returns the number of entries of the cache, it is called by Stats if it is not nil.
+	// Otherwise the size set by SetSize is used. It must be set before Stats is called.
+	SizeFunc func() int
+
+	name     string
+	capacity int64
+
+	hits      int64
+	misses    int64
+	evictions int64
+	size      int64
+
+	mu         sync.Mutex
+	prevHits   int64
+	prevMisses int64
+}
+
+// New creates a Cache named name, which is used in metric keys, holding at most capacity entries.
+// capacity may be 0 if the cache is unbounded, then the fill ratio is not reported.
+func New(name string, capacity int) *Cache {
+	return &Cache{
+		name:     name,
+		capacity: int64(capacity),
+	}
+}
+
+// Hit records a cache hit.
+func (c *Cache) Hit() {
+	atomic.AddInt64(&c.hits, 1)
+}
+
+// Miss records a cache miss.
+func (c *Cache) Miss() {
+	atomic.AddInt64(&c.misses, 1)
+}
+
+// Record records a hit if hit is true, a miss otherwise, e.g. with the ok result of a lookup.
+func (c *Cache) Record(hit bool) {
+	if hit {
+		c.Hit()
+	} else {
+		c.Miss()
+	}
+}
+
+// Evict records n evicted entries. It can be called from the eviction callback of a cache.
+func (c *Cache) Evict(n int) {
+	atomic.AddInt64(&c.evictions, int64(n))
+}
+
+// SetSize sets the number of entries of the cache.
+func (c *Cache) SetSize(n int) {
+	atomic.StoreInt64(&c.size, int64(n))
+}
+
+// Stats returns the current stats of the cache. HitRatio is calculated since the previous call.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{
+		Name:      c.name,
+		Hits:      atomic.LoadInt64(&c.hits),
+		Misses:    atomic.LoadInt64(&c.misses),
+		Evictions: atomic.LoadInt64(&c.evictions),
+		Size:      atomic.LoadInt64(&c.size),
+		Capacity:  c.capacity,
+	}
+	if c.SizeFunc != nil {
+		stats.Size = int64(c.SizeFunc())
+	}
+	if stats.Capacity > 0 {
+		stats.FillRatio = float64(stats.Size) / float64(stats.Capacity)
+	}
+
+	hits, misses := stats.Hits-c.prevHits, stats.Misses-c.prevMisses
+	if hits+misses > 0 {
+		stats.HitRatio = float64(hits) / float64(hits+misses)
+	}
+	c.prevHits, c.prevMisses = stats.Hits, stats.Misses
+	return stats
+}
+
+// CacheStats represents the stats of a cache.
+type CacheStats struct {
+	Name string
+
+	// Hits, Misses and Evictions are cumulative.
+	Hits      int64
+	Misses    int64
+	Evictions int64
+
+	Size     int64
+	Capacity int64
+	// FillRatio is Size / Capacity, it is 0 if the capacity is unknown.
+	FillRatio float64
+	// HitRatio is the fraction of lookups which hit since the previous Stats, it is 0 without lookups.
+	HitRatio float64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as cache.<name>.<metric>.
+func (s *CacheStats) Values() map[string]interface{} {
+	prefix := "cache." + s.Name + "."
+	return map[string]interface{}{
+		prefix + "hits":       s.Hits,
+		prefix + "misses":     s.Misses,
+		prefix + "evictions":  s.Evictions,
+		prefix + "size":       s.Size,
+		prefix + "capacity":   s.Capacity,
+		prefix + "fill_ratio": s.FillRatio,
+		prefix + "hit_ratio":  s.HitRatio,
+	}
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	c := New("users", 100)
+	c.Record(true)
+	c.Record(true)
+	c.Hit()
+	c.Miss()
+	c.Evict(2)
+	c.SetSize(25)
+
+	stats := c.Stats()
+	assert.Equal(t, int64(3), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, int64(2), stats.Evictions)
+	assert.Equal(t, 0.75, stats.HitRatio)
+	assert.Equal(t, 0.25, stats.FillRatio)
+
+	c.SizeFunc = func() int { return 50 }
+	c.Miss()
+	stats = c.Stats()
+	assert.Equal(t, 0.0, stats.HitRatio)
+
+	values := stats.Values()
+	assert.Equal(t, int64(50), values["cache.users.size"])
+	assert.Equal(t, 0.5, values["cache.users.fill_ratio"])
+	assert.Equal(t, int64(2), values["cache.users.misses"])
+}
@@ -0,0 +1,205 @@
+// Package cardinality provides a guard which enforces a budget of distinct series,
+// so that per-partition and per-interface metrics can't explode, e.g. veth interfaces on kubernetes nodes.
+package cardinality
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/smallnest/go-app-metrics/internal/rollup"
+	"github.com/smallnest/go-app-metrics/internal/value"
+	"github.com/smallnest/go-app-metrics/metadata"
+)
+
+// Policy decides what to do with the series beyond the budget. The priority of the metric of a series,
+// see metadata.Priority, takes precedence: critical series are always aggregated and debug series
+// are always dropped.
+type Policy int
+
+const (
+	// Drop drops the series beyond the budget.
+	Drop Policy = iota
+	// Aggregate folds the series beyond the budget into the series of the "other" bucket:
+	// the counters and bytes are summed, the percentages take the max.
+	Aggregate
+)
+
+// Other is the name of the bucket into which the series beyond the budget are aggregated.
+const Other = "other"
+
+// DefaultExpiry is the default number of collections after which an admitted name which
+// doesn't appear anymore is expired, see Family.Expiry.
+const DefaultExpiry = 10
+
+// Family is a group of series keyed as <Prefix><name>.<metric>, e.g. net.eth0.bytes_sent
+// where the name is the interface. The budget limits the number of distinct names.
+type Family struct {
+	Name   string
+	Prefix string
+	Budget int
+	Policy Policy
+	// Expiry is the number of collections an admitted name may be absent before it is expired,
+	// which frees its place in the budget for new names, e.g. of short-lived veth interfaces.
+	// Defaults to DefaultExpiry if 0, names never expire if negative.
+	Expiry int
+}
+
+// DefaultFamilies are the families of the per-partition and per-interface series of system.SystemStats.
+var DefaultFamilies = []Family{
+	{Name: "disk", Prefix: "disk.", Budget: 32, Policy: Aggregate},
+	{Name: "net", Prefix: "net.", Budget: 32, Policy: Aggregate},
+}
+
+// Guard enforces the budgets of families. Names are admitted in order of appearance (sorted within
+// an interval) and stay admitted while they appear, so series don't flap between intervals. Names
+// absent for Family.Expiry collections are expired. The "other" bucket and
+// the rollup series (system.Rollup) don't count against the budget.
+// It is safe for use from multiple go routines.
+type Guard struct {
+	mu          sync.Mutex
+	families    []Family
+	admitted    map[string]map[string]int64 // family -> name -> last collection the name appeared in
+	dropped     map[string]int64
+	collections int64
+}
+
+// NewGuard creates a Guard of families. DefaultFamilies are used if no family is given.
+func NewGuard(families ...Family) *Guard {
+	if len(families) == 0 {
+		families = DefaultFamilies
+	}
+
+	g := &Guard{
+		families: families,
+		admitted: make(map[string]map[string]int64, len(families)),
+		dropped:  make(map[string]int64, len(families)),
+	}
+	for _, f := range families {
+		g.admitted[f.Name] = make(map[string]int64)
+	}
+	return g
+}
+
+// Apply enforces the budgets on values in place. It also adds cardinality.<family>.series, the number
+// of admitted names, and cardinality.<family>.dropped, the cumulative number of series beyond the budget.
+func (g *Guard) Apply(values map[string]interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.collections++
+	for _, f := range g.families {
+		admitted := g.admitted[f.Name]
+		others := make(map[string]float64)
+
+		// sort the keys so the admitted names of the same interval are deterministic
+		var keys []string
+		for k := range values {
+			if strings.HasPrefix(k, f.Prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if name, _, ok := split(f.Prefix, k); ok {
+				if _, ok := admitted[name]; ok {
+					admitted[name] = g.collections
+				}
+			}
+		}
+		g.expire(f, admitted)
+
+		for _, k := range keys {
+			name, metric, ok := split(f.Prefix, k)
+			if !ok || name == Other || name == rollup.Name {
+				continue
+			}
+			if _, ok := admitted[name]; ok {
+				continue
+			}
+			if len(admitted) < f.Budget {
+				admitted[name] = g.collections
+				continue
+			}
+
+			v := values[k]
+			delete(values, k)
+			g.dropped[f.Name]++
+			if aggregate(f.Policy, k) {
+				if fv, ok := value.Float64(v); ok {
+					if prev, ok := others[metric]; ok {
+						fv = fold(k, prev, fv)
+					}
+					others[metric] = fv
+				}
+			}
+		}
+
+		for metric, v := range others {
+			values[f.Prefix+Other+"."+metric] = v
+		}
+		values["cardinality."+f.Name+".series"] = int64(len(admitted))
+		values["cardinality."+f.Name+".dropped"] = g.dropped[f.Name]
+	}
+}
+
+// expire removes the names of f which haven't appeared for f.Expiry collections from admitted.
+func (g *Guard) expire(f Family, admitted map[string]int64) {
+	expiry := f.Expiry
+	if expiry == 0 {
+		expiry = DefaultExpiry
+	}
+	if expiry < 0 {
+		return
+	}
+	for name, last := range admitted {
+		if g.collections-last >= int64(expiry) {
+			delete(admitted, name)
+		}
+	}
+}
+
+// aggregate reports whether the series key beyond the budget is aggregated by policy or by its priority.
+func aggregate(policy Policy, key string) bool {
+	m, _ := metadata.Lookup(key)
+	switch m.Priority {
+	case metadata.Critical:
+		return true
+	case metadata.Debug:
+		return false
+	default:
+		return policy == Aggregate
+	}
+}
+
+// fold folds the value v of the series key into acc, the value of the "other" bucket so far.
+// The counters, bytes and counts are summed. The percentages, ratios, means and maximums of the
+// metadata of key take the max, as their sum is meaningless, and the minimums take the min.
+func fold(key string, acc, v float64) float64 {
+	m, _ := metadata.Lookup(key)
+	switch {
+	case m.Aggregation == metadata.Min:
+		return math.Min(acc, v)
+	case m.Aggregation == metadata.Mean || m.Aggregation == metadata.Max ||
+		m.Unit == metadata.Ratio || strings.HasSuffix(key, "_percent"):
+		return math.Max(acc, v)
+	default:
+		return acc + v
+	}
+}
+
+// split splits key into the name and the metric if it belongs to the family of prefix.
+// The metric is the last segment of key, so the name may contain dots.
+func split(prefix, key string) (name, metric string, ok bool) {
+	if !strings.HasPrefix(key, prefix) {
+		return "", "", false
+	}
+	rest := key[len(prefix):]
+	i := strings.LastIndexByte(rest, '.')
+	if i <= 0 {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
@@ -0,0 +1,155 @@
+package cardinality
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuardAggregate(t *testing.T) {
+	g := NewGuard(Family{Name: "net", Prefix: "net.", Budget: 1, Policy: Aggregate})
+
+	values := map[string]interface{}{
+		"net.eth0.bytes_sent":  uint64(10),
+		"net.veth1.bytes_sent": uint64(1),
+		"net.veth2.bytes_sent": uint64(2),
+		"mem.total":            uint64(100),
+	}
+	g.Apply(values)
+
+	assert.Equal(t, map[string]interface{}{
+		"net.eth0.bytes_sent":     uint64(10),
+		"net.other.bytes_sent":    3.0,
+		"mem.total":               uint64(100),
+		"cardinality.net.series":  int64(1),
+		"cardinality.net.dropped": int64(2),
+	}, values)
+
+	// eth0 stays admitted even if a name sorted before it appears
+	values = map[string]interface{}{
+		"net.docker0.bytes_sent": uint64(5),
+		"net.eth0.bytes_sent":    uint64(20),
+	}
+	g.Apply(values)
+	assert.Equal(t, uint64(20), values["net.eth0.bytes_sent"])
+	assert.Equal(t, 5.0, values["net.other.bytes_sent"])
+	assert.Equal(t, int64(3), values["cardinality.net.dropped"])
+}
+
+func TestGuardAggregatePercent(t *testing.T) {
+	g := NewGuard(Family{Name: "disk", Prefix: "disk.", Budget: 1, Policy: Aggregate})
+
+	values := map[string]interface{}{
+		"disk./.total":                uint64(100),
+		"disk./.used_percent":         50.0,
+		"disk./a.total":               uint64(10),
+		"disk./a.used_percent":        90.0,
+		"disk./a.inodes_used_percent": 20.0,
+		"disk./b.total":               uint64(30),
+		"disk./b.used_percent":        40.0,
+		"disk./b.inodes_used_percent": 70.0,
+	}
+	g.Apply(values)
+
+	assert.Equal(t, 40.0, values["disk.other.total"])
+	assert.Equal(t, 90.0, values["disk.other.used_percent"])
+	assert.Equal(t, 70.0, values["disk.other.inodes_used_percent"])
+}
+
+func TestGuardDrop(t *testing.T) {
+	g := NewGuard(Family{Name: "disk", Prefix: "disk.", Budget: 2, Policy: Drop})
+
+	values := map[string]interface{}{
+		"disk./.total":         uint64(1),
+		"disk./.free":          uint64(1),
+		"disk./boot.total":     uint64(1),
+		"disk./var/lib.total":  uint64(1),
+		"disk./mnt/x.y.total":  uint64(1),
+		"disk.other.total":     uint64(1),
+		"diskless.other.total": uint64(1),
+	}
+	g.Apply(values)
+
+	assert.Contains(t, values, "disk./.total")
+	assert.Contains(t, values, "disk./.free")
+	assert.Contains(t, values, "disk./boot.total")
+	assert.NotContains(t, values, "disk./var/lib.total")
+	assert.NotContains(t, values, "disk./mnt/x.y.total")
+	assert.Contains(t, values, "disk.other.total")
+	assert.Contains(t, values, "diskless.other.total")
+	assert.Equal(t, int64(2), values["cardinality.disk.series"])
+	assert.Equal(t, int64(2), values["cardinality.disk.dropped"])
+}
+
+func TestGuardRollup(t *testing.T) {
+	g := NewGuard(Family{Name: "net", Prefix: "net.", Budget: 1, Policy: Drop})
+
+	values := map[string]interface{}{
+		"net.eth0.bytes_sent":  uint64(1),
+		"net.total.bytes_sent": uint64(1),
+	}
+	g.Apply(values)
+	assert.Contains(t, values, "net.eth0.bytes_sent")
+	assert.Contains(t, values, "net.total.bytes_sent")
+	assert.Equal(t, int64(0), values["cardinality.net.dropped"])
+}
+
+func TestGuardPriority(t *testing.T) {
+	g := NewGuard(Family{Name: "disk", Prefix: "disk.", Budget: 1, Policy: Drop})
+
+	values := map[string]interface{}{
+		"disk./.free":      uint64(1),
+		"disk./boot.free":  uint64(2),
+		"disk./boot.total": uint64(3),
+	}
+	g.Apply(values)
+
+	// the critical free space is aggregated despite the Drop policy
+	assert.Equal(t, 2.0, values["disk.other.free"])
+	assert.NotContains(t, values, "disk.other.total")
+
+	g = NewGuard(Family{Name: "disk_io", Prefix: "disk_io.", Budget: 1, Policy: Aggregate})
+	values = map[string]interface{}{
+		"disk_io.sda.read_bytes":       uint64(1),
+		"disk_io.sdb.read_bytes":       uint64(2),
+		"disk_io.sdb.weighted_io_time": uint64(3),
+	}
+	g.Apply(values)
+
+	// the debug weighted IO time is dropped despite the Aggregate policy
+	assert.Equal(t, 2.0, values["disk_io.other.read_bytes"])
+	assert.NotContains(t, values, "disk_io.other.weighted_io_time")
+}
+
+func TestGuardExpiry(t *testing.T) {
+	g := NewGuard(Family{Name: "net", Prefix: "net.", Budget: 2, Policy: Aggregate, Expiry: 2})
+
+	// short-lived veth interfaces churn, eth0 stays
+	for i := 0; i < 10; i++ {
+		veth := fmt.Sprintf("net.veth%d.bytes_sent", i)
+		values := map[string]interface{}{
+			"net.eth0.bytes_sent": uint64(1),
+			veth:                  uint64(2),
+		}
+		g.Apply(values)
+		assert.Contains(t, values, "net.eth0.bytes_sent")
+		if i%2 == 0 {
+			// the previous veth hasn't been absent long enough
+			assert.Contains(t, values, veth, i)
+		} else {
+			assert.Equal(t, 2.0, values["net.other.bytes_sent"], i)
+		}
+		assert.Equal(t, int64(2), values["cardinality.net.series"])
+	}
+
+	g = NewGuard(Family{Name: "net", Prefix: "net.", Budget: 1, Policy: Drop, Expiry: -1})
+	g.Apply(map[string]interface{}{"net.veth0.bytes_sent": uint64(1)})
+	for i := 0; i < 2*DefaultExpiry; i++ {
+		g.Apply(map[string]interface{}{})
+	}
+	values := map[string]interface{}{"net.veth1.bytes_sent": uint64(1)}
+	g.Apply(values)
+	assert.NotContains(t, values, "net.veth1.bytes_sent")
+	assert.Equal(t, int64(1), values["cardinality.net.series"])
+}
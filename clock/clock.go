@@ -0,0 +1,126 @@
+// Package clock provides method to detect clock jumps and pauses of the host, such as an NTP step,
+// a suspend/resume or a paused VM, by comparing the elapsed wall-clock time of every interval with
+// the elapsed monotonic time. Such discrepancies distort the rates computed from wall-clock timestamps.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// ClockStatsHandler represents a handler to handle stats after successfully gathering statistics
+type ClockStatsHandler func(ClockStats)
+
+// Collector implements the periodic check of the clocks to a ClockStatsHandler.
+type Collector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Threshold is the minimum absolute drift of an interval which is counted as a jump.
+	// Defaults to 1 second.
+	Threshold time.Duration
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	mu           sync.Mutex
+	prev         time.Time // with the monotonic reading
+	prevWall     time.Time // without the monotonic reading
+	jumps        int64
+	statsHandler ClockStatsHandler
+}
+
+// New creates a new Collector that will periodically output the clock stats to statsHandler.
+func New(statsHandler ClockStatsHandler) *Collector {
+	if statsHandler == nil {
+		statsHandler = func(ClockStats) {}
+	}
+
+	now := time.Now()
+	return &Collector{
+		CollectInterval: 10 * time.Second,
+		Threshold:       time.Second,
+		prev:            now,
+		prevWall:        now.Round(0),
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured ClockStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *Collector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the clock stats since the previous collection, or since New for the first one.
+// It is safe for use from multiple go routines.
+func (c *Collector) Once() ClockStats {
+	return c.collectStats()
+}
+
+func (c *Collector) collectStats() ClockStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Sub uses the monotonic readings if both times have them, Round(0) strips them
+	now := time.Now()
+	wall := now.Round(0)
+	stats := ClockStats{
+		MonotonicElapsed: now.Sub(c.prev),
+		WallElapsed:      wall.Sub(c.prevWall),
+	}
+	stats.Drift = stats.WallElapsed - stats.MonotonicElapsed
+	if stats.Drift >= c.Threshold || -stats.Drift >= c.Threshold {
+		c.jumps++
+	}
+	stats.Jumps = c.jumps
+	c.prev = now
+	c.prevWall = wall
+
+	return stats
+}
+
+// ClockStats represents the elapsed times of the clocks in an interval.
+type ClockStats struct {
+	WallElapsed      time.Duration
+	MonotonicElapsed time.Duration
+	// Drift is WallElapsed - MonotonicElapsed. It is positive if the wall clock has been stepped forward
+	// or the host has been suspended, which the monotonic clock doesn't count, and negative if the wall
+	// clock has been stepped back.
+	Drift time.Duration
+	// Jumps is the cumulative number of intervals whose drift exceeded Collector.Threshold.
+	Jumps int64
+}
+
+// Correct converts a rate per wall-clock second of the interval into a rate per monotonic second,
+// e.g. the rate of a counter whose delta has been divided by the difference of wall-clock timestamps.
+func (s *ClockStats) Correct(rate float64) float64 {
+	if s.MonotonicElapsed <= 0 {
+		return rate
+	}
+	return rate * float64(s.WallElapsed) / float64(s.MonotonicElapsed)
+}
+
+// Values returns metrics which you can write into TSDB. The durations are in nanoseconds.
+func (s *ClockStats) Values() map[string]interface{} {
+	return map[string]interface{}{
+		"clock.wall_elapsed":      int64(s.WallElapsed),
+		"clock.monotonic_elapsed": int64(s.MonotonicElapsed),
+		"clock.drift":             int64(s.Drift),
+		"clock.jumps":             s.Jumps,
+	}
+}
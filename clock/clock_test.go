@@ -0,0 +1,29 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	c := New(nil)
+	time.Sleep(10 * time.Millisecond)
+	stats := c.Once()
+	assert.True(t, stats.MonotonicElapsed >= 10*time.Millisecond)
+	assert.Equal(t, int64(0), stats.Jumps)
+
+	// the wall clock has been stepped back by 1 minute since the previous collection
+	c.prevWall = c.prevWall.Add(time.Minute)
+	stats = c.Once()
+	assert.True(t, stats.Drift <= -time.Minute+time.Second, stats.Drift)
+	assert.Equal(t, int64(1), stats.Jumps)
+	assert.Equal(t, int64(1), stats.Values()["clock.jumps"])
+}
+
+func TestCorrect(t *testing.T) {
+	// 100 events in 10s, measured with a wall clock stepped forward by 10s
+	s := ClockStats{WallElapsed: 20 * time.Second, MonotonicElapsed: 10 * time.Second}
+	assert.Equal(t, 10.0, s.Correct(5))
+}
@@ -0,0 +1,252 @@
+// Package connstate provides transport-level stats of HTTP servers by hooking http.Server.ConnState:
+// the numbers of new, active, idle and hijacked connections, TLS connections and the age distribution
+// of the open connections. It complements the request middlewares.
+//
+// Closed connections are counted by reason: closed by the idle timeout, by the client while idle,
+// by the server shutdown or otherwise, which helps to tune http.Server.IdleTimeout with data.
+//
+//	srv := &http.Server{Addr: ":8080", Handler: h}
+//	conns := connstate.Instrument("api", srv)
+//	...
+//	stats := conns.Stats()
+package connstate
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the default upper bounds of the connection age histogram.
+var DefaultBuckets = []time.Duration{
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+}
+
+type conn struct {
+	state   http.ConnState
+	created time.Time
+	since   time.Time // time of the last state change
+	tls     bool
+}
+
+// Tracker tracks the connections of a server. It is safe for use from multiple go routines.
+type Tracker struct {
+	// IdleTimeout is the idle timeout of the server. Idle connections closed after being idle
+	// for IdleTimeout are counted as closed by the idle timeout. Set by Instrument.
+	IdleTimeout time.Duration
+
+	name    string
+	buckets []time.Duration
+
+	mu           sync.Mutex
+	conns        map[net.Conn]*conn
+	accepted     int64
+	closed       int64
+	hijacked     int64
+	shuttingDown bool
+
+	closedIdleTimeout int64
+	closedByClient    int64
+	closedShutdown    int64
+	closedOther       int64
+}
+
+// New creates a Tracker named name, which is used in metric keys. Set its ConnState method as
+// http.Server.ConnState, or use Instrument.
+func New(name string) *Tracker {
+	return NewWithBuckets(name, DefaultBuckets)
+}
+
+// NewWithBuckets creates a Tracker like New with the upper bounds of the age histogram in ascending order.
+func NewWithBuckets(name string, buckets []time.Duration) *Tracker {
+	return &Tracker{
+		name:    name,
+		buckets: buckets,
+		conns:   make(map[net.Conn]*conn),
+	}
+}
+
+// Instrument creates a Tracker named name and hooks it into srv.ConnState, calling the previous hook
+// if there is one, and into srv.RegisterOnShutdown. It must be called after srv.IdleTimeout has been
+// set and before the server starts.
+func Instrument(name string, srv *http.Server) *Tracker {
+	t := New(name)
+	// like net/http, fall back on ReadTimeout if there is no IdleTimeout
+	t.IdleTimeout = srv.IdleTimeout
+	if t.IdleTimeout <= 0 {
+		t.IdleTimeout = srv.ReadTimeout
+	}
+	srv.RegisterOnShutdown(t.Shutdown)
+	prev := srv.ConnState
+	srv.ConnState = func(c net.Conn, s http.ConnState) {
+		t.ConnState(c, s)
+		if prev != nil {
+			prev(c, s)
+		}
+	}
+	return t
+}
+
+// Shutdown records that the server is shutting down, so the connections closed afterwards are
+// counted as closed by the shutdown. Instrument registers it with http.Server.RegisterOnShutdown.
+func (t *Tracker) Shutdown() {
+	t.mu.Lock()
+	t.shuttingDown = true
+	t.mu.Unlock()
+}
+
+// ConnState records that the state of c changed to s. It has the signature of http.Server.ConnState.
+func (t *Tracker) ConnState(c net.Conn, s http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	switch s {
+	case http.StateNew:
+		_, isTLS := c.(*tls.Conn)
+		t.conns[c] = &conn{state: s, created: now, since: now, tls: isTLS}
+		t.accepted++
+	case http.StateActive, http.StateIdle:
+		if cn, ok := t.conns[c]; ok {
+			cn.state = s
+			cn.since = now
+		}
+	case http.StateHijacked:
+		// the server doesn't track hijacked connections any more, so they won't be closed in our view
+		delete(t.conns, c)
+		t.hijacked++
+	case http.StateClosed:
+		if cn, ok := t.conns[c]; ok {
+			t.countClosed(cn, now)
+		}
+		delete(t.conns, c)
+		t.closed++
+	}
+}
+
+// countClosed counts the closed connection c by reason.
+func (t *Tracker) countClosed(c *conn, now time.Time) {
+	switch {
+	case t.shuttingDown:
+		t.closedShutdown++
+	case c.state != http.StateIdle:
+		t.closedOther++
+	case t.IdleTimeout > 0 && now.Sub(c.since) >= t.IdleTimeout:
+		t.closedIdleTimeout++
+	default:
+		t.closedByClient++
+	}
+}
+
+// Stats returns the current stats of the connections.
+func (t *Tracker) Stats() ConnStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	stats := ConnStats{
+		Name:     t.name,
+		Open:     int64(len(t.conns)),
+		Accepted: t.accepted,
+		Closed:   t.closed,
+		Hijacked: t.hijacked,
+
+		ClosedIdleTimeout: t.closedIdleTimeout,
+		ClosedByClient:    t.closedByClient,
+		ClosedShutdown:    t.closedShutdown,
+		ClosedOther:       t.closedOther,
+
+		Buckets: t.buckets,
+		Ages:    make([]int64, len(t.buckets)+1),
+	}
+	for _, c := range t.conns {
+		switch c.state {
+		case http.StateNew:
+			stats.New++
+		case http.StateActive:
+			stats.Active++
+		case http.StateIdle:
+			stats.Idle++
+		}
+		if c.tls {
+			stats.TLS++
+		}
+
+		age := now.Sub(c.created)
+		i := 0
+		for i < len(t.buckets) && age > t.buckets[i] {
+			i++
+		}
+		stats.Ages[i]++
+	}
+	return stats
+}
+
+// ConnStats represents the connections of a server.
+type ConnStats struct {
+	Name string
+
+	// Open is the number of open connections, which are New, Active or Idle.
+	Open   int64
+	New    int64
+	Active int64
+	Idle   int64
+	// TLS is the number of open TLS connections.
+	TLS int64
+
+	// Accepted, Closed and Hijacked are cumulative counters.
+	Accepted int64
+	Closed   int64
+	Hijacked int64
+
+	// The closed connections by reason: ClosedIdleTimeout were closed by the server after being idle for
+	// IdleTimeout, ClosedByClient were closed while idle before the timeout, which is usually done by the
+	// client, ClosedShutdown were closed after the server began to shut down and ClosedOther were closed
+	// while new or active, e.g. because of `Connection: close`, errors or read timeouts.
+	ClosedIdleTimeout int64
+	ClosedByClient    int64
+	ClosedShutdown    int64
+	ClosedOther       int64
+
+	// Buckets are the upper bounds of the age histogram of the open connections and Ages
+	// are the non-cumulative counts of the buckets with the +Inf bucket at the end.
+	Buckets []time.Duration
+	Ages    []int64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as conn.<name>.<metric>.
+// The age histogram is exported cumulatively as conn.<name>.age.le_<bucket>, e.g. le_1m0s and le_inf.
+func (s *ConnStats) Values() map[string]interface{} {
+	prefix := "conn." + s.Name + "."
+	values := make(map[string]interface{}, 12+len(s.Ages))
+	values[prefix+"open"] = s.Open
+	values[prefix+"new"] = s.New
+	values[prefix+"active"] = s.Active
+	values[prefix+"idle"] = s.Idle
+	values[prefix+"tls"] = s.TLS
+	values[prefix+"accepted"] = s.Accepted
+	values[prefix+"closed"] = s.Closed
+	values[prefix+"hijacked"] = s.Hijacked
+	values[prefix+"closed.idle_timeout"] = s.ClosedIdleTimeout
+	values[prefix+"closed.client"] = s.ClosedByClient
+	values[prefix+"closed.shutdown"] = s.ClosedShutdown
+	values[prefix+"closed.other"] = s.ClosedOther
+
+	var count int64
+	for i, n := range s.Ages {
+		count += n
+		if i < len(s.Buckets) {
+			values[prefix+"age.le_"+s.Buckets[i].String()] = count
+		} else {
+			values[prefix+"age.le_inf"] = count
+		}
+	}
+	return values
+}
@@ -0,0 +1,88 @@
+package connstate
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	tr := New("api")
+	c1, c2, c3 := &net.TCPConn{}, &net.UnixConn{}, &net.IPConn{}
+
+	tr.ConnState(c1, http.StateNew)
+	tr.ConnState(c2, http.StateNew)
+	tr.ConnState(c3, http.StateNew)
+	tr.ConnState(c1, http.StateActive)
+	tr.ConnState(c2, http.StateActive)
+	tr.ConnState(c2, http.StateIdle)
+	tr.ConnState(c3, http.StateActive)
+	tr.ConnState(c3, http.StateHijacked)
+
+	stats := tr.Stats()
+	assert.Equal(t, int64(2), stats.Open)
+	assert.Equal(t, int64(1), stats.Active)
+	assert.Equal(t, int64(1), stats.Idle)
+	assert.Equal(t, int64(3), stats.Accepted)
+	assert.Equal(t, int64(1), stats.Hijacked)
+
+	tr.ConnState(c1, http.StateClosed)
+	stats = tr.Stats()
+	assert.Equal(t, int64(1), stats.Open)
+	assert.Equal(t, int64(1), stats.Closed)
+
+	values := stats.Values()
+	assert.Equal(t, int64(1), values["conn.api.age.le_1s"])
+	assert.Equal(t, int64(1), values["conn.api.age.le_inf"])
+}
+
+func TestInstrument(t *testing.T) {
+	var prevCalled int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(net.Conn, http.ConnState) { atomic.StoreInt32(&prevCalled, 1) }
+	tr := Instrument("test", srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Eventually(t, func() bool { return tr.Stats().Idle == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), tr.Stats().Accepted)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&prevCalled))
+}
+
+func TestCloseReasons(t *testing.T) {
+	tr := New("api")
+	tr.IdleTimeout = 20 * time.Millisecond
+	c1, c2, c3, c4 := &net.TCPConn{}, &net.UnixConn{}, &net.IPConn{}, &net.UDPConn{}
+
+	for _, c := range []net.Conn{c1, c2, c3, c4} {
+		tr.ConnState(c, http.StateNew)
+		tr.ConnState(c, http.StateActive)
+	}
+	tr.ConnState(c1, http.StateIdle)
+	tr.ConnState(c2, http.StateIdle)
+	tr.ConnState(c1, http.StateClosed)
+	tr.ConnState(c3, http.StateClosed)
+
+	time.Sleep(tr.IdleTimeout)
+	tr.ConnState(c2, http.StateClosed)
+
+	tr.Shutdown()
+	tr.ConnState(c4, http.StateClosed)
+
+	stats := tr.Stats()
+	assert.Equal(t, int64(1), stats.ClosedByClient)
+	assert.Equal(t, int64(1), stats.ClosedOther)
+	assert.Equal(t, int64(1), stats.ClosedIdleTimeout)
+	assert.Equal(t, int64(1), stats.ClosedShutdown)
+	assert.Equal(t, int64(4), stats.Closed)
+	assert.Equal(t, int64(1), stats.Values()["conn.api.closed.shutdown"])
+}
@@ -0,0 +1,167 @@
+// Package container provides method to collect the resource constraints of containers from cgroups.
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoCgroup is returned if the cgroup files can't be found.
+var ErrNoCgroup = errors.New("container: cgroup not found")
+
+// Cgroup reads cgroup v1 and v2 files mounted at Root.
+// Nested cgroup paths are not resolved, so it expects the cgroup namespace
+// of the container, which is the default of docker and kubernetes.
+type Cgroup struct {
+	// Root is the mount point of the cgroup filesystem.
+	Root string
+}
+
+// DefaultCgroup reads cgroups mounted at /sys/fs/cgroup.
+var DefaultCgroup = &Cgroup{Root: "/sys/fs/cgroup"}
+
+// IsV2 reports whether the unified cgroup v2 hierarchy is mounted at Root.
+func (c *Cgroup) IsV2() bool {
+	_, err := os.Stat(filepath.Join(c.Root, "cgroup.controllers"))
+	return err == nil
+}
+
+// CPUQuota returns the CPU quota as number of CPUs, e.g. 1.5 for 150ms per 100ms period.
+// It returns -1 if the CPU is not limited.
+func (c *Cgroup) CPUQuota() (float64, error) {
+	quota, period, err := c.cpuMax()
+	if err != nil {
+		return 0, err
+	}
+	if quota < 0 {
+		return -1, nil
+	}
+	return float64(quota) / float64(period), nil
+}
+
+// cpuMax returns the CPU quota and period in microseconds. The quota is -1 if the CPU is not limited.
+func (c *Cgroup) cpuMax() (quota, period int64, err error) {
+	if c.IsV2() {
+		// cpu.max contains "$MAX $PERIOD", $MAX is "max" if it is not limited
+		fields, err := c.readFields("cpu.max")
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(fields) != 2 {
+			return 0, 0, errors.New("container: invalid cpu.max")
+		}
+		if period, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return 0, 0, err
+		}
+		if fields[0] == "max" {
+			return -1, period, nil
+		}
+		if quota, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+			return 0, 0, err
+		}
+	} else {
+		dir := c.v1Dir("cpu", "cpu,cpuacct")
+		if quota, err = c.readInt(filepath.Join(dir, "cpu.cfs_quota_us")); err != nil {
+			return 0, 0, err
+		}
+		period, err = c.readInt(filepath.Join(dir, "cpu.cfs_period_us"))
+		if quota < 0 {
+			return -1, period, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if period <= 0 {
+		return 0, 0, errors.New("container: invalid cpu period")
+	}
+	return quota, period, nil
+}
+
+// cpuacctControllers are the directories of the cgroup v1 cpuacct controller.
+var cpuacctControllers = []string{"cpuacct", "cpu,cpuacct", "cpuacct,cpu"}
+
+// Groups returns the top-level cgroups accounting the CPU, e.g. system.slice, user.slice and kubepods.slice.
+func (c *Cgroup) Groups() ([]string, error) {
+	dir := c.Root
+	if !c.IsV2() {
+		dir = filepath.Join(c.Root, c.v1Dir(cpuacctControllers...))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoCgroup
+		}
+		return nil, err
+	}
+
+	var groups []string
+	for _, e := range entries {
+		if e.IsDir() {
+			groups = append(groups, e.Name())
+		}
+	}
+	return groups, nil
+}
+
+// CPUUsage returns the cumulative CPU time used by the tasks of the cgroup group, a path relative to
+// the root of the hierarchy such as system.slice, including its descendants.
+func (c *Cgroup) CPUUsage(group string) (time.Duration, error) {
+	if !c.IsV2() {
+		ns, err := c.readInt(filepath.Join(c.v1Dir(cpuacctControllers...), group, "cpuacct.usage"))
+		return time.Duration(ns), err
+	}
+
+	// cpu.stat contains "usage_usec $USAGE" among other lines
+	fields, err := c.readFields(filepath.Join(group, "cpu.stat"))
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == "usage_usec" {
+			us, err := strconv.ParseInt(fields[i+1], 10, 64)
+			return time.Duration(us) * time.Microsecond, err
+		}
+	}
+	return 0, errors.New("container: usage_usec not found in cpu.stat")
+}
+
+// v1Dir returns the first existing directory of the cgroup v1 controllers.
+func (c *Cgroup) v1Dir(controllers ...string) string {
+	for _, ctrl := range controllers {
+		if _, err := os.Stat(filepath.Join(c.Root, ctrl)); err == nil {
+			return ctrl
+		}
+	}
+	return controllers[0]
+}
+
+func (c *Cgroup) readFields(name string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(c.Root, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoCgroup
+		}
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+func (c *Cgroup) readInt(name string) (int64, error) {
+	fields, err := c.readFields(name)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) == 0 {
+		return 0, errors.New("container: empty " + name)
+	}
+	if fields[0] == "max" {
+		return -1, nil
+	}
+	return strconv.ParseInt(fields[0], 10, 64)
+}
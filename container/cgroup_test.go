@@ -0,0 +1,97 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fixture creates a cgroup filesystem in a temporary directory.
+func fixture(t *testing.T, files map[string]string) *Cgroup {
+	root := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0o755))
+		assert.Nil(t, os.WriteFile(file, []byte(content), 0o644))
+	}
+	return &Cgroup{Root: root}
+}
+
+func TestCPUQuotaV2(t *testing.T) {
+	c := fixture(t, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "150000 100000\n",
+	})
+	assert.True(t, c.IsV2())
+	quota, err := c.CPUQuota()
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, quota)
+
+	c = fixture(t, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "max 100000\n",
+	})
+	quota, err = c.CPUQuota()
+	assert.Nil(t, err)
+	assert.Equal(t, -1.0, quota)
+}
+
+func TestCPUQuotaV1(t *testing.T) {
+	c := fixture(t, map[string]string{
+		"cpu,cpuacct/cpu.cfs_quota_us":  "200000\n",
+		"cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+	})
+	assert.False(t, c.IsV2())
+	quota, err := c.CPUQuota()
+	assert.Nil(t, err)
+	assert.Equal(t, 2.0, quota)
+
+	c = fixture(t, map[string]string{
+		"cpu/cpu.cfs_quota_us":  "-1\n",
+		"cpu/cpu.cfs_period_us": "100000\n",
+	})
+	quota, err = c.CPUQuota()
+	assert.Nil(t, err)
+	assert.Equal(t, -1.0, quota)
+}
+
+func TestNoCgroup(t *testing.T) {
+	c := &Cgroup{Root: t.TempDir()}
+	_, err := c.CPUQuota()
+	assert.Equal(t, ErrNoCgroup, err)
+}
+
+func TestCPUUsageV2(t *testing.T) {
+	c := fixture(t, map[string]string{
+		"cgroup.controllers":          "cpu memory",
+		"system.slice/cpu.stat":       "usage_usec 1500000\nuser_usec 1000000\nsystem_usec 500000\n",
+		"kubepods.slice/cpu.stat":     "usage_usec 20\n",
+		"kubepods.slice/cgroup.procs": "",
+	})
+	groups, err := c.Groups()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"kubepods.slice", "system.slice"}, groups)
+
+	usage, err := c.CPUUsage("system.slice")
+	assert.Nil(t, err)
+	assert.Equal(t, 1500*time.Millisecond, usage)
+}
+
+func TestCPUUsageV1(t *testing.T) {
+	c := fixture(t, map[string]string{
+		"cpu,cpuacct/docker/cpuacct.usage": "2500000000\n",
+	})
+	groups, err := c.Groups()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"docker"}, groups)
+
+	usage, err := c.CPUUsage("docker")
+	assert.Nil(t, err)
+	assert.Equal(t, 2500*time.Millisecond, usage)
+
+	_, err = c.CPUUsage("missing")
+	assert.Equal(t, ErrNoCgroup, err)
+}
@@ -0,0 +1,215 @@
+package container
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// unlimitedMemory is the smallest memory limit of cgroup v1 treated as unlimited, which is
+// the largest page counter rounded down to the page size, e.g. 9223372036854771712.
+const unlimitedMemory = 1 << 62
+
+// Throttling is the cumulative CPU throttling of a cgroup by its CPU quota.
+type Throttling struct {
+	// Periods is the number of enforcement periods elapsed while the cgroup had runnable tasks.
+	Periods int64
+	// ThrottledPeriods is the number of periods the cgroup exhausted its quota in.
+	ThrottledPeriods int64
+	// ThrottledTime is the total time the tasks of the cgroup have been throttled.
+	ThrottledTime time.Duration
+}
+
+// CPUThrottling returns the CPU throttling of the cgroup.
+func (c *Cgroup) CPUThrottling() (Throttling, error) {
+	var t Throttling
+	name := "cpu.stat"
+	if !c.IsV2() {
+		name = filepath.Join(c.v1Dir("cpu", "cpu,cpuacct"), "cpu.stat")
+	}
+	stat, err := c.readKeyed(name)
+	if err != nil {
+		return t, err
+	}
+
+	t.Periods = stat["nr_periods"]
+	t.ThrottledPeriods = stat["nr_throttled"]
+	if us, ok := stat["throttled_usec"]; ok {
+		t.ThrottledTime = time.Duration(us) * time.Microsecond
+	} else {
+		// cgroup v1 reports throttled_time in nanoseconds
+		t.ThrottledTime = time.Duration(stat["throttled_time"])
+	}
+	return t, nil
+}
+
+// MemoryLimit returns the memory limit of the cgroup in bytes. It returns -1 if the memory is not limited.
+func (c *Cgroup) MemoryLimit() (int64, error) {
+	if c.IsV2() {
+		return c.readInt("memory.max")
+	}
+	limit, err := c.readInt(filepath.Join("memory", "memory.limit_in_bytes"))
+	if err == nil && limit >= unlimitedMemory {
+		return -1, nil
+	}
+	return limit, err
+}
+
+// MemoryUsage returns the memory used by the cgroup in bytes, including the page cache.
+func (c *Cgroup) MemoryUsage() (int64, error) {
+	if c.IsV2() {
+		return c.readInt("memory.current")
+	}
+	return c.readInt(filepath.Join("memory", "memory.usage_in_bytes"))
+}
+
+// OOMKills returns the number of processes of the cgroup killed by the OOM killer.
+// cgroup v1 reports it since linux 4.13.
+func (c *Cgroup) OOMKills() (int64, error) {
+	name := "memory.events"
+	if !c.IsV2() {
+		name = filepath.Join("memory", "memory.oom_control")
+	}
+	events, err := c.readKeyed(name)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := events["oom_kill"]
+	if !ok {
+		return 0, errors.New("container: oom_kill not found in " + name)
+	}
+	return n, nil
+}
+
+// readKeyed reads a flat keyed file made of "$KEY $VALUE" lines, such as cpu.stat.
+func (c *Cgroup) readKeyed(name string) (map[string]int64, error) {
+	fields, err := c.readFields(name)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]int64, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		if v, err := strconv.ParseInt(fields[i+1], 10, 64); err == nil {
+			values[fields[i]] = v
+		}
+	}
+	return values, nil
+}
+
+// LimitsStatsHandler represents a handler to handle stats after successfully gathering statistics
+type LimitsStatsHandler func(LimitsStats)
+
+// Limits implements the periodic collection of the CPU and memory limits and usage of the container
+// to a LimitsStatsHandler, which apps should report instead of the totals of the host.
+type Limits struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Cgroup is used to read the limits and usage. Defaults to DefaultCgroup.
+	Cgroup *Cgroup
+
+	// Done, when closed, is used to signal Limits that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	statsHandler LimitsStatsHandler
+}
+
+// NewLimits creates a new Limits that will periodically output the limits and usage of the container to statsHandler.
+func NewLimits(statsHandler LimitsStatsHandler) *Limits {
+	if statsHandler == nil {
+		statsHandler = func(LimitsStats) {}
+	}
+
+	return &Limits{
+		CollectInterval: 10 * time.Second,
+		Cgroup:          DefaultCgroup,
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured LimitsStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (l *Limits) Run() {
+	l.statsHandler(l.Once())
+
+	tick := time.NewTicker(l.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-l.Done:
+			return
+		case <-tick.C:
+			l.statsHandler(l.Once())
+		}
+	}
+}
+
+// Once returns the limits and usage of the container. The stats which can't be read, e.g. outside
+// of a container, are -1 for the limits and 0 otherwise. It is safe for use from multiple go routines.
+func (l *Limits) Once() LimitsStats {
+	c := l.Cgroup
+	stats := LimitsStats{CPUQuota: -1, MemoryLimit: -1}
+
+	if quota, period, err := c.cpuMax(); err == nil {
+		stats.CPUPeriod = time.Duration(period) * time.Microsecond
+		if quota >= 0 {
+			stats.CPUQuota = float64(quota) / float64(period)
+		}
+	}
+	stats.CPUUsage, _ = c.CPUUsage("")
+	stats.Throttling, _ = c.CPUThrottling()
+
+	if limit, err := c.MemoryLimit(); err == nil {
+		stats.MemoryLimit = limit
+	}
+	stats.MemoryUsage, _ = c.MemoryUsage()
+	stats.OOMKills, _ = c.OOMKills()
+	return stats
+}
+
+// LimitsStats represents the CPU and memory limits and usage of a container. The counters are cumulative.
+type LimitsStats struct {
+	// CPUQuota is the CPU quota as number of CPUs, or -1 if the CPU is not limited.
+	CPUQuota float64
+	// CPUPeriod is the period the CPU quota is enforced over.
+	CPUPeriod time.Duration
+	// CPUUsage is the CPU time used by the container.
+	CPUUsage time.Duration
+	Throttling
+
+	// MemoryLimit is the memory limit in bytes, or -1 if the memory is not limited.
+	MemoryLimit int64
+	// MemoryUsage is the memory used in bytes, including the page cache.
+	MemoryUsage int64
+	// OOMKills is the number of processes killed by the OOM killer.
+	OOMKills int64
+}
+
+// MemoryPercent returns the memory usage as a percentage of the limit, or 0 if the memory is not limited.
+func (s *LimitsStats) MemoryPercent() float64 {
+	if s.MemoryLimit <= 0 {
+		return 0
+	}
+	return float64(s.MemoryUsage) / float64(s.MemoryLimit) * 100
+}
+
+// Values returns metrics which you can write into TSDB, keyed as container.cpu.<metric> and container.mem.<metric>.
+func (s *LimitsStats) Values() map[string]interface{} {
+	return map[string]interface{}{
+		"container.cpu.quota":             s.CPUQuota,
+		"container.cpu.period":            int64(s.CPUPeriod),
+		"container.cpu.usage":             int64(s.CPUUsage),
+		"container.cpu.periods":           s.Periods,
+		"container.cpu.throttled_periods": s.ThrottledPeriods,
+		"container.cpu.throttled_time":    int64(s.ThrottledTime),
+
+		"container.mem.limit":        s.MemoryLimit,
+		"container.mem.usage":        s.MemoryUsage,
+		"container.mem.used_percent": s.MemoryPercent(),
+		"container.mem.oom_kills":    s.OOMKills,
+	}
+}
@@ -0,0 +1,66 @@
+package container
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitsV2(t *testing.T) {
+	c := fixture(t, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "50000 100000\n",
+		"cpu.stat":           "usage_usec 3000000\nuser_usec 2000000\nsystem_usec 1000000\nnr_periods 40\nnr_throttled 10\nthrottled_usec 250000\n",
+		"memory.max":         "536870912\n",
+		"memory.current":     "134217728\n",
+		"memory.events":      "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+	})
+	l := NewLimits(nil)
+	l.Cgroup = c
+	stats := l.Once()
+
+	assert.Equal(t, 0.5, stats.CPUQuota)
+	assert.Equal(t, 100*time.Millisecond, stats.CPUPeriod)
+	assert.Equal(t, 3*time.Second, stats.CPUUsage)
+	assert.Equal(t, Throttling{Periods: 40, ThrottledPeriods: 10, ThrottledTime: 250 * time.Millisecond}, stats.Throttling)
+	assert.Equal(t, int64(512<<20), stats.MemoryLimit)
+	assert.Equal(t, int64(128<<20), stats.MemoryUsage)
+	assert.Equal(t, int64(1), stats.OOMKills)
+
+	values := stats.Values()
+	assert.Equal(t, 25.0, values["container.mem.used_percent"])
+	assert.Equal(t, int64(10), values["container.cpu.throttled_periods"])
+}
+
+func TestLimitsV1(t *testing.T) {
+	c := fixture(t, map[string]string{
+		"cpu,cpuacct/cpu.cfs_quota_us":  "-1\n",
+		"cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+		"cpu,cpuacct/cpuacct.usage":     "2000000000\n",
+		"cpu,cpuacct/cpu.stat":          "nr_periods 5\nnr_throttled 2\nthrottled_time 30000000\n",
+		"memory/memory.limit_in_bytes":  "9223372036854771712\n",
+		"memory/memory.usage_in_bytes":  "1048576\n",
+		"memory/memory.oom_control":     "oom_kill_disable 0\nunder_oom 0\noom_kill 2\n",
+	})
+	l := NewLimits(nil)
+	l.Cgroup = c
+	stats := l.Once()
+
+	assert.Equal(t, -1.0, stats.CPUQuota)
+	assert.Equal(t, 2*time.Second, stats.CPUUsage)
+	assert.Equal(t, 30*time.Millisecond, stats.ThrottledTime)
+	assert.Equal(t, int64(-1), stats.MemoryLimit)
+	assert.Equal(t, int64(1<<20), stats.MemoryUsage)
+	assert.Equal(t, int64(2), stats.OOMKills)
+	assert.Equal(t, 0.0, stats.MemoryPercent())
+}
+
+func TestLimitsNoCgroup(t *testing.T) {
+	l := NewLimits(nil)
+	l.Cgroup = &Cgroup{Root: t.TempDir()}
+	stats := l.Once()
+	assert.Equal(t, -1.0, stats.CPUQuota)
+	assert.Equal(t, int64(-1), stats.MemoryLimit)
+	assert.Zero(t, stats.MemoryUsage)
+}
@@ -0,0 +1,160 @@
+package container
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runtimeMaxProcs reports whether the runtime itself sets GOMAXPROCS to the CPU quota, as Go 1.25 and
+// later do unless containermaxprocs=0 is set by GODEBUG or by the go version of the main module.
+var runtimeMaxProcs = containerMaxProcs()
+
+func containerMaxProcs() bool {
+	sample := []metrics.Sample{{Name: "/godebug/non-default-behavior/containermaxprocs:events"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() == metrics.KindBad {
+		return false
+	}
+
+	enabled := true
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "DefaultGODEBUG" {
+				enabled = godebugMaxProcs(s.Value, enabled)
+			}
+		}
+	}
+	return godebugMaxProcs(os.Getenv("GODEBUG"), enabled)
+}
+
+// godebugMaxProcs returns the containermaxprocs setting of godebug, or enabled if it isn't set.
+// The last setting wins, as in the runtime.
+func godebugMaxProcs(godebug string, enabled bool) bool {
+	for _, kv := range strings.Split(godebug, ",") {
+		switch strings.TrimSpace(kv) {
+		case "containermaxprocs=0":
+			enabled = false
+		case "containermaxprocs=1":
+			enabled = true
+		}
+	}
+	return enabled
+}
+
+// MaxProcsStatsHandler represents a handler to handle stats after successfully gathering statistics
+type MaxProcsStatsHandler func(MaxProcsStats)
+
+// MaxProcs sets GOMAXPROCS to match the CPU quota of the container at startup and whenever the quota changes,
+// at most the number of CPUs, and restores the initial GOMAXPROCS when the quota is removed. It does nothing if
+// the GOMAXPROCS environment variable is set or the runtime already follows the CPU quota, as Go 1.25 does.
+type MaxProcs struct {
+	// CollectInterval represents the interval in-between each check of the CPU quota.
+	// Defaults to 1 minute.
+	CollectInterval time.Duration
+
+	// MinProcs is the lower bound of GOMAXPROCS. Defaults to 1.
+	MinProcs int
+
+	// Cgroup is used to read the CPU quota. Defaults to DefaultCgroup.
+	Cgroup *Cgroup
+
+	// Done, when closed, is used to signal MaxProcs that is should stop checking
+	// and the Run function should return.
+	Done <-chan struct{}
+
+	mu           sync.Mutex
+	initial      int // GOMAXPROCS before the first adjustment
+	statsHandler MaxProcsStatsHandler
+}
+
+// NewMaxProcs creates a new MaxProcs that will periodically output the quota and the applied GOMAXPROCS to statsHandler.
+func NewMaxProcs(statsHandler MaxProcsStatsHandler) *MaxProcs {
+	if statsHandler == nil {
+		statsHandler = func(MaxProcsStats) {}
+	}
+
+	return &MaxProcs{
+		CollectInterval: time.Minute,
+		MinProcs:        1,
+		Cgroup:          DefaultCgroup,
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run adjusts GOMAXPROCS then outputs the stats to the configured MaxProcsStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (m *MaxProcs) Run() {
+	m.statsHandler(m.Once())
+
+	tick := time.NewTicker(m.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-m.Done:
+			return
+		case <-tick.C:
+			m.statsHandler(m.Once())
+		}
+	}
+}
+
+// Once adjusts GOMAXPROCS to the current CPU quota and returns the stats.
+// It is safe for use from multiple go routines。
+func (m *MaxProcs) Once() MaxProcsStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := MaxProcsStats{Quota: -1}
+	quota, err := m.Cgroup.CPUQuota()
+	if err == nil {
+		stats.Quota = quota
+	}
+
+	if m.initial == 0 {
+		m.initial = runtime.GOMAXPROCS(0)
+	}
+
+	if _, ok := os.LookupEnv("GOMAXPROCS"); !ok && !runtimeMaxProcs {
+		procs := m.initial
+		if stats.Quota > 0 {
+			procs = int(math.Floor(stats.Quota))
+			if procs < m.MinProcs {
+				procs = m.MinProcs
+			}
+			if n := runtime.NumCPU(); procs > n {
+				procs = n
+			}
+			if procs < 1 {
+				procs = 1
+			}
+		}
+		if procs != runtime.GOMAXPROCS(0) {
+			runtime.GOMAXPROCS(procs)
+		}
+	}
+
+	stats.MaxProcs = runtime.GOMAXPROCS(0)
+	return stats
+}
+
+// MaxProcsStats represents the CPU quota and the applied GOMAXPROCS.
+type MaxProcsStats struct {
+	// Quota is the CPU quota as number of CPUs, or -1 if the CPU is not limited.
+	Quota    float64
+	MaxProcs int
+}
+
+// Values returns metrics which you can write into TSDB.
+func (s *MaxProcsStats) Values() map[string]interface{} {
+	return map[string]interface{}{
+		"container.cpu.quota": s.Quota,
+		"cpu.gomaxprocs":      int64(s.MaxProcs),
+	}
+}
@@ -0,0 +1,93 @@
+package container
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxProcs(t *testing.T) {
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		t.Skip("Skipping test because GOMAXPROCS is set")
+	}
+	if runtime.NumCPU() < 2 {
+		t.Skip("Skipping test because there are less than 2 CPUs")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	defer func(aware bool) { runtimeMaxProcs = aware }(runtimeMaxProcs)
+	runtimeMaxProcs = false
+
+	m := NewMaxProcs(nil)
+	m.Cgroup = fixture(t, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "250000 100000\n",
+	})
+
+	stats := m.Once()
+	assert.Equal(t, 2.5, stats.Quota)
+	assert.Equal(t, 2, stats.MaxProcs)
+	assert.Equal(t, 2, runtime.GOMAXPROCS(0))
+
+	m.Cgroup = fixture(t, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "50000 100000\n",
+	})
+	stats = m.Once()
+	assert.Equal(t, 1, stats.MaxProcs)
+	assert.Equal(t, int64(1), stats.Values()["cpu.gomaxprocs"])
+}
+
+func TestMaxProcsRestore(t *testing.T) {
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		t.Skip("Skipping test because GOMAXPROCS is set")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	defer func(aware bool) { runtimeMaxProcs = aware }(runtimeMaxProcs)
+	runtimeMaxProcs = false
+
+	initial := runtime.GOMAXPROCS(0)
+	m := NewMaxProcs(nil)
+	m.Cgroup = fixture(t, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "1000000000 100000\n",
+	})
+	stats := m.Once()
+	assert.Equal(t, runtime.NumCPU(), stats.MaxProcs, "clamped to the number of CPUs")
+
+	m.Cgroup = fixture(t, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "50000 100000\n",
+	})
+	assert.Equal(t, 1, m.Once().MaxProcs)
+
+	m.Cgroup = fixture(t, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "max 100000\n",
+	})
+	stats = m.Once()
+	assert.Equal(t, -1.0, stats.Quota)
+	assert.Equal(t, initial, stats.MaxProcs, "restored when the quota is removed")
+}
+
+func TestMaxProcsRuntimeAware(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	defer func(aware bool) { runtimeMaxProcs = aware }(runtimeMaxProcs)
+	runtimeMaxProcs = true
+
+	procs := runtime.GOMAXPROCS(0)
+	m := NewMaxProcs(nil)
+	m.Cgroup = fixture(t, map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"cpu.max":            "50000 100000\n",
+	})
+	assert.Equal(t, procs, m.Once().MaxProcs)
+}
+
+func TestGodebugMaxProcs(t *testing.T) {
+	assert.True(t, godebugMaxProcs("", true))
+	assert.False(t, godebugMaxProcs("", false))
+	assert.False(t, godebugMaxProcs("asyncpreemptoff=1,containermaxprocs=0", true))
+	assert.True(t, godebugMaxProcs("containermaxprocs=0,containermaxprocs=1", false))
+}
@@ -0,0 +1,224 @@
+// Package cpuacct provides method to break down the CPU time of a machine by user and by top-level
+// cgroup, e.g. system.slice or kubepods.slice, for multi-tenant hosts where who is using the CPU
+// matters more than the total.
+package cpuacct
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/smallnest/go-app-metrics/container"
+	"github.com/smallnest/go-app-metrics/sanitize"
+)
+
+// CPUAcctStatsHandler represents a handler to handle stats after successfully gathering statistics
+type CPUAcctStatsHandler func(CPUAcctStats)
+
+// Collector implements the periodic accounting of the CPU time of users and cgroups to a CPUAcctStatsHandler.
+type Collector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// EnableUsers determines whether the CPU time is broken down by the users owning the processes.
+	// It walks all processes every collection. Defaults to true.
+	EnableUsers bool
+
+	// EnableCgroups determines whether the CPU time is broken down by top-level cgroup. Defaults to true.
+	EnableCgroups bool
+
+	// Cgroup is used to read the CPU usage of the cgroups. Defaults to container.DefaultCgroup.
+	Cgroup *container.Cgroup
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	collected    bool
+	lastCollect  time.Time
+	procs        map[int32]procSample
+	cgroups      map[string]time.Duration
+	users        map[string]string // uid -> user name
+	statsHandler CPUAcctStatsHandler
+}
+
+// procSample is the previous sample of a process.
+type procSample struct {
+	user string
+	cpu  float64 // user + system seconds
+}
+
+// New creates a new Collector that will periodically output the CPU time of users and cgroups to statsHandler.
+func New(statsHandler CPUAcctStatsHandler) *Collector {
+	if statsHandler == nil {
+		statsHandler = func(CPUAcctStats) {}
+	}
+
+	return &Collector{
+		CollectInterval: 10 * time.Second,
+		EnableUsers:     true,
+		EnableCgroups:   true,
+		Cgroup:          container.DefaultCgroup,
+		procs:           make(map[int32]procSample),
+		cgroups:         make(map[string]time.Duration),
+		users:           make(map[string]string),
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured CPUAcctStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *Collector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the CPU time of users and cgroups since the previous collection.
+// The first collection only records the samples, so its stats are empty.
+func (c *Collector) Once() CPUAcctStats {
+	return c.collectStats()
+}
+
+func (c *Collector) collectStats() CPUAcctStats {
+	now := time.Now()
+	stats := CPUAcctStats{
+		Users:   make(map[string]float64),
+		Cgroups: make(map[string]float64),
+	}
+	if c.collected {
+		stats.Elapsed = now.Sub(c.lastCollect)
+	}
+
+	if c.EnableUsers {
+		c.collectUsers(&stats)
+	}
+	if c.EnableCgroups && c.Cgroup != nil {
+		c.collectCgroups(&stats)
+	}
+
+	c.collected = true
+	c.lastCollect = now
+	return stats
+}
+
+func (c *Collector) collectUsers(stats *CPUAcctStats) {
+	procs, err := process.Processes()
+	if err != nil {
+		return
+	}
+
+	cur := make(map[int32]procSample, len(procs))
+	for _, p := range procs {
+		times, err := p.Times()
+		if err != nil {
+			continue
+		}
+		s := procSample{cpu: times.User + times.System}
+
+		prev, ok := c.procs[p.Pid]
+		if ok {
+			s.user = prev.user
+		} else if s.user = c.username(p); s.user == "" {
+			continue
+		}
+		cur[p.Pid] = s
+
+		switch {
+		case ok && s.cpu >= prev.cpu:
+			stats.Users[s.user] += s.cpu - prev.cpu
+		case c.collected:
+			// the process started since the previous collection, or its pid has been reused
+			stats.Users[s.user] += s.cpu
+		}
+	}
+	c.procs = cur
+}
+
+// username returns the name of the user owning p, or its uid if the user has no name.
+func (c *Collector) username(p *process.Process) string {
+	uids, err := p.Uids()
+	if err != nil || len(uids) == 0 {
+		return ""
+	}
+	uid := strconv.Itoa(int(uids[0]))
+	if name, ok := c.users[uid]; ok {
+		return name
+	}
+
+	name, err := p.Username()
+	if err != nil || name == "" {
+		name = uid
+	}
+	c.users[uid] = name
+	return name
+}
+
+func (c *Collector) collectCgroups(stats *CPUAcctStats) {
+	groups, err := c.Cgroup.Groups()
+	if err != nil {
+		return
+	}
+
+	cur := make(map[string]time.Duration, len(groups))
+	for _, g := range groups {
+		usage, err := c.Cgroup.CPUUsage(g)
+		if err != nil {
+			continue
+		}
+		cur[g] = usage
+
+		if prev, ok := c.cgroups[g]; ok && usage >= prev {
+			stats.Cgroups[g] = (usage - prev).Seconds()
+		} else if c.collected {
+			stats.Cgroups[g] = usage.Seconds()
+		}
+	}
+	c.cgroups = cur
+}
+
+// CPUAcctStats represents the CPU time of users and cgroups since the previous collection.
+type CPUAcctStats struct {
+	// Users are the CPU seconds used by the processes of every user, keyed by user name.
+	Users map[string]float64
+	// Cgroups are the CPU seconds used by every top-level cgroup, keyed by its name, e.g. system.slice.
+	Cgroups map[string]float64
+	// Elapsed is the time since the previous collection, it is zero for the first collection.
+	Elapsed time.Duration
+}
+
+// Values returns metrics which you can write into TSDB, keyed as cpuacct.user.<name>.<metric> and
+// cpuacct.cgroup.<name>.<metric>. Users and cgroups are embedded in keys as is, see SanitizedValues.
+func (s *CPUAcctStats) Values() map[string]interface{} {
+	return s.SanitizedValues(sanitize.Raw)
+}
+
+// SanitizedValues returns metrics like Values, but users and cgroups embedded in keys are sanitized by sf,
+// e.g. sanitize.Graphite turns "cpuacct.cgroup.system.slice.seconds" into "cpuacct.cgroup.system_slice.seconds".
+// The metrics are seconds, the CPU time, and percent, the CPU time per elapsed time where 100 is one core.
+func (s *CPUAcctStats) SanitizedValues(sf sanitize.Func) map[string]interface{} {
+	values := make(map[string]interface{}, (len(s.Users)+len(s.Cgroups))*2)
+	add := func(prefix string, seconds map[string]float64) {
+		for name, v := range seconds {
+			key := prefix + sf(name) + "."
+			values[key+"seconds"] = v
+			if s.Elapsed > 0 {
+				values[key+"percent"] = v / s.Elapsed.Seconds() * 100
+			}
+		}
+	}
+	add("cpuacct.user.", s.Users)
+	add("cpuacct.cgroup.", s.Cgroups)
+	return values
+}
@@ -0,0 +1,61 @@
+package cpuacct
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/container"
+	"github.com/smallnest/go-app-metrics/sanitize"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test because testing.Short is enabled")
+	}
+
+	c := New(nil)
+	c.EnableCgroups = false
+	stats := c.Once()
+	assert.Empty(t, stats.Users)
+
+	// burn some CPU
+	for end := time.Now().Add(50 * time.Millisecond); time.Now().Before(end); {
+	}
+	stats = c.Once()
+
+	u, err := user.Current()
+	assert.Nil(t, err)
+	assert.True(t, stats.Users[u.Username] > 0, stats.Users)
+	assert.True(t, stats.Elapsed > 0)
+	assert.Contains(t, stats.Values(), "cpuacct.user."+u.Username+".percent")
+}
+
+func TestCgroups(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		file := filepath.Join(root, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0o755))
+		assert.Nil(t, os.WriteFile(file, []byte(content), 0o644))
+	}
+	write("cgroup.controllers", "cpu memory")
+	write("system.slice/cpu.stat", "usage_usec 1000000\n")
+
+	c := New(nil)
+	c.EnableUsers = false
+	c.Cgroup = &container.Cgroup{Root: root}
+	c.Once()
+
+	write("system.slice/cpu.stat", "usage_usec 3500000\n")
+	write("kubepods.slice/cpu.stat", "usage_usec 500000\n")
+	stats := c.Once()
+	assert.Equal(t, map[string]float64{"system.slice": 2.5, "kubepods.slice": 0.5}, stats.Cgroups)
+
+	stats.Elapsed = 5 * time.Second
+	values := stats.SanitizedValues(sanitize.Graphite)
+	assert.Equal(t, 2.5, values["cpuacct.cgroup.system_slice.seconds"])
+	assert.Equal(t, 50.0, values["cpuacct.cgroup.system_slice.percent"])
+}
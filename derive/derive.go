@@ -0,0 +1,74 @@
+// Package derive provides user-defined derived metrics computed from expressions over metric keys,
+// such as
+//
+//	mem.used_percent = mem.used / mem.total * 100
+//	mem.gc.rate = rate(mem.gc.count)
+//
+// Expressions support numbers, metric keys, + - * /, parentheses and the functions rate(key) and
+// delta(key) of cumulative counters. Keys containing special characters must be quoted, e.g. "disk./.free".
+// The keys of rate and delta must be cumulative, e.g. mem.gc.count of rmetric: most stats of system, such as
+// net.eth0.bytes_sent, are already the delta since the previous collection and can be divided by elapsed.
+package derive
+
+import (
+	"sync"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/value"
+)
+
+// Deriver evaluates derived metrics. It is safe for use from multiple go routines.
+type Deriver struct {
+	mu    sync.Mutex
+	names []string
+	exprs map[string]node
+	prev  map[string]sample // the latest value of every key, so values of several collectors can be applied in turn
+}
+
+// New creates a Deriver without derived metrics.
+func New() *Deriver {
+	return &Deriver{exprs: make(map[string]node), prev: make(map[string]sample)}
+}
+
+// Add adds a derived metric named name. It returns an error if expr is invalid.
+func (d *Deriver) Add(name, expr string) error {
+	n, err := parse(expr)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.exprs[name]; !ok {
+		d.names = append(d.names, name)
+	}
+	d.exprs[name] = n
+	return nil
+}
+
+// Apply evaluates all derived metrics over values collected at t and adds them into values as float64.
+// Derived metrics which can't be evaluated (a missing metric, a division by zero, the first sample
+// of rate/delta) are not added. Derived metrics can refer to the ones added before them.
+// rate and delta compare a key with its latest value in a previous Apply, so Apply can be called
+// in turn with the values of different collectors.
+func (d *Deriver) Apply(t time.Time, values map[string]interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e := &env{
+		values: value.Floats(values),
+		prev:   d.prev,
+		time:   t,
+	}
+
+	for _, name := range d.names {
+		if v, ok := d.exprs[name].eval(e); ok {
+			values[name] = v
+			e.values[name] = v
+		}
+	}
+
+	for k, v := range e.values {
+		d.prev[k] = sample{value: v, time: t}
+	}
+}
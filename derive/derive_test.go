@@ -0,0 +1,94 @@
+package derive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeriver(t *testing.T) {
+	d := New()
+	assert.Nil(t, d.Add("mem.used_percent", "mem.used / mem.total * 100"))
+	assert.Nil(t, d.Add("net.eth0.util", `rate(net.eth0.bytes_sent) / 1000`))
+	assert.Nil(t, d.Add("disk.root.used", `("disk./.total" - "disk./.free")`))
+	assert.Nil(t, d.Add("mem.free_percent", "100 - mem.used_percent"))
+	assert.Nil(t, d.Add("missing", "mem.unknown + 1"))
+
+	now := time.Now()
+	values := map[string]interface{}{
+		"mem.used":            uint64(25),
+		"mem.total":           uint64(100),
+		"net.eth0.bytes_sent": uint64(1000),
+		"disk./.total":        uint64(10),
+		"disk./.free":         uint64(4),
+	}
+	d.Apply(now, values)
+	assert.Equal(t, 25.0, values["mem.used_percent"])
+	assert.Equal(t, 75.0, values["mem.free_percent"])
+	assert.Equal(t, 6.0, values["disk.root.used"])
+	assert.NotContains(t, values, "net.eth0.util")
+	assert.NotContains(t, values, "missing")
+
+	values = map[string]interface{}{
+		"mem.used":            uint64(50),
+		"mem.total":           uint64(0),
+		"net.eth0.bytes_sent": uint64(21000),
+	}
+	d.Apply(now.Add(10*time.Second), values)
+	assert.Equal(t, 2.0, values["net.eth0.util"])
+	assert.NotContains(t, values, "mem.used_percent")
+
+	// counter reset
+	values = map[string]interface{}{"net.eth0.bytes_sent": uint64(10)}
+	d.Apply(now.Add(20*time.Second), values)
+	assert.NotContains(t, values, "net.eth0.util")
+}
+
+// TestApplyInTurn makes sure the previous values are kept per key when the values of
+// several collectors are applied in turn.
+func TestApplyInTurn(t *testing.T) {
+	d := New()
+	assert.Nil(t, d.Add("mem.gc.rate", "rate(mem.gc.count)"))
+
+	now := time.Now()
+	d.Apply(now, map[string]interface{}{"mem.gc.count": int64(100)})
+	d.Apply(now.Add(5*time.Second), map[string]interface{}{"cpu.percent": 10.0})
+	values := map[string]interface{}{"mem.gc.count": int64(1100)}
+	d.Apply(now.Add(10*time.Second), values)
+	assert.Equal(t, 100.0, values["mem.gc.rate"])
+}
+
+func TestParse(t *testing.T) {
+	e := &env{values: map[string]float64{"a": 2, "b": 3}}
+	for expr, want := range map[string]float64{
+		"1 + 2 * 3":     7,
+		"(1 + 2) * 3":   9,
+		"-a * b":        -6,
+		"a - b - 1":     -2,
+		"b / a":         1.5,
+		"delta(a) + 1":  0,
+		"2.5e1":         25,
+		"2.5e-1":        0.25,
+		"1E+3 - 1e3":    0,
+		"a-2e-1":        1.8,
+		`"a" * "b" / 2`: 3,
+	} {
+		n, err := parse(expr)
+		if !assert.Nil(t, err, expr) {
+			continue
+		}
+		v, ok := n.eval(e)
+		if expr == "delta(a) + 1" {
+			assert.False(t, ok)
+			continue
+		}
+		assert.True(t, ok, expr)
+		assert.Equal(t, want, v, expr)
+	}
+
+	for _, expr := range []string{"", "1 +", "(1", "a b", `"a`, "rate(1)", "1 $ 2", "1e-", "1e+a"} {
+		_, err := parse(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
@@ -0,0 +1,296 @@
+package derive
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sample is a value of a key and the time it was collected.
+type sample struct {
+	value float64
+	time  time.Time
+}
+
+// env is the environment to evaluate expressions.
+type env struct {
+	values map[string]float64
+	prev   map[string]sample
+	time   time.Time // when values were collected
+}
+
+// node is a node of an expression tree. eval returns false if the expression can't be evaluated,
+// e.g. a metric is missing or a division by zero.
+type node interface {
+	eval(e *env) (float64, bool)
+}
+
+type number float64
+
+func (n number) eval(*env) (float64, bool) { return float64(n), true }
+
+type metric string
+
+func (m metric) eval(e *env) (float64, bool) {
+	v, ok := e.values[string(m)]
+	return v, ok
+}
+
+type binary struct {
+	op          byte
+	left, right node
+}
+
+func (b *binary) eval(e *env) (float64, bool) {
+	l, ok := b.left.eval(e)
+	if !ok {
+		return 0, false
+	}
+	r, ok := b.right.eval(e)
+	if !ok {
+		return 0, false
+	}
+
+	switch b.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	default:
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	}
+}
+
+type neg struct{ x node }
+
+func (n neg) eval(e *env) (float64, bool) {
+	v, ok := n.x.eval(e)
+	return -v, ok
+}
+
+// counter is rate(key) or delta(key) of a cumulative counter.
+// A negative delta is treated as a counter reset and can't be evaluated.
+type counter struct {
+	key  string
+	rate bool
+}
+
+func (c *counter) eval(e *env) (float64, bool) {
+	cur, ok := e.values[c.key]
+	if !ok {
+		return 0, false
+	}
+	prev, ok := e.prev[c.key]
+	if !ok || !e.time.After(prev.time) || cur < prev.value {
+		return 0, false
+	}
+	if c.rate {
+		return (cur - prev.value) / e.time.Sub(prev.time).Seconds(), true
+	}
+	return cur - prev.value, true
+}
+
+// parser is a recursive descent parser of expressions:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = unary { ("*" | "/") unary }
+//	unary  = "-" unary | primary
+//	primary = number | key | "rate(" key ")" | "delta(" key ")" | "(" expr ")"
+//
+// key is a metric key like mem.used, keys with special characters such as disk./.total must be quoted.
+type parser struct {
+	s   string
+	pos int
+}
+
+func parse(s string) (node, error) {
+	p := &parser{s: s}
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos])
+	}
+	return n, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("derive: %s at position %d of %q", fmt.Sprintf(format, args...), p.pos, p.s)
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// consume consumes c if it is the next non-space character.
+func (p *parser) consume(c byte) bool {
+	p.skipSpaces()
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op byte
+		switch {
+		case p.consume('+'):
+			op = '+'
+		case p.consume('-'):
+			op = '-'
+		default:
+			return left, nil
+		}
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op byte
+		switch {
+		case p.consume('*'):
+			op = '*'
+		case p.consume('/'):
+			op = '/'
+		default:
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if p.consume('-') {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return neg{x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("unexpected end")
+	}
+
+	c := p.s[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(')') {
+			return nil, p.errorf("missing )")
+		}
+		return n, nil
+	case c == '"':
+		key, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return metric(key), nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.s) {
+			c := p.s[p.pos]
+			if c == 'e' || c == 'E' {
+				// the exponent may be signed, e.g. 2.5e-1
+				if p.pos+1 < len(p.s) && (p.s[p.pos+1] == '+' || p.s[p.pos+1] == '-') {
+					p.pos++
+				}
+			} else if !(c >= '0' && c <= '9' || c == '.') {
+				break
+			}
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.s[start:p.pos])
+		}
+		return number(v), nil
+	case isKeyChar(c):
+		key := p.key()
+		if key == "rate" || key == "delta" {
+			if p.consume('(') {
+				arg, err := p.keyArg()
+				if err != nil {
+					return nil, err
+				}
+				if !p.consume(')') {
+					return nil, p.errorf("missing )")
+				}
+				return &counter{key: arg, rate: key == "rate"}, nil
+			}
+		}
+		return metric(key), nil
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *parser) keyArg() (string, error) {
+	p.skipSpaces()
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		return p.quoted()
+	}
+	if p.pos < len(p.s) && isKeyChar(p.s[p.pos]) {
+		return p.key(), nil
+	}
+	return "", p.errorf("expect a metric key")
+}
+
+func (p *parser) key() string {
+	start := p.pos
+	for p.pos < len(p.s) && (isKeyChar(p.s[p.pos]) || p.s[p.pos] >= '0' && p.s[p.pos] <= '9' || p.s[p.pos] == '.') {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *parser) quoted() (string, error) {
+	end := strings.IndexByte(p.s[p.pos+1:], '"')
+	if end < 0 {
+		return "", p.errorf("missing closing quote")
+	}
+	key := p.s[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return key, nil
+}
+
+func isKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,165 @@
+// Package dispatch provides a queue between collectors and their handlers, so a slow handler can't
+// delay subsequent collections or grow memory unboundedly:
+//
+//	d := dispatch.New("runtime", handler, 16, dispatch.DropOldest)
+//	defer d.Close()
+//	c := rmetric.New(d.Handle)
+package dispatch
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/smallnest/go-app-metrics/internal/safe"
+)
+
+// Policy decides what happens when the queue is full.
+type Policy int
+
+const (
+	// Block waits until the handler takes an item from the queue, delaying the collector.
+	Block Policy = iota
+	// DropOldest removes the oldest queued item to make room for the new one.
+	DropOldest
+	// DropNewest drops the new item.
+	DropNewest
+)
+
+// Dispatcher calls a handler in its own goroutine with the items queued by Handle.
+// It is safe for use from multiple go routines.
+type Dispatcher[T any] struct {
+	// PanicHandler, if not nil, is called with an error describing the panic when the handler panics.
+	// The panic is recovered so the following items are still handled. Set it before the first Handle.
+	// Defaults to nil.
+	PanicHandler func(err error)
+
+	name    string
+	handler func(T)
+	policy  Policy
+	queue   chan T
+
+	mu     sync.Mutex // serializes enqueueing with DropOldest and Close
+	closed bool
+	done   chan struct{}
+
+	enqueued  int64
+	delivered int64
+	dropped   int64
+	panics    int64
+}
+
+// New creates a Dispatcher named name, which is used in metric keys, calling handler with the items
+// queued by Handle. At most size items are queued, the policy decides what happens beyond.
+func New[T any](name string, handler func(T), size int, policy Policy) *Dispatcher[T] {
+	if size < 1 {
+		size = 1
+	}
+	d := &Dispatcher[T]{
+		name:    name,
+		handler: handler,
+		policy:  policy,
+		queue:   make(chan T, size),
+		done:    make(chan struct{}),
+	}
+	go d.loop()
+	return d
+}
+
+func (d *Dispatcher[T]) loop() {
+	defer close(d.done)
+	for v := range d.queue {
+		if err := safe.Call(d.handler, v); err != nil {
+			atomic.AddInt64(&d.panics, 1)
+			if d.PanicHandler != nil {
+				d.PanicHandler(err)
+			}
+		}
+		atomic.AddInt64(&d.delivered, 1)
+	}
+}
+
+// Handle queues v for the handler according to the policy. It can be used as the handler of a collector.
+// Items handled after Close are dropped.
+func (d *Dispatcher[T]) Handle(v T) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		atomic.AddInt64(&d.dropped, 1)
+		return
+	}
+
+	switch d.policy {
+	case DropNewest:
+		select {
+		case d.queue <- v:
+		default:
+			atomic.AddInt64(&d.dropped, 1)
+			return
+		}
+	case DropOldest:
+		for {
+			select {
+			case d.queue <- v:
+				atomic.AddInt64(&d.enqueued, 1)
+				return
+			default:
+			}
+			select {
+			case <-d.queue:
+				atomic.AddInt64(&d.dropped, 1)
+			default:
+			}
+		}
+	default:
+		d.queue <- v
+	}
+	atomic.AddInt64(&d.enqueued, 1)
+}
+
+// Close stops accepting items and waits until the queued items have been handled.
+func (d *Dispatcher[T]) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	<-d.done
+}
+
+// Stats returns the current stats of the Dispatcher.
+func (d *Dispatcher[T]) Stats() DispatchStats {
+	return DispatchStats{
+		Name:      d.name,
+		Queued:    int64(len(d.queue)),
+		Enqueued:  atomic.LoadInt64(&d.enqueued),
+		Delivered: atomic.LoadInt64(&d.delivered),
+		Dropped:   atomic.LoadInt64(&d.dropped),
+		Panics:    atomic.LoadInt64(&d.panics),
+	}
+}
+
+// DispatchStats represents the stats of a Dispatcher. The counters are cumulative.
+// Panics is the number of delivered items whose handler panicked.
+type DispatchStats struct {
+	Name      string
+	Queued    int64
+	Enqueued  int64
+	Delivered int64
+	Dropped   int64
+	Panics    int64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as dispatch.<name>.<metric>.
+func (s *DispatchStats) Values() map[string]interface{} {
+	prefix := "dispatch." + s.Name + "."
+	return map[string]interface{}{
+		prefix + "queued":    s.Queued,
+		prefix + "enqueued":  s.Enqueued,
+		prefix + "delivered": s.Delivered,
+		prefix + "dropped":   s.Dropped,
+		prefix + "panics":    s.Panics,
+	}
+}
@@ -0,0 +1,101 @@
+package dispatch
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockedHandler records the items after release is closed.
+type blockedHandler struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	items   []int
+}
+
+func newBlockedHandler() *blockedHandler {
+	return &blockedHandler{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (h *blockedHandler) handle(v int) {
+	h.once.Do(func() { close(h.started) })
+	<-h.release
+	h.mu.Lock()
+	h.items = append(h.items, v)
+	h.mu.Unlock()
+}
+
+func TestDropOldest(t *testing.T) {
+	h := newBlockedHandler()
+	d := New("test", h.handle, 2, DropOldest)
+	d.Handle(1)
+	<-h.started // 1 is being handled
+	d.Handle(2)
+	d.Handle(3)
+	d.Handle(4)
+	close(h.release)
+	d.Close()
+
+	assert.Equal(t, []int{1, 3, 4}, h.items)
+	stats := d.Stats()
+	assert.Equal(t, int64(1), stats.Dropped)
+	assert.Equal(t, int64(3), stats.Delivered)
+}
+
+func TestDropNewest(t *testing.T) {
+	h := newBlockedHandler()
+	d := New("test", h.handle, 2, DropNewest)
+	d.Handle(1)
+	<-h.started
+	d.Handle(2)
+	d.Handle(3)
+	d.Handle(4)
+	close(h.release)
+	d.Close()
+	d.Handle(5)
+
+	assert.Equal(t, []int{1, 2, 3}, h.items)
+	values := d.Stats()
+	assert.Equal(t, int64(2), values.Values()["dispatch.test.dropped"])
+}
+
+func TestBlock(t *testing.T) {
+	var got []rmetric.RuntimeStats
+	d := New("runtime", func(stats rmetric.RuntimeStats) { got = append(got, stats) }, 1, Block)
+	c := rmetric.New(d.Handle)
+	for i := 0; i < 3; i++ {
+		d.Handle(c.Once())
+	}
+	d.Close()
+
+	assert.Len(t, got, 3)
+	assert.Equal(t, int64(0), d.Stats().Dropped)
+}
+
+func TestHandlerPanics(t *testing.T) {
+	var got []int
+	var errs []error
+	d := New("test", func(v int) {
+		if v == 2 {
+			panic("boom")
+		}
+		got = append(got, v)
+	}, 4, Block)
+	d.PanicHandler = func(err error) { errs = append(errs, err) }
+	for i := 1; i <= 3; i++ {
+		d.Handle(i)
+	}
+	d.Close()
+
+	assert.Equal(t, []int{1, 3}, got)
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "handler panicked: boom")
+	stats := d.Stats()
+	assert.Equal(t, int64(3), stats.Delivered)
+	assert.Equal(t, int64(1), stats.Panics)
+	assert.Equal(t, int64(1), stats.Values()["dispatch.test.panics"])
+}
@@ -0,0 +1,79 @@
+package appmetrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/system"
+)
+
+// SchemaVersion is the version of the JSON encoding of snapshots, written as schema_version.
+// Adding fields doesn't change the version because decoders ignore unknown fields and leave
+// missing ones zero, it is only increased by changes which older decoders can't read correctly.
+const SchemaVersion = 1
+
+// snapshotJSON is the encoding of a snapshot. Field names are matched case-insensitively by
+// encoding/json, so it also decodes the unversioned encoding of the Snapshot struct (version 0).
+type snapshotJSON struct {
+	SchemaVersion int                  `json:"schema_version"`
+	Time          time.Time            `json:"time"`
+	Elapsed       time.Duration        `json:"elapsed,omitempty"`
+	Runtime       rmetric.RuntimeStats `json:"runtime"`
+	// Tags are all tags of the snapshot, the tags of the runtime stats aren't encoded by the stats themselves.
+	Tags   map[string]string  `json:"tags,omitempty"`
+	System system.SystemStats `json:"system"`
+}
+
+// MarshalJSON encodes the snapshot with its schema version.
+func (s *Snapshot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(snapshotJSON{
+		SchemaVersion: SchemaVersion,
+		Time:          s.Time,
+		Elapsed:       s.Elapsed,
+		Runtime:       s.Runtime,
+		Tags:          s.AllTags(),
+		System:        s.System,
+	})
+}
+
+// UnmarshalJSON decodes a snapshot encoded by MarshalJSON of this or an older version,
+// including the unversioned encoding. It fails if the schema version is newer than SchemaVersion.
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	var v snapshotJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("appmetrics: unsupported snapshot schema version %d, the latest supported is %d",
+			v.SchemaVersion, SchemaVersion)
+	}
+
+	v.Runtime.Goos = v.Tags["go.os"]
+	v.Runtime.Goarch = v.Tags["go.arch"]
+	v.Runtime.Version = v.Tags["go.version"]
+
+	// the remaining tags are the dynamic tags
+	known := v.Runtime.Tags()
+	for k, val := range v.System.Tags() {
+		known[k] = val
+	}
+	var tags map[string]string
+	for k, val := range v.Tags {
+		if _, ok := known[k]; ok {
+			continue
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[k] = val
+	}
+
+	s.Runtime = v.Runtime
+	s.System = v.System
+	s.Time = v.Time
+	s.Elapsed = v.Elapsed
+	s.Tags = tags
+	return nil
+}
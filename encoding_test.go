@@ -0,0 +1,39 @@
+package appmetrics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotJSON(t *testing.T) {
+	snap := testSnapshot()
+	snap.Runtime.Goos = "linux"
+	snap.Time = time.Unix(1700000000, 0).UTC()
+
+	data, err := json.Marshal(snap)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"schema_version":1`)
+
+	var decoded Snapshot
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, snap.Runtime, decoded.Runtime)
+	assert.Equal(t, snap.System.DiskStat, decoded.System.DiskStat)
+	assert.True(t, snap.Time.Equal(decoded.Time))
+	v, _ := Get[int64](&decoded, "mem.heap.alloc")
+	assert.Equal(t, int64(100), v)
+}
+
+func TestSnapshotJSONCompat(t *testing.T) {
+	// unversioned encoding with unknown fields
+	legacy := `{"Runtime":{"mem.heap.alloc":100},"System":{"MemStat":{"Total":2000}},"Time":"2023-11-14T22:13:20Z","Extra":1}`
+	var snap Snapshot
+	assert.NoError(t, json.Unmarshal([]byte(legacy), &snap))
+	assert.Equal(t, int64(100), snap.Runtime.HeapAlloc)
+	assert.Equal(t, uint64(2000), snap.System.MemStat.Total)
+
+	newer := `{"schema_version":99,"runtime":{}}`
+	assert.Error(t, json.Unmarshal([]byte(newer), &snap))
+}
@@ -3,70 +3,207 @@ package exp
 import (
 	"context"
 	"expvar"
-	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/smallnest/go-app-metrics/internal/value"
+	"github.com/smallnest/go-app-metrics/metadata"
 	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/status"
 	"github.com/smallnest/go-app-metrics/system"
+	"github.com/smallnest/go-app-metrics/units"
 )
 
-var (
-	rmetricMap = expvar.NewMap("rmetricStats")
-	systemMap  = expvar.NewMap("systemStats")
-)
+// Exporter writes the system stats and the go runtime stats in expvar variables. Each Exporter holds
+// its own variables and state, so several of them can run in one process.
+type Exporter struct {
+	// MaxAge, if positive, is the maximum age of the metrics. The metrics of a collector which hasn't
+	// updated them within MaxAge, e.g. because the collection has stalled, are removed instead of
+	// exporting frozen values forever. It must be set before Run is called. Defaults to 0 which keeps them.
+	MaxAge time.Duration
+
+	// Scale converts memory, disk and duration values before they are written into expvar variables.
+	// Scaled values are written as floats. It must be set before Run is called. Defaults to raw bytes and nanoseconds.
+	Scale units.Scale
+
+	rmetricMap *expvar.Map
+	systemMap  *expvar.Map
+	// collectedAtMap records the unix times of the last collections as rmetric and system,
+	// so consumers can tell stale metrics.
+	collectedAtMap *expvar.Map
+
+	rmetricUpdated int64 // unix nanoseconds
+	systemUpdated  int64
+}
+
+// New creates an Exporter writing the go runtime stats, the system stats and the unix times of their
+// last updates in the expvar variables named rmetricName, systemName and collectedAtName. Like
+// expvar.NewMap, it panics if a variable of the names has already been published.
+func New(rmetricName, systemName, collectedAtName string) *Exporter {
+	return newExporter(expvar.NewMap(rmetricName), expvar.NewMap(systemName), expvar.NewMap(collectedAtName))
+}
+
+func newExporter(rmetricMap, systemMap, collectedAtMap *expvar.Map) *Exporter {
+	return &Exporter{
+		rmetricMap:     rmetricMap,
+		systemMap:      systemMap,
+		collectedAtMap: collectedAtMap,
+	}
+}
+
+// std is the Exporter of the package level functions.
+var std = newExporter(expvar.NewMap("rmetricStats"), expvar.NewMap("systemStats"), expvar.NewMap("statsCollectedAt"))
+
+// MaxAge is Exporter.MaxAge of the variables written by Run.
+//
+// Deprecated: use New and set Exporter.MaxAge.
+var MaxAge time.Duration
+
+// Scale is Exporter.Scale of the variables written by Run.
+//
+// Deprecated: use New and set Exporter.Scale.
+var Scale units.Scale
 
 // Run starts a collector to collect system stats and go runtime stats,
 // and writes them in expvar variables named as `rmetricStats` and `systemStats`.
+// The unix times of the last updates are written in `statsCollectedAt`. The collectors are registered to package status until ctx is done.
+//
+// Deprecated: use New and Exporter.Run, which don't share state with other users of the package.
 func Run(ctx context.Context, interval time.Duration) {
-	c := rmetric.New(runtimeStatsCallback)
+	std.MaxAge = MaxAge
+	std.Scale = Scale
+	std.Run(ctx, interval)
+}
+
+// Clear removes all metrics written by Run from the expvar variables `rmetricStats`, `systemStats` and `statsCollectedAt`.
+//
+// Deprecated: use Exporter.Clear.
+func Clear() {
+	std.Clear()
+}
+
+// Run starts a collector to collect system stats and go runtime stats and writes them in the
+// variables of e. The collectors are registered to package status until ctx is done.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	c := rmetric.New(e.writeRuntime)
 	c.CollectInterval = interval
 	c.Done = ctx.Done()
 	go c.Run()
 
-	sc := system.New(systemStatsCallback)
+	sc := system.New(e.writeSystem)
 	sc.CollectInterval = interval
 	sc.Done = ctx.Done()
 	go sc.Run()
+
+	status.Register(c)
+	status.Register(sc)
+	go func() {
+		<-ctx.Done()
+		status.Unregister(c)
+		status.Unregister(sc)
+	}()
+
+	if e.MaxAge > 0 {
+		go e.expire(ctx, interval, e.MaxAge)
+	}
+}
+
+// Once collects the system stats and the go runtime stats once and writes them in the variables of e.
+// The system stats computed from the difference of two collections, such as the bandwidth, are zero.
+func (e *Exporter) Once() {
+	e.writeRuntime(rmetric.New(nil).Once())
+	e.writeSystem(system.New(nil).Once())
+}
+
+// expire removes the metrics which are older than maxAge every interval until ctx is done.
+func (e *Exporter) expire(ctx context.Context, interval, maxAge time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			expireMap(e.rmetricMap, &e.rmetricUpdated, now, maxAge)
+			expireMap(e.systemMap, &e.systemUpdated, now, maxAge)
+		}
+	}
+}
+
+func expireMap(m *expvar.Map, updated *int64, now time.Time, maxAge time.Duration) {
+	if t := atomic.LoadInt64(updated); t > 0 && now.Sub(time.Unix(0, t)) > maxAge {
+		clearMap(m)
+	}
 }
 
-func runtimeStatsCallback(stats rmetric.RuntimeStats) {
+// markUpdated records that the metrics of name have been updated at t.
+func (e *Exporter) markUpdated(name string, updated *int64, t time.Time) {
+	atomic.StoreInt64(updated, t.UnixNano())
+	setValue(e.collectedAtMap, name, t.Unix())
+}
+
+// Clear removes all metrics written by e from its expvar variables, so tests and reconfigured services
+// don't keep stale metrics. The variables themselves stay published because expvar can't unregister them.
+// Cancel the context passed to Run first, otherwise the collectors write the metrics again.
+func (e *Exporter) Clear() {
+	clearMap(e.rmetricMap)
+	clearMap(e.systemMap)
+	clearMap(e.collectedAtMap)
+}
+
+func clearMap(m *expvar.Map) {
+	var keys []string
+	m.Do(func(kv expvar.KeyValue) {
+		keys = append(keys, kv.Key)
+	})
+	for _, k := range keys {
+		m.Delete(k)
+	}
+}
+
+func (e *Exporter) writeRuntime(stats rmetric.RuntimeStats) {
 	values := stats.Values()
+	e.Scale.Apply(values)
 	for k, v := range values {
-		va := rmetricMap.Get(k)
-
-		if k == "mem.gc.cpu_fraction" {
-			if va == nil {
-				va = new(expvar.Float)
-				rmetricMap.Set(k, va)
-			}
-			va.(*expvar.Float).Set(v.(float64))
-			continue
-		}
-		if va == nil {
-			va = new(expvar.Int)
-			rmetricMap.Set(k, va)
-		}
-		va.(*expvar.Int).Set(v.(int64))
+		setValue(e.rmetricMap, k, v)
 	}
+	e.markUpdated("rmetric", &e.rmetricUpdated, time.Now())
 }
 
-func systemStatsCallback(stats system.SystemStats) {
+func (e *Exporter) writeSystem(stats system.SystemStats) {
 	values := stats.Values()
+	e.Scale.Apply(values)
 	for k, v := range values {
-		va := systemMap.Get(k)
-
-		if strings.HasPrefix(k, "cpu.") || strings.HasPrefix(k, "load.") {
-			if va == nil {
-				va = new(expvar.Float)
-				systemMap.Set(k, va)
-			}
-			systemMap.Get(k).(*expvar.Float).Set(v.(float64))
-			continue
-		}
-		if va == nil {
-			va = new(expvar.Int)
-			systemMap.Set(k, va)
+		setValue(e.systemMap, k, v)
+	}
+	e.markUpdated("system", &e.systemUpdated, time.Now())
+}
+
+// setValue sets v as an expvar.Float if it is a float, otherwise as an expvar.Int.
+// Unsigned integers beyond the range of int64 are saturated. If the kind of a value changes,
+// the variable is replaced instead of panicking.
+func setValue(m *expvar.Map, k string, v interface{}) {
+	va := m.Get(k)
+
+	if value.KindOf(v) == metadata.Float {
+		f, _ := value.Float64(v)
+		fv, ok := va.(*expvar.Float)
+		if !ok {
+			fv = new(expvar.Float)
+			m.Set(k, fv)
 		}
-		va.(*expvar.Int).Set(int64(v.(uint64)))
+		fv.Set(f)
+		return
+	}
+
+	n, ok := value.Int64(v)
+	if !ok {
+		return
+	}
+	iv, ok := va.(*expvar.Int)
+	if !ok {
+		iv = new(expvar.Int)
+		m.Set(k, iv)
 	}
+	iv.Set(n)
 }
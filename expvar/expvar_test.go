@@ -3,9 +3,14 @@ package exp
 import (
 	"context"
 	"expvar"
+	"math"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/system"
+	"github.com/smallnest/go-app-metrics/units"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -46,3 +51,80 @@ func TestCollector(t *testing.T) {
 		}
 	}
 }
+
+func testExporter() *Exporter {
+	return newExporter(new(expvar.Map).Init(), new(expvar.Map).Init(), new(expvar.Map).Init())
+}
+
+func TestClear(t *testing.T) {
+	e := testExporter()
+	e.writeRuntime(rmetric.RuntimeStats{})
+	e.writeSystem(system.SystemStats{})
+	assert.NotNil(t, e.rmetricMap.Get("mem.lookups"))
+	assert.NotNil(t, e.systemMap.Get("mem.total"))
+	e.Clear()
+
+	count := 0
+	e.rmetricMap.Do(func(expvar.KeyValue) { count++ })
+	e.systemMap.Do(func(expvar.KeyValue) { count++ })
+	assert.Equal(t, 0, count)
+}
+
+func TestExpire(t *testing.T) {
+	e := testExporter()
+	e.writeRuntime(rmetric.RuntimeStats{})
+	assert.NotNil(t, e.collectedAtMap.Get("rmetric"))
+
+	now := time.Now()
+	expireMap(e.rmetricMap, &e.rmetricUpdated, now, time.Minute)
+	assert.NotNil(t, e.rmetricMap.Get("mem.lookups"))
+
+	expireMap(e.rmetricMap, &e.rmetricUpdated, now.Add(2*time.Minute), time.Minute)
+	assert.Nil(t, e.rmetricMap.Get("mem.lookups"))
+}
+
+func TestScale(t *testing.T) {
+	e := testExporter()
+	e.Scale = units.Scale{Bytes: units.MiB}
+
+	stats := system.SystemStats{}
+	stats.MemStat.Total = 2 << 20
+	e.writeSystem(stats)
+	assert.Equal(t, "2", e.systemMap.Get("mem.total").String())
+	_, ok := e.systemMap.Get("mem.total").(*expvar.Float)
+	assert.True(t, ok)
+
+	e.Scale = units.Scale{}
+	e.writeSystem(stats)
+	assert.Equal(t, "2097152", e.systemMap.Get("mem.total").String())
+}
+
+func TestExporters(t *testing.T) {
+	a := New("test_a_rmetric", "test_a_system", "test_a_collected_at")
+	b := New("test_b_rmetric", "test_b_system", "test_b_collected_at")
+	a.Once()
+	assert.NotNil(t, expvar.Get("test_a_rmetric").(*expvar.Map).Get("cpu.goroutines"))
+	assert.Nil(t, expvar.Get("test_b_rmetric").(*expvar.Map).Get("cpu.goroutines"))
+
+	b.Once()
+	a.Clear()
+	assert.Nil(t, expvar.Get("test_a_rmetric").(*expvar.Map).Get("cpu.goroutines"))
+	assert.NotNil(t, expvar.Get("test_b_rmetric").(*expvar.Map).Get("cpu.goroutines"))
+}
+
+func TestSetValue(t *testing.T) {
+	m := new(expvar.Map).Init()
+
+	setValue(m, "a", uint64(math.MaxUint64))
+	assert.Equal(t, strconv.FormatInt(math.MaxInt64, 10), m.Get("a").String())
+
+	// the kind changes from int to float
+	setValue(m, "a", 1.5)
+	assert.Equal(t, "1.5", m.Get("a").String())
+
+	setValue(m, "a", int64(2))
+	assert.Equal(t, "2", m.Get("a").String())
+
+	setValue(m, "b", "x")
+	assert.Nil(t, m.Get("b"))
+}
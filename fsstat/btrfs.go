@@ -0,0 +1,173 @@
+package fsstat
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// btrfsChunkTypes are the types of the chunks btrfs allocates.
+var btrfsChunkTypes = []string{"data", "metadata", "system"}
+
+// BtrfsStatsHandler represents a handler to handle stats after successfully gathering statistics
+type BtrfsStatsHandler func(BtrfsStats)
+
+// BtrfsCollector implements the periodic collection of the allocation of btrfs filesystems to a BtrfsStatsHandler.
+type BtrfsCollector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Root is the directory of the btrfs filesystems in sysfs. Defaults to /sys/fs/btrfs.
+	Root string
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	statsHandler BtrfsStatsHandler
+}
+
+// NewBtrfs creates a new BtrfsCollector that will periodically output the stats of btrfs to statsHandler.
+func NewBtrfs(statsHandler BtrfsStatsHandler) *BtrfsCollector {
+	if statsHandler == nil {
+		statsHandler = func(BtrfsStats) {}
+	}
+
+	return &BtrfsCollector{
+		CollectInterval: 10 * time.Second,
+		Root:            "/sys/fs/btrfs",
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured BtrfsStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *BtrfsCollector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the stats of the btrfs filesystems.
+func (c *BtrfsCollector) Once() BtrfsStats {
+	return c.collectStats()
+}
+
+func (c *BtrfsCollector) collectStats() BtrfsStats {
+	stats := BtrfsStats{Filesystems: make(map[string]BtrfsStat)}
+
+	entries, err := os.ReadDir(c.Root)
+	if err != nil {
+		return stats
+	}
+	for _, e := range entries {
+		// the filesystems are directories named by uuid, besides the features directory
+		dir := filepath.Join(c.Root, e.Name())
+		if _, err := os.Stat(filepath.Join(dir, "allocation")); err != nil {
+			continue
+		}
+
+		fs := BtrfsStat{UUID: e.Name(), Chunks: make(map[string]BtrfsChunkStat, len(btrfsChunkTypes))}
+		fs.Label, _ = readString(filepath.Join(dir, "label"))
+
+		var allocated uint64
+		for _, t := range btrfsChunkTypes {
+			var chunk BtrfsChunkStat
+			chunk.Total, _ = readUint(filepath.Join(dir, "allocation", t, "total_bytes"))
+			chunk.Used, _ = readUint(filepath.Join(dir, "allocation", t, "bytes_used"))
+			fs.Chunks[t] = chunk
+
+			// disk_total counts the copies of raid profiles
+			if diskTotal, err := readUint(filepath.Join(dir, "allocation", t, "disk_total")); err == nil {
+				allocated += diskTotal
+			} else {
+				allocated += chunk.Total
+			}
+		}
+
+		devices, _ := os.ReadDir(filepath.Join(dir, "devices"))
+		for _, d := range devices {
+			// the size of a block device is in 512-byte sectors
+			if sectors, err := readUint(filepath.Join(dir, "devices", d.Name(), "size")); err == nil {
+				fs.DeviceSize += sectors * 512
+			}
+		}
+		if fs.DeviceSize > allocated {
+			fs.Unallocated = fs.DeviceSize - allocated
+		}
+
+		name := fs.Label
+		if name == "" {
+			name = fs.UUID
+		}
+		stats.Filesystems[name] = fs
+	}
+	return stats
+}
+
+func readString(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	return strings.TrimSpace(string(data)), err
+}
+
+func readUint(path string) (uint64, error) {
+	s, err := readString(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// BtrfsStats represents the stats of the btrfs filesystems keyed by label, or by uuid if they have no label.
+type BtrfsStats struct {
+	Filesystems map[string]BtrfsStat
+}
+
+// BtrfsStat represents the allocation of a btrfs filesystem.
+type BtrfsStat struct {
+	UUID  string
+	Label string
+
+	// Chunks are the allocation of the chunk types data, metadata and system.
+	Chunks map[string]BtrfsChunkStat
+	// DeviceSize is the size of all devices of the filesystem.
+	DeviceSize uint64
+	// Unallocated is the space of the devices not allocated to chunks yet. The filesystem is full when
+	// it runs out of unallocated space and the metadata chunks are full, even if the data chunks have space.
+	Unallocated uint64
+}
+
+// BtrfsChunkStat represents the space allocated to chunks of a type and the space used in them.
+type BtrfsChunkStat struct {
+	Total uint64
+	Used  uint64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as btrfs.<name>.<metric> and
+// btrfs.<name>.<chunk type>.<metric>.
+func (s *BtrfsStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Filesystems)*(2+2*len(btrfsChunkTypes)))
+	for name, fs := range s.Filesystems {
+		prefix := "btrfs." + name + "."
+		values[prefix+"device_size"] = fs.DeviceSize
+		values[prefix+"unallocated"] = fs.Unallocated
+		for t, chunk := range fs.Chunks {
+			values[prefix+t+".total"] = chunk.Total
+			values[prefix+t+".used"] = chunk.Used
+		}
+	}
+	return values
+}
@@ -0,0 +1,119 @@
+package fsstat
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/sanitize"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixture creates files in a temporary directory.
+func fixture(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0o755))
+		assert.Nil(t, os.WriteFile(file, []byte(content), 0o644))
+	}
+	return root
+}
+
+func TestZFS(t *testing.T) {
+	root := fixture(t, map[string]string{
+		"arcstats": "13 1 0x01 123 33456 5430463245 2345345243524\nname type data\nhits 4 100\nmisses 4 20\nsize 4 1024\nc_max 4 4096\n",
+		"zpool":    "#!/bin/sh\nprintf 'tank\\tONLINE\\t12\\t1000\\t400\\t600\\nbackup\\tDEGRADED\\t-\\t2000\\t100\\t1900\\n'\n",
+	})
+	assert.Nil(t, os.Chmod(filepath.Join(root, "zpool"), 0o755))
+
+	c := NewZFS(nil)
+	c.ARCStatsPath = filepath.Join(root, "arcstats")
+	c.Zpool = filepath.Join(root, "zpool")
+	stats := c.Once()
+	assert.Equal(t, uint64(1024), stats.ARCSize)
+	assert.Equal(t, uint64(0), stats.ARCHits)
+
+	assert.Nil(t, os.WriteFile(c.ARCStatsPath, []byte("name type data\nhits 4 190\nmisses 4 30\nsize 4 2048\n"), 0o644))
+	stats = c.Once()
+	assert.Equal(t, uint64(90), stats.ARCHits)
+	assert.Equal(t, uint64(10), stats.ARCMisses)
+
+	values := stats.Values()
+	assert.Equal(t, 0.9, values["zfs.arc.hit_ratio"])
+	assert.Equal(t, int64(1), values["zfs.pool.tank.healthy"])
+	assert.Equal(t, 12.0, values["zfs.pool.tank.fragmentation"])
+	assert.Equal(t, uint64(600), values["zfs.pool.tank.free"])
+	assert.Equal(t, int64(0), values["zfs.pool.backup.healthy"])
+}
+
+func TestBtrfs(t *testing.T) {
+	const uuid = "4e6a3c0a-2b1e-4f7c-9b7d-1f2e3d4c5b6a"
+	root := fixture(t, map[string]string{
+		"features/raid56":                         "0\n",
+		uuid + "/label":                           "data\n",
+		uuid + "/allocation/data/total_bytes":     "1000\n",
+		uuid + "/allocation/data/bytes_used":      "900\n",
+		uuid + "/allocation/data/disk_total":      "2000\n",
+		uuid + "/allocation/metadata/total_bytes": "100\n",
+		uuid + "/allocation/metadata/bytes_used":  "50\n",
+		uuid + "/allocation/metadata/disk_total":  "200\n",
+		uuid + "/allocation/system/total_bytes":   "10\n",
+		uuid + "/allocation/system/bytes_used":    "1\n",
+		uuid + "/allocation/system/disk_total":    "20\n",
+		uuid + "/devices/sda/size":                "8\n",
+		uuid + "/devices/sdb/size":                "8\n",
+	})
+
+	c := NewBtrfs(nil)
+	c.Root = root
+	stats := c.Once()
+	assert.Len(t, stats.Filesystems, 1)
+
+	fs := stats.Filesystems["data"]
+	assert.Equal(t, uuid, fs.UUID)
+	assert.Equal(t, uint64(8192), fs.DeviceSize)
+	assert.Equal(t, uint64(8192-2220), fs.Unallocated)
+
+	values := stats.Values()
+	assert.Equal(t, uint64(900), values["btrfs.data.data.used"])
+	assert.Equal(t, uint64(100), values["btrfs.data.metadata.total"])
+}
+
+const mountstats = `device rootfs mounted on / with fstype rootfs
+device proc mounted on /proc with fstype proc
+device nfs.example.com:/export mounted on /mnt/my\040data with fstype nfs4 statvers=1.1
+	opts:	rw,vers=4.2,rsize=1048576,wsize=1048576,hard,proto=tcp
+	age:	3600
+	xprt:	tcp 0 1 2 0 0 1000 1000 0 1200 0 2 0 0
+	per-op statistics
+	        NULL: 0 0 0 0 0 0 0 0
+	        READ: %d %d 0 12000 1200000 10 %d 600
+	     GETATTR: 50 50 %d 5000 10000 0 100 120
+`
+
+func TestNFS(t *testing.T) {
+	root := fixture(t, map[string]string{"mountstats": fmt.Sprintf(mountstats, 100, 100, 500, 0)})
+
+	c := NewNFS(nil)
+	c.Path = filepath.Join(root, "mountstats")
+	stats := c.Once()
+	assert.Len(t, stats.Mounts, 1)
+	assert.Empty(t, stats.Mounts["/mnt/my data"].Ops)
+
+	assert.Nil(t, os.WriteFile(c.Path, []byte(fmt.Sprintf(mountstats, 110, 113, 600, 2)), 0o644))
+	stats = c.Once()
+	m := stats.Mounts["/mnt/my data"]
+	assert.Equal(t, "nfs.example.com:/export", m.Device)
+	assert.Equal(t, NFSOpStat{Ops: 10, Retransmits: 3, RTT: 100 * time.Millisecond}, m.Ops["READ"])
+	assert.Equal(t, 10*time.Millisecond, m.Ops["READ"].AvgRTT())
+
+	values := stats.SanitizedValues(sanitize.Graphite)
+	assert.Equal(t, uint64(10), values["nfs.mnt_my_data.ops"])
+	assert.Equal(t, uint64(2), values["nfs.mnt_my_data.timeouts"])
+	assert.Equal(t, uint64(3), values["nfs.mnt_my_data.op.READ.retransmits"])
+	assert.Equal(t, uint64(10*time.Millisecond), values["nfs.mnt_my_data.op.READ.rtt_avg"])
+	assert.NotContains(t, values, "nfs.mnt_my_data.op.NULL.ops")
+}
@@ -0,0 +1,264 @@
+package fsstat
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/counter"
+	"github.com/smallnest/go-app-metrics/sanitize"
+)
+
+// NFSStatsHandler represents a handler to handle stats after successfully gathering statistics
+type NFSStatsHandler func(NFSStats)
+
+// NFSCollector implements the periodic collection of the operations of NFS mounts to a NFSStatsHandler.
+type NFSCollector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Path is the mountstats file. Defaults to /proc/self/mountstats.
+	Path string
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	prev         map[string]map[string]NFSOpStat // mountpoint -> operation -> counters
+	statsHandler NFSStatsHandler
+}
+
+// NewNFS creates a new NFSCollector that will periodically output the stats of NFS mounts to statsHandler.
+func NewNFS(statsHandler NFSStatsHandler) *NFSCollector {
+	if statsHandler == nil {
+		statsHandler = func(NFSStats) {}
+	}
+
+	return &NFSCollector{
+		CollectInterval: 10 * time.Second,
+		Path:            "/proc/self/mountstats",
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured NFSStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *NFSCollector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the operations of NFS mounts since the previous collection.
+// The first collection only records the counters, so the operations of its mounts are empty.
+func (c *NFSCollector) Once() NFSStats {
+	return c.collectStats()
+}
+
+func (c *NFSCollector) collectStats() NFSStats {
+	stats := NFSStats{Mounts: make(map[string]NFSMountStat)}
+
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return stats
+	}
+
+	cur := parseMountStats(data)
+	for mountpoint, m := range cur {
+		stat := NFSMountStat{Device: m.Device, Ops: make(map[string]NFSOpStat, len(m.Ops))}
+		if prev, ok := c.prev[mountpoint]; ok {
+			for op, v := range m.Ops {
+				stat.Ops[op] = v.delta(prev[op])
+			}
+		}
+		stats.Mounts[mountpoint] = stat
+	}
+
+	// mounts which are gone are dropped
+	c.prev = make(map[string]map[string]NFSOpStat, len(cur))
+	for mountpoint, m := range cur {
+		c.prev[mountpoint] = m.Ops
+	}
+	return stats
+}
+
+// parseMountStats parses the NFS mounts of a mountstats file, keyed by mountpoint. A mount starts with
+// "device <export> mounted on <mountpoint> with fstype nfs..." and its operations are listed after
+// "per-op statistics" as "<OP>: <ops> <transmissions> <major timeouts> <bytes sent> <bytes received>
+// <queue ms> <rtt ms> <execute ms>".
+func parseMountStats(data []byte) map[string]NFSMountStat {
+	mounts := make(map[string]NFSMountStat)
+
+	var cur *NFSMountStat
+	var perOp bool
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "device" {
+			cur, perOp = nil, false
+			// device <export> mounted on <mountpoint> with fstype <fstype> ...
+			if len(fields) >= 8 && fields[2] == "mounted" && fields[5] == "with" && strings.HasPrefix(fields[7], "nfs") {
+				m := NFSMountStat{Device: fields[1], Ops: make(map[string]NFSOpStat)}
+				mounts[unescapeMountpoint(fields[4])] = m
+				cur = &m
+			}
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if fields[0] == "per-op" {
+			perOp = true
+			continue
+		}
+		if !perOp || len(fields) < 9 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+
+		var v [8]uint64
+		for i := range v {
+			v[i], _ = strconv.ParseUint(fields[i+1], 10, 64)
+		}
+		op := NFSOpStat{
+			Ops:      v[0],
+			Timeouts: v[2],
+			RTT:      time.Duration(v[6]) * time.Millisecond,
+			Execute:  time.Duration(v[7]) * time.Millisecond,
+		}
+		if v[1] > v[0] {
+			op.Retransmits = v[1] - v[0]
+		}
+		cur.Ops[strings.TrimSuffix(fields[0], ":")] = op
+	}
+	return mounts
+}
+
+// unescapeMountpoint replaces the octal escapes of mountpoints, e.g. \040 for a space.
+func unescapeMountpoint(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// NFSStats represents the operations of NFS mounts since the previous collection, keyed by mountpoint.
+type NFSStats struct {
+	Mounts map[string]NFSMountStat
+}
+
+// NFSMountStat represents the operations of a NFS mount, keyed by operation, e.g. READ or GETATTR.
+type NFSMountStat struct {
+	// Device is the export, e.g. server:/export.
+	Device string
+	Ops    map[string]NFSOpStat
+}
+
+// Total returns the sum of the operations of the mount.
+func (m *NFSMountStat) Total() NFSOpStat {
+	var total NFSOpStat
+	for _, op := range m.Ops {
+		total.Ops += op.Ops
+		total.Retransmits += op.Retransmits
+		total.Timeouts += op.Timeouts
+		total.RTT += op.RTT
+		total.Execute += op.Execute
+	}
+	return total
+}
+
+// NFSOpStat represents the counters of a NFS operation.
+type NFSOpStat struct {
+	Ops uint64
+	// Retransmits are the transmissions besides the first one of every operation.
+	Retransmits uint64
+	// Timeouts are the major timeouts, which are reported as "server not responding" for hard mounts.
+	Timeouts uint64
+	// RTT is the total time waiting for replies of the server.
+	RTT time.Duration
+	// Execute is the total time of the operations, including queueing and retransmits.
+	Execute time.Duration
+}
+
+func (s NFSOpStat) delta(prev NFSOpStat) NFSOpStat {
+	ops, _ := counter.Delta(s.Ops, prev.Ops)
+	retransmits, _ := counter.Delta(s.Retransmits, prev.Retransmits)
+	timeouts, _ := counter.Delta(s.Timeouts, prev.Timeouts)
+	rtt, _ := counter.Delta(uint64(s.RTT), uint64(prev.RTT))
+	execute, _ := counter.Delta(uint64(s.Execute), uint64(prev.Execute))
+	return NFSOpStat{
+		Ops:         ops,
+		Retransmits: retransmits,
+		Timeouts:    timeouts,
+		RTT:         time.Duration(rtt),
+		Execute:     time.Duration(execute),
+	}
+}
+
+// AvgRTT returns the average time waiting for a reply per operation, or 0 without operations.
+func (s NFSOpStat) AvgRTT() time.Duration {
+	if s.Ops == 0 {
+		return 0
+	}
+	return s.RTT / time.Duration(s.Ops)
+}
+
+// Values returns metrics which you can write into TSDB, keyed as nfs.<mountpoint>.<metric> for all operations
+// and nfs.<mountpoint>.op.<operation>.<metric>. Mountpoints are embedded in keys as is, see SanitizedValues.
+func (s *NFSStats) Values() map[string]interface{} {
+	return s.SanitizedValues(sanitize.Raw)
+}
+
+// SanitizedValues returns metrics like Values, but mountpoints embedded in keys are sanitized by sf,
+// e.g. sanitize.Graphite turns "nfs./mnt/data.ops" into "nfs.mnt_data.ops".
+// The metrics are ops, retransmits, timeouts and rtt_avg, the average round trip time in nanoseconds.
+func (s *NFSStats) SanitizedValues(sf sanitize.Func) map[string]interface{} {
+	values := make(map[string]interface{})
+	add := func(prefix string, op NFSOpStat) {
+		values[prefix+"ops"] = op.Ops
+		values[prefix+"retransmits"] = op.Retransmits
+		values[prefix+"timeouts"] = op.Timeouts
+		values[prefix+"rtt_avg"] = uint64(op.AvgRTT())
+	}
+
+	for mountpoint, m := range s.Mounts {
+		prefix := "nfs." + sf(mountpoint) + "."
+		add(prefix, m.Total())
+		for name, op := range m.Ops {
+			// most operations are never used by a mount
+			if op.Ops > 0 || op.Timeouts > 0 {
+				add(prefix+"op."+name+".", op)
+			}
+		}
+	}
+	return values
+}
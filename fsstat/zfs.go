@@ -0,0 +1,203 @@
+// Package fsstat provides method to collect metrics specific to filesystems which pool their storage,
+// ZFS and btrfs, whose free space reported by disk.Usage is misleading: ZFS datasets share the free space
+// of their pool and btrfs allocates chunks of data and metadata from unallocated space.
+// It also collects the operations of NFS mounts, since hung or slow mounts stall applications silently.
+package fsstat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/counter"
+)
+
+// ZFSStatsHandler represents a handler to handle stats after successfully gathering statistics
+type ZFSStatsHandler func(ZFSStats)
+
+// ZFSCollector implements the periodic collection of the ARC and pool stats of ZFS to a ZFSStatsHandler.
+type ZFSCollector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// ARCStatsPath is the kstat file of the ARC. Defaults to /proc/spl/kstat/zfs/arcstats.
+	ARCStatsPath string
+
+	// Zpool is the command listing the pools with `zpool list -Hp -o name,health,frag,size,alloc,free`.
+	// Defaults to zpool in PATH.
+	Zpool string
+
+	// Timeout is the timeout of the zpool command. Defaults to 5 seconds.
+	Timeout time.Duration
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	prevHits, prevMisses uint64
+	collected            bool
+	statsHandler         ZFSStatsHandler
+}
+
+// NewZFS creates a new ZFSCollector that will periodically output the stats of ZFS to statsHandler.
+func NewZFS(statsHandler ZFSStatsHandler) *ZFSCollector {
+	if statsHandler == nil {
+		statsHandler = func(ZFSStats) {}
+	}
+
+	return &ZFSCollector{
+		CollectInterval: 10 * time.Second,
+		ARCStatsPath:    "/proc/spl/kstat/zfs/arcstats",
+		Zpool:           "zpool",
+		Timeout:         5 * time.Second,
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured ZFSStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *ZFSCollector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the stats of ZFS.
+func (c *ZFSCollector) Once() ZFSStats {
+	return c.collectStats()
+}
+
+func (c *ZFSCollector) collectStats() ZFSStats {
+	stats := ZFSStats{Pools: make(map[string]ZFSPoolStat)}
+
+	if arc, err := readARCStats(c.ARCStatsPath); err == nil {
+		stats.ARCSize = arc["size"]
+		stats.ARCMax = arc["c_max"]
+		hits, misses := arc["hits"], arc["misses"]
+		if c.collected {
+			stats.ARCHits, _ = counter.Delta(hits, c.prevHits)
+			stats.ARCMisses, _ = counter.Delta(misses, c.prevMisses)
+		}
+		c.prevHits, c.prevMisses = hits, misses
+		c.collected = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, c.Zpool, "list", "-Hp", "-o", "name,health,frag,size,alloc,free").Output(); err == nil {
+		stats.Pools = parseZpoolList(out)
+	}
+
+	return stats
+}
+
+// readARCStats reads the numeric kstats of the ARC, which are lines of "name type data" after two header lines.
+func readARCStats(path string) (map[string]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[2], 10, 64); err == nil {
+			stats[fields[0]] = v
+		}
+	}
+	return stats, nil
+}
+
+// parseZpoolList parses the tab separated output of `zpool list -Hp -o name,health,frag,size,alloc,free`.
+// The fragmentation is "-" for pools without free space maps.
+func parseZpoolList(out []byte) map[string]ZFSPoolStat {
+	pools := make(map[string]ZFSPoolStat)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 {
+			continue
+		}
+
+		var pool ZFSPoolStat
+		pool.Health = fields[1]
+		pool.Fragmentation, _ = strconv.ParseFloat(strings.TrimSuffix(fields[2], "%"), 64)
+		pool.Size, _ = strconv.ParseUint(fields[3], 10, 64)
+		pool.Allocated, _ = strconv.ParseUint(fields[4], 10, 64)
+		pool.Free, _ = strconv.ParseUint(fields[5], 10, 64)
+		pools[fields[0]] = pool
+	}
+	return pools
+}
+
+// ZFSStats represents the stats of the ARC and the pools of ZFS.
+type ZFSStats struct {
+	// ARCSize and ARCMax are the current and the maximum size of the ARC in bytes.
+	ARCSize uint64
+	ARCMax  uint64
+	// ARCHits and ARCMisses are the hits and misses of the ARC since the previous collection.
+	ARCHits   uint64
+	ARCMisses uint64
+
+	// Pools are the stats of the pools keyed by name.
+	Pools map[string]ZFSPoolStat
+}
+
+// ZFSPoolStat represents the stats of a ZFS pool.
+type ZFSPoolStat struct {
+	// Health is the health of the pool, e.g. ONLINE or DEGRADED.
+	Health string
+	// Fragmentation is the percentage of fragmented free space.
+	Fragmentation float64
+	Size          uint64
+	Allocated     uint64
+	Free          uint64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as zfs.arc.<metric> and zfs.pool.<name>.<metric>.
+// The health of a pool is exported as healthy, 1 if it is ONLINE.
+func (s *ZFSStats) Values() map[string]interface{} {
+	values := map[string]interface{}{
+		"zfs.arc.size":   s.ARCSize,
+		"zfs.arc.max":    s.ARCMax,
+		"zfs.arc.hits":   s.ARCHits,
+		"zfs.arc.misses": s.ARCMisses,
+	}
+	if total := s.ARCHits + s.ARCMisses; total > 0 {
+		values["zfs.arc.hit_ratio"] = float64(s.ARCHits) / float64(total)
+	}
+
+	for name, pool := range s.Pools {
+		var healthy int64
+		if pool.Health == "ONLINE" {
+			healthy = 1
+		}
+
+		prefix := "zfs.pool." + name + "."
+		values[prefix+"healthy"] = healthy
+		values[prefix+"fragmentation"] = pool.Fragmentation
+		values[prefix+"size"] = pool.Size
+		values[prefix+"allocated"] = pool.Allocated
+		values[prefix+"free"] = pool.Free
+	}
+	return values
+}
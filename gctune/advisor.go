@@ -0,0 +1,199 @@
+// Package gctune provides an advisor which suggests GC parameters from observed runtime stats,
+// and optionally applies them via debug.SetGCPercent and debug.SetMemoryLimit.
+package gctune
+
+import (
+	"math"
+	"os"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/rmetric"
+)
+
+// Advisor suggests GOGC and the memory limit from allocation rates and GC frequency.
+// It is safe for use from multiple go routines.
+type Advisor struct {
+	// MaxGCPerMinute is the acceptable number of GC cycles per minute. GOGC is
+	// suggested to be increased if GC runs more frequently. Defaults to 60.
+	MaxGCPerMinute float64
+
+	// MaxGCPercent is the upper bound of the suggested GOGC when raising it, a higher GOGC set
+	// by the user is never lowered to it. Defaults to 400.
+	MaxGCPercent int
+
+	// MemoryLimit is the memory available to the process in bytes, e.g. the limit of the container.
+	// If it is set, a memory limit with 10% headroom is suggested and GOGC is suggested to be
+	// decreased if the next heap goal would exceed it.
+	MemoryLimit int64
+
+	// Apply determines whether the suggested parameters are applied. Defaults to false.
+	Apply bool
+
+	mu       sync.Mutex
+	prev     *rmetric.RuntimeStats
+	prevTime time.Time
+	advice   Advice
+}
+
+// NewAdvisor creates an Advisor with default settings.
+func NewAdvisor() *Advisor {
+	return &Advisor{
+		MaxGCPerMinute: 60,
+		MaxGCPercent:   400,
+	}
+}
+
+// RuntimeStatsHandler feeds runtime stats into the advisor. It can be used as a rmetric.RuntimeStatsHandler.
+// The GC and memory stats of rmetric.Collector must be enabled.
+func (a *Advisor) RuntimeStatsHandler(stats rmetric.RuntimeStats) {
+	a.Observe(stats, time.Now())
+}
+
+// Observe feeds runtime stats collected at t into the advisor and returns the new advice.
+func (a *Advisor) Observe(stats rmetric.RuntimeStats, t time.Time) Advice {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	prev, prevTime := a.prev, a.prevTime
+	a.prev, a.prevTime = &stats, t
+	if prev == nil || !t.After(prevTime) {
+		return a.advice
+	}
+
+	elapsed := t.Sub(prevTime)
+	advice := Advice{
+		GCPerMinute:      float64(stats.NumGC-prev.NumGC) / elapsed.Minutes(),
+		AllocRate:        float64(stats.TotalAlloc-prev.TotalAlloc) / elapsed.Seconds(),
+		CurrentGCPercent: currentGCPercent(),
+	}
+	advice.SuggestedGCPercent = a.suggestGCPercent(advice.CurrentGCPercent, advice.GCPerMinute, stats.HeapAlloc)
+	if a.MemoryLimit > 0 {
+		advice.SuggestedMemoryLimit = a.MemoryLimit / 10 * 9
+	}
+
+	if a.Apply {
+		if advice.SuggestedGCPercent != advice.CurrentGCPercent {
+			debug.SetGCPercent(advice.SuggestedGCPercent)
+			advice.Applied = true
+		}
+		// a negative limit reads the current limit without changing it
+		if advice.SuggestedMemoryLimit > 0 && advice.SuggestedMemoryLimit != debug.SetMemoryLimit(-1) {
+			debug.SetMemoryLimit(advice.SuggestedMemoryLimit)
+			advice.Applied = true
+		}
+	}
+
+	a.advice = advice
+	return advice
+}
+
+// Advice returns the latest advice.
+func (a *Advisor) Advice() Advice {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.advice
+}
+
+func (a *Advisor) suggestGCPercent(current int, gcPerMinute float64, heapAlloc int64) int {
+	if current <= 0 {
+		// GC is disabled, leave it to the user.
+		return current
+	}
+
+	suggested := current
+	if a.MaxGCPerMinute > 0 && gcPerMinute > a.MaxGCPerMinute {
+		suggested = int(math.Ceil(float64(current) * gcPerMinute / a.MaxGCPerMinute))
+	}
+	if a.MaxGCPercent > 0 && suggested > current && suggested > a.MaxGCPercent {
+		suggested = a.MaxGCPercent
+		if suggested < current {
+			suggested = current
+		}
+	}
+
+	// the next heap goal is about heapAlloc * (1 + GOGC/100), keep it under the limit
+	if a.MemoryLimit > 0 && heapAlloc > 0 {
+		limit := float64(a.MemoryLimit) / 10 * 9
+		if float64(heapAlloc)*(1+float64(suggested)/100) > limit {
+			suggested = int((limit/float64(heapAlloc) - 1) * 100)
+			if suggested < 10 {
+				suggested = 10
+			}
+		}
+	}
+
+	return suggested
+}
+
+// gogcSample is the runtime/metrics sample of GOGC, available since go 1.21.
+const gogcSample = "/gc/gogc:percent"
+
+var gogcSupported = func() bool {
+	for _, d := range metrics.All() {
+		if d.Name == gogcSample {
+			return true
+		}
+	}
+	return false
+}()
+
+// currentGCPercent returns the current GOGC, negative if the GC is off. It reads runtime/metrics
+// instead of debug.SetGCPercent, which would change the setting for a moment. Older runtimes fall
+// back to the GOGC environment variable, missing the changes by debug.SetGCPercent.
+func currentGCPercent() int {
+	if gogcSupported {
+		s := []metrics.Sample{{Name: gogcSample}}
+		metrics.Read(s)
+		if s[0].Value.Kind() == metrics.KindUint64 {
+			// GOGC=off is reported as -1 converted to uint64
+			return int(int64(s[0].Value.Uint64()))
+		}
+	}
+
+	switch v := os.Getenv("GOGC"); v {
+	case "":
+		return 100
+	case "off":
+		return -1
+	default:
+		if p, err := strconv.Atoi(v); err == nil {
+			return p
+		}
+		return 100
+	}
+}
+
+// Advice represents the suggested GC parameters.
+type Advice struct {
+	// GCPerMinute is the observed number of GC cycles per minute.
+	GCPerMinute float64
+	// AllocRate is the observed allocation rate in bytes per second.
+	AllocRate float64
+
+	CurrentGCPercent     int
+	SuggestedGCPercent   int
+	SuggestedMemoryLimit int64
+
+	// Applied reports whether the suggestion has been applied, i.e. GOGC or the memory limit has been changed.
+	Applied bool
+}
+
+// Values returns metrics which you can write into TSDB.
+func (a *Advice) Values() map[string]interface{} {
+	var applied int64
+	if a.Applied {
+		applied = 1
+	}
+	return map[string]interface{}{
+		"gc.advice.gc_per_minute":          a.GCPerMinute,
+		"gc.advice.alloc_rate":             a.AllocRate,
+		"gc.advice.gogc.current":           int64(a.CurrentGCPercent),
+		"gc.advice.gogc.suggested":         int64(a.SuggestedGCPercent),
+		"gc.advice.memory_limit.suggested": a.SuggestedMemoryLimit,
+		"gc.advice.applied":                applied,
+	}
+}
@@ -0,0 +1,80 @@
+package gctune
+
+import (
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdvisor(t *testing.T) {
+	old := debug.SetGCPercent(100)
+	defer debug.SetGCPercent(old)
+
+	a := NewAdvisor()
+	now := time.Now()
+	a.Observe(rmetric.RuntimeStats{NumGC: 0, TotalAlloc: 0}, now)
+	advice := a.Observe(rmetric.RuntimeStats{NumGC: 240, TotalAlloc: 60 << 20, HeapAlloc: 1 << 20}, now.Add(time.Minute))
+
+	assert.Equal(t, 240.0, advice.GCPerMinute)
+	assert.Equal(t, float64(1<<20), advice.AllocRate)
+	assert.Equal(t, 100, advice.CurrentGCPercent)
+	assert.Equal(t, 400, advice.SuggestedGCPercent)
+	assert.False(t, advice.Applied)
+	assert.Equal(t, advice, a.Advice())
+	assert.Equal(t, 100, currentGCPercent())
+}
+
+func TestAdvisorAboveMax(t *testing.T) {
+	old := debug.SetGCPercent(800)
+	defer debug.SetGCPercent(old)
+
+	a := NewAdvisor()
+	a.Apply = true
+	now := time.Now()
+	a.Observe(rmetric.RuntimeStats{}, now)
+	advice := a.Observe(rmetric.RuntimeStats{NumGC: 240, HeapAlloc: 1 << 20}, now.Add(time.Minute))
+
+	// a GOGC set above MaxGCPercent on purpose isn't lowered
+	assert.Equal(t, 800, advice.CurrentGCPercent)
+	assert.Equal(t, 800, advice.SuggestedGCPercent)
+	assert.False(t, advice.Applied)
+	assert.Equal(t, 800, currentGCPercent())
+}
+
+func TestAdvisorMemoryLimit(t *testing.T) {
+	old := debug.SetGCPercent(100)
+	defer debug.SetGCPercent(old)
+	oldLimit := debug.SetMemoryLimit(-1)
+	defer debug.SetMemoryLimit(oldLimit)
+
+	a := NewAdvisor()
+	a.MemoryLimit = 1000 << 20
+	a.Apply = true
+
+	now := time.Now()
+	a.Observe(rmetric.RuntimeStats{}, now)
+	advice := a.Observe(rmetric.RuntimeStats{NumGC: 600, HeapAlloc: 300 << 20}, now.Add(time.Minute))
+
+	assert.Equal(t, int64(900<<20), advice.SuggestedMemoryLimit)
+	assert.Equal(t, 200, advice.SuggestedGCPercent)
+	assert.True(t, advice.Applied)
+	assert.Equal(t, 200, currentGCPercent())
+	assert.Equal(t, int64(900<<20), debug.SetMemoryLimit(-1))
+	assert.Equal(t, int64(1), advice.Values()["gc.advice.applied"])
+
+	// nothing to change
+	advice = a.Observe(rmetric.RuntimeStats{NumGC: 600, HeapAlloc: 300 << 20}, now.Add(2*time.Minute))
+	assert.Equal(t, 200, advice.SuggestedGCPercent)
+	assert.False(t, advice.Applied)
+}
+
+func TestCurrentGCPercentOff(t *testing.T) {
+	old := debug.SetGCPercent(-1)
+	defer debug.SetGCPercent(old)
+
+	assert.True(t, currentGCPercent() < 0)
+	assert.Equal(t, -1, debug.SetGCPercent(-1))
+}
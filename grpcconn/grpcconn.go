@@ -0,0 +1,144 @@
+// Package grpcconn provides per-target connectivity metrics of gRPC client connections: the current
+// state, the numbers of transitions into each state, e.g. READY and TRANSIENT_FAILURE, and the number
+// of resolver updates, so flapping backends are visible.
+//
+// The package doesn't depend on grpc-go: *grpc.ClientConn satisfies Conn, so watch a connection with
+//
+//	conns := grpcconn.New()
+//	cc, _ := grpc.Dial("dns:///orders:443", opts...)
+//	go grpcconn.Watch[connectivity.State](ctx, conns, "orders", cc)
+//
+// and report resolver updates from a wrapping resolver.ClientConn by calling conns.ResolverUpdated("orders")
+// from its UpdateState.
+package grpcconn
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Ready is the name of the ready state of gRPC connectivity.State.
+const Ready = "READY"
+
+// Conn is a client connection whose connectivity state can be watched, like *grpc.ClientConn
+// with S being connectivity.State.
+type Conn[S fmt.Stringer] interface {
+	GetState() S
+	WaitForStateChange(ctx context.Context, sourceState S) bool
+}
+
+// Watch records the states of conn as target until ctx is done. It blocks, so call it in its own goroutine.
+func Watch[S fmt.Stringer](ctx context.Context, c *Conns, target string, conn Conn[S]) {
+	state := conn.GetState()
+	c.SetState(target, state)
+	for conn.WaitForStateChange(ctx, state) {
+		state = conn.GetState()
+		c.SetState(target, state)
+	}
+}
+
+// targetStat is the state and the cumulative counters of a target.
+type targetStat struct {
+	state           string
+	entered         map[string]int64
+	resolverUpdates int64
+}
+
+// Conns records the connectivity of client connections by target. It is safe for use from multiple go routines.
+type Conns struct {
+	mu      sync.Mutex
+	targets map[string]*targetStat
+}
+
+// New creates Conns without targets.
+func New() *Conns {
+	return &Conns{targets: make(map[string]*targetStat)}
+}
+
+func (c *Conns) target(name string) *targetStat {
+	t, ok := c.targets[name]
+	if !ok {
+		t = &targetStat{entered: make(map[string]int64)}
+		c.targets[name] = t
+	}
+	return t
+}
+
+// SetState records the current state of the connection to target. A change counts as a transition into s.
+func (c *Conns) SetState(target string, s fmt.Stringer) {
+	state := s.String()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := c.target(target)
+	if t.state == state {
+		return
+	}
+	t.state = state
+	t.entered[state]++
+}
+
+// ResolverUpdated records that the resolver of target has updated its addresses or service config.
+func (c *Conns) ResolverUpdated(target string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.target(target).resolverUpdates++
+}
+
+// Stats returns the current stats of the targets.
+func (c *Conns) Stats() ConnStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := ConnStats{Targets: make(map[string]TargetStat, len(c.targets))}
+	for name, t := range c.targets {
+		entered := make(map[string]int64, len(t.entered))
+		for s, n := range t.entered {
+			entered[s] = n
+		}
+		stats.Targets[name] = TargetStat{
+			State:           t.state,
+			Entered:         entered,
+			ResolverUpdates: t.resolverUpdates,
+		}
+	}
+	return stats
+}
+
+// ConnStats represents the connectivity of client connections keyed by target.
+type ConnStats struct {
+	Targets map[string]TargetStat
+}
+
+// TargetStat represents the connectivity of the connection to a target.
+type TargetStat struct {
+	// State is the current state, e.g. "READY", or "" if it hasn't been reported.
+	State string
+	// Entered is the cumulative number of transitions into each state.
+	Entered map[string]int64
+	// ResolverUpdates is the cumulative number of resolver updates.
+	ResolverUpdates int64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as grpc.client.<target>.<metric>.
+// grpc.client.<target>.ready is 1 if the connection is ready and the transitions into a state are
+// keyed by the lower case state, e.g. grpc.client.<target>.transitions.transient_failure.
+func (s *ConnStats) Values() map[string]interface{} {
+	values := make(map[string]interface{})
+	for name, t := range s.Targets {
+		prefix := "grpc.client." + name + "."
+		var ready int64
+		if t.State == Ready {
+			ready = 1
+		}
+		values[prefix+"ready"] = ready
+		values[prefix+"resolver_updates"] = t.ResolverUpdates
+		for state, n := range t.Entered {
+			values[prefix+"transitions."+strings.ToLower(state)] = n
+		}
+	}
+	return values
+}
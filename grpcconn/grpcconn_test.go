@@ -0,0 +1,61 @@
+package grpcconn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type state int
+
+func (s state) String() string {
+	return [...]string{"IDLE", "CONNECTING", "READY", "TRANSIENT_FAILURE", "SHUTDOWN"}[s]
+}
+
+// fakeConn goes through the states and then blocks until ctx is done.
+type fakeConn struct {
+	states []state
+	i      int
+}
+
+func (c *fakeConn) GetState() state {
+	return c.states[c.i]
+}
+
+func (c *fakeConn) WaitForStateChange(ctx context.Context, s state) bool {
+	if c.i+1 < len(c.states) {
+		c.i++
+		return true
+	}
+	<-ctx.Done()
+	return false
+}
+
+func TestWatch(t *testing.T) {
+	c := New()
+	conn := &fakeConn{states: []state{0, 1, 2, 3, 1, 2, 3, 1, 2}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Watch[state](ctx, c, "orders", conn)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return c.Stats().Targets["orders"].State == Ready }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	c.ResolverUpdated("orders")
+
+	stats := c.Stats()
+	orders := stats.Targets["orders"]
+	assert.Equal(t, int64(3), orders.Entered["READY"])
+	assert.Equal(t, int64(2), orders.Entered["TRANSIENT_FAILURE"])
+	assert.Equal(t, int64(1), orders.ResolverUpdates)
+
+	values := stats.Values()
+	assert.Equal(t, int64(1), values["grpc.client.orders.ready"])
+	assert.Equal(t, int64(2), values["grpc.client.orders.transitions.transient_failure"])
+}
@@ -0,0 +1,232 @@
+// Package httpmetrics provides a middleware which counts the requests, server errors and the time spent
+// per route of HTTP servers, keeping the number of routes bounded.
+//
+// The route of a request is its route template, e.g. "/users/{id}", which is set by SetRoute from
+// a router or returned by Metrics.Route. Services without routers fall back on a Bucketer, which
+// templates identifiers in paths and puts the paths beyond its budget into "other" buckets.
+//
+//	m := httpmetrics.New()
+//	http.ListenAndServe(":8080", m.Handler(mux))
+package httpmetrics
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/sanitize"
+)
+
+// Metrics counts requests per route. It is safe for use from multiple go routines.
+type Metrics struct {
+	// Route, if not nil, returns the route of a request which hasn't been set by SetRoute.
+	Route RouteFunc
+	// Fallback returns the route of a request when neither SetRoute nor Route know it.
+	// Defaults to a Bucketer admitting 100 paths with 8 other buckets.
+	Fallback *Bucketer
+
+	// AccountResources, if true, makes the middleware account the heap bytes allocated and the goroutines
+	// started during each request, see RouteStat. It is experimental. Defaults to false.
+	AccountResources bool
+
+	mu     sync.Mutex
+	routes map[string]*RouteStat
+}
+
+// New creates a Metrics with the default Fallback.
+func New() *Metrics {
+	return &Metrics{
+		Fallback: NewBucketer(100, 8),
+		routes:   make(map[string]*RouteStat),
+	}
+}
+
+// Handler returns a middleware which counts the requests to next.
+func (m *Metrics) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, route := withRouteHolder(r)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		var before resources
+		if m.AccountResources {
+			before = readResources()
+		}
+		start := time.Now()
+		defer func() {
+			// a panicking handler is recorded as a server error, net/http aborts its response
+			p := recover()
+			status := sw.status
+			if p != nil {
+				status = http.StatusInternalServerError
+			}
+
+			var delta resources
+			if m.AccountResources {
+				delta = readResources().sub(before)
+			}
+			m.observe(m.route(r, *route), status, time.Since(start), delta)
+			if p != nil {
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(sw.wrap(), r)
+	})
+}
+
+func (m *Metrics) route(r *http.Request, route string) string {
+	if route == "" && m.Route != nil {
+		route = m.Route(r)
+	}
+	if route == "" {
+		route = m.Fallback.Route(r)
+	}
+	return route
+}
+
+func (m *Metrics) observe(route string, status int, d time.Duration, delta resources) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.routes[route]
+	if !ok {
+		s = &RouteStat{}
+		m.routes[route] = s
+	}
+	s.Requests++
+	if status >= 500 {
+		s.Errors++
+	}
+	s.Duration += d
+	s.AllocBytes += delta.allocBytes
+	s.Goroutines += delta.goroutines
+}
+
+// Stats returns the cumulative stats of the routes.
+func (m *Metrics) Stats() HTTPStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := HTTPStats{
+		Routes:     make(map[string]RouteStat, len(m.routes)),
+		Overflowed: m.Fallback.Overflowed(),
+		Resources:  m.AccountResources,
+	}
+	for route, s := range m.routes {
+		stats.Routes[route] = *s
+	}
+	return stats
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// wrap returns w as a ResponseWriter implementing http.Flusher and http.Hijacker if the underlying
+// ResponseWriter does, so handlers asserting them, e.g. for streaming or websockets, keep working.
+func (w *statusWriter) wrap() http.ResponseWriter {
+	_, flusher := w.ResponseWriter.(http.Flusher)
+	_, hijacker := w.ResponseWriter.(http.Hijacker)
+	switch {
+	case flusher && hijacker:
+		return struct {
+			*statusWriter
+			http.Flusher
+			http.Hijacker
+		}{w, flushWriter{w}, hijackWriter{w}}
+	case flusher:
+		return struct {
+			*statusWriter
+			http.Flusher
+		}{w, flushWriter{w}}
+	case hijacker:
+		return struct {
+			*statusWriter
+			http.Hijacker
+		}{w, hijackWriter{w}}
+	}
+	return w
+}
+
+// flushWriter implements http.Flusher for a statusWriter whose ResponseWriter is a http.Flusher.
+type flushWriter struct{ w *statusWriter }
+
+func (f flushWriter) Flush() {
+	if !f.w.wroteHeader {
+		f.w.WriteHeader(http.StatusOK)
+	}
+	f.w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// hijackWriter implements http.Hijacker for a statusWriter whose ResponseWriter is a http.Hijacker.
+type hijackWriter struct{ w *statusWriter }
+
+func (h hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// RouteStat represents the cumulative stats of a route.
+type RouteStat struct {
+	Requests int64
+	// Errors is the number of responses with status 5xx.
+	Errors int64
+	// Duration is the total time spent handling the requests.
+	Duration time.Duration
+
+	// AllocBytes and Goroutines are the heap bytes allocated and the change of the number of goroutines
+	// during the requests if Metrics.AccountResources is set. They are approximations: they are
+	// measured process-wide around the handler, so concurrent requests and background work are
+	// accounted too. Compare routes over many requests rather than reading single values.
+	AllocBytes int64
+	Goroutines int64
+}
+
+// HTTPStats represents the stats of the routes keyed by route.
+type HTTPStats struct {
+	Routes map[string]RouteStat
+	// Overflowed is the number of requests whose paths were put into the other buckets by the Fallback.
+	Overflowed int64
+	// Resources reports whether AllocBytes and Goroutines of the routes have been accounted.
+	Resources bool
+}
+
+// Values returns metrics which you can write into TSDB, keyed as http.route.<route>.requests, .errors and .duration,
+// together with .alloc_bytes and .goroutines if the resources have been accounted.
+func (s *HTTPStats) Values() map[string]interface{} {
+	return s.SanitizedValues(sanitize.Raw)
+}
+
+// SanitizedValues returns the metrics like Values, but the routes are sanitized by sf,
+// e.g. sanitize.Graphite turns "http.route./users/:id.requests" into "http.route.users__id.requests".
+func (s *HTTPStats) SanitizedValues(sf sanitize.Func) map[string]interface{} {
+	values := make(map[string]interface{}, 3*len(s.Routes)+1)
+	for route, stat := range s.Routes {
+		prefix := "http.route." + sf(route) + "."
+		values[prefix+"requests"] = stat.Requests
+		values[prefix+"errors"] = stat.Errors
+		values[prefix+"duration"] = stat.Duration.Nanoseconds()
+		if s.Resources {
+			values[prefix+"alloc_bytes"] = stat.AllocBytes
+			values[prefix+"goroutines"] = stat.Goroutines
+		}
+	}
+	values["http.routes.overflowed"] = s.Overflowed
+	return values
+}
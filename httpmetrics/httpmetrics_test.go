@@ -0,0 +1,131 @@
+package httpmetrics
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallnest/go-app-metrics/sanitize"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplatePath(t *testing.T) {
+	assert.Equal(t, "/users/:id/orders", TemplatePath("/users/42/orders"))
+	assert.Equal(t, "/objects/:id", TemplatePath("/objects/123e4567-e89b-12d3-a456-426614174000"))
+	assert.Equal(t, "/commits/:id", TemplatePath("/commits/0123456789abcdef01"))
+	assert.Equal(t, "/feed/cafe", TemplatePath("/feed/cafe"))
+	assert.Equal(t, "/", TemplatePath(""))
+}
+
+func TestBucketer(t *testing.T) {
+	b := NewBucketer(2, 4)
+	route := func(path string) string {
+		return b.Route(httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, "/a", route("/a"))
+	assert.Equal(t, "/b/:id", route("/b/1"))
+	assert.Equal(t, "/b/:id", route("/b/2"))
+	other := route("/c")
+	assert.Contains(t, []string{"other.0", "other.1", "other.2", "other.3"}, other)
+	assert.Equal(t, other, route("/c"))
+	assert.Equal(t, int64(2), b.Overflowed())
+
+	assert.Equal(t, Other, NewBucketer(0, 1).Route(httptest.NewRequest("GET", "/", nil)))
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/routed/1" {
+			SetRoute(r, "/routed/{id}")
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	for _, path := range []string{"/users/1", "/users/2", "/routed/1", "/fail"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	stats := m.Stats()
+	assert.Equal(t, int64(2), stats.Routes["/users/:id"].Requests)
+	assert.Equal(t, int64(1), stats.Routes["/routed/{id}"].Requests)
+	assert.Equal(t, int64(1), stats.Routes["/fail"].Errors)
+
+	values := stats.SanitizedValues(sanitize.Graphite)
+	assert.Equal(t, int64(2), values["http.route.users__id.requests"])
+	assert.False(t, SetRoute(httptest.NewRequest("GET", "/", nil), "/"))
+}
+
+func TestHandlerPanic(t *testing.T) {
+	m := New()
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	})
+	assert.Equal(t, int64(1), m.Stats().Routes["/panic"].Errors)
+}
+
+// hijackRecorder is a ResponseRecorder which implements http.Hijacker.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	return nil, nil, nil
+}
+
+func TestHandlerInterfaces(t *testing.T) {
+	m := New()
+	var flusher, hijacker bool
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+		if hijacker {
+			w.(http.Hijacker).Hijack()
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.True(t, flusher)
+	assert.False(t, hijacker)
+
+	hr := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(hr, httptest.NewRequest("GET", "/", nil))
+	assert.True(t, flusher)
+	assert.True(t, hijacker)
+	assert.True(t, hr.hijacked)
+
+	h.ServeHTTP(struct{ http.ResponseWriter }{httptest.NewRecorder()}, httptest.NewRequest("GET", "/", nil))
+	assert.False(t, flusher)
+	assert.False(t, hijacker)
+}
+
+var sink []byte
+
+func TestAccountResources(t *testing.T) {
+	m := New()
+	m.AccountResources = true
+	done := make(chan struct{})
+	defer close(done)
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sink = make([]byte, 1<<20)
+		go func() { <-done }()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/upload", nil))
+
+	stats := m.Stats()
+	assert.True(t, stats.Routes["/upload"].AllocBytes >= 1<<20)
+	assert.True(t, stats.Routes["/upload"].Goroutines >= 1)
+	assert.Contains(t, stats.Values(), "http.route./upload.alloc_bytes")
+}
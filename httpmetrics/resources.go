@@ -0,0 +1,35 @@
+package httpmetrics
+
+import "runtime/metrics"
+
+// resources is a reading of the process-wide counters used to account the resources of requests.
+type resources struct {
+	allocBytes int64
+	goroutines int64
+}
+
+// readResources reads the counters from runtime/metrics, which, unlike runtime.ReadMemStats,
+// doesn't stop the world.
+func readResources() resources {
+	samples := []metrics.Sample{
+		{Name: "/gc/heap/allocs:bytes"},
+		{Name: "/sched/goroutines:goroutines"},
+	}
+	metrics.Read(samples)
+
+	var r resources
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		r.allocBytes = int64(samples[0].Value.Uint64())
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		r.goroutines = int64(samples[1].Value.Uint64())
+	}
+	return r
+}
+
+func (r resources) sub(prev resources) resources {
+	return resources{
+		allocBytes: r.allocBytes - prev.allocBytes,
+		goroutines: r.goroutines - prev.goroutines,
+	}
+}
@@ -0,0 +1,125 @@
+package httpmetrics
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RouteFunc returns the route template of a request, e.g. "/users/{id}", or "" if it doesn't know it.
+type RouteFunc func(r *http.Request) string
+
+type routeKey struct{}
+
+// SetRoute sets the route template of a request handled by Metrics.Handler. Routers which only know
+// the route after matching call it from the matched handler or a router middleware. It returns
+// false if the request isn't handled by Metrics.Handler.
+func SetRoute(r *http.Request, route string) bool {
+	p, ok := r.Context().Value(routeKey{}).(*string)
+	if ok {
+		*p = route
+	}
+	return ok
+}
+
+func withRouteHolder(r *http.Request) (*http.Request, *string) {
+	p := new(string)
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, p)), p
+}
+
+// Other is the route of the paths beyond the budget of a Bucketer.
+const Other = "other"
+
+// Bucketer maps request paths to a bounded number of routes for services without routers.
+// Path segments which look like identifiers are replaced by TemplatePath, then the first MaxPaths
+// distinct paths are admitted as routes and the others are hashed into the "other" buckets.
+// It is safe for use from multiple go routines.
+type Bucketer struct {
+	maxPaths     int
+	otherBuckets int
+
+	mu         sync.Mutex
+	admitted   map[string]struct{}
+	overflowed int64
+}
+
+// NewBucketer creates a Bucketer admitting maxPaths distinct paths. The other paths are hashed into
+// otherBuckets buckets named other.0, other.1 and so on, or into the single bucket "other" if
+// otherBuckets is less than 2, so a few hot unknown paths stay distinguishable.
+func NewBucketer(maxPaths, otherBuckets int) *Bucketer {
+	return &Bucketer{
+		maxPaths:     maxPaths,
+		otherBuckets: otherBuckets,
+		admitted:     make(map[string]struct{}),
+	}
+}
+
+// Route returns the route of r.
+func (b *Bucketer) Route(r *http.Request) string {
+	path := TemplatePath(r.URL.Path)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.admitted[path]; ok {
+		return path
+	}
+	if len(b.admitted) < b.maxPaths {
+		b.admitted[path] = struct{}{}
+		return path
+	}
+	b.overflowed++
+
+	if b.otherBuckets < 2 {
+		return Other
+	}
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return Other + "." + strconv.Itoa(int(h.Sum32()%uint32(b.otherBuckets)))
+}
+
+// Overflowed returns the number of requests whose paths were beyond the budget.
+func (b *Bucketer) Overflowed() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.overflowed
+}
+
+// TemplatePath replaces the segments of path which look like identifiers, i.e. numbers, UUIDs
+// and hexadecimal strings of at least 16 digits, with ":id", e.g. "/users/42/orders" becomes "/users/:id/orders".
+func TemplatePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if isID(s) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isID(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	digits, hex := true, true
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+		case c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+			digits = false
+		case c == '-' && len(s) == 36:
+			// UUID
+			digits = false
+		default:
+			return false
+		}
+	}
+	return digits || hex && len(s) >= 16
+}
@@ -0,0 +1,38 @@
+// Package counter provides wrap-aware arithmetic of cumulative counters, such as the bytes sent by
+// a network interface, whose deltas must not underflow when the counters wrap or reset.
+package counter
+
+import "math"
+
+// wrapFraction is the fraction of the range of a counter above which a previous value followed
+// by a lower one is considered a wrap instead of a reset.
+const wrapFraction = 0.75
+
+// Sub returns a - b, or 0 if b is greater than a.
+func Sub(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+// Delta returns the increase of a cumulative counter from prev to cur.
+//
+// A cur lower than prev means the counter has wrapped or has been reset, e.g. by re-creating a network
+// interface. It is considered a wrap of a 32-bit or 64-bit counter if prev is in the top quarter of
+// the range of the counter, and the delta includes the increase up to the maximum. Otherwise it is
+// considered a reset, cur is the increase since the reset and reset is true.
+func Delta(cur, prev uint64) (delta uint64, reset bool) {
+	if cur >= prev {
+		return cur - prev, false
+	}
+
+	switch {
+	case prev <= math.MaxUint32 && float64(prev) >= wrapFraction*math.MaxUint32 && cur <= math.MaxUint32:
+		return math.MaxUint32 - prev + cur + 1, false
+	case float64(prev) >= wrapFraction*math.MaxUint64:
+		return math.MaxUint64 - prev + cur + 1, false
+	default:
+		return cur, true
+	}
+}
@@ -0,0 +1,37 @@
+package counter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSub(t *testing.T) {
+	assert.Equal(t, uint64(2), Sub(5, 3))
+	assert.Equal(t, uint64(0), Sub(3, 5))
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		cur, prev uint64
+		delta     uint64
+		reset     bool
+	}{
+		{"increase", 150, 100, 50, false},
+		{"unchanged", 100, 100, 0, false},
+		{"32-bit wrap", 10, math.MaxUint32 - 9, 20, false},
+		{"64-bit wrap", 10, math.MaxUint64 - 9, 20, false},
+		{"64-bit wrap beyond 32 bits", 1 << 40, math.MaxUint64, 1<<40 + 1, false},
+		{"reset", 30, 100000, 30, true},
+		{"reset of a large 64-bit counter", 30, 1 << 40, 30, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, reset := Delta(tt.cur, tt.prev)
+			assert.Equal(t, tt.delta, delta)
+			assert.Equal(t, tt.reset, reset)
+		})
+	}
+}
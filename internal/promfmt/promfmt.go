@@ -0,0 +1,229 @@
+// Package promfmt maps the dotted metric keys of the runtime and system stats to Prometheus metric
+// names with labels, so the exporters of the Prometheus formats name the metrics the same way.
+package promfmt
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/smallnest/go-app-metrics/internal/rollup"
+	"github.com/smallnest/go-app-metrics/internal/value"
+	"github.com/smallnest/go-app-metrics/metadata"
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/sanitize"
+	"github.com/smallnest/go-app-metrics/system"
+)
+
+// Sample is a value of a metric with labels.
+type Sample struct {
+	Name string
+	Help string
+	// Labels are the names and values of the labels, sorted by name.
+	Labels [][2]string
+	Value  float64
+}
+
+// family is a group of keys which embed a name, such as disk.<partition>.total, exported with the name as a label.
+type family struct {
+	prefix string
+	label  string
+	// metric replaces prefix in the metric names if not empty, so they don't clash with the unlabeled
+	// metrics of the prefix, e.g. cpu.core0.user becomes cpu.core.user while cpu.user is the aggregate.
+	metric string
+}
+
+var systemFamilies = []family{
+	{prefix: "cpu.", label: "core", metric: "cpu.core."},
+	{prefix: "disk.", label: "partition"},
+	{prefix: "disk_io.", label: "device"},
+	{prefix: "net.", label: "interface"},
+}
+
+// Runtime returns the samples of the runtime stats named <namespace>_runtime_<key>, and
+// <namespace>_runtime_info with the tags, such as go_version, as labels.
+func Runtime(namespace string, s *rmetric.RuntimeStats) []Sample {
+	prefix := namespace + "_runtime_"
+	var samples []Sample
+	for k, v := range s.Values() {
+		if sample, ok := newSample(prefix, k, k, v, metadata.Runtime); ok {
+			samples = append(samples, sample)
+		}
+	}
+
+	info := Sample{Name: prefix + "info", Help: "Information about the go runtime.", Value: 1}
+	for k, v := range s.Tags() {
+		info.Labels = append(info.Labels, [2]string{LabelName(k), v})
+	}
+	sortLabels(info.Labels)
+	samples = append(samples, info)
+
+	sortSamples(samples)
+	return samples
+}
+
+// System returns the samples of the system stats named <namespace>_system_<key>. Cores, partitions, disk
+// devices and network interfaces are the labels core, partition, device and interface instead of being
+// embedded in the names, and the rollup series are omitted because they can be summed by queries.
+// The samples of a partition also have its comma separated mountpoints as the label mountpoints.
+func System(namespace string, s *system.SystemStats) []Sample {
+	names := map[string][]string{
+		"cpu.":     make([]string, 0, len(s.CPUCoreStat)),
+		"disk.":    make([]string, 0, len(s.DiskStat)),
+		"disk_io.": make([]string, 0, len(s.DiskIOStat)),
+		"net.":     make([]string, 0, len(s.BandwidthStat)),
+	}
+	for core := range s.CPUCoreStat {
+		names["cpu."] = append(names["cpu."], core)
+	}
+	for partition := range s.DiskStat {
+		names["disk."] = append(names["disk."], partition)
+	}
+	for dev := range s.DiskIOStat {
+		names["disk_io."] = append(names["disk_io."], dev)
+	}
+	for n := range s.BandwidthStat {
+		names["net."] = append(names["net."], n)
+	}
+
+	prefix := namespace + "_system_"
+	var samples []Sample
+	for k, v := range s.Values() {
+		if isRollup(k) {
+			continue
+		}
+		sample, ok := labeledSample(prefix, k, v, names)
+		if ok && sample.Labels[0][0] == "partition" {
+			if mountpoints := s.DiskStat[sample.Labels[0][1]].Mountpoints; len(mountpoints) > 0 {
+				sample.Labels = append(sample.Labels, [2]string{"mountpoints", strings.Join(mountpoints, ",")})
+				sortLabels(sample.Labels)
+			}
+		}
+		if !ok {
+			sample, ok = newSample(prefix, k, k, v, metadata.System)
+		}
+		if ok {
+			samples = append(samples, sample)
+		}
+	}
+	sortSamples(samples)
+	return samples
+}
+
+// isRollup reports whether k is a rollup series of a family.
+func isRollup(k string) bool {
+	for _, f := range systemFamilies {
+		if strings.HasPrefix(k, f.prefix+rollup.Name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// labeledSample returns the sample of a key of a family, ok is false if the key doesn't belong to a family.
+func labeledSample(prefix, k string, v interface{}, names map[string][]string) (Sample, bool) {
+	for _, f := range systemFamilies {
+		name, ok := Name(k, f.prefix, names[f.prefix])
+		if !ok {
+			continue
+		}
+		metric := f.prefix
+		if f.metric != "" {
+			metric = f.metric
+		}
+		metric += k[len(f.prefix)+len(name)+1:]
+		sample, ok := newSample(prefix, metric, k, v, metadata.System)
+		sample.Labels = [][2]string{{f.label, name}}
+		return sample, ok
+	}
+	return Sample{}, false
+}
+
+// Name returns the name embedded in key after prefix, e.g. eth0 in net.eth0.bytes_sent, which is
+// the longest of names matching, so the VLAN eth0.100 isn't mistaken for eth0. ok is false if
+// key doesn't embed any of names.
+func Name(key, prefix string, names []string) (name string, ok bool) {
+	if !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+	for _, n := range names {
+		if len(n) > len(name) && strings.HasPrefix(key[len(prefix):], n+".") {
+			name, ok = n, true
+		}
+	}
+	return name, ok
+}
+
+// newSample returns the sample of metric, whose value v of key is described in r.
+// Durations and timestamps in nanoseconds are converted into seconds as Prometheus recommends.
+func newSample(prefix, metric, key string, v interface{}, r *metadata.Registry) (Sample, bool) {
+	f, ok := value.Float64(v)
+	if !ok {
+		return Sample{}, false
+	}
+
+	name := prefix + sanitize.PrometheusName(strings.ReplaceAll(metric, ".", "_"))
+	m, _ := r.Lookup(key)
+	switch m.Unit {
+	case metadata.Bytes:
+		if !strings.HasSuffix(name, "_bytes") {
+			name += "_bytes"
+		}
+	case metadata.Nanoseconds:
+		name += "_seconds"
+		f /= 1e9
+	case metadata.Timestamp:
+		name += "_timestamp_seconds"
+		f /= 1e9
+	}
+	return Sample{Name: name, Help: m.Help, Value: f}, true
+}
+
+// LabelName replaces characters which are not allowed in Prometheus label names with '_', e.g. go.os becomes go_os.
+func LabelName(name string) string {
+	return strings.ReplaceAll(sanitize.PrometheusName(name), ":", "_")
+}
+
+// AddLabels adds tags as labels to all samples, e.g. the dynamic tags of a snapshot.
+// A label which a sample already has is kept.
+func AddLabels(samples []Sample, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	for i := range samples {
+		s := &samples[i]
+		has := make(map[string]bool, len(s.Labels))
+		for _, l := range s.Labels {
+			has[l[0]] = true
+		}
+		for k, v := range tags {
+			if name := LabelName(k); !has[name] {
+				s.Labels = append(s.Labels, [2]string{name, v})
+			}
+		}
+		sortLabels(s.Labels)
+	}
+}
+
+func sortLabels(labels [][2]string) {
+	sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+}
+
+func sortSamples(samples []Sample) {
+	sort.SliceStable(samples, func(i, j int) bool {
+		if samples[i].Name != samples[j].Name {
+			return samples[i].Name < samples[j].Name
+		}
+		return labelString(samples[i].Labels) < labelString(samples[j].Labels)
+	})
+}
+
+func labelString(labels [][2]string) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l[0])
+		b.WriteByte('=')
+		b.WriteString(l[1])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package promfmt
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/system"
+	"github.com/stretchr/testify/assert"
+)
+
+func find(samples []Sample, name string, labels ...[2]string) (Sample, bool) {
+	for _, s := range samples {
+		if s.Name == name && len(s.Labels) == len(labels) && (len(labels) == 0 || assert.ObjectsAreEqual(labels, s.Labels)) {
+			return s, true
+		}
+	}
+	return Sample{}, false
+}
+
+func TestRuntime(t *testing.T) {
+	samples := Runtime("app", &rmetric.RuntimeStats{NumGoroutine: 8, PauseTotalNs: 2e9, Alloc: 10, Goos: "linux"})
+
+	s, ok := find(samples, "app_runtime_cpu_goroutines")
+	assert.True(t, ok)
+	assert.Equal(t, 8.0, s.Value)
+	assert.Equal(t, "Number of goroutines that currently exist.", s.Help)
+
+	s, _ = find(samples, "app_runtime_mem_gc_pause_total_seconds")
+	assert.Equal(t, 2.0, s.Value)
+	_, ok = find(samples, "app_runtime_mem_alloc_bytes")
+	assert.True(t, ok)
+
+	s, _ = find(samples, "app_runtime_info", [2]string{"go_arch", ""}, [2]string{"go_os", "linux"}, [2]string{"go_version", ""})
+	assert.Equal(t, 1.0, s.Value)
+}
+
+func TestSystem(t *testing.T) {
+	stats := system.SystemStats{
+		DiskStat:      map[string]system.DiskStat{"/": {Total: 10}, "/var/lib": {Free: 5, Mountpoints: []string{"/var/lib", "/srv"}}},
+		DiskIOStat:    map[string]system.DiskIOStat{"sda": {ReadTime: 2e9}},
+		BandwidthStat: map[string]system.BandwidthStat{"eth0": {BytesSent: 7}},
+	}
+	stats.CPUStat.User = 1.5
+	stats.CPUCoreStat = map[string]system.CPUStat{"core0": {User: 0.5}}
+	samples := System("app", &stats)
+
+	s, _ := find(samples, "app_system_cpu_user")
+	assert.Equal(t, 1.5, s.Value)
+	s, _ = find(samples, "app_system_cpu_core_user", [2]string{"core", "core0"})
+	assert.Equal(t, 0.5, s.Value)
+	s, _ = find(samples, "app_system_disk_total_bytes", [2]string{"partition", "/"})
+	assert.Equal(t, 10.0, s.Value)
+	s, _ = find(samples, "app_system_disk_free_bytes", [2]string{"mountpoints", "/var/lib,/srv"}, [2]string{"partition", "/var/lib"})
+	assert.Equal(t, 5.0, s.Value)
+	s, _ = find(samples, "app_system_disk_io_read_time_seconds", [2]string{"device", "sda"})
+	assert.Equal(t, 2.0, s.Value)
+	s, _ = find(samples, "app_system_net_bytes_sent_bytes", [2]string{"interface", "eth0"})
+	assert.Equal(t, 7.0, s.Value)
+
+	for _, s := range samples {
+		assert.NotEmpty(t, s.Name)
+		for _, l := range s.Labels {
+			assert.NotEqual(t, system.Rollup, l[1])
+		}
+	}
+}
+
+func TestSystemOverlappingNames(t *testing.T) {
+	stats := system.SystemStats{
+		DiskStat:      map[string]system.DiskStat{"/mnt/a": {Total: 1}, "/mnt/a.b": {Total: 2}},
+		BandwidthStat: map[string]system.BandwidthStat{"eth0": {BytesSent: 1}, "eth0.100": {BytesSent: 2}},
+	}
+	// the names are matched in map order, repeat to catch the order dependent matches
+	for i := 0; i < 20; i++ {
+		samples := System("app", &stats)
+		s, ok := find(samples, "app_system_net_bytes_sent_bytes", [2]string{"interface", "eth0.100"})
+		assert.True(t, ok)
+		assert.Equal(t, 2.0, s.Value)
+		s, _ = find(samples, "app_system_net_bytes_sent_bytes", [2]string{"interface", "eth0"})
+		assert.Equal(t, 1.0, s.Value)
+		s, ok = find(samples, "app_system_disk_total_bytes", [2]string{"partition", "/mnt/a.b"})
+		assert.True(t, ok)
+		assert.Equal(t, 2.0, s.Value)
+	}
+
+	name, ok := Name("net.eth0.100.bytes_sent", "net.", []string{"eth0", "eth0.100", "eth"})
+	assert.True(t, ok)
+	assert.Equal(t, "eth0.100", name)
+	_, ok = Name("net.lo.bytes_sent", "net.", []string{"eth0"})
+	assert.False(t, ok)
+}
+
+func TestAddLabels(t *testing.T) {
+	samples := []Sample{
+		{Name: "app_system_disk_free_bytes", Labels: [][2]string{{"partition", "/"}}},
+		{Name: "app_runtime_info", Labels: [][2]string{{"role", "runtime"}}},
+	}
+	AddLabels(samples, map[string]string{"role": "leader", "shard.id": "3"})
+	assert.Equal(t, [][2]string{{"partition", "/"}, {"role", "leader"}, {"shard_id", "3"}}, samples[0].Labels)
+	assert.Equal(t, [][2]string{{"role", "runtime"}, {"shard_id", "3"}}, samples[1].Labels)
+}
+
+func TestWriteText(t *testing.T) {
+	var b strings.Builder
+	err := WriteText(&b, []Sample{
+		{Name: "app_system_disk_free_bytes", Help: "Free space.", Labels: [][2]string{{"partition", "/"}}, Value: 5},
+		{Name: "app_system_disk_free_bytes", Help: "Free space.", Labels: [][2]string{{"partition", `a"b`}}, Value: 1.5e10},
+		{Name: "app_system_load_load1", Value: math.Inf(1)},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `# HELP app_system_disk_free_bytes Free space.
+# TYPE app_system_disk_free_bytes gauge
+app_system_disk_free_bytes{partition="/"} 5
+app_system_disk_free_bytes{partition="a\"b"} 1.5e+10
+# TYPE app_system_load_load1 gauge
+app_system_load_load1 +Inf
+`, b.String())
+}
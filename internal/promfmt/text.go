@@ -0,0 +1,59 @@
+package promfmt
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/smallnest/go-app-metrics/sanitize"
+)
+
+// ContentType is the content type of the Prometheus text exposition format written by WriteText.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WriteText writes samples sorted by name in the Prometheus text exposition format. The HELP and
+// TYPE lines are written once per metric, all metrics are gauges.
+func WriteText(w io.Writer, samples []Sample) error {
+	bw := bufio.NewWriter(w)
+	for i, s := range samples {
+		if i == 0 || samples[i-1].Name != s.Name {
+			if s.Help != "" {
+				bw.WriteString("# HELP " + s.Name + " " + helpReplacer.Replace(s.Help) + "\n")
+			}
+			bw.WriteString("# TYPE " + s.Name + " gauge\n")
+		}
+
+		bw.WriteString(s.Name)
+		if len(s.Labels) > 0 {
+			bw.WriteByte('{')
+			for j, l := range s.Labels {
+				if j > 0 {
+					bw.WriteByte(',')
+				}
+				bw.WriteString(l[0] + `="` + sanitize.PrometheusLabel(l[1]) + `"`)
+			}
+			bw.WriteByte('}')
+		}
+		bw.WriteByte(' ')
+		bw.WriteString(formatValue(s.Value))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
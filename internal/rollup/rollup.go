@@ -0,0 +1,7 @@
+// Package rollup defines the name of the rollup series of the system stats, so the packages
+// recognizing them don't have to depend on package system.
+package rollup
+
+// Name is the name used in keys of the series summing all partitions, disk devices and network interfaces,
+// e.g. disk.total.free and net.total.bytes_sent.
+const Name = "total"
@@ -0,0 +1,28 @@
+// Package safe provides calling of user handlers isolated from their panics.
+package safe
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned by Call if the handler panicked.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+// Call calls h with v and returns a *PanicError if h panics.
+func Call[T any](h func(T), v T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	h(v)
+	return nil
+}
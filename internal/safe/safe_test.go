@@ -0,0 +1,16 @@
+package safe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCall(t *testing.T) {
+	assert.Nil(t, Call(func(int) {}, 1))
+
+	err := Call(func(int) { panic("boom") }, 1)
+	assert.EqualError(t, err, "handler panicked: boom")
+	assert.Equal(t, "boom", err.(*PanicError).Value)
+	assert.NotEmpty(t, err.(*PanicError).Stack)
+}
@@ -0,0 +1,102 @@
+// Package value provides helpers to handle the dynamic values returned by Values().
+package value
+
+import (
+	"math"
+
+	"github.com/smallnest/go-app-metrics/metadata"
+)
+
+// KindOf returns the numeric kind of v.
+func KindOf(v interface{}) metadata.Kind {
+	switch v.(type) {
+	case int64, int, int32:
+		return metadata.Int
+	case uint64, uint, uint32:
+		return metadata.Uint
+	case float64, float32:
+		return metadata.Float
+	default:
+		return metadata.Unknown
+	}
+}
+
+// Float64 converts a metric value into float64. It returns false if v is not a numeric value.
+func Float64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// Int64 converts a metric value into int64. Values out of the range of int64 are saturated
+// to math.MaxInt64 or math.MinInt64, floats are truncated and NaN becomes 0.
+// It returns false if v is not a numeric value.
+func Int64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case uint64:
+		if n > math.MaxInt64 {
+			return math.MaxInt64, true
+		}
+		return int64(n), true
+	case uint:
+		if uint64(n) > math.MaxInt64 {
+			return math.MaxInt64, true
+		}
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case float64:
+		return floatToInt64(n), true
+	case float32:
+		return floatToInt64(float64(n)), true
+	default:
+		return 0, false
+	}
+}
+
+func floatToInt64(f float64) int64 {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	case f <= math.MinInt64:
+		return math.MinInt64
+	default:
+		return int64(f)
+	}
+}
+
+// Floats converts all numeric values into float64 and drops the others.
+func Floats(values map[string]interface{}) map[string]float64 {
+	m := make(map[string]float64, len(values))
+	for k, v := range values {
+		if f, ok := Float64(v); ok {
+			m[k] = f
+		}
+	}
+	return m
+}
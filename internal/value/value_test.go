@@ -0,0 +1,59 @@
+package value
+
+import (
+	"math"
+	"testing"
+
+	"github.com/smallnest/go-app-metrics/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFloat64(t *testing.T) {
+	for _, v := range []interface{}{int64(3), uint64(3), float64(3), 3, float32(3)} {
+		f, ok := Float64(v)
+		assert.True(t, ok)
+		assert.Equal(t, 3.0, f)
+	}
+
+	_, ok := Float64("3")
+	assert.False(t, ok)
+}
+
+func TestFloats(t *testing.T) {
+	m := Floats(map[string]interface{}{
+		"a": int64(1),
+		"b": uint64(2),
+		"c": "x",
+	})
+	assert.Equal(t, map[string]float64{"a": 1, "b": 2}, m)
+}
+
+func TestInt64(t *testing.T) {
+	cases := []struct {
+		v    interface{}
+		want int64
+	}{
+		{int64(-3), -3},
+		{uint64(3), 3},
+		{uint64(math.MaxUint64), math.MaxInt64},
+		{2.9, 2},
+		{math.Inf(1), math.MaxInt64},
+		{math.Inf(-1), math.MinInt64},
+		{math.NaN(), 0},
+	}
+	for _, c := range cases {
+		n, ok := Int64(c.v)
+		assert.True(t, ok)
+		assert.Equal(t, c.want, n, c.v)
+	}
+
+	_, ok := Int64("3")
+	assert.False(t, ok)
+}
+
+func TestKindOf(t *testing.T) {
+	assert.Equal(t, metadata.Int, KindOf(int64(1)))
+	assert.Equal(t, metadata.Uint, KindOf(uint64(1)))
+	assert.Equal(t, metadata.Float, KindOf(1.0))
+	assert.Equal(t, metadata.Unknown, KindOf("1"))
+}
@@ -0,0 +1,168 @@
+// Package job provides metrics of scheduled jobs, such as cron jobs: the last success time, the run
+// duration, the failure count and whether a run has been missed.
+//
+//	jobs := job.New()
+//	jobs.Register("cleanup", time.Hour)
+//	c.AddFunc("@hourly", jobs.Wrap("cleanup", cleanup))
+package job
+
+import (
+	"sync"
+	"time"
+)
+
+// Jobs records the runs of scheduled jobs. It is safe for use from multiple go routines.
+type Jobs struct {
+	mu   sync.Mutex
+	jobs map[string]*jobStat
+}
+
+// jobStat is the state of a job.
+type jobStat struct {
+	interval    time.Duration
+	registered  time.Time
+	lastStart   time.Time
+	lastSuccess time.Time
+	lastFailure time.Time
+	duration    time.Duration
+	runs        int64
+	failures    int64
+	running     int64
+}
+
+// New creates Jobs without jobs.
+func New() *Jobs {
+	return &Jobs{jobs: make(map[string]*jobStat)}
+}
+
+func (j *Jobs) job(name string) *jobStat {
+	s, ok := j.jobs[name]
+	if !ok {
+		s = &jobStat{registered: time.Now()}
+		j.jobs[name] = s
+	}
+	return s
+}
+
+// Register declares the job name which is expected to run every interval, so a missed run can be
+// detected even if the job has never run. Jobs which are run without being registered are not
+// checked for missed runs.
+func (j *Jobs) Register(name string, interval time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	s := j.job(name)
+	s.interval = interval
+	s.registered = time.Now()
+}
+
+// Run runs fn as the job name, records its duration and result and returns the error of fn.
+func (j *Jobs) Run(name string, fn func() error) error {
+	start := time.Now()
+	j.mu.Lock()
+	s := j.job(name)
+	s.lastStart = start
+	s.running++
+	j.mu.Unlock()
+
+	err := fn()
+
+	end := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s.running--
+	s.runs++
+	s.duration = end.Sub(start)
+	if err != nil {
+		s.failures++
+		s.lastFailure = end
+	} else {
+		s.lastSuccess = end
+	}
+	return err
+}
+
+// Wrap returns a func running fn as the job name, which can be passed to cron libraries.
+func (j *Jobs) Wrap(name string, fn func() error) func() {
+	return func() {
+		j.Run(name, fn)
+	}
+}
+
+// Stats returns the current stats of the jobs keyed by name.
+func (j *Jobs) Stats() JobStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	stats := JobStats{Jobs: make(map[string]JobStat, len(j.jobs))}
+	for name, s := range j.jobs {
+		stat := JobStat{
+			LastSuccess: s.lastSuccess,
+			LastFailure: s.lastFailure,
+			Duration:    s.duration,
+			Runs:        s.runs,
+			Failures:    s.failures,
+			Running:     s.running > 0,
+		}
+		if s.interval > 0 {
+			last := s.lastStart
+			if last.IsZero() {
+				last = s.registered
+			}
+			stat.Missed = now.Sub(last) > s.interval*3/2
+		}
+		stats.Jobs[name] = stat
+	}
+	return stats
+}
+
+// JobStats represents the stats of jobs keyed by name.
+type JobStats struct {
+	Jobs map[string]JobStat
+}
+
+// JobStat represents the stats of a job.
+type JobStat struct {
+	LastSuccess time.Time
+	LastFailure time.Time
+	// Duration is the duration of the last finished run.
+	Duration time.Duration
+	Runs     int64
+	Failures int64
+	Running  bool
+	// Missed reports whether a registered job hasn't started within 1.5 intervals since the previous
+	// start, or since it was registered if it has never run.
+	Missed bool
+}
+
+// Values returns metrics which you can write into TSDB, keyed as job.<name>.<metric>.
+// Times are unix seconds, 0 if never happened.
+func (s *JobStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Jobs)*8)
+	for name, stat := range s.Jobs {
+		prefix := "job." + name + "."
+		values[prefix+"last_success"] = unix(stat.LastSuccess)
+		values[prefix+"last_failure"] = unix(stat.LastFailure)
+		values[prefix+"duration"] = stat.Duration.Nanoseconds()
+		values[prefix+"runs"] = stat.Runs
+		values[prefix+"failures"] = stat.Failures
+		values[prefix+"running"] = boolInt(stat.Running)
+		values[prefix+"missed"] = boolInt(stat.Missed)
+	}
+	return values
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
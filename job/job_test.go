@@ -0,0 +1,36 @@
+package job
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobs(t *testing.T) {
+	jobs := New()
+	jobs.Register("cleanup", time.Hour)
+	jobs.Register("report", 10*time.Millisecond)
+
+	jobs.Wrap("cleanup", func() error { return nil })()
+	err := jobs.Run("cleanup", func() error { return errors.New("failed") })
+	assert.NotNil(t, err)
+	jobs.Run("adhoc", func() error { return nil })
+
+	time.Sleep(20 * time.Millisecond)
+	stats := jobs.Stats()
+
+	cleanup := stats.Jobs["cleanup"]
+	assert.Equal(t, int64(2), cleanup.Runs)
+	assert.Equal(t, int64(1), cleanup.Failures)
+	assert.False(t, cleanup.LastSuccess.IsZero())
+	assert.False(t, cleanup.Missed)
+	assert.True(t, stats.Jobs["report"].Missed)
+	assert.False(t, stats.Jobs["adhoc"].Missed)
+
+	values := stats.Values()
+	assert.Equal(t, int64(1), values["job.report.missed"])
+	assert.Equal(t, int64(0), values["job.report.last_success"])
+	assert.Equal(t, int64(1), values["job.cleanup.failures"])
+}
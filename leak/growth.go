@@ -0,0 +1,42 @@
+// Package leak provides heuristics to detect resource leaks of go applications.
+package leak
+
+// GrowthDetector flags a value which keeps growing in a sliding window of samples.
+// It is not safe for use from multiple go routines.
+type GrowthDetector struct {
+	// Window is the number of consecutive samples which must be increasing. Defaults to 6.
+	Window int
+
+	// MinGrowth is the minimal growth between the first and the last sample of the window.
+	MinGrowth float64
+
+	samples []float64
+}
+
+// Add adds a sample and reports whether the value grew monotonically in the whole window.
+func (d *GrowthDetector) Add(v float64) bool {
+	window := d.Window
+	if window < 2 {
+		window = 6
+	}
+
+	d.samples = append(d.samples, v)
+	if len(d.samples) > window {
+		d.samples = d.samples[len(d.samples)-window:]
+	}
+	if len(d.samples) < window {
+		return false
+	}
+
+	for i := 1; i < len(d.samples); i++ {
+		if d.samples[i] <= d.samples[i-1] {
+			return false
+		}
+	}
+	return d.samples[len(d.samples)-1]-d.samples[0] >= d.MinGrowth
+}
+
+// Reset discards all samples.
+func (d *GrowthDetector) Reset() {
+	d.samples = d.samples[:0]
+}
@@ -0,0 +1,29 @@
+package leak
+
+import "testing"
+
+func TestGrowthDetector(t *testing.T) {
+	d := &GrowthDetector{Window: 3, MinGrowth: 10}
+
+	for i, c := range []struct {
+		v    float64
+		want bool
+	}{
+		{1, false},
+		{5, false},
+		{11, true},
+		{12, false}, // 5 -> 12 is less than MinGrowth
+		{30, true},
+		{30, false},
+		{40, false},
+	} {
+		if got := d.Add(c.v); got != c.want {
+			t.Errorf("sample %d: got %v, want %v", i, got, c.want)
+		}
+	}
+
+	d.Reset()
+	if d.Add(100) {
+		t.Errorf("expected no growth after reset")
+	}
+}
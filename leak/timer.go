@@ -0,0 +1,155 @@
+package leak
+
+import (
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timerFuncs are the functions which allocate runtime timers.
+var timerFuncs = []string{
+	"time.NewTimer",
+	"time.NewTicker",
+	"time.After",
+	"time.AfterFunc",
+	"time.Tick",
+}
+
+// TimerStatsHandler represents a handler to handle stats after successfully gathering statistics
+type TimerStatsHandler func(TimerStats)
+
+// TimerCollector periodically estimates the number of live timers and tickers and
+// flags monotonic growth, which usually means leaked time.Tick/time.After patterns.
+//
+// The go runtime doesn't expose the number of timers, so the number is estimated from the
+// heap profile: it counts live objects allocated by time.NewTimer, time.NewTicker, time.After,
+// time.AfterFunc and time.Tick. It is approximate and depends on runtime.MemProfileRate.
+type TimerCollector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 1 minute.
+	CollectInterval time.Duration
+
+	// Detector decides whether the number of timers is growing.
+	Detector *GrowthDetector
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	mu           sync.Mutex
+	statsHandler TimerStatsHandler
+}
+
+// NewTimerCollector creates a new TimerCollector that will periodically output statistics to statsHandler.
+func NewTimerCollector(statsHandler TimerStatsHandler) *TimerCollector {
+	if statsHandler == nil {
+		statsHandler = func(TimerStats) {}
+	}
+
+	return &TimerCollector{
+		CollectInterval: time.Minute,
+		Detector:        &GrowthDetector{Window: 6},
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured TimerStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *TimerCollector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the statistics. It is safe for use from multiple go routines。
+func (c *TimerCollector) Once() TimerStats {
+	return c.collectStats()
+}
+
+func (c *TimerCollector) collectStats() TimerStats {
+	n := liveTimers()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return TimerStats{
+		Timers:  n,
+		Growing: c.Detector.Add(float64(n)),
+	}
+}
+
+// liveTimers estimates the number of live timers from the heap profile.
+func liveTimers() int64 {
+	var records []runtime.MemProfileRecord
+	n, ok := runtime.MemProfile(nil, true)
+	for !ok {
+		records = make([]runtime.MemProfileRecord, n+50)
+		n, ok = runtime.MemProfile(records, true)
+	}
+	records = records[:n]
+
+	rate := float64(runtime.MemProfileRate)
+	var total float64
+	for i := range records {
+		r := &records[i]
+		objects := r.InUseObjects()
+		if objects <= 0 || !allocatedByTimer(r.Stack()) {
+			continue
+		}
+
+		// scale the sampled objects like pprof does
+		scale := 1.0
+		if rate > 1 {
+			avgSize := float64(r.InUseBytes()) / float64(objects)
+			scale = 1 / (1 - math.Exp(-avgSize/rate))
+		}
+		total += float64(objects) * scale
+	}
+	return int64(total)
+}
+
+func allocatedByTimer(stack []uintptr) bool {
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+		for _, fn := range timerFuncs {
+			if frame.Function == fn || strings.HasPrefix(frame.Function, fn+".") {
+				return true
+			}
+		}
+		if !more {
+			return false
+		}
+	}
+}
+
+// TimerStats represents the estimated number of timers.
+type TimerStats struct {
+	// Timers is the estimated number of live timers and tickers.
+	Timers int64
+	// Growing reports whether the number of timers grew monotonically in the detector window.
+	Growing bool
+}
+
+// Values returns metrics which you can write into TSDB.
+func (s *TimerStats) Values() map[string]interface{} {
+	var growing int64
+	if s.Growing {
+		growing = 1
+	}
+	return map[string]interface{}{
+		"timer.count":   s.Timers,
+		"timer.growing": growing,
+	}
+}
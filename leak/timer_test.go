@@ -0,0 +1,40 @@
+package leak
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+var tickers []*time.Ticker
+
+func TestTimerCollector(t *testing.T) {
+	old := runtime.MemProfileRate
+	runtime.MemProfileRate = 1
+	defer func() { runtime.MemProfileRate = old }()
+
+	c := NewTimerCollector(nil)
+	c.Detector.Window = 3
+
+	var stats TimerStats
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 100; j++ {
+			tickers = append(tickers, time.NewTicker(time.Hour))
+		}
+		runtime.GC()
+		runtime.GC()
+		stats = c.Once()
+	}
+
+	if stats.Timers < 300 {
+		t.Errorf("expected at least 300 timers, got %d", stats.Timers)
+	}
+	if !stats.Growing {
+		t.Errorf("expected timers to be growing")
+	}
+
+	for _, tk := range tickers {
+		tk.Stop()
+	}
+	tickers = nil
+}
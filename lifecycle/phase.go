@@ -0,0 +1,57 @@
+package lifecycle
+
+import (
+	"sync"
+	"time"
+)
+
+// PhaseStat represents the duration of a phase.
+type PhaseStat struct {
+	Name     string
+	Duration time.Duration
+}
+
+// phases records the durations of named phases in the order they are started.
+type phases struct {
+	mu        sync.Mutex
+	names     []string
+	durations map[string]time.Duration
+}
+
+func newPhases() *phases {
+	return &phases{durations: make(map[string]time.Duration)}
+}
+
+// phase starts timing the phase name and returns the func to end it.
+// The durations of a phase which is recorded multiple times are summed.
+func (p *phases) phase(name string) func() {
+	start := time.Now()
+
+	p.mu.Lock()
+	if _, ok := p.durations[name]; !ok {
+		p.names = append(p.names, name)
+		p.durations[name] = 0
+	}
+	p.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d := time.Since(start)
+			p.mu.Lock()
+			p.durations[name] += d
+			p.mu.Unlock()
+		})
+	}
+}
+
+func (p *phases) stats() []PhaseStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]PhaseStat, 0, len(p.names))
+	for _, name := range p.names {
+		stats = append(stats, PhaseStat{Name: name, Duration: p.durations[name]})
+	}
+	return stats
+}
@@ -0,0 +1,129 @@
+package lifecycle
+
+import (
+	"sync"
+	"time"
+
+	appmetrics "github.com/smallnest/go-app-metrics"
+)
+
+var shutdown = struct {
+	mu     sync.Mutex
+	phases *phases
+	start  time.Time
+	end    time.Time
+}{}
+
+// BeginShutdown marks the beginning of the graceful shutdown and resets the previous shutdown phases.
+//
+//	lifecycle.BeginShutdown()
+//	lifecycle.ShutdownPhase("stop_accepting")()
+//	end := lifecycle.ShutdownPhase("drain")
+//	srv.Shutdown(ctx)
+//	end()
+//	lifecycle.FinishShutdown(runner, push)
+func BeginShutdown() {
+	shutdown.mu.Lock()
+	defer shutdown.mu.Unlock()
+
+	shutdown.phases = newPhases()
+	shutdown.start = time.Now()
+	shutdown.end = time.Time{}
+}
+
+// ShutdownPhase starts timing the shutdown phase name and returns the func to end it.
+// BeginShutdown is called first if the shutdown hasn't begun.
+func ShutdownPhase(name string) func() {
+	shutdown.mu.Lock()
+	if shutdown.phases == nil {
+		shutdown.mu.Unlock()
+		BeginShutdown()
+		shutdown.mu.Lock()
+	}
+	p := shutdown.phases
+	shutdown.mu.Unlock()
+
+	return p.phase(name)
+}
+
+// FinishShutdown marks the end of the graceful shutdown and passes a final snapshot of the runtime stats,
+// the system stats and the shutdown metrics to handler, e.g. to push them before the process exits.
+// The snapshot is collected by r with Collect, so it is also output to the handler and the subscribers
+// of r; appmetrics.Default() is used if r is nil. The runtime and system values are prefixed with
+// runtime. and system., as both have e.g. mem.total. handler may be nil.
+func FinishShutdown(r *appmetrics.Runner, handler func(values map[string]interface{})) {
+	shutdown.mu.Lock()
+	if shutdown.start.IsZero() {
+		shutdown.start = time.Now()
+	}
+	shutdown.end = time.Now()
+	shutdown.mu.Unlock()
+
+	if handler == nil {
+		return
+	}
+
+	if r == nil {
+		r = appmetrics.Default()
+	}
+	snap := r.Collect()
+	stats := Shutdown()
+
+	values := make(map[string]interface{})
+	for k, v := range snap.Runtime.Values() {
+		values["runtime."+k] = v
+	}
+	for k, v := range snap.System.Values() {
+		values["system."+k] = v
+	}
+	for k, v := range stats.Values() {
+		values[k] = v
+	}
+	handler(values)
+}
+
+// ShutdownStats represents the durations of the shutdown phases.
+type ShutdownStats struct {
+	// Phases are in the order they were started.
+	Phases []PhaseStat
+	// Finished reports whether FinishShutdown has been called. Duration is the time since BeginShutdown,
+	// until FinishShutdown if it has finished.
+	Finished bool
+	Duration time.Duration
+}
+
+// Shutdown returns the current shutdown stats.
+func Shutdown() ShutdownStats {
+	shutdown.mu.Lock()
+	defer shutdown.mu.Unlock()
+
+	var stats ShutdownStats
+	if shutdown.phases != nil {
+		stats.Phases = shutdown.phases.stats()
+	}
+	switch {
+	case shutdown.start.IsZero():
+	case shutdown.end.IsZero():
+		stats.Duration = time.Since(shutdown.start)
+	default:
+		stats.Finished = true
+		stats.Duration = shutdown.end.Sub(shutdown.start)
+	}
+	return stats
+}
+
+// Values returns metrics which you can write into TSDB: shutdown.phase.<name>.duration and
+// shutdown.duration in nanoseconds, and shutdown.finished.
+func (s *ShutdownStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Phases)+2)
+	for _, p := range s.Phases {
+		values["shutdown.phase."+p.Name+".duration"] = p.Duration.Nanoseconds()
+	}
+	values["shutdown.duration"] = s.Duration.Nanoseconds()
+	var finished int64
+	if s.Finished {
+		finished = 1
+	}
+	values["shutdown.finished"] = finished
+	return values
+}
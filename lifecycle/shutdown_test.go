@@ -0,0 +1,35 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	BeginShutdown()
+	ShutdownPhase("stop_accepting")()
+	end := ShutdownPhase("drain")
+	time.Sleep(10 * time.Millisecond)
+	end()
+
+	stats := Shutdown()
+	assert.False(t, stats.Finished)
+	assert.Len(t, stats.Phases, 2)
+	assert.True(t, stats.Phases[1].Duration >= 10*time.Millisecond)
+
+	var final map[string]interface{}
+	r := appmetrics.NewRunner(nil)
+	FinishShutdown(r, func(values map[string]interface{}) {
+		final = values
+	})
+	assert.Equal(t, int64(1), final["shutdown.finished"])
+	assert.Contains(t, final, "shutdown.phase.drain.duration")
+	assert.Contains(t, final, "runtime.cpu.goroutines")
+	assert.Contains(t, final, "runtime.mem.total")
+	assert.Contains(t, final, "system.mem.total")
+	assert.NotNil(t, r.Latest())
+	assert.True(t, final["shutdown.duration"].(int64) >= int64(10*time.Millisecond))
+}
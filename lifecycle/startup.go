@@ -0,0 +1,120 @@
+// Package lifecycle provides timing of the startup phases of applications, such as loading config,
+// connecting databases and warming caches, and the total time to ready:
+//
+//	defer lifecycle.StartupPhase("config")()
+//	...
+//	lifecycle.Ready()
+//
+// and of the graceful shutdown phases, such as draining in-flight requests and closing pools,
+// so deploy tooling can verify drains complete within termination grace periods.
+package lifecycle
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// initTime is used as the start time of the process if the create time is not available.
+var initTime = time.Now()
+
+// processStart returns the create time of the current process.
+func processStart() time.Time {
+	p, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return initTime
+	}
+	ms, err := p.CreateTime()
+	if err != nil || ms <= 0 {
+		return initTime
+	}
+	return time.UnixMilli(ms)
+}
+
+var startup = struct {
+	phases *phases
+
+	mu       sync.Mutex
+	start    time.Time
+	ready    time.Time
+	exported bool
+}{
+	phases: newPhases(),
+	start:  processStart(),
+}
+
+// StartupPhase starts timing the startup phase name and returns the func to end it.
+func StartupPhase(name string) func() {
+	return startup.phases.phase(name)
+}
+
+// Ready marks the application as ready, the time to ready is the time since the process started.
+// Only the first call takes effect.
+func Ready() {
+	startup.mu.Lock()
+	defer startup.mu.Unlock()
+
+	if startup.ready.IsZero() {
+		startup.ready = time.Now()
+	}
+}
+
+// StartupStats represents the durations of the startup phases.
+type StartupStats struct {
+	// Phases are in the order they were started.
+	Phases []PhaseStat
+	Start  time.Time
+	// Ready reports whether Ready has been called, TimeToReady is 0 until then.
+	Ready       bool
+	TimeToReady time.Duration
+}
+
+// Startup returns the current startup stats.
+func Startup() StartupStats {
+	startup.mu.Lock()
+	defer startup.mu.Unlock()
+
+	stats := StartupStats{
+		Phases: startup.phases.stats(),
+		Start:  startup.start,
+		Ready:  !startup.ready.IsZero(),
+	}
+	if stats.Ready {
+		stats.TimeToReady = startup.ready.Sub(startup.start)
+	}
+	return stats
+}
+
+// Values returns metrics which you can write into TSDB: startup.phase.<name>.duration and
+// startup.time_to_ready in nanoseconds.
+func (s *StartupStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Phases)+1)
+	for _, p := range s.Phases {
+		values["startup.phase."+p.Name+".duration"] = p.Duration.Nanoseconds()
+	}
+	values["startup.time_to_ready"] = s.TimeToReady.Nanoseconds()
+	return values
+}
+
+// StartupValues returns the startup metrics once, on the first call after Ready, and nil otherwise.
+// It isn't called by the Runner: a handler merging them into the values it writes exports them
+// only with its first snapshot after the application is ready:
+//
+//	values := snap.Runtime.Values()
+//	for k, v := range lifecycle.StartupValues() {
+//		values[k] = v
+//	}
+func StartupValues() map[string]interface{} {
+	startup.mu.Lock()
+	if startup.ready.IsZero() || startup.exported {
+		startup.mu.Unlock()
+		return nil
+	}
+	startup.exported = true
+	startup.mu.Unlock()
+
+	stats := Startup()
+	return stats.Values()
+}
@@ -0,0 +1,31 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartup(t *testing.T) {
+	done := StartupPhase("config")
+	time.Sleep(10 * time.Millisecond)
+	done()
+	done()
+	StartupPhase("db")()
+
+	assert.Nil(t, StartupValues())
+
+	Ready()
+	stats := Startup()
+	assert.True(t, stats.Ready)
+	assert.True(t, stats.TimeToReady >= 10*time.Millisecond)
+	assert.Equal(t, "config", stats.Phases[0].Name)
+	assert.Equal(t, "db", stats.Phases[1].Name)
+	assert.True(t, stats.Phases[0].Duration >= 10*time.Millisecond)
+
+	values := StartupValues()
+	assert.Contains(t, values, "startup.phase.config.duration")
+	assert.Equal(t, stats.TimeToReady.Nanoseconds(), values["startup.time_to_ready"])
+	assert.Nil(t, StartupValues())
+}
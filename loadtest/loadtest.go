@@ -0,0 +1,169 @@
+// Package loadtest provides a recorder which summarizes runtime and system metrics during a load test.
+//
+// Start the Recorder before the load test and Stop it at the end, it returns a Report
+// containing min/max/avg/percentiles of every metric collected in the time window.
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/value"
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/system"
+)
+
+// Recorder accumulates metrics between Start and Stop.
+// It is safe for use from multiple go routines.
+type Recorder struct {
+	mu      sync.Mutex
+	running bool
+	start   time.Time
+	samples map[string][]float64
+}
+
+// NewRecorder creates a new Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start marks the beginning of the time window. Samples recorded before are discarded.
+func (r *Recorder) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.running = true
+	r.start = time.Now()
+	r.samples = make(map[string][]float64)
+}
+
+// Stop marks the end of the time window and returns the summary of the recorded samples.
+func (r *Recorder) Stop() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &Report{
+		Start:   r.start,
+		End:     time.Now(),
+		Metrics: make(map[string]Summary, len(r.samples)),
+	}
+	for k, samples := range r.samples {
+		report.Metrics[k] = summarize(samples)
+	}
+
+	r.running = false
+	r.samples = nil
+	return report
+}
+
+// Record adds a sample of metrics. It is ignored if the recorder is not started.
+func (r *Recorder) Record(values map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.running {
+		return
+	}
+	for k, v := range value.Floats(values) {
+		r.samples[k] = append(r.samples[k], v)
+	}
+}
+
+// RuntimeStatsHandler records runtime stats. It can be used as a rmetric.RuntimeStatsHandler.
+func (r *Recorder) RuntimeStatsHandler(stats rmetric.RuntimeStats) {
+	r.Record(stats.Values())
+}
+
+// SystemStatsHandler records system stats. It can be used as a system.SystemStatsHandler.
+func (r *Recorder) SystemStatsHandler(stats system.SystemStats) {
+	r.Record(stats.Values())
+}
+
+// Summary represents the distribution of a metric in the time window.
+type Summary struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Avg   float64 `json:"avg"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+}
+
+// Report is the summary of all metrics recorded in the time window.
+type Report struct {
+	Start   time.Time          `json:"start"`
+	End     time.Time          `json:"end"`
+	Metrics map[string]Summary `json:"metrics"`
+}
+
+// WriteJSON writes the report in json format.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteMarkdown writes the report as a markdown table sorted by metric name.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	keys := make([]string, 0, len(r.Metrics))
+	for k := range r.Metrics {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	_, err := fmt.Fprintf(w, "# Load test report\n\n%s - %s (%s)\n\n", r.Start.Format(time.RFC3339),
+		r.End.Format(time.RFC3339), r.End.Sub(r.Start).Round(time.Second))
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "| metric | count | min | max | avg | p50 | p90 | p99 |\n|---|---|---|---|---|---|---|---|\n"); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		s := r.Metrics[k]
+		_, err := fmt.Fprintf(w, "| %s | %d | %g | %g | %g | %g | %g | %g |\n", k, s.Count, s.Min, s.Max, s.Avg, s.P50, s.P90, s.P99)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func summarize(samples []float64) Summary {
+	if len(samples) == 0 {
+		return Summary{}
+	}
+
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+
+	return Summary{
+		Count: len(sorted),
+		Min:   sorted[0],
+		Max:   sorted[len(sorted)-1],
+		Avg:   sum / float64(len(sorted)),
+		P50:   percentile(sorted, 0.5),
+		P90:   percentile(sorted, 0.9),
+		P99:   percentile(sorted, 0.99),
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted samples.
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,37 @@
+package loadtest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder()
+	r.Record(map[string]interface{}{"cpu.goroutines": int64(100)})
+
+	r.Start()
+	for i := 1; i <= 100; i++ {
+		r.Record(map[string]interface{}{"cpu.goroutines": int64(i)})
+	}
+	report := r.Stop()
+	r.Record(map[string]interface{}{"cpu.goroutines": int64(1000)})
+
+	s := report.Metrics["cpu.goroutines"]
+	assert.Equal(t, 100, s.Count)
+	assert.Equal(t, 1.0, s.Min)
+	assert.Equal(t, 100.0, s.Max)
+	assert.Equal(t, 50.5, s.Avg)
+	assert.Equal(t, 50.0, s.P50)
+	assert.Equal(t, 90.0, s.P90)
+	assert.Equal(t, 99.0, s.P99)
+
+	var buf bytes.Buffer
+	assert.Nil(t, report.WriteMarkdown(&buf))
+	assert.Contains(t, buf.String(), "| cpu.goroutines | 100 | 1 | 100 | 50.5 | 50 | 90 | 99 |")
+
+	buf.Reset()
+	assert.Nil(t, report.WriteJSON(&buf))
+	assert.Contains(t, buf.String(), `"p99": 99`)
+}
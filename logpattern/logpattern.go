@@ -0,0 +1,251 @@
+// Package logpattern provides a collector which tails log files and counts the lines matching
+// regular expressions, e.g. errors and panics, so simple alerting doesn't need a log pipeline.
+package logpattern
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// maxLineLength is the length of the beginning of a line which is matched, the rest of longer lines is skipped.
+const maxLineLength = 64 << 10
+
+// Pattern is a regular expression to count the matching lines of.
+type Pattern struct {
+	// Name is used in metric keys.
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// LogStatsHandler represents a handler to handle stats after successfully gathering statistics
+type LogStatsHandler func(LogStats)
+
+// Collector implements the periodic counting of the lines appended to log files to a LogStatsHandler.
+// Files are read from their end when they are opened for the first time, and from the beginning after
+// they have been rotated or truncated.
+type Collector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// MaxBytes is the maximum number of bytes read from a file per collection, so a burst of logs
+	// doesn't stall the collection or exhaust the memory. The rest is read by the next collections.
+	// Defaults to 16 MiB.
+	MaxBytes int64
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	mu           sync.Mutex
+	files        []string
+	patterns     []Pattern
+	tails        map[string]*tail
+	totals       map[string]int64
+	statsHandler LogStatsHandler
+}
+
+// tail is the read position of a log file.
+type tail struct {
+	info   os.FileInfo
+	offset int64
+	// skip is set while the rest of a line longer than MaxBytes is skipped.
+	skip bool
+}
+
+// New creates a new Collector that will periodically count the lines of the files matching the patterns
+// and output statistics to statsHandler.
+func New(statsHandler LogStatsHandler, files []string, patterns ...Pattern) *Collector {
+	if statsHandler == nil {
+		statsHandler = func(LogStats) {}
+	}
+
+	return &Collector{
+		CollectInterval: 10 * time.Second,
+		MaxBytes:        16 << 20,
+		files:           files,
+		patterns:        patterns,
+		tails:           make(map[string]*tail),
+		totals:          make(map[string]int64),
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured LogStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *Collector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the numbers of matching lines appended since the previous collection.
+// It is safe for use from multiple go routines.
+func (c *Collector) Once() LogStats {
+	return c.collectStats()
+}
+
+func (c *Collector) collectStats() LogStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := LogStats{
+		Patterns: make(map[string]PatternStat, len(c.patterns)),
+	}
+	counts := make([]int64, len(c.patterns))
+
+	for _, file := range c.files {
+		lines, err := c.readFile(file, counts)
+		stats.Lines += lines
+		if err != nil {
+			stats.Errors++
+		}
+	}
+
+	for i, p := range c.patterns {
+		c.totals[p.Name] += counts[i]
+		stats.Patterns[p.Name] = PatternStat{
+			Count: counts[i],
+			Total: c.totals[p.Name],
+		}
+	}
+	return stats
+}
+
+// readFile counts the complete lines appended to file since the previous read and returns the number of lines.
+func (c *Collector) readFile(file string, counts []int64) (int64, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		delete(c.tails, file)
+		return 0, err
+	}
+
+	t := c.tails[file]
+	switch {
+	case t == nil:
+		// start from the end of an existing file
+		c.tails[file] = &tail{info: info, offset: info.Size()}
+		return 0, nil
+	case !os.SameFile(t.info, info) || info.Size() < t.offset:
+		// rotated or truncated
+		t.offset = 0
+		t.skip = false
+	}
+	t.info = info
+	if info.Size() == t.offset {
+		return 0, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, limited := info.Size()-t.offset, false
+	if c.MaxBytes > 0 && n > c.MaxBytes {
+		n, limited = c.MaxBytes, true
+	}
+	size := maxLineLength
+	if int64(size) > n {
+		size = int(n)
+	}
+	r := bufio.NewReaderSize(io.NewSectionReader(f, t.offset, n), size)
+
+	var lines, read, complete int64 // complete is the length of the complete lines read
+	var head []byte                 // beginning of the current line if it's longer than the buffer
+	match := func(line []byte) {
+		lines++
+		for i, p := range c.patterns {
+			if p.Regexp.Match(line) {
+				counts[i]++
+			}
+		}
+	}
+	for {
+		chunk, err := r.ReadSlice('\n')
+		read += int64(len(chunk))
+		if errors.Is(err, bufio.ErrBufferFull) {
+			if head == nil {
+				head = append([]byte(nil), chunk...)
+			}
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			if complete == 0 && limited {
+				// a line longer than MaxBytes is counted by its beginning and the rest is skipped
+				if head == nil {
+					head = chunk
+				}
+				if !t.skip {
+					match(head)
+				}
+				t.skip = true
+				complete = read
+			}
+			// leave the incomplete last line to the next read
+			break
+		}
+		if err != nil {
+			return lines, err
+		}
+
+		complete = read
+		line := chunk[:len(chunk)-1]
+		if head != nil {
+			line, head = head, nil
+		}
+		if t.skip {
+			t.skip = false
+			continue
+		}
+		match(line)
+	}
+	t.offset += complete
+	return lines, nil
+}
+
+// LogStats represents the numbers of lines appended to the log files since the previous collection.
+type LogStats struct {
+	// Patterns are the stats of the patterns keyed by Pattern.Name.
+	Patterns map[string]PatternStat
+	// Lines is the number of lines read from all files.
+	Lines int64
+	// Errors is the number of files which couldn't be read.
+	Errors int64
+}
+
+// PatternStat represents the numbers of lines matching a pattern.
+type PatternStat struct {
+	// Count is the number of matching lines since the previous collection.
+	Count int64
+	// Total is the cumulative number of matching lines.
+	Total int64
+}
+
+// Values returns metrics which you can write into TSDB.
+func (s *LogStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Patterns)*2+2)
+	values["log.lines"] = s.Lines
+	values["log.errors"] = s.Errors
+	for name, stat := range s.Patterns {
+		values["log.pattern."+name+".count"] = stat.Count
+		values["log.pattern."+name+".total"] = stat.Total
+	}
+	return values
+}
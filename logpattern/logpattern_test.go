@@ -0,0 +1,72 @@
+package logpattern
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func appendFile(t *testing.T, file, data string) {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(data)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func TestCollectorOnce(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, file, "ERROR before start\n")
+
+	c := New(nil, []string{file, file + ".missing"},
+		Pattern{Name: "error", Regexp: regexp.MustCompile(`\bERROR\b`)},
+		Pattern{Name: "panic", Regexp: regexp.MustCompile(`^panic:`)},
+	)
+	stats := c.Once()
+	assert.Equal(t, int64(0), stats.Patterns["error"].Count)
+	assert.Equal(t, int64(1), stats.Errors)
+
+	appendFile(t, file, "INFO ok\nERROR failed\npanic: boom\nERROR incomplete")
+	stats = c.Once()
+	assert.Equal(t, int64(3), stats.Lines)
+	assert.Equal(t, int64(1), stats.Patterns["error"].Count)
+	assert.Equal(t, int64(1), stats.Patterns["panic"].Count)
+
+	appendFile(t, file, " line\n")
+	stats = c.Once()
+	assert.Equal(t, int64(1), stats.Patterns["error"].Count)
+	assert.Equal(t, int64(2), stats.Patterns["error"].Total)
+
+	// truncated
+	assert.Nil(t, os.WriteFile(file, []byte("ERROR again\n"), 0o644))
+	stats = c.Once()
+	assert.Equal(t, int64(1), stats.Patterns["error"].Count)
+
+	values := stats.Values()
+	assert.Equal(t, int64(3), values["log.pattern.error.total"])
+	assert.Equal(t, int64(0), values["log.pattern.panic.count"])
+}
+
+func TestCollectorMaxBytes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, file, "")
+
+	c := New(nil, []string{file}, Pattern{Name: "error", Regexp: regexp.MustCompile(`^ERROR`)})
+	c.MaxBytes = 16
+	c.Once()
+
+	appendFile(t, file, "ERROR one\nINFO two\nERROR "+strings.Repeat("x", 40)+"\nERROR three\n")
+	var lines, errs int64
+	for i := 0; i < 10; i++ {
+		stats := c.Once()
+		assert.True(t, stats.Lines <= 2)
+		lines += stats.Lines
+		errs += stats.Patterns["error"].Count
+	}
+	assert.Equal(t, int64(4), lines)
+	assert.Equal(t, int64(3), errs)
+}
@@ -0,0 +1,44 @@
+package metadata_test
+
+import (
+	"testing"
+
+	"github.com/smallnest/go-app-metrics/metadata"
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/system"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAllKeysDescribed makes sure every key returned by Values() is described.
+func TestAllKeysDescribed(t *testing.T) {
+	rstats := rmetric.RuntimeStats{SchedLatency: map[string]int64{"p99": 1}}
+	for k, v := range rstats.Values() {
+		m, ok := metadata.Runtime.Lookup(k)
+		assert.True(t, ok, k)
+		assert.Equal(t, kindOf(v), m.Kind, k)
+	}
+
+	sstats := system.SystemStats{
+		DiskStat:      map[string]system.DiskStat{"/": {}},
+		DiskIOStat:    map[string]system.DiskIOStat{"sda": {}},
+		BandwidthStat: map[string]system.BandwidthStat{"eth0": {}},
+	}
+	for k, v := range sstats.Values() {
+		m, ok := metadata.System.Lookup(k)
+		assert.True(t, ok, k)
+		assert.Equal(t, kindOf(v), m.Kind, k)
+	}
+}
+
+func kindOf(v interface{}) metadata.Kind {
+	switch v.(type) {
+	case int64:
+		return metadata.Int
+	case uint64:
+		return metadata.Uint
+	case float64:
+		return metadata.Float
+	default:
+		return metadata.Unknown
+	}
+}
@@ -0,0 +1,359 @@
+// Package metadata provides the description of metrics returned by Values(), such as units and help texts,
+// so exporters can scale and document them.
+package metadata
+
+import (
+	"strings"
+	"sync"
+)
+
+// Unit is the unit of a metric.
+type Unit string
+
+const (
+	// None means the metric is a plain number, such as a count.
+	None Unit = ""
+	// Bytes means the metric is in bytes.
+	Bytes Unit = "bytes"
+	// Nanoseconds means the metric is a duration in nanoseconds.
+	Nanoseconds Unit = "nanoseconds"
+	// Timestamp means the metric is a unix timestamp in nanoseconds.
+	Timestamp Unit = "timestamp"
+	// Ratio means the metric is a ratio between 0 and 1.
+	Ratio Unit = "ratio"
+)
+
+// Kind is the numeric kind of a metric value as returned by Values().
+type Kind string
+
+const (
+	// Unknown means the value is not numeric.
+	Unknown Kind = ""
+	// Int means the value is an int64.
+	Int Kind = "int"
+	// Uint means the value is an uint64.
+	Uint Kind = "uint"
+	// Float means the value is a float64.
+	Float Kind = "float"
+)
+
+// Aggregation tells how the values of a metric from several collections are combined into one,
+// e.g. by a sink flushing less often than the metrics are collected.
+type Aggregation string
+
+const (
+	// Last means the latest value is kept, e.g. for gauges and cumulative counters.
+	Last Aggregation = ""
+	// Sum means the values are summed, e.g. for counts since the previous collection.
+	Sum Aggregation = "sum"
+	// Mean means the values are averaged, e.g. for percentages since the previous collection.
+	Mean Aggregation = "mean"
+	// Min means the smallest value is kept.
+	Min Aggregation = "min"
+	// Max means the largest value is kept, e.g. for percentiles since the previous collection,
+	// which can't be combined exactly.
+	Max Aggregation = "max"
+)
+
+// Priority is the importance of a metric, which decides what to keep under constraints such as
+// a cardinality or cost budget.
+type Priority string
+
+const (
+	// Normal is the priority of most metrics.
+	Normal Priority = ""
+	// Critical means the metric is needed to tell whether the app is healthy, e.g. the heap size
+	// or the open file descriptors. It is kept first.
+	Critical Priority = "critical"
+	// Debug means the metric is only needed to investigate an issue, e.g. the runtime internal
+	// allocations. It is dropped first.
+	Debug Priority = "debug"
+)
+
+// Rank returns the priority as a number for comparisons: 1 for Critical, 0 for Normal and -1 for Debug.
+func (p Priority) Rank() int {
+	switch p {
+	case Critical:
+		return 1
+	case Debug:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// Metric describes a metric.
+type Metric struct {
+	Unit Unit
+	Help string
+	// Kind is the original kind of the value, exporters may convert it, e.g. into float64.
+	Kind Kind
+	// Aggregation tells how to combine the values of several collections.
+	Aggregation Aggregation
+	// Priority is the importance of the metric.
+	Priority Priority
+}
+
+type pattern struct {
+	prefix, suffix string
+	metric         Metric
+}
+
+// Registry contains the descriptions of metrics. It is safe for use from multiple go routines.
+type Registry struct {
+	mu       sync.RWMutex
+	exact    map[string]Metric
+	patterns []pattern
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{exact: make(map[string]Metric)}
+}
+
+// Register registers the description of key. The key may contain a "*" wildcard for the name
+// embedded in it, e.g. "disk.*.total" which matches "disk./.total" and "disk./var/lib.total".
+func (r *Registry) Register(key string, m Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i := strings.IndexByte(key, '*'); i >= 0 {
+		r.patterns = append(r.patterns, pattern{prefix: key[:i], suffix: key[i+1:], metric: m})
+		return
+	}
+	r.exact[key] = m
+}
+
+// Lookup returns the description of key.
+func (r *Registry) Lookup(key string) (Metric, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if m, ok := r.exact[key]; ok {
+		return m, true
+	}
+	for _, p := range r.patterns {
+		if len(key) > len(p.prefix)+len(p.suffix) && strings.HasPrefix(key, p.prefix) && strings.HasSuffix(key, p.suffix) {
+			return p.metric, true
+		}
+	}
+	return Metric{}, false
+}
+
+// Runtime contains the descriptions of the metrics of rmetric.RuntimeStats.
+var Runtime = NewRegistry()
+
+// System contains the descriptions of the metrics of system.SystemStats.
+var System = NewRegistry()
+
+// Keep reports whether the metric key of r is kept when only the metrics of at least priority min
+// are kept. Unknown metrics have the Normal priority.
+func (r *Registry) Keep(key string, min Priority) bool {
+	m, _ := r.Lookup(key)
+	return m.Priority.Rank() >= min.Rank()
+}
+
+// Lookup returns the description of key from Runtime or System.
+// Both describe mem.total in bytes, but with different help texts.
+func Lookup(key string) (Metric, bool) {
+	if m, ok := Runtime.Lookup(key); ok {
+		return m, true
+	}
+	return System.Lookup(key)
+}
+
+// entry is the short form of Metric used in the tables below.
+type entry struct {
+	unit Unit
+	help string
+}
+
+// aggregations are the metrics since the previous collection, the other metrics keep their last value.
+var aggregations = map[string]Aggregation{
+	"cpu.sched_latency.*": Max,
+	"mem.gc.pause_count":  Sum,
+	"mem.gc.pause_min":    Min,
+	"mem.gc.pause_max":    Max,
+	"mem.gc.pause_mean":   Mean,
+	"mem.gc.pause_p99":    Max,
+
+	"cpu.iowait_percent": Mean,
+	"cpu.percent":        Mean,
+	"swap.in":            Sum,
+	"swap.out":           Sum,
+	"elapsed":            Sum,
+
+	"disk_io.*.read_bytes":       Sum,
+	"disk_io.*.write_bytes":      Sum,
+	"disk_io.*.read_count":       Sum,
+	"disk_io.*.write_count":      Sum,
+	"disk_io.*.read_time":        Sum,
+	"disk_io.*.write_time":       Sum,
+	"disk_io.*.io_time":          Sum,
+	"disk_io.*.weighted_io_time": Sum,
+	"disk_io.*.pressure":         Mean,
+
+	"net.*.bytes_sent":   Sum,
+	"net.*.bytes_recv":   Sum,
+	"net.*.packets_sent": Sum,
+	"net.*.packets_recv": Sum,
+}
+
+// runtimePriorities and systemPriorities are the critical and debug metrics, the other metrics are normal.
+// They are separate as both have a mem.total.
+var runtimePriorities = map[string]Priority{
+	"cpu.goroutines":   Critical,
+	"mem.sys":          Critical,
+	"mem.heap.alloc":   Critical,
+	"mem.gc.pause_p99": Critical,
+	"fd.open":          Critical,
+	"fd.limit":         Critical,
+	"fd.used_percent":  Critical,
+
+	"cpu.cgo_calls":          Debug,
+	"mem.lookups":            Debug,
+	"mem.stack.mspan_inuse":  Debug,
+	"mem.stack.mspan_sys":    Debug,
+	"mem.stack.mcache_inuse": Debug,
+	"mem.stack.mcache_sys":   Debug,
+	"mem.othersys":           Debug,
+	"mem.gc.sys":             Debug,
+	"mem.gc.pause":           Debug,
+}
+
+var systemPriorities = map[string]Priority{
+	"cpu.percent":   Critical,
+	"load.load1":    Critical,
+	"mem.total":     Critical,
+	"mem.available": Critical,
+	"disk.*.free":   Critical,
+
+	"cpu.*.user":                 Debug,
+	"cpu.*.system":               Debug,
+	"cpu.*.idle":                 Debug,
+	"cpu.*.iowait":               Debug,
+	"disk_io.*.weighted_io_time": Debug,
+	"counter_resets":             Debug,
+}
+
+func init() {
+	for key, e := range map[string]entry{
+		"cpu.count":      {None, "Number of logical CPUs usable by the current process."},
+		"cpu.threads":    {None, "Number of OS threads created."},
+		"cpu.goroutines": {None, "Number of goroutines that currently exist."},
+		"cpu.cgo_calls":  {None, "Number of cgo calls made by the current process."},
+		"cpu.gomaxprocs": {None, "Current GOMAXPROCS, the number of OS threads that can execute Go code simultaneously."},
+		"cpu.mutex_wait": {Nanoseconds, "Cumulative time goroutines have spent blocked on a sync.Mutex or sync.RWMutex."},
+
+		"cpu.sched_latency.*": {Nanoseconds, "Percentile of the time goroutines have been runnable before running since the previous collection."},
+
+		"mem.alloc":   {Bytes, "Bytes of allocated heap objects."},
+		"mem.total":   {Bytes, "Cumulative bytes allocated for heap objects."},
+		"mem.sys":     {Bytes, "Total bytes of memory obtained from the OS."},
+		"mem.lookups": {None, "Number of pointer lookups performed by the runtime."},
+		"mem.mallocs": {None, "Cumulative count of heap objects allocated."},
+		"mem.frees":   {None, "Cumulative count of heap objects freed."},
+
+		"mem.heap.alloc":    {Bytes, "Bytes of allocated heap objects."},
+		"mem.heap.sys":      {Bytes, "Bytes of heap memory obtained from the OS."},
+		"mem.heap.idle":     {Bytes, "Bytes in idle (unused) spans."},
+		"mem.heap.inuse":    {Bytes, "Bytes in in-use spans."},
+		"mem.heap.released": {Bytes, "Bytes of physical memory returned to the OS."},
+		"mem.heap.objects":  {None, "Number of allocated heap objects."},
+
+		"mem.stack.inuse":        {Bytes, "Bytes in stack spans."},
+		"mem.stack.sys":          {Bytes, "Bytes of stack memory obtained from the OS."},
+		"mem.stack.mspan_inuse":  {Bytes, "Bytes of allocated mspan structures."},
+		"mem.stack.mspan_sys":    {Bytes, "Bytes of memory obtained from the OS for mspan structures."},
+		"mem.stack.mcache_inuse": {Bytes, "Bytes of allocated mcache structures."},
+		"mem.stack.mcache_sys":   {Bytes, "Bytes of memory obtained from the OS for mcache structures."},
+		"mem.othersys":           {Bytes, "Bytes of memory in miscellaneous off-heap runtime allocations."},
+
+		"mem.gc.sys":          {Bytes, "Bytes of memory in garbage collection metadata."},
+		"mem.gc.next":         {Bytes, "Target heap size of the next GC cycle."},
+		"mem.gc.last":         {Timestamp, "Time the last garbage collection finished."},
+		"mem.gc.pause_total":  {Nanoseconds, "Cumulative time spent in GC stop-the-world pauses."},
+		"mem.gc.pause":        {Nanoseconds, "Duration of the most recent GC stop-the-world pause."},
+		"mem.gc.pause_count":  {None, "Number of GC cycles since the previous collection."},
+		"mem.gc.pause_min":    {Nanoseconds, "Shortest GC stop-the-world pause since the previous collection."},
+		"mem.gc.pause_max":    {Nanoseconds, "Longest GC stop-the-world pause since the previous collection."},
+		"mem.gc.pause_mean":   {Nanoseconds, "Mean GC stop-the-world pause since the previous collection."},
+		"mem.gc.pause_p99":    {Nanoseconds, "99th percentile of the GC stop-the-world pauses since the previous collection."},
+		"mem.gc.count":        {None, "Number of completed GC cycles."},
+		"mem.gc.cpu_fraction": {Ratio, "Fraction of available CPU time used by the GC since the program started."},
+
+		"mem.gc.finalizer_backlog": {None, "Number of objects pending finalization."},
+		"mem.gc.cleanup_backlog":   {None, "Number of objects pending cleanup."},
+
+		"fd.open":         {None, "Number of open file descriptors of the process, or handles on windows."},
+		"fd.limit":        {None, "Soft limit of the open file descriptors of the process, -1 if unlimited."},
+		"fd.hard_limit":   {None, "Hard limit of the open file descriptors of the process, -1 if unlimited."},
+		"fd.used_percent": {None, "Percentage of the soft limit of the open file descriptors in use."},
+	} {
+		// all runtime stats are int64 except ratios and percentages
+		m := Metric{Unit: e.unit, Help: e.help, Kind: Int, Aggregation: aggregations[key], Priority: runtimePriorities[key]}
+		if m.Unit == Ratio || strings.HasSuffix(key, "_percent") {
+			m.Kind = Float
+		}
+		Runtime.Register(key, m)
+	}
+
+	for key, e := range map[string]entry{
+		"cpu.user":           {None, "CPU time spent in user mode, in hundredths of a second."},
+		"cpu.system":         {None, "CPU time spent in kernel mode, in hundredths of a second."},
+		"cpu.idle":           {None, "CPU time spent idle, in hundredths of a second."},
+		"cpu.iowait":         {None, "CPU time spent waiting for IO, in hundredths of a second."},
+		"cpu.iowait_percent": {None, "Percentage of the CPU time spent waiting for IO since the previous collection."},
+		"cpu.percent":        {None, "CPU utilization of all cores since the previous collection, between 0 and 100."},
+
+		"cpu.*.user":   {None, "Percentage of the time the core spent in user mode since the previous collection."},
+		"cpu.*.system": {None, "Percentage of the time the core spent in kernel mode since the previous collection."},
+		"cpu.*.idle":   {None, "Percentage of the time the core spent idle since the previous collection."},
+		"cpu.*.iowait": {None, "Percentage of the time the core spent waiting for IO since the previous collection."},
+
+		"load.load1":  {None, "Load average over 1 minute."},
+		"load.load5":  {None, "Load average over 5 minutes."},
+		"load.load15": {None, "Load average over 15 minutes."},
+
+		"mem.total":     {Bytes, "Total physical memory."},
+		"mem.available": {Bytes, "Memory available for starting new applications."},
+		"mem.used":      {Bytes, "Used physical memory."},
+		"swap.total":    {Bytes, "Total swap space."},
+		"swap.free":     {Bytes, "Free swap space."},
+		"swap.used":     {Bytes, "Used swap space."},
+		"swap.in":       {Bytes, "Bytes swapped in since the previous collection."},
+		"swap.out":      {Bytes, "Bytes swapped out since the previous collection."},
+
+		"counter_resets": {None, "Number of counters found reset, e.g. by re-creating a network interface."},
+		"elapsed":        {Nanoseconds, "Time since the previous collection, which the stats since the previous collection cover."},
+
+		"disk.*.total": {Bytes, "Total size of the partition."},
+		"disk.*.free":  {Bytes, "Free space of the partition."},
+
+		"disk.*.inodes_total":        {None, "Total inodes of the filesystem, 0 if it has no fixed number of inodes."},
+		"disk.*.inodes_free":         {None, "Free inodes of the filesystem."},
+		"disk.*.inodes_used_percent": {None, "Percentage of the inodes of the filesystem in use."},
+
+		"disk_io.*.read_bytes":       {Bytes, "Bytes read from the device since the previous collection."},
+		"disk_io.*.write_bytes":      {Bytes, "Bytes written to the device since the previous collection."},
+		"disk_io.*.read_count":       {None, "Read operations completed by the device since the previous collection."},
+		"disk_io.*.write_count":      {None, "Write operations completed by the device since the previous collection."},
+		"disk_io.*.read_time":        {Nanoseconds, "Time spent reading from the device since the previous collection."},
+		"disk_io.*.write_time":       {Nanoseconds, "Time spent writing to the device since the previous collection."},
+		"disk_io.*.io_time":          {Nanoseconds, "Time the device was busy since the previous collection."},
+		"disk_io.*.weighted_io_time": {Nanoseconds, "Time the requests to the device were queued or in flight since the previous collection, summed over the requests."},
+		"disk_io.*.pressure":         {None, "Part of the iowait percentage attributed to the device by its share of the weighted IO time."},
+
+		"net.*.bytes_sent":   {Bytes, "Bytes sent since the previous collection."},
+		"net.*.bytes_recv":   {Bytes, "Bytes received since the previous collection."},
+		"net.*.packets_sent": {None, "Packets sent since the previous collection."},
+		"net.*.packets_recv": {None, "Packets received since the previous collection."},
+	} {
+		// all system stats are uint64 except cpu times, load averages and percentages
+		m := Metric{Unit: e.unit, Help: e.help, Kind: Uint, Aggregation: aggregations[key], Priority: systemPriorities[key]}
+		if strings.HasPrefix(key, "cpu.") || strings.HasPrefix(key, "load.") || strings.HasSuffix(key, "_percent") || strings.HasSuffix(key, ".pressure") {
+			m.Kind = Float
+		}
+		System.Register(key, m)
+	}
+}
@@ -0,0 +1,39 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	m, ok := Lookup("mem.heap.alloc")
+	assert.True(t, ok)
+	assert.Equal(t, Bytes, m.Unit)
+
+	m, ok = Lookup("disk./var/lib.total")
+	assert.True(t, ok)
+	assert.Equal(t, Bytes, m.Unit)
+
+	m, ok = System.Lookup("net.eth0.packets_sent")
+	assert.True(t, ok)
+	assert.Equal(t, None, m.Unit)
+	assert.Equal(t, Sum, m.Aggregation)
+
+	m, _ = System.Lookup("cpu.percent")
+	assert.Equal(t, Mean, m.Aggregation)
+	m, _ = Runtime.Lookup("mem.heap.alloc")
+	assert.Equal(t, Last, m.Aggregation)
+	assert.Equal(t, Critical, m.Priority)
+
+	m, _ = Runtime.Lookup("mem.total")
+	assert.Equal(t, Normal, m.Priority)
+	assert.True(t, System.Keep("mem.total", Critical))
+	assert.False(t, System.Keep("cpu.core0.user", Normal))
+	assert.True(t, System.Keep("unknown", Debug))
+
+	_, ok = Lookup("disk..total")
+	assert.False(t, ok)
+	_, ok = Lookup("unknown")
+	assert.False(t, ok)
+}
@@ -0,0 +1,118 @@
+// Package metricsmiddleware provides counters of recovered panics and categorized errors of applications:
+//
+//	http.Handle("/", metricsmiddleware.RecoverCounter()(handler))
+//
+//	if err != nil {
+//		metricsmiddleware.ErrorCounter("db.timeout").Inc()
+//	}
+//
+// The counters are not part of the snapshots of a Runner. Merge Values into the values written
+// by the handler, e.g. next to the runtime and system stats:
+//
+//	values := snap.Runtime.Values()
+//	for k, v := range metricsmiddleware.Values() {
+//		values[k] = v
+//	}
+package metricsmiddleware
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a cumulative counter. It is safe for use from multiple go routines.
+type Counter struct {
+	n int64
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.n, 1)
+}
+
+// Add increments the counter by n.
+func (c *Counter) Add(n int64) {
+	atomic.AddInt64(&c.n, n)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+var (
+	panics Counter
+
+	mu            sync.RWMutex
+	errorCounters = make(map[string]*Counter)
+)
+
+// ErrorCounter returns the counter of the errors of category name, creating it if it doesn't exist.
+// Callers may keep the counter to avoid the lookup.
+func ErrorCounter(name string) *Counter {
+	mu.RLock()
+	c, ok := errorCounters[name]
+	mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if c, ok = errorCounters[name]; !ok {
+		c = &Counter{}
+		errorCounters[name] = c
+	}
+	return c
+}
+
+// PanicCounter returns the counter of recovered panics.
+func PanicCounter() *Counter {
+	return &panics
+}
+
+// RecoverCounter returns a middleware which recovers panics of the handler, counts them and
+// responds with 500 Internal Server Error. http.ErrAbortHandler is counted and re-panicked
+// so the server aborts the response as usual.
+func RecoverCounter() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if err := recover(); err != nil {
+					panics.Inc()
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Recover recovers and counts a panic. It must be deferred directly, e.g. at the top of a go routine:
+//
+//	go func() {
+//		defer metricsmiddleware.Recover()
+//		...
+//	}()
+func Recover() {
+	if err := recover(); err != nil {
+		panics.Inc()
+	}
+}
+
+// Values returns metrics which you can write into TSDB, app.panics and app.errors.<name> of every error counter.
+func Values() map[string]interface{} {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	values := make(map[string]interface{}, len(errorCounters)+1)
+	values["app.panics"] = panics.Value()
+	for name, c := range errorCounters {
+		values["app.errors."+name] = c.Value()
+	}
+	return values
+}
@@ -0,0 +1,46 @@
+package metricsmiddleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverCounter(t *testing.T) {
+	before := PanicCounter().Value()
+
+	h := RecoverCounter()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	func() {
+		defer Recover()
+		panic("boom")
+	}()
+
+	assert.Equal(t, before+2, PanicCounter().Value())
+	assert.Equal(t, before+2, Values()["app.panics"])
+}
+
+func TestErrorCounter(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ErrorCounter("db.timeout").Inc()
+		}()
+	}
+	wg.Wait()
+	ErrorCounter("db.conflict").Add(2)
+
+	values := Values()
+	assert.Equal(t, int64(10), values["app.errors.db.timeout"])
+	assert.Equal(t, int64(2), values["app.errors.db.conflict"])
+}
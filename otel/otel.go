@@ -0,0 +1,202 @@
+// Package otel registers the go runtime stats and the system stats as asynchronous OpenTelemetry
+// instruments, so they can be exported by OTLP pipelines:
+//
+//	reg, err := otel.Register(meterProvider, appmetrics.Default())
+//	defer reg.Unregister()
+//
+// The runtime stats are named runtime.<key> and the system stats system.<key>. Cores, partitions,
+// disk devices and network interfaces are the attributes core, partition, device and interface
+// instead of being embedded in the names, e.g. system.disk.total{partition="/"}, and partitions also
+// have their comma separated mountpoints as the attribute mountpoints. The tags of the runtime stats,
+// such as go.os, are attributes of all observations.
+package otel
+
+import (
+	"context"
+	"strings"
+
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/smallnest/go-app-metrics/internal/promfmt"
+	"github.com/smallnest/go-app-metrics/internal/rollup"
+	"github.com/smallnest/go-app-metrics/internal/value"
+	"github.com/smallnest/go-app-metrics/metadata"
+	"github.com/smallnest/go-app-metrics/system"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ScopeName is the name of the meter of the instruments.
+const ScopeName = "github.com/smallnest/go-app-metrics"
+
+// counters are the keys of cumulative stats, which are registered as counters instead of gauges.
+var counters = map[string]bool{
+	"runtime.cpu.cgo_calls":      true,
+	"runtime.mem.total":          true,
+	"runtime.mem.lookups":        true,
+	"runtime.mem.malloc":         true,
+	"runtime.mem.frees":          true,
+	"runtime.mem.gc.count":       true,
+	"runtime.mem.gc.pause_total": true,
+	"system.cpu.user":            true,
+	"system.cpu.system":          true,
+	"system.cpu.idle":            true,
+	"system.cpu.iowait":          true,
+}
+
+// family is a group of system keys which embed a name, such as disk.<partition>.total.
+type family struct {
+	prefix    string
+	attribute string
+	// metric replaces prefix in the instrument names if not empty, so they don't clash with the
+	// instruments of the keys without a name, e.g. cpu.core0.user becomes cpu.core.user.
+	metric string
+	names  func(s *system.SystemStats) []string
+}
+
+var families = []family{
+	{prefix: "cpu.", attribute: "core", metric: "cpu.core.", names: func(s *system.SystemStats) []string { return keys(s.CPUCoreStat) }},
+	{prefix: "disk.", attribute: "partition", names: func(s *system.SystemStats) []string { return keys(s.DiskStat) }},
+	{prefix: "disk_io.", attribute: "device", names: func(s *system.SystemStats) []string { return keys(s.DiskIOStat) }},
+	{prefix: "net.", attribute: "interface", names: func(s *system.SystemStats) []string { return keys(s.BandwidthStat) }},
+}
+
+func keys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	return names
+}
+
+// observation is a value of a snapshot to be observed by the instrument name.
+type observation struct {
+	name     string
+	key      string
+	registry *metadata.Registry // describes key
+	value    float64
+	attrs    []attribute.KeyValue // attributes of the name, e.g. the partition and its mountpoints
+}
+
+// observations returns the values of snap, the rollup series of the families are omitted.
+func observations(snap *appmetrics.Snapshot) []observation {
+	var obs []observation
+	for k, v := range snap.Runtime.Values() {
+		if f, ok := value.Float64(v); ok {
+			obs = append(obs, observation{name: "runtime." + k, key: k, registry: metadata.Runtime, value: f})
+		}
+	}
+
+	names := make([][]string, len(families))
+	for i, fam := range families {
+		names[i] = fam.names(&snap.System)
+	}
+	for k, v := range snap.System.Values() {
+		f, ok := value.Float64(v)
+		if !ok {
+			continue
+		}
+		o := observation{name: "system." + k, key: k, registry: metadata.System, value: f}
+		skip := false
+		for i, fam := range families {
+			if !strings.HasPrefix(k, fam.prefix) {
+				continue
+			}
+			if strings.HasPrefix(k, fam.prefix+rollup.Name+".") {
+				skip = true
+				break
+			}
+			name, ok := promfmt.Name(k, fam.prefix, names[i])
+			if !ok {
+				continue
+			}
+			metric := fam.prefix
+			if fam.metric != "" {
+				metric = fam.metric
+			}
+			o.name = "system." + metric + k[len(fam.prefix)+len(name)+1:]
+			o.attrs = []attribute.KeyValue{attribute.String(fam.attribute, name)}
+			if mountpoints := snap.System.DiskStat[name].Mountpoints; fam.prefix == "disk." && len(mountpoints) > 0 {
+				o.attrs = append(o.attrs, attribute.String("mountpoints", strings.Join(mountpoints, ",")))
+			}
+			break
+		}
+		if !skip {
+			obs = append(obs, o)
+		}
+	}
+	return obs
+}
+
+// instrument is a registered instrument, values are multiplied by scale before being observed.
+type instrument struct {
+	observable metric.Float64Observable
+	scale      float64
+}
+
+// Register registers the stats as instruments of the meter ScopeName of mp. The instruments are
+// determined by the latest snapshot of r when Register is called, and the callback observes the
+// snapshot returned by r.Demand, which starts the collection loop of r while the stats are read.
+// Stats which first appear in later snapshots have no instrument and aren't observed, e.g. the
+// per-core stats after PerCPU has been enabled or the stats of a probe enabled by a profile, so
+// configure r before calling Register, or register again after reconfiguring it.
+// Durations and timestamps in nanoseconds are observed in seconds.
+func Register(mp metric.MeterProvider, r *appmetrics.Runner) (metric.Registration, error) {
+	meter := mp.Meter(ScopeName)
+
+	instruments := make(map[string]instrument)
+	var observables []metric.Observable
+	for _, o := range observations(r.Demand()) {
+		if _, ok := instruments[o.name]; ok {
+			continue
+		}
+
+		m, _ := o.registry.Lookup(o.key)
+		unit, scale := "", 1.0
+		switch m.Unit {
+		case metadata.Bytes:
+			unit = "By"
+		case metadata.Nanoseconds, metadata.Timestamp:
+			unit, scale = "s", 1e-9
+		case metadata.Ratio:
+			unit = "1"
+		}
+
+		var (
+			obs metric.Float64Observable
+			err error
+		)
+		if counters[o.name] {
+			obs, err = meter.Float64ObservableCounter(o.name, metric.WithDescription(m.Help), metric.WithUnit(unit))
+		} else {
+			obs, err = meter.Float64ObservableGauge(o.name, metric.WithDescription(m.Help), metric.WithUnit(unit))
+		}
+		if err != nil {
+			return nil, err
+		}
+		instruments[o.name] = instrument{observable: obs, scale: scale}
+		observables = append(observables, obs)
+	}
+
+	return meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		snap := r.Demand()
+
+		tags := snap.AllTags()
+		base := make([]attribute.KeyValue, 0, len(tags)+1)
+		for k, v := range tags {
+			base = append(base, attribute.String(k, v))
+		}
+
+		for _, o := range observations(snap) {
+			inst, ok := instruments[o.name]
+			if !ok {
+				continue
+			}
+			attrs := base
+			if o.attrs != nil {
+				attrs = append(attrs[:len(base):len(base)], o.attrs...)
+			}
+			observer.ObserveFloat64(inst.observable, o.value*inst.scale, metric.WithAttributes(attrs...))
+		}
+		return nil
+	}, observables...)
+}
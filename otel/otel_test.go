@@ -0,0 +1,81 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/system"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRegister(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	r := appmetrics.NewRunner(nil)
+	reg, err := Register(mp, r)
+	assert.NoError(t, err)
+	defer reg.Unregister()
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+	assert.Len(t, rm.ScopeMetrics, 1)
+
+	metrics := make(map[string]metricdata.Metrics)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	goroutines, ok := metrics["runtime.cpu.goroutines"].Data.(metricdata.Gauge[float64])
+	assert.True(t, ok)
+	assert.True(t, goroutines.DataPoints[0].Value > 0)
+	os, _ := goroutines.DataPoints[0].Attributes.Value("go.os")
+	assert.NotEmpty(t, os.AsString())
+
+	_, ok = metrics["runtime.mem.total"].Data.(metricdata.Sum[float64])
+	assert.True(t, ok)
+	assert.Equal(t, "By", metrics["runtime.mem.alloc"].Unit)
+	assert.Equal(t, "s", metrics["runtime.mem.gc.pause_total"].Unit)
+}
+
+func TestObservations(t *testing.T) {
+	sstats := system.SystemStats{
+		DiskStat:      map[string]system.DiskStat{"/": {Total: 10, Mountpoints: []string{"/", "/mnt"}}},
+		BandwidthStat: map[string]system.BandwidthStat{"eth0": {BytesSent: 7}},
+	}
+	snap := appmetrics.NewSnapshot(rmetric.RuntimeStats{}, sstats)
+
+	obs := make(map[string][]observation)
+	for _, o := range observations(snap) {
+		obs[o.name] = append(obs[o.name], o)
+	}
+	assert.Len(t, obs["system.disk.total"], 1)
+	assert.Equal(t, []attribute.KeyValue{attribute.String("partition", "/"), attribute.String("mountpoints", "/,/mnt")},
+		obs["system.disk.total"][0].attrs)
+	assert.Equal(t, 10.0, obs["system.disk.total"][0].value)
+	assert.Equal(t, []attribute.KeyValue{attribute.String("interface", "eth0")}, obs["system.net.bytes_sent"][0].attrs)
+	assert.NotContains(t, obs, "system.disk.total.total")
+	assert.Contains(t, obs, "system.mem.total")
+	assert.Contains(t, obs, "runtime.mem.total")
+}
+
+func TestObservationsOverlappingNames(t *testing.T) {
+	sstats := system.SystemStats{
+		BandwidthStat: map[string]system.BandwidthStat{"eth0": {BytesSent: 1}, "eth0.100": {BytesSent: 2}},
+	}
+	snap := appmetrics.NewSnapshot(rmetric.RuntimeStats{}, sstats)
+	for i := 0; i < 20; i++ {
+		sent := make(map[string]float64)
+		for _, o := range observations(snap) {
+			if o.name == "system.net.bytes_sent" {
+				sent[o.attrs[0].Value.AsString()] = o.value
+			}
+		}
+		assert.Equal(t, map[string]float64{"eth0": 1, "eth0.100": 2}, sent)
+	}
+}
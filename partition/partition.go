@@ -0,0 +1,251 @@
+// Package partition provides custom metrics partitioned by label sets, e.g. per tenant or per
+// worker shard, so resources can be attributed to partitions instead of only the whole process:
+//
+//	r := partition.NewRegistry()
+//	shard := r.With(partition.Labels{"shard": "3"})
+//	shard.Counter("jobs.processed").Inc()
+//	shard.Gauge("queue.depth").Set(12)
+//
+//	stats := r.Snapshot(partition.Labels{"shard": "3"})
+package partition
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Labels is a label set identifying a partition.
+type Labels map[string]string
+
+// String returns the labels sorted by name in the Prometheus format, e.g. {shard="3",tenant="acme"},
+// or an empty string if there is no label.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelReplacer.Replace(l[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// matches reports whether l contains all labels of selector.
+func (l Labels) matches(selector Labels) bool {
+	for name, v := range selector {
+		if lv, ok := l[name]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (l Labels) clone() Labels {
+	c := make(Labels, len(l))
+	for k, v := range l {
+		c[k] = v
+	}
+	return c
+}
+
+// Counter is a cumulative counter. It is safe for use from multiple go routines.
+type Counter struct {
+	n int64
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.n, 1)
+}
+
+// Add increments the counter by n.
+func (c *Counter) Add(n int64) {
+	atomic.AddInt64(&c.n, n)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// Gauge is a value which can go up and down. It is safe for use from multiple go routines.
+type Gauge struct {
+	bits uint64
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Add adds delta to the gauge.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		n := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&g.bits, old, n) {
+			return
+		}
+	}
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// Partition groups the custom metrics of a label set. It is safe for use from multiple go routines.
+type Partition struct {
+	labels Labels
+
+	mu       sync.Mutex
+	counters map[string]*Counter
+	gauges   map[string]*Gauge
+}
+
+// Labels returns the labels of the partition.
+func (p *Partition) Labels() Labels {
+	return p.labels.clone()
+}
+
+// Counter returns the counter name of the partition, creating it if it doesn't exist.
+func (p *Partition) Counter(name string) *Counter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, ok := p.counters[name]
+	if !ok {
+		c = &Counter{}
+		p.counters[name] = c
+	}
+	return c
+}
+
+// Gauge returns the gauge name of the partition, creating it if it doesn't exist.
+func (p *Partition) Gauge(name string) *Gauge {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	g, ok := p.gauges[name]
+	if !ok {
+		g = &Gauge{}
+		p.gauges[name] = g
+	}
+	return g
+}
+
+// Registry holds the partitions. It is safe for use from multiple go routines.
+type Registry struct {
+	mu         sync.Mutex
+	partitions map[string]*Partition // keyed by Labels.String()
+}
+
+// NewRegistry creates a Registry without partitions.
+func NewRegistry() *Registry {
+	return &Registry{partitions: make(map[string]*Partition)}
+}
+
+// With returns the partition of labels, creating it if it doesn't exist.
+func (r *Registry) With(labels Labels) *Partition {
+	key := labels.String()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.partitions[key]
+	if !ok {
+		p = &Partition{
+			labels:   labels.clone(),
+			counters: make(map[string]*Counter),
+			gauges:   make(map[string]*Gauge),
+		}
+		r.partitions[key] = p
+	}
+	return p
+}
+
+// Remove removes the partition of labels, e.g. after a tenant has been removed.
+func (r *Registry) Remove(labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.partitions, labels.String())
+}
+
+// Snapshot returns the current metrics of the partitions whose labels contain all labels of selector.
+// A nil selector selects all partitions.
+func (r *Registry) Snapshot(selector Labels) PartitionStats {
+	r.mu.Lock()
+	var selected []*Partition
+	for _, p := range r.partitions {
+		if p.labels.matches(selector) {
+			selected = append(selected, p)
+		}
+	}
+	r.mu.Unlock()
+
+	stats := PartitionStats{Partitions: make([]PartitionStat, 0, len(selected))}
+	for _, p := range selected {
+		stat := PartitionStat{
+			Labels: p.labels.clone(),
+			Values: make(map[string]interface{}),
+		}
+		p.mu.Lock()
+		for name, c := range p.counters {
+			stat.Values[name] = c.Value()
+		}
+		for name, g := range p.gauges {
+			stat.Values[name] = g.Value()
+		}
+		p.mu.Unlock()
+		stats.Partitions = append(stats.Partitions, stat)
+	}
+	sort.Slice(stats.Partitions, func(i, j int) bool {
+		return stats.Partitions[i].Labels.String() < stats.Partitions[j].Labels.String()
+	})
+	return stats
+}
+
+// PartitionStats represents the metrics of partitions.
+type PartitionStats struct {
+	Partitions []PartitionStat
+}
+
+// PartitionStat represents the metrics of a partition, counters as int64 and gauges as float64.
+type PartitionStat struct {
+	Labels Labels
+	Values map[string]interface{}
+}
+
+// Values returns metrics which you can write into TSDB. The labels of a partition are appended to the
+// keys of its metrics in the Prometheus format, e.g. jobs.processed{shard="3"}, so the keys are unique.
+// The exporters of this module don't split them into labels; to write the labels as tags, iterate
+// Partitions and use the Labels and Values of each partition.
+func (s *PartitionStats) Values() map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, p := range s.Partitions {
+		labels := p.Labels.String()
+		for k, v := range p.Values {
+			values[k+labels] = v
+		}
+	}
+	return values
+}
@@ -0,0 +1,39 @@
+package partition
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabels(t *testing.T) {
+	assert.Equal(t, "", Labels{}.String())
+	assert.Equal(t, `{shard="3",tenant="a\"b"}`, Labels{"tenant": `a"b`, "shard": "3"}.String())
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	a := r.With(Labels{"tenant": "a", "shard": "1"})
+	a.Counter("jobs").Inc()
+	a.Counter("jobs").Add(2)
+	a.Gauge("depth").Set(3)
+	a.Gauge("depth").Add(1.5)
+	assert.Same(t, a, r.With(Labels{"shard": "1", "tenant": "a"}))
+
+	b := r.With(Labels{"tenant": "b", "shard": "1"})
+	b.Counter("jobs").Inc()
+
+	stats := r.Snapshot(Labels{"tenant": "a"})
+	assert.Len(t, stats.Partitions, 1)
+	assert.Equal(t, int64(3), stats.Partitions[0].Values["jobs"])
+	assert.Equal(t, 4.5, stats.Partitions[0].Values["depth"])
+
+	stats = r.Snapshot(Labels{"shard": "1"})
+	assert.Len(t, stats.Partitions, 2)
+	values := stats.Values()
+	assert.Equal(t, int64(3), values[`jobs{shard="1",tenant="a"}`])
+	assert.Equal(t, int64(1), values[`jobs{shard="1",tenant="b"}`])
+
+	r.Remove(Labels{"tenant": "b", "shard": "1"})
+	assert.Len(t, r.Snapshot(nil).Partitions, 1)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package perfcounter
+
+type query struct{}
+
+func openQuery([]Counter) (*query, error) {
+	return nil, ErrNotSupported
+}
+
+func (*query) collect() map[string]float64 {
+	return nil
+}
+
+func (*query) close() error {
+	return nil
+}
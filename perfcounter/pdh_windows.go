@@ -0,0 +1,100 @@
+//go:build windows
+
+package perfcounter
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	pdh                             = windows.NewLazySystemDLL("pdh.dll")
+	procPdhOpenQueryW               = pdh.NewProc("PdhOpenQueryW")
+	procPdhAddEnglishCounterW       = pdh.NewProc("PdhAddEnglishCounterW")
+	procPdhCollectQueryData         = pdh.NewProc("PdhCollectQueryData")
+	procPdhGetFormattedCounterValue = pdh.NewProc("PdhGetFormattedCounterValue")
+	procPdhCloseQuery               = pdh.NewProc("PdhCloseQuery")
+)
+
+const (
+	errorSuccess    = 0
+	pdhFmtDouble    = 0x00000200
+	pdhCstatusValid = 0
+	pdhCstatusNew   = 1
+)
+
+// pdhFmtCounterValueDouble is PDH_FMT_COUNTERVALUE with the double member of the union.
+type pdhFmtCounterValueDouble struct {
+	CStatus     uint32
+	_           uint32
+	DoubleValue float64
+}
+
+type query struct {
+	mu       sync.Mutex
+	handle   uintptr
+	counters map[string]uintptr
+}
+
+func openQuery(counters []Counter) (*query, error) {
+	q := &query{counters: make(map[string]uintptr, len(counters))}
+	if r, _, _ := procPdhOpenQueryW.Call(0, 0, uintptr(unsafe.Pointer(&q.handle))); r != errorSuccess {
+		return nil, fmt.Errorf("perfcounter: PdhOpenQuery failed with 0x%x", r)
+	}
+
+	for _, c := range counters {
+		path, err := windows.UTF16PtrFromString(c.Path)
+		if err != nil {
+			q.close()
+			return nil, err
+		}
+		var h uintptr
+		if r, _, _ := procPdhAddEnglishCounterW.Call(q.handle, uintptr(unsafe.Pointer(path)), 0, uintptr(unsafe.Pointer(&h))); r != errorSuccess {
+			q.close()
+			return nil, fmt.Errorf("perfcounter: invalid counter %q: 0x%x", c.Path, r)
+		}
+		q.counters[c.Key] = h
+	}
+
+	// rate counters need two samples, collect the first one now
+	procPdhCollectQueryData.Call(q.handle)
+	return q, nil
+}
+
+func (q *query) collect() map[string]float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	values := make(map[string]float64, len(q.counters))
+	if r, _, _ := procPdhCollectQueryData.Call(q.handle); r != errorSuccess {
+		return values
+	}
+
+	for key, h := range q.counters {
+		var v pdhFmtCounterValueDouble
+		r, _, _ := procPdhGetFormattedCounterValue.Call(h, pdhFmtDouble, 0, uintptr(unsafe.Pointer(&v)))
+		if r != errorSuccess || (v.CStatus != pdhCstatusValid && v.CStatus != pdhCstatusNew) {
+			continue
+		}
+		values[key] = v.DoubleValue
+	}
+	return values
+}
+
+func (q *query) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.handle == 0 {
+		return nil
+	}
+	r, _, _ := procPdhCloseQuery.Call(q.handle)
+	q.handle = 0
+	if r != errorSuccess {
+		return fmt.Errorf("perfcounter: PdhCloseQuery failed with 0x%x", r)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// Package perfcounter provides a collector of custom Windows performance counters, such as
+// `\Processor(_Total)\% Processor Time`, exported like native metrics.
+// It is only supported on Windows, New returns ErrNotSupported on other platforms.
+package perfcounter
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotSupported is returned by New on platforms other than Windows.
+var ErrNotSupported = errors.New("perfcounter: performance counters are only supported on windows")
+
+// Counter is a performance counter to collect.
+type Counter struct {
+	// Key is the metric key of the counter, e.g. processor.total.time_percent.
+	Key string
+	// Path is the english counter path, e.g. `\Processor(_Total)\% Processor Time`.
+	Path string
+}
+
+// PerfStatsHandler represents a handler to handle stats after successfully gathering statistics
+type PerfStatsHandler func(PerfStats)
+
+// Collector implements the periodic collection of performance counters to a PerfStatsHandler.
+type Collector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	query        *query
+	statsHandler PerfStatsHandler
+}
+
+// New creates a new Collector of the counters that will periodically output statistics to statsHandler.
+// It returns an error if a counter path is invalid. The Collector must be closed after use.
+func New(statsHandler PerfStatsHandler, counters ...Counter) (*Collector, error) {
+	if statsHandler == nil {
+		statsHandler = func(PerfStats) {}
+	}
+
+	q, err := openQuery(counters)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Collector{
+		CollectInterval: 10 * time.Second,
+		query:           q,
+		statsHandler:    statsHandler,
+	}, nil
+}
+
+// Run gathers statistics then outputs them to the configured PerfStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *Collector) Run() {
+	c.statsHandler(c.Once())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.Once())
+		}
+	}
+}
+
+// Once returns the current values of the counters. Rate counters, like % Processor Time,
+// are calculated since the previous collection.
+func (c *Collector) Once() PerfStats {
+	return PerfStats{Counters: c.query.collect()}
+}
+
+// Close releases the resources of the counters.
+func (c *Collector) Close() error {
+	return c.query.close()
+}
+
+// PerfStats represents the values of the counters keyed by Counter.Key.
+// Counters without a valid value are omitted.
+type PerfStats struct {
+	Counters map[string]float64
+}
+
+// Values returns metrics which you can write into TSDB.
+func (s *PerfStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Counters))
+	for k, v := range s.Counters {
+		values[k] = v
+	}
+	return values
+}
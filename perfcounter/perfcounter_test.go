@@ -0,0 +1,30 @@
+package perfcounter
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	c, err := New(nil, Counter{Key: "processor.total.time_percent", Path: `\Processor(_Total)\% Processor Time`})
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, ErrNotSupported, err)
+		return
+	}
+	assert.Nil(t, err)
+	defer c.Close()
+
+	stats := c.Once()
+	assert.Contains(t, stats.Values(), "processor.total.time_percent")
+}
+
+func TestInvalidCounter(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("Skipping test because performance counters are only supported on windows")
+	}
+
+	_, err := New(nil, Counter{Key: "invalid", Path: `\NoSuchObject\NoSuchCounter`})
+	assert.NotNil(t, err)
+}
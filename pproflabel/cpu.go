@@ -0,0 +1,147 @@
+package pproflabel
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"time"
+)
+
+// CPUStatsHandler represents a handler to handle stats after successfully gathering statistics
+type CPUStatsHandler func(CPUStats)
+
+// CPUCollector attributes approximate CPU time to pprof label values by sampling the CPU profile.
+// It is experimental. Every collection profiles the process for ProfileDuration, which fails if
+// another CPU profile is running, e.g. one captured by net/http/pprof.
+//
+// Heap bytes can't be attributed the same way because go heap profiles don't record pprof labels.
+type CPUCollector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// ProfileDuration is the duration profiled in every collection, which bounds the overhead.
+	// Defaults to 1 second.
+	ProfileDuration time.Duration
+
+	// Labels are the label keys to aggregate CPU time by.
+	Labels []string
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	statsHandler CPUStatsHandler
+}
+
+// NewCPUCollector creates a new CPUCollector that will periodically output CPU time grouped by the
+// given label keys to statsHandler.
+func NewCPUCollector(statsHandler CPUStatsHandler, labels ...string) *CPUCollector {
+	if statsHandler == nil {
+		statsHandler = func(CPUStats) {}
+	}
+
+	return &CPUCollector{
+		CollectInterval: 10 * time.Second,
+		ProfileDuration: time.Second,
+		Labels:          labels,
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured CPUStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *CPUCollector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once profiles the process for ProfileDuration and returns the CPU time grouped by labels.
+func (c *CPUCollector) Once() CPUStats {
+	return c.collectStats()
+}
+
+func (c *CPUCollector) collectStats() CPUStats {
+	stats := CPUStats{
+		Seconds: make(map[string]map[string]float64, len(c.Labels)),
+	}
+	for _, l := range c.Labels {
+		stats.Seconds[l] = make(map[string]float64)
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		stats.Err = err
+		return stats
+	}
+	start := time.Now()
+	select {
+	case <-time.After(c.ProfileDuration):
+	case <-c.Done:
+	}
+	pprof.StopCPUProfile()
+	stats.Window = time.Since(start)
+
+	p, err := parseProfile(buf.Bytes())
+	if err != nil {
+		stats.Err = err
+		return stats
+	}
+
+	for _, s := range p.samples {
+		// the values of CPU profiles are the number of samples and the CPU time in nanoseconds
+		if len(s.values) < 2 {
+			continue
+		}
+		sec := float64(s.values[1]) / float64(time.Second)
+		stats.Total += sec
+		for _, l := range c.Labels {
+			v, ok := s.labels[l]
+			if !ok {
+				v = Unlabeled
+			}
+			stats.Seconds[l][v] += sec
+		}
+	}
+
+	return stats
+}
+
+// CPUStats represents the CPU time grouped by label values during a profile window.
+type CPUStats struct {
+	// Window is the duration profiled.
+	Window time.Duration
+	// Total is the CPU seconds of the process in the window.
+	Total float64
+	// Seconds maps label key to the CPU seconds per label value in the window.
+	Seconds map[string]map[string]float64
+	// Err is the error of profiling.
+	Err error
+}
+
+// Values returns metrics which you can write into TSDB, keyed as cpu.label.<label>.<value>,
+// the average number of cores used in the window.
+func (s *CPUStats) Values() map[string]interface{} {
+	values := make(map[string]interface{})
+	if s.Window <= 0 {
+		return values
+	}
+	window := s.Window.Seconds()
+	values["cpu.label.total"] = s.Total / window
+	for l, secs := range s.Seconds {
+		for v, sec := range secs {
+			values["cpu.label."+l+"."+v] = sec / window
+		}
+	}
+	return values
+}
@@ -0,0 +1,42 @@
+package pproflabel
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPUCollectorOnce(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test because testing.Short is enabled")
+	}
+
+	var stop int32
+	pprof.Do(context.Background(), pprof.Labels("component", "ingest"), func(context.Context) {
+		go func() {
+			n := 0
+			for atomic.LoadInt32(&stop) == 0 {
+				n++
+			}
+		}()
+	})
+	defer atomic.StoreInt32(&stop, 1)
+
+	c := NewCPUCollector(nil, "component")
+	c.ProfileDuration = 500 * time.Millisecond
+	stats := c.Once()
+
+	assert.Nil(t, stats.Err)
+	assert.True(t, stats.Total > 0)
+	assert.True(t, stats.Seconds["component"]["ingest"] > 0)
+	assert.Contains(t, stats.Values(), "cpu.label.component.ingest")
+}
+
+func TestParseProfileMalformed(t *testing.T) {
+	_, err := parseProfile([]byte{0x12, 0xff})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,163 @@
+// Package pproflabel provides method to break down go runtime metrics by pprof labels,
+// so applications can see which subsystem owns the goroutines and uses the CPU.
+//
+// Label goroutines with pprof.Do or pprof.SetGoroutineLabels, e.g.
+//
+//	pprof.Do(ctx, pprof.Labels("handler", "upload"), func(ctx context.Context) { ... })
+package pproflabel
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unlabeled is the label value used for goroutines which don't have the label.
+const Unlabeled = "unlabeled"
+
+// GoroutineStatsHandler represents a handler to handle stats after successfully gathering statistics
+type GoroutineStatsHandler func(GoroutineStats)
+
+// GoroutineCollector implements the periodic sampling of the goroutine profile to a GoroutineStatsHandler.
+type GoroutineCollector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Labels are the label keys to aggregate goroutines by.
+	Labels []string
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	statsHandler GoroutineStatsHandler
+}
+
+// NewGoroutineCollector creates a new GoroutineCollector that will periodically output goroutine counts
+// grouped by the given label keys to statsHandler.
+func NewGoroutineCollector(statsHandler GoroutineStatsHandler, labels ...string) *GoroutineCollector {
+	if statsHandler == nil {
+		statsHandler = func(GoroutineStats) {}
+	}
+
+	return &GoroutineCollector{
+		CollectInterval: 10 * time.Second,
+		Labels:          labels,
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured GoroutineStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *GoroutineCollector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the goroutine counts grouped by labels. It is safe for use from multiple go routines。
+func (c *GoroutineCollector) Once() GoroutineStats {
+	return c.collectStats()
+}
+
+func (c *GoroutineCollector) collectStats() GoroutineStats {
+	stats := GoroutineStats{
+		Counts: make(map[string]map[string]int64, len(c.Labels)),
+	}
+	for _, l := range c.Labels {
+		stats.Counts[l] = make(map[string]int64)
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return stats
+	}
+
+	for _, g := range parseGoroutineProfile(&buf) {
+		stats.Total += g.count
+		for _, l := range c.Labels {
+			v, ok := g.labels[l]
+			if !ok {
+				v = Unlabeled
+			}
+			stats.Counts[l][v] += g.count
+		}
+	}
+
+	return stats
+}
+
+type goroutineGroup struct {
+	count  int64
+	labels map[string]string
+}
+
+// parseGoroutineProfile parses the goroutine profile in debug=1 format.
+func parseGoroutineProfile(buf *bytes.Buffer) []goroutineGroup {
+	var groups []goroutineGroup
+
+	scanner := bufio.NewScanner(buf)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "# labels: ") {
+			if len(groups) > 0 {
+				labels := make(map[string]string)
+				if json.Unmarshal([]byte(strings.TrimPrefix(line, "# labels: ")), &labels) == nil {
+					groups[len(groups)-1].labels = labels
+				}
+			}
+			continue
+		}
+
+		// a new stack starts with "<count> @ <pc>..."
+		i := strings.Index(line, " @ ")
+		if i <= 0 {
+			continue
+		}
+		count, err := strconv.ParseInt(line[:i], 10, 64)
+		if err != nil {
+			continue
+		}
+		groups = append(groups, goroutineGroup{count: count})
+	}
+
+	return groups
+}
+
+// GoroutineStats represents the number of goroutines grouped by label values.
+type GoroutineStats struct {
+	// Total is the number of all goroutines.
+	Total int64
+	// Counts maps label key to the number of goroutines per label value.
+	Counts map[string]map[string]int64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as goroutines.<label>.<value>.
+func (s *GoroutineStats) Values() map[string]interface{} {
+	values := map[string]interface{}{
+		"goroutines.total": s.Total,
+	}
+	for l, counts := range s.Counts {
+		for v, n := range counts {
+			values["goroutines."+l+"."+v] = n
+		}
+	}
+	return values
+}
@@ -0,0 +1,36 @@
+package pproflabel
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoroutineCollectorOnce(t *testing.T) {
+	done := make(chan struct{})
+	started := make(chan struct{})
+	pprof.Do(context.Background(), pprof.Labels("handler", "upload"), func(context.Context) {
+		for i := 0; i < 3; i++ {
+			go func() {
+				started <- struct{}{}
+				<-done
+			}()
+		}
+	})
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+	defer close(done)
+
+	c := NewGoroutineCollector(nil, "handler")
+	stats := c.Once()
+
+	assert.Equal(t, int64(3), stats.Counts["handler"]["upload"])
+	assert.True(t, stats.Counts["handler"][Unlabeled] >= 1)
+
+	values := stats.Values()
+	assert.Equal(t, int64(3), values["goroutines.handler.upload"])
+	assert.Equal(t, stats.Total, values["goroutines.total"])
+}
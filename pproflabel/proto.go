@@ -0,0 +1,171 @@
+package pproflabel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// errMalformed is returned if a profile can't be decoded.
+var errMalformed = errors.New("pproflabel: malformed profile")
+
+// sample is a sample of a profile with its labels resolved.
+type sample struct {
+	values []int64
+	labels map[string]string
+}
+
+// cpuProfile is the part of a profile.proto message used for attribution.
+type cpuProfile struct {
+	samples []sample
+}
+
+// rawSample is a sample whose labels are still indexes of the string table.
+type rawSample struct {
+	values []int64
+	labels [][2]int64 // key, str
+}
+
+// parseProfile decodes a gzipped profile.proto, as written by pprof.StartCPUProfile.
+// Only the values and string labels of the samples are decoded.
+func parseProfile(data []byte) (*cpuProfile, error) {
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+
+	var raws []rawSample
+	var strs []string
+	err := eachField(data, func(num int, wire int, v uint64, b []byte) error {
+		switch {
+		case num == 2 && wire == 2: // sample
+			s, err := parseSample(b)
+			if err != nil {
+				return err
+			}
+			raws = append(raws, s)
+		case num == 6 && wire == 2: // string_table
+			strs = append(strs, string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	str := func(i int64) string {
+		if i < 0 || i >= int64(len(strs)) {
+			return ""
+		}
+		return strs[i]
+	}
+	p := &cpuProfile{samples: make([]sample, 0, len(raws))}
+	for _, r := range raws {
+		s := sample{values: r.values}
+		if len(r.labels) > 0 {
+			s.labels = make(map[string]string, len(r.labels))
+			for _, l := range r.labels {
+				s.labels[str(l[0])] = str(l[1])
+			}
+		}
+		p.samples = append(p.samples, s)
+	}
+	return p, nil
+}
+
+func parseSample(data []byte) (rawSample, error) {
+	var s rawSample
+	err := eachField(data, func(num int, wire int, v uint64, b []byte) error {
+		switch num {
+		case 2: // value, packed or not
+			if wire == 0 {
+				s.values = append(s.values, int64(v))
+				return nil
+			}
+			for len(b) > 0 {
+				x, n := binary.Uvarint(b)
+				if n <= 0 {
+					return errMalformed
+				}
+				s.values = append(s.values, int64(x))
+				b = b[n:]
+			}
+		case 3: // label
+			var key, str int64
+			err := eachField(b, func(num int, wire int, v uint64, _ []byte) error {
+				switch num {
+				case 1:
+					key = int64(v)
+				case 2:
+					str = int64(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if str != 0 {
+				s.labels = append(s.labels, [2]int64{key, str})
+			}
+		}
+		return nil
+	})
+	return s, err
+}
+
+// eachField calls fn with every field of a protobuf message. v is the value of varint fields,
+// b is the payload of length-delimited fields. Fixed-size fields are skipped.
+func eachField(data []byte, fn func(num int, wire int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errMalformed
+		}
+		data = data[n:]
+		num, wire := int(key>>3), int(key&7)
+
+		var v uint64
+		var b []byte
+		switch wire {
+		case 0:
+			v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errMalformed
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return errMalformed
+			}
+			data = data[8:]
+			continue
+		case 2:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return errMalformed
+			}
+			b = data[n : n+int(l)]
+			data = data[n+int(l):]
+		case 5:
+			if len(data) < 4 {
+				return errMalformed
+			}
+			data = data[4:]
+			continue
+		default:
+			return errMalformed
+		}
+
+		if err := fn(num, wire, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
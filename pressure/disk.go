@@ -0,0 +1,184 @@
+package pressure
+
+import (
+	"sync"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/safe"
+	"github.com/smallnest/go-app-metrics/system"
+)
+
+// DiskWatermarks are the watermarks of the free space of a partition in percent, 0 disables them.
+type DiskWatermarks struct {
+	SoftFreePercent float64
+	HardFreePercent float64
+}
+
+// DiskPressure is passed to the callbacks of a DiskGuard.
+type DiskPressure struct {
+	// Partition is the key of the partition in system.SystemStats.DiskStat, e.g. a mountpoint.
+	Partition   string
+	Level       Level
+	Total       uint64
+	Free        uint64
+	FreePercent float64
+}
+
+// diskPartition is the state of a watched partition.
+type diskPartition struct {
+	watermarks DiskWatermarks
+	callbacks  []func(DiskPressure) error
+	level      Level
+	lastAction time.Time
+	stats      DiskPressureStat
+}
+
+// DiskGuard invokes callbacks, e.g. to rotate logs or clean temporary files, when the free space of
+// a partition falls below watermarks. Callbacks are invoked when the level rises, and again after
+// Cooldown if it stays above Normal. It is safe for use from multiple go routines.
+type DiskGuard struct {
+	// Cooldown is the minimum duration between the reactions for a partition while the level doesn't rise.
+	// Defaults to 1 minute.
+	Cooldown time.Duration
+
+	mu         sync.Mutex
+	partitions map[string]*diskPartition
+}
+
+// NewDiskGuard creates a DiskGuard without watched partitions.
+func NewDiskGuard() *DiskGuard {
+	return &DiskGuard{
+		Cooldown:   time.Minute,
+		partitions: make(map[string]*diskPartition),
+	}
+}
+
+func (g *DiskGuard) partition(name string) *diskPartition {
+	p, ok := g.partitions[name]
+	if !ok {
+		p = &diskPartition{}
+		g.partitions[name] = p
+	}
+	return p
+}
+
+// Watch sets the watermarks of partition.
+func (g *DiskGuard) Watch(partition string, w DiskWatermarks) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.partition(partition).watermarks = w
+}
+
+// OnPressure registers fn to be called when the pressure of partition reaches Soft or Hard.
+// The error returned by fn is recorded as the outcome of the action, a panic counts as a failure.
+func (g *DiskGuard) OnPressure(partition string, fn func(DiskPressure) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.partition(partition)
+	p.callbacks = append(p.callbacks, fn)
+}
+
+// SystemStatsHandler feeds the disk stats into the guard. It can be used as a system.SystemStatsHandler.
+func (g *DiskGuard) SystemStatsHandler(stats system.SystemStats) {
+	now := time.Now()
+	for partition, stat := range stats.DiskStat {
+		g.Observe(partition, stat.Total, stat.Free, now)
+	}
+}
+
+// Observe feeds the total and free bytes of partition observed at t into the guard, reacts if needed
+// and returns the pressure level. Partitions without watermarks are ignored.
+func (g *DiskGuard) Observe(partition string, total, free uint64, t time.Time) Level {
+	g.mu.Lock()
+	p, ok := g.partitions[partition]
+	if !ok || total == 0 {
+		g.mu.Unlock()
+		return Normal
+	}
+
+	percent := float64(free) / float64(total) * 100
+	var l Level
+	switch w := p.watermarks; {
+	case w.HardFreePercent > 0 && percent <= w.HardFreePercent:
+		l = Hard
+	case w.SoftFreePercent > 0 && percent <= w.SoftFreePercent:
+		l = Soft
+	}
+
+	prev := p.level
+	p.level = l
+	p.stats.Level = l
+	if l == Normal || (l <= prev && t.Sub(p.lastAction) < g.Cooldown) {
+		g.mu.Unlock()
+		return l
+	}
+
+	p.lastAction = t
+	if l == Hard {
+		p.stats.HardTriggers++
+	} else {
+		p.stats.SoftTriggers++
+	}
+	callbacks := make([]func(DiskPressure) error, len(p.callbacks))
+	copy(callbacks, p.callbacks)
+	g.mu.Unlock()
+
+	dp := DiskPressure{Partition: partition, Level: l, Total: total, Free: free, FreePercent: percent}
+	var succeeded, failed int64
+	for _, fn := range callbacks {
+		var err error
+		perr := safe.Call(func(dp DiskPressure) { err = fn(dp) }, dp)
+		if perr != nil || err != nil {
+			failed++
+		} else {
+			succeeded++
+		}
+	}
+
+	g.mu.Lock()
+	p.stats.Succeeded += succeeded
+	p.stats.Failed += failed
+	g.mu.Unlock()
+	return l
+}
+
+// Stats returns the current levels and the cumulative counters of the reactions keyed by partition.
+func (g *DiskGuard) Stats() DiskPressureStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	stats := DiskPressureStats{Partitions: make(map[string]DiskPressureStat, len(g.partitions))}
+	for name, p := range g.partitions {
+		stats.Partitions[name] = p.stats
+	}
+	return stats
+}
+
+// DiskPressureStats represents the disk pressure and the reactions taken keyed by partition.
+type DiskPressureStats struct {
+	Partitions map[string]DiskPressureStat
+}
+
+// DiskPressureStat represents the pressure of a partition and the reactions taken.
+type DiskPressureStat struct {
+	Level        Level
+	SoftTriggers int64
+	HardTriggers int64
+	// Succeeded and Failed are the numbers of callback invocations by outcome.
+	Succeeded int64
+	Failed    int64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as disk.<partition>.pressure.<metric>.
+func (s *DiskPressureStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Partitions)*5)
+	for name, stat := range s.Partitions {
+		prefix := "disk." + name + ".pressure."
+		values[prefix+"level"] = int64(stat.Level)
+		values[prefix+"soft_triggers"] = stat.SoftTriggers
+		values[prefix+"hard_triggers"] = stat.HardTriggers
+		values[prefix+"succeeded"] = stat.Succeeded
+		values[prefix+"failed"] = stat.Failed
+	}
+	return values
+}
@@ -0,0 +1,40 @@
+package pressure
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/system"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskGuard(t *testing.T) {
+	g := NewDiskGuard()
+	g.Watch("/var", DiskWatermarks{SoftFreePercent: 20, HardFreePercent: 5})
+
+	var got []DiskPressure
+	g.OnPressure("/var", func(p DiskPressure) error {
+		got = append(got, p)
+		return nil
+	})
+	g.OnPressure("/var", func(DiskPressure) error { return errors.New("rotate failed") })
+
+	now := time.Now()
+	assert.Equal(t, Normal, g.Observe("/var", 100, 50, now))
+	assert.Equal(t, Normal, g.Observe("/tmp", 100, 1, now))
+	assert.Equal(t, Soft, g.Observe("/var", 100, 10, now))
+	assert.Equal(t, Soft, g.Observe("/var", 100, 9, now.Add(time.Second)))
+	assert.Equal(t, Hard, g.Observe("/var", 100, 5, now.Add(2*time.Second)))
+
+	assert.Len(t, got, 2)
+	assert.Equal(t, Hard, got[1].Level)
+	assert.Equal(t, 5.0, got[1].FreePercent)
+
+	stats := g.Stats()
+	assert.Equal(t, DiskPressureStat{Level: Hard, SoftTriggers: 1, HardTriggers: 1, Succeeded: 2, Failed: 2}, stats.Partitions["/var"])
+	assert.Equal(t, int64(2), stats.Values()["disk./var.pressure.level"])
+
+	g.SystemStatsHandler(system.SystemStats{DiskStat: map[string]system.DiskStat{"/var": {Total: 100, Free: 80}}})
+	assert.Equal(t, Normal, g.Stats().Partitions["/var"].Level)
+}
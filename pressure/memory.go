@@ -0,0 +1,194 @@
+// Package pressure provides reaction hooks for resource pressure: callbacks registered by the application,
+// e.g. to shed load or flush caches, are invoked when usage crosses configured watermarks, and the actions
+// taken are recorded as metrics.
+package pressure
+
+import (
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/smallnest/go-app-metrics/internal/safe"
+	"github.com/smallnest/go-app-metrics/rmetric"
+)
+
+// Level is the level of pressure.
+type Level int
+
+const (
+	// Normal is below the soft watermarks.
+	Normal Level = iota
+	// Soft is at or above a soft watermark.
+	Soft
+	// Hard is at or above a hard watermark.
+	Hard
+)
+
+func (l Level) String() string {
+	switch l {
+	case Soft:
+		return "soft"
+	case Hard:
+		return "hard"
+	default:
+		return "normal"
+	}
+}
+
+// MemoryPressure is passed to the callbacks of a MemoryGuard.
+type MemoryPressure struct {
+	Level Level
+	// Heap and RSS are the observed usage in bytes, RSS is 0 if it isn't observed.
+	Heap int64
+	RSS  int64
+}
+
+// MemoryGuard invokes callbacks when the heap or the RSS of the process crosses watermarks.
+// Callbacks are invoked when the level rises, and again after Cooldown if it stays above Normal.
+// It is safe for use from multiple go routines.
+type MemoryGuard struct {
+	// HeapSoft and HeapHard are the watermarks of the heap in bytes, 0 disables them.
+	HeapSoft int64
+	HeapHard int64
+	// RSSSoft and RSSHard are the watermarks of the resident set size in bytes, 0 disables them.
+	RSSSoft int64
+	RSSHard int64
+
+	// FreeOSMemory determines whether debug.FreeOSMemory is called at the Hard level. Defaults to true.
+	FreeOSMemory bool
+
+	// Cooldown is the minimum duration between the reactions while the level doesn't rise.
+	// Defaults to 1 minute.
+	Cooldown time.Duration
+
+	mu         sync.Mutex
+	callbacks  []func(MemoryPressure)
+	level      Level
+	lastAction time.Time
+	stats      MemoryPressureStats
+}
+
+// NewMemoryGuard creates a MemoryGuard without watermarks.
+func NewMemoryGuard() *MemoryGuard {
+	return &MemoryGuard{
+		FreeOSMemory: true,
+		Cooldown:     time.Minute,
+	}
+}
+
+// OnPressure registers fn to be called when the pressure reaches Soft or Hard.
+// A panic of fn is recovered and counted.
+func (g *MemoryGuard) OnPressure(fn func(MemoryPressure)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.callbacks = append(g.callbacks, fn)
+}
+
+// RuntimeStatsHandler feeds the heap of runtime stats into the guard, together with the RSS of the
+// current process if RSS watermarks are set. It can be used as a rmetric.RuntimeStatsHandler.
+func (g *MemoryGuard) RuntimeStatsHandler(stats rmetric.RuntimeStats) {
+	var rss int64
+	if g.RSSSoft > 0 || g.RSSHard > 0 {
+		if p, err := process.NewProcess(int32(os.Getpid())); err == nil {
+			if mem, err := p.MemoryInfo(); err == nil {
+				rss = int64(mem.RSS)
+			}
+		}
+	}
+	g.Observe(stats.HeapAlloc, rss, time.Now())
+}
+
+func level(v, soft, hard int64) Level {
+	switch {
+	case hard > 0 && v >= hard:
+		return Hard
+	case soft > 0 && v >= soft:
+		return Soft
+	default:
+		return Normal
+	}
+}
+
+// Observe feeds the heap and the RSS in bytes observed at t into the guard, reacts if needed
+// and returns the pressure level.
+func (g *MemoryGuard) Observe(heap, rss int64, t time.Time) Level {
+	g.mu.Lock()
+	l := level(heap, g.HeapSoft, g.HeapHard)
+	if r := level(rss, g.RSSSoft, g.RSSHard); r > l {
+		l = r
+	}
+
+	prev := g.level
+	g.level = l
+	g.stats.Level = l
+	if l == Normal || (l <= prev && t.Sub(g.lastAction) < g.Cooldown) {
+		g.mu.Unlock()
+		return l
+	}
+
+	g.lastAction = t
+	if l == Hard {
+		g.stats.HardTriggers++
+	} else {
+		g.stats.SoftTriggers++
+	}
+	callbacks := make([]func(MemoryPressure), len(g.callbacks))
+	copy(callbacks, g.callbacks)
+	freeOSMemory := g.FreeOSMemory && l == Hard
+	g.mu.Unlock()
+
+	p := MemoryPressure{Level: l, Heap: heap, RSS: rss}
+	var calls, panics int64
+	for _, fn := range callbacks {
+		calls++
+		if safe.Call(fn, p) != nil {
+			panics++
+		}
+	}
+	if freeOSMemory {
+		debug.FreeOSMemory()
+	}
+
+	g.mu.Lock()
+	g.stats.Callbacks += calls
+	g.stats.CallbackPanics += panics
+	if freeOSMemory {
+		g.stats.FreeOSMemory++
+	}
+	g.mu.Unlock()
+	return l
+}
+
+// Stats returns the current level and the cumulative counters of the reactions.
+func (g *MemoryGuard) Stats() MemoryPressureStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats
+}
+
+// MemoryPressureStats represents the memory pressure and the reactions taken.
+type MemoryPressureStats struct {
+	Level Level
+	// SoftTriggers and HardTriggers are the numbers of reactions at the levels.
+	SoftTriggers int64
+	HardTriggers int64
+	// Callbacks is the number of callback invocations, CallbackPanics the number of them which panicked.
+	Callbacks      int64
+	CallbackPanics int64
+	// FreeOSMemory is the number of calls of debug.FreeOSMemory.
+	FreeOSMemory int64
+}
+
+// Values returns metrics which you can write into TSDB.
+func (s *MemoryPressureStats) Values() map[string]interface{} {
+	return map[string]interface{}{
+		"mem.pressure.level":           int64(s.Level),
+		"mem.pressure.soft_triggers":   s.SoftTriggers,
+		"mem.pressure.hard_triggers":   s.HardTriggers,
+		"mem.pressure.callbacks":       s.Callbacks,
+		"mem.pressure.callback_panics": s.CallbackPanics,
+		"mem.pressure.free_os_memory":  s.FreeOSMemory,
+	}
+}
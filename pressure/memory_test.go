@@ -0,0 +1,51 @@
+package pressure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryGuard(t *testing.T) {
+	g := NewMemoryGuard()
+	g.HeapSoft = 100
+	g.HeapHard = 200
+	g.RSSHard = 1000
+
+	var got []MemoryPressure
+	g.OnPressure(func(p MemoryPressure) { got = append(got, p) })
+	g.OnPressure(func(MemoryPressure) { panic("boom") })
+
+	now := time.Now()
+	assert.Equal(t, Normal, g.Observe(50, 0, now))
+	assert.Equal(t, Soft, g.Observe(150, 0, now))
+	// no reaction within the cooldown unless the level rises
+	assert.Equal(t, Soft, g.Observe(160, 0, now.Add(time.Second)))
+	assert.Equal(t, Hard, g.Observe(150, 1000, now.Add(2*time.Second)))
+	assert.Equal(t, Soft, g.Observe(150, 0, now.Add(2*time.Minute)))
+
+	assert.Equal(t, []MemoryPressure{
+		{Level: Soft, Heap: 150},
+		{Level: Hard, Heap: 150, RSS: 1000},
+		{Level: Soft, Heap: 150},
+	}, got)
+
+	stats := g.Stats()
+	assert.Equal(t, Soft, stats.Level)
+	assert.Equal(t, int64(2), stats.SoftTriggers)
+	assert.Equal(t, int64(1), stats.HardTriggers)
+	assert.Equal(t, int64(6), stats.Callbacks)
+	assert.Equal(t, int64(3), stats.CallbackPanics)
+	assert.Equal(t, int64(1), stats.FreeOSMemory)
+	assert.Equal(t, int64(1), stats.Values()["mem.pressure.level"])
+}
+
+func TestMemoryGuardRuntimeStatsHandler(t *testing.T) {
+	g := NewMemoryGuard()
+	g.HeapSoft = 1
+	g.RSSSoft = 1
+	g.RuntimeStatsHandler(rmetric.New(nil).Once())
+	assert.Equal(t, Soft, g.Stats().Level)
+}
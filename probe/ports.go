@@ -0,0 +1,285 @@
+package probe
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/smallnest/go-app-metrics/internal/safe"
+	"github.com/smallnest/go-app-metrics/status"
+)
+
+// Port is a port which is expected to be bound by a process, e.g. by the current one.
+type Port struct {
+	// Name is used in metric keys.
+	Name string
+	Port uint32
+	// Network is tcp, tcp4, tcp6, udp, udp4 or udp6. Defaults to tcp.
+	Network string
+	// Pid is the process expected to bind the port. Defaults to the current process.
+	Pid int32
+	// Process, if set, is the name of the process expected to bind the port instead of Pid,
+	// e.g. for a port bound by a sidecar.
+	Process string
+}
+
+func (p *Port) String() string {
+	return fmt.Sprintf("%s (%s/%d)", p.Name, p.network(), p.Port)
+}
+
+func (p *Port) network() string {
+	if p.Network == "" {
+		return "tcp"
+	}
+	return p.Network
+}
+
+// PortStatsHandler represents a handler to handle stats after successfully gathering statistics
+type PortStatsHandler func(PortStats)
+
+// PortCollector implements the periodic verification of the processes binding ports to a PortStatsHandler.
+// It only lists the sockets of the machine and never binds or connects to the ports, so it doesn't
+// disturb the processes. It detects a port which failed to be bound, and a port which is bound by another
+// process, e.g. when several instances race for the port behind a supervisor.
+type PortCollector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Done, when closed, is used to signal PortCollector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	// PanicHandler, if not nil, is called with an error describing the panic when the stats handler
+	// panics. The panic is recovered so the collection continues. Defaults to nil.
+	PanicHandler func(err error)
+
+	mu           sync.Mutex
+	ports        []Port
+	mismatches   []int64
+	connections  func(kind string) ([]net.ConnectionStat, error)
+	processName  func(pid int32) (string, error)
+	tracker      status.Tracker
+	statsHandler PortStatsHandler
+}
+
+// NewPorts creates a new PortCollector that will periodically verify the ports and output statistics to statsHandler.
+func NewPorts(statsHandler PortStatsHandler, ports ...Port) *PortCollector {
+	if statsHandler == nil {
+		statsHandler = func(PortStats) {}
+	}
+
+	return &PortCollector{
+		CollectInterval: 10 * time.Second,
+		ports:           ports,
+		mismatches:      make([]int64, len(ports)),
+		connections:     net.Connections,
+		processName:     processName,
+		statsHandler:    statsHandler,
+	}
+}
+
+func processName(pid int32) (string, error) {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return "", err
+	}
+	return p.Name()
+}
+
+// Run gathers statistics then outputs them to the configured PortStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *PortCollector) Run() {
+	c.tracker.SetRunning(true)
+	defer c.tracker.SetRunning(false)
+
+	c.handle(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.handle(c.collectStats())
+		}
+	}
+}
+
+// handle outputs stats to the handler, recovering its panic.
+func (c *PortCollector) handle(stats PortStats) {
+	if err := safe.Call(c.statsHandler, stats); err != nil {
+		c.tracker.HandlerPanicked()
+		if c.PanicHandler != nil {
+			c.PanicHandler(err)
+		}
+	}
+}
+
+// Once verifies all ports and returns their statistics. It is safe for use from multiple go routines.
+func (c *PortCollector) Once() PortStats {
+	return c.collectStats()
+}
+
+// Status returns the state of the PortCollector. The probes are the names of the ports.
+func (c *PortCollector) Status() status.Status {
+	probes := make(map[string]bool, len(c.ports))
+	for _, port := range c.ports {
+		probes[port.Name] = true
+	}
+	return c.tracker.Status("ports", c.CollectInterval, probes)
+}
+
+func (c *PortCollector) collectStats() PortStats {
+	stats := PortStats{Ports: make(map[string]PortStat, len(c.ports))}
+	errs := make(map[string]error, len(c.ports))
+	defer c.tracker.Collected(errs)
+
+	// the sockets are listed once per network
+	listeners := make(map[string]map[uint32][]int32)
+	listErrs := make(map[string]error)
+	for _, port := range c.ports {
+		network := port.network()
+		if _, ok := listeners[network]; ok || listErrs[network] != nil {
+			continue
+		}
+		conns, err := c.connections(network)
+		if err != nil {
+			listErrs[network] = err
+			continue
+		}
+		listeners[network] = listening(conns)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.ports {
+		port := &c.ports[i]
+		var stat PortStat
+		if err := listErrs[port.network()]; err != nil {
+			stat.Err = err
+		} else {
+			stat.Pids = listeners[port.network()][port.Port]
+			stat.Bound = len(stat.Pids) > 0
+			stat.Owned = stat.Bound && c.owned(port, stat.Pids)
+			switch {
+			case !stat.Bound:
+				stat.Err = fmt.Errorf("port %s is not bound", port)
+			case !stat.Owned:
+				c.mismatches[i]++
+				stat.Err = fmt.Errorf("port %s is bound by pids %v, expected %s", port, stat.Pids, c.expected(port))
+			}
+		}
+		stat.Mismatches = c.mismatches[i]
+		stats.Ports[port.Name] = stat
+		errs[port.Name] = stat.Err
+	}
+	return stats
+}
+
+// listening returns the pids of the processes listening on the local ports of conns. A tcp socket is
+// listening if its state is LISTEN, an udp socket if it isn't connected.
+func listening(conns []net.ConnectionStat) map[uint32][]int32 {
+	ports := make(map[uint32][]int32)
+	for _, conn := range conns {
+		if conn.Status != "LISTEN" && (conn.Type != 2 || conn.Raddr.Port != 0) { // 2 is SOCK_DGRAM
+			continue
+		}
+		pids := ports[conn.Laddr.Port]
+		if !containsPid(pids, conn.Pid) {
+			pids = append(pids, conn.Pid)
+			sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+		}
+		ports[conn.Laddr.Port] = pids
+	}
+	return ports
+}
+
+func containsPid(pids []int32, pid int32) bool {
+	for _, p := range pids {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// owned reports whether all pids are the expected process. The pid of a socket of another user
+// is unknown (0) without privileges, so it is never owned.
+func (c *PortCollector) owned(port *Port, pids []int32) bool {
+	for _, pid := range pids {
+		if pid == 0 {
+			return false
+		}
+		if port.Process == "" {
+			if pid != expectedPid(port) {
+				return false
+			}
+			continue
+		}
+		if name, err := c.processName(pid); err != nil || name != port.Process {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *PortCollector) expected(port *Port) string {
+	if port.Process != "" {
+		return "process " + port.Process
+	}
+	return fmt.Sprintf("pid %d", expectedPid(port))
+}
+
+func expectedPid(port *Port) int32 {
+	if port.Pid != 0 {
+		return port.Pid
+	}
+	return int32(os.Getpid())
+}
+
+// PortStats represents the results of the verification of the ports keyed by Port.Name.
+type PortStats struct {
+	Ports map[string]PortStat
+}
+
+// PortStat represents the result of the verification of a port.
+type PortStat struct {
+	// Bound reports whether a process listens on the port.
+	Bound bool
+	// Owned reports whether only the expected process listens on the port.
+	Owned bool
+	// Pids are the processes listening on the port, 0 if a process is unknown.
+	Pids []int32
+	Err  error
+
+	// Mismatches is the cumulative number of verifications which found the port bound by another process.
+	Mismatches int64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as port.<name>.bound,
+// port.<name>.owned and port.<name>.mismatches.
+func (s *PortStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Ports)*3)
+	for name, stat := range s.Ports {
+		prefix := "port." + name + "."
+
+		var bound, owned int64
+		if stat.Bound {
+			bound = 1
+		}
+		if stat.Owned {
+			owned = 1
+		}
+		values[prefix+"bound"] = bound
+		values[prefix+"owned"] = owned
+		values[prefix+"mismatches"] = stat.Mismatches
+	}
+	return values
+}
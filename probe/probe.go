@@ -0,0 +1,285 @@
+// Package probe provides a collector which runs commands or scripts on a schedule and exports
+// the metrics printed on their stdout. The output is either lines of `key value`:
+//
+//	queue.pending 42
+//	# comments and blank lines are ignored
+//	queue.oldest_seconds 3.5
+//
+// or a JSON object whose nested objects are flattened with dots, e.g. {"queue": {"pending": 42}}.
+//
+// It also provides PortCollector, which verifies that ports are bound by the expected processes.
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/safe"
+	"github.com/smallnest/go-app-metrics/status"
+)
+
+// Command is a command to run on every collection.
+type Command struct {
+	// Name is used in metric keys.
+	Name string
+	// Path is the program to run, it is looked up in PATH if it contains no path separators.
+	Path string
+	Args []string
+	// Timeout is the maximum duration of a run, the command is killed if it is exceeded.
+	// Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// ProbeStatsHandler represents a handler to handle stats after successfully gathering statistics
+type ProbeStatsHandler func(ProbeStats)
+
+// Collector implements the periodic running of commands to a ProbeStatsHandler.
+type Collector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	// PanicHandler, if not nil, is called with an error describing the panic when the stats handler
+	// panics. The panic is recovered so the collection continues. Defaults to nil.
+	PanicHandler func(err error)
+
+	mu           sync.Mutex
+	commands     []Command
+	failures     []int64
+	timeouts     []int64
+	tracker      status.Tracker
+	statsHandler ProbeStatsHandler
+}
+
+// New creates a new Collector that will periodically run the commands and output statistics to statsHandler.
+func New(statsHandler ProbeStatsHandler, commands ...Command) *Collector {
+	if statsHandler == nil {
+		statsHandler = func(ProbeStats) {}
+	}
+
+	return &Collector{
+		CollectInterval: 10 * time.Second,
+		commands:        commands,
+		failures:        make([]int64, len(commands)),
+		timeouts:        make([]int64, len(commands)),
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured ProbeStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *Collector) Run() {
+	c.tracker.SetRunning(true)
+	defer c.tracker.SetRunning(false)
+
+	c.handle(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.handle(c.collectStats())
+		}
+	}
+}
+
+// handle outputs stats to the handler, recovering its panic.
+func (c *Collector) handle(stats ProbeStats) {
+	if err := safe.Call(c.statsHandler, stats); err != nil {
+		c.tracker.HandlerPanicked()
+		if c.PanicHandler != nil {
+			c.PanicHandler(err)
+		}
+	}
+}
+
+// Once runs all commands concurrently and returns their statistics. It is safe for use from multiple go routines.
+func (c *Collector) Once() ProbeStats {
+	return c.collectStats()
+}
+
+// Status returns the state of the Collector. The probes are the names of the commands.
+func (c *Collector) Status() status.Status {
+	probes := make(map[string]bool, len(c.commands))
+	for _, command := range c.commands {
+		probes[command.Name] = true
+	}
+	return c.tracker.Status("probe", c.CollectInterval, probes)
+}
+
+func (c *Collector) collectStats() ProbeStats {
+	results := make([]ProbeStat, len(c.commands))
+
+	var wg sync.WaitGroup
+	for i := range c.commands {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = runCommand(&c.commands[i])
+		}(i)
+	}
+	wg.Wait()
+
+	stats := ProbeStats{Probes: make(map[string]ProbeStat, len(c.commands))}
+	errs := make(map[string]error, len(c.commands))
+	defer c.tracker.Collected(errs)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, stat := range results {
+		if stat.Err != nil {
+			c.failures[i]++
+		}
+		if stat.TimedOut {
+			c.timeouts[i]++
+		}
+		stat.Failures = c.failures[i]
+		stat.Timeouts = c.timeouts[i]
+		stats.Probes[c.commands[i].Name] = stat
+		errs[c.commands[i].Name] = stat.Err
+	}
+	return stats
+}
+
+func runCommand(command *Command) ProbeStat {
+	timeout := command.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, command.Path, command.Args...)
+	cmd.Stdout = &stdout
+	// don't wait for children which inherited stdout after the command has been killed
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	stat := ProbeStat{Duration: time.Since(start)}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		stat.TimedOut = true
+		stat.Err = fmt.Errorf("probe: %s timed out after %s", command.Name, timeout)
+		return stat
+	}
+	if err != nil {
+		stat.Err = err
+		return stat
+	}
+
+	stat.Values, stat.Err = parse(stdout.Bytes())
+	stat.Up = stat.Err == nil
+	return stat
+}
+
+// parse parses the output of a command as JSON if it starts with '{', as `key value` lines otherwise.
+func parse(out []byte) (map[string]float64, error) {
+	out = bytes.TrimSpace(out)
+	values := make(map[string]float64)
+	if len(out) > 0 && out[0] == '{' {
+		var obj map[string]interface{}
+		if err := json.Unmarshal(out, &obj); err != nil {
+			return nil, err
+		}
+		flatten("", obj, values)
+		return values, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("probe: invalid line %d: %q", n, line)
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("probe: invalid value of %s at line %d: %w", fields[0], n, err)
+		}
+		values[fields[0]] = v
+	}
+	return values, scanner.Err()
+}
+
+// flatten adds the numeric and boolean members of obj into values, nested objects are keyed
+// by the path joined with dots. Other members are ignored.
+func flatten(prefix string, obj map[string]interface{}, values map[string]float64) {
+	for k, v := range obj {
+		key := prefix + k
+		switch v := v.(type) {
+		case float64:
+			values[key] = v
+		case bool:
+			if v {
+				values[key] = 1
+			} else {
+				values[key] = 0
+			}
+		case map[string]interface{}:
+			flatten(key+".", v, values)
+		}
+	}
+}
+
+// ProbeStats represents the results of the commands keyed by Command.Name.
+type ProbeStats struct {
+	Probes map[string]ProbeStat
+}
+
+// ProbeStat represents the result of a run of a command.
+type ProbeStat struct {
+	// Values are the metrics parsed from stdout.
+	Values map[string]float64
+	// Up reports whether the command exited successfully and its output was parsed.
+	Up       bool
+	Duration time.Duration
+	TimedOut bool
+	Err      error
+
+	// Failures and Timeouts are the cumulative numbers of failed and timed out runs.
+	Failures int64
+	Timeouts int64
+}
+
+// Values returns metrics which you can write into TSDB. The metrics of a command are keyed
+// as probe.<name>.<key>, together with probe.<name>.up, .duration, .failures and .timeouts.
+func (s *ProbeStats) Values() map[string]interface{} {
+	values := make(map[string]interface{})
+	for name, stat := range s.Probes {
+		prefix := "probe." + name + "."
+		for k, v := range stat.Values {
+			values[prefix+k] = v
+		}
+
+		var up int64
+		if stat.Up {
+			up = 1
+		}
+		values[prefix+"up"] = up
+		values[prefix+"duration"] = stat.Duration.Nanoseconds()
+		values[prefix+"failures"] = stat.Failures
+		values[prefix+"timeouts"] = stat.Timeouts
+	}
+	return values
+}
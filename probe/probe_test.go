@@ -0,0 +1,106 @@
+package probe
+
+import (
+	stdnet "net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	values, err := parse([]byte("# queue stats\nqueue.pending 42\n\nqueue.oldest_seconds 3.5\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float64{"queue.pending": 42, "queue.oldest_seconds": 3.5}, values)
+
+	values, err = parse([]byte(`{"queue": {"pending": 42, "paused": true}, "name": "jobs"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float64{"queue.pending": 42, "queue.paused": 1}, values)
+
+	_, err = parse([]byte("queue.pending"))
+	assert.NotNil(t, err)
+	_, err = parse([]byte("queue.pending many"))
+	assert.NotNil(t, err)
+}
+
+func TestCollectorOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test because it requires sh")
+	}
+
+	c := New(nil,
+		Command{Name: "queue", Path: "sh", Args: []string{"-c", "echo queue.pending 42"}},
+		Command{Name: "fail", Path: "sh", Args: []string{"-c", "exit 1"}},
+		Command{Name: "slow", Path: "sh", Args: []string{"-c", "sleep 5"}, Timeout: 100 * time.Millisecond},
+	)
+	c.Once()
+	stats := c.Once()
+
+	assert.True(t, stats.Probes["queue"].Up)
+	assert.Equal(t, int64(0), stats.Probes["queue"].Failures)
+	assert.False(t, stats.Probes["fail"].Up)
+	assert.Equal(t, int64(2), stats.Probes["fail"].Failures)
+	assert.True(t, stats.Probes["slow"].TimedOut)
+	assert.Equal(t, int64(2), stats.Probes["slow"].Timeouts)
+
+	st := c.Status()
+	assert.Equal(t, int64(2), st.Collections)
+	assert.Len(t, st.Probes, 3)
+	assert.Equal(t, "fail", st.Probes[0].Name)
+	assert.NotEmpty(t, st.Probes[0].LastError)
+	assert.Empty(t, st.Probes[1].LastError)
+
+	values := stats.Values()
+	assert.Equal(t, 42.0, values["probe.queue.queue.pending"])
+	assert.Equal(t, int64(1), values["probe.queue.up"])
+	assert.Equal(t, int64(0), values["probe.fail.up"])
+	assert.Equal(t, int64(2), values["probe.slow.timeouts"])
+}
+
+func TestPortCollector(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Skipping test because it lists the sockets in /proc")
+	}
+
+	ln, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	port := uint32(ln.Addr().(*stdnet.TCPAddr).Port)
+
+	c := NewPorts(nil, Port{Name: "http", Port: port}, Port{Name: "sidecar", Port: port, Pid: 1})
+	stats := c.Once()
+	assert.True(t, stats.Ports["http"].Owned, stats.Ports["http"].Err)
+	assert.Nil(t, stats.Ports["http"].Err)
+	assert.True(t, stats.Ports["sidecar"].Bound)
+	assert.False(t, stats.Ports["sidecar"].Owned)
+	assert.Equal(t, int64(1), stats.Ports["sidecar"].Mismatches)
+
+	ln.Close()
+	stats = c.Once()
+	assert.False(t, stats.Ports["http"].Bound)
+	assert.NotNil(t, stats.Ports["http"].Err)
+
+	values := stats.Values()
+	assert.Equal(t, int64(0), values["port.http.bound"])
+	assert.Equal(t, int64(1), values["port.sidecar.mismatches"])
+	st := c.Status()
+	assert.False(t, st.Healthy())
+}
+
+func TestPortCollectorProcess(t *testing.T) {
+	c := NewPorts(nil, Port{Name: "dns", Port: 53, Network: "udp", Process: "unbound"})
+	c.connections = func(kind string) ([]net.ConnectionStat, error) {
+		assert.Equal(t, "udp", kind)
+		return []net.ConnectionStat{
+			{Type: 2, Laddr: net.Addr{Port: 53}, Pid: 10},
+			{Type: 2, Laddr: net.Addr{Port: 5353}, Raddr: net.Addr{Port: 53}, Pid: 11},
+		}, nil
+	}
+	c.processName = func(pid int32) (string, error) { return map[int32]string{10: "unbound", 11: "dnsmasq"}[pid], nil }
+
+	stat := c.Once().Ports["dns"]
+	assert.Equal(t, []int32{10}, stat.Pids)
+	assert.True(t, stat.Owned)
+}
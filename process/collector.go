@@ -0,0 +1,310 @@
+// Package process provides method to collect metrics of processes, including processes
+// which are not written in go, e.g. a colocated Java or Python service.
+package process
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/smallnest/go-app-metrics/internal/counter"
+)
+
+// Target selects a process to collect. It is resolved on every collection,
+// so a restarted process is picked up by its pidfile or name.
+type Target struct {
+	// Label is used in metric keys. Defaults to Name, the base name of PIDFile or PID.
+	Label string
+
+	// PID selects the process by pid.
+	PID int32
+	// PIDFile selects the process by the pid written in a file.
+	PIDFile string
+	// Name selects the process by executable name. The one with the lowest pid is
+	// selected if multiple processes have the name.
+	Name string
+}
+
+// Self returns the target of the current process, labeled "self".
+func Self() Target {
+	return Target{PID: int32(os.Getpid()), Label: "self"}
+}
+
+func (t *Target) label() string {
+	switch {
+	case t.Label != "":
+		return t.Label
+	case t.Name != "":
+		return t.Name
+	case t.PIDFile != "":
+		return strings.TrimSuffix(filepath.Base(t.PIDFile), ".pid")
+	default:
+		return strconv.Itoa(int(t.PID))
+	}
+}
+
+// errNotFound is returned if the process of a target doesn't exist.
+var errNotFound = errors.New("process: not found")
+
+// resolve returns the pid of the target.
+func (t *Target) resolve() (int32, error) {
+	switch {
+	case t.PIDFile != "":
+		data, err := os.ReadFile(t.PIDFile)
+		if err != nil {
+			return 0, err
+		}
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		return int32(pid), nil
+	case t.Name != "":
+		procs, err := process.Processes()
+		if err != nil {
+			return 0, err
+		}
+		var found int32
+		for _, p := range procs {
+			if name, err := p.Name(); err == nil && name == t.Name && (found == 0 || p.Pid < found) {
+				found = p.Pid
+			}
+		}
+		if found == 0 {
+			return 0, errNotFound
+		}
+		return found, nil
+	default:
+		return t.PID, nil
+	}
+}
+
+// ProcessStatsHandler represents a handler to handle stats after successfully gathering statistics
+type ProcessStatsHandler func(ProcessStats)
+
+// Collector implements the periodic grabbing of informational data of processes to a ProcessStatsHandler.
+type Collector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	targets      []Target
+	mu           sync.Mutex // guards the previous samples below, so Once can be called while Run is running
+	prev         map[string]*sample
+	resets       int64
+	statsHandler ProcessStatsHandler
+}
+
+// sample is the previous sample of the cumulative counters of a target.
+type sample struct {
+	pid    int32
+	t      time.Time
+	cpu    float64 // user + system seconds
+	io     process.IOCountersStat
+	hasIO  bool
+	ctx    process.NumCtxSwitchesStat
+	hasCtx bool
+}
+
+// New creates a new Collector that will periodically output statistics of the targets to statsHandler.
+func New(statsHandler ProcessStatsHandler, targets ...Target) *Collector {
+	if statsHandler == nil {
+		statsHandler = func(ProcessStats) {}
+	}
+
+	return &Collector{
+		CollectInterval: 10 * time.Second,
+		targets:         targets,
+		prev:            make(map[string]*sample),
+		statsHandler:    statsHandler,
+	}
+}
+
+// NewSelf creates a new Collector that will periodically output statistics of the current process
+// to statsHandler, keyed as process.self.<metric>.
+func NewSelf(statsHandler ProcessStatsHandler) *Collector {
+	return New(statsHandler, Self())
+}
+
+// Run gathers statistics then outputs them to the configured ProcessStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *Collector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the statistics of the targets. It is safe for use from multiple go routines.
+func (c *Collector) Once() ProcessStats {
+	return c.collectStats()
+}
+
+func (c *Collector) collectStats() ProcessStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := ProcessStats{
+		Processes: make(map[string]ProcStat, len(c.targets)),
+	}
+
+	for i := range c.targets {
+		label := c.targets[i].label()
+		var stat ProcStat
+
+		pid, err := c.targets[i].resolve()
+		if err == nil {
+			err = c.collectProcess(label, pid, &stat)
+		}
+		if err != nil {
+			delete(c.prev, label)
+		}
+		stats.Processes[label] = stat
+	}
+	stats.CounterResets = c.resets
+
+	return stats
+}
+
+func (c *Collector) collectProcess(label string, pid int32, stat *ProcStat) error {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	cur := &sample{pid: pid, t: now}
+	prev := c.prev[label]
+	if prev != nil && prev.pid != pid {
+		// the process has been restarted
+		prev = nil
+	}
+
+	stat.PID = pid
+	stat.Up = true
+
+	if times, err := p.Times(); err == nil {
+		cur.cpu = times.User + times.System
+		if prev != nil && now.After(prev.t) && cur.cpu >= prev.cpu {
+			stat.CPUPercent = (cur.cpu - prev.cpu) / now.Sub(prev.t).Seconds() * 100
+		}
+	}
+	if mem, err := p.MemoryInfo(); err == nil {
+		stat.RSS = mem.RSS
+		stat.VMS = mem.VMS
+	}
+	if fds, err := p.NumFDs(); err == nil {
+		stat.NumFDs = int64(fds)
+	}
+	if threads, err := p.NumThreads(); err == nil {
+		stat.NumThreads = int64(threads)
+	}
+	if io, err := p.IOCounters(); err == nil {
+		cur.io = *io
+		cur.hasIO = true
+		if prev != nil && prev.hasIO {
+			stat.ReadBytes = c.delta(io.ReadBytes, prev.io.ReadBytes)
+			stat.WriteBytes = c.delta(io.WriteBytes, prev.io.WriteBytes)
+			stat.ReadCount = c.delta(io.ReadCount, prev.io.ReadCount)
+			stat.WriteCount = c.delta(io.WriteCount, prev.io.WriteCount)
+		}
+	}
+	if ctx, err := p.NumCtxSwitches(); err == nil {
+		cur.ctx = *ctx
+		cur.hasCtx = true
+		if prev != nil && prev.hasCtx {
+			stat.VoluntaryCtxSwitches = int64(c.delta(uint64(ctx.Voluntary), uint64(prev.ctx.Voluntary)))
+			stat.InvoluntaryCtxSwitches = int64(c.delta(uint64(ctx.Involuntary), uint64(prev.ctx.Involuntary)))
+		}
+	}
+
+	c.prev[label] = cur
+	return nil
+}
+
+// delta returns the increase of a cumulative counter since the previous sample, see counter.Delta
+// for how wraps and resets are handled. The resets are counted.
+func (c *Collector) delta(cur, prev uint64) uint64 {
+	d, reset := counter.Delta(cur, prev)
+	if reset {
+		c.resets++
+	}
+	return d
+}
+
+// ProcessStats represents the stats of the targets keyed by label.
+type ProcessStats struct {
+	Processes map[string]ProcStat
+	// CounterResets is the cumulative number of counters found reset when computing the stats
+	// since the previous collection, such as the bytes read by a process.
+	CounterResets int64
+}
+
+// ProcStat represents the stats of a process.
+type ProcStat struct {
+	PID int32
+	// Up reports whether the process has been found.
+	Up bool
+
+	// CPUPercent is the CPU usage since the previous collection, 100 means one CPU is fully used.
+	CPUPercent float64
+	RSS        uint64
+	VMS        uint64
+	NumFDs     int64
+	NumThreads int64
+
+	// IO since the previous collection.
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadCount  uint64
+	WriteCount uint64
+
+	// Context switches since the previous collection.
+	VoluntaryCtxSwitches   int64
+	InvoluntaryCtxSwitches int64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as process.<label>.<metric>.
+func (s *ProcessStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Processes)*12+1)
+	values["process.counter_resets"] = s.CounterResets
+	for label, stat := range s.Processes {
+		var up int64
+		if stat.Up {
+			up = 1
+		}
+
+		prefix := "process." + label + "."
+		values[prefix+"up"] = up
+		values[prefix+"cpu_percent"] = stat.CPUPercent
+		values[prefix+"rss"] = stat.RSS
+		values[prefix+"vms"] = stat.VMS
+		values[prefix+"fds"] = stat.NumFDs
+		values[prefix+"threads"] = stat.NumThreads
+		values[prefix+"io.read_bytes"] = stat.ReadBytes
+		values[prefix+"io.write_bytes"] = stat.WriteBytes
+		values[prefix+"io.read_count"] = stat.ReadCount
+		values[prefix+"io.write_count"] = stat.WriteCount
+		values[prefix+"ctx_switches.voluntary"] = stat.VoluntaryCtxSwitches
+		values[prefix+"ctx_switches.involuntary"] = stat.InvoluntaryCtxSwitches
+	}
+	return values
+}
@@ -0,0 +1,87 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorOnce(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test because testing.Short is enabled")
+	}
+
+	pidfile := filepath.Join(t.TempDir(), "app.pid")
+	assert.Nil(t, os.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644))
+
+	c := New(nil,
+		Target{PID: int32(os.Getpid()), Label: "self"},
+		Target{PIDFile: pidfile},
+		Target{Name: "no-such-process-name"},
+	)
+	c.Once()
+	time.Sleep(100 * time.Millisecond)
+	stats := c.Once()
+
+	self := stats.Processes["self"]
+	assert.True(t, self.Up)
+	assert.Equal(t, int32(os.Getpid()), self.PID)
+	assert.True(t, self.RSS > 0)
+	assert.True(t, self.NumThreads > 0)
+
+	assert.True(t, stats.Processes["app"].Up)
+	assert.False(t, stats.Processes["no-such-process-name"].Up)
+
+	values := stats.Values()
+	assert.Equal(t, int64(1), values["process.self.up"])
+	assert.Equal(t, int64(0), values["process.no-such-process-name.up"])
+	assert.Contains(t, values, "process.self.cpu_percent")
+}
+
+func TestNewSelf(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test because testing.Short is enabled")
+	}
+
+	c := NewSelf(nil)
+	c.Once()
+	time.Sleep(10 * time.Millisecond)
+	stats := c.Once()
+
+	self := stats.Processes["self"]
+	assert.True(t, self.Up)
+	assert.Equal(t, int32(os.Getpid()), self.PID)
+	assert.True(t, self.NumFDs > 0)
+	values := stats.Values()
+	assert.Contains(t, values, "process.self.ctx_switches.voluntary")
+}
+
+// TestConcurrentOnce runs Once concurrently, run it with -race.
+func TestConcurrentOnce(t *testing.T) {
+	c := NewSelf(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Once()
+		}()
+	}
+	wg.Wait()
+	assert.True(t, c.Once().Processes["self"].Up)
+}
+
+func TestCounterReset(t *testing.T) {
+	c := New(nil)
+	assert.Equal(t, uint64(50), c.delta(150, 100))
+	assert.Equal(t, uint64(30), c.delta(30, 100))
+
+	stats := c.Once()
+	assert.Equal(t, int64(1), stats.CounterResets)
+	assert.Equal(t, int64(1), stats.Values()["process.counter_resets"])
+}
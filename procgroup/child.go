@@ -0,0 +1,39 @@
+// Package procgroup provides method to aggregate the go runtime stats of a group of processes,
+// such as the workers of a pre-fork server.
+//
+// Each child process exposes its runtime stats on a local endpoint with Serve,
+// and the parent process collects and aggregates them with a Collector.
+package procgroup
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/smallnest/go-app-metrics/rmetric"
+)
+
+// ChildStats is the payload exposed by a child process.
+type ChildStats struct {
+	PID   int                  `json:"pid"`
+	Stats rmetric.RuntimeStats `json:"stats"`
+}
+
+// Handler returns a http.Handler which responds with the runtime stats of the current process in json format.
+func Handler() http.Handler {
+	c := rmetric.New(nil)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChildStats{
+			PID:   os.Getpid(),
+			Stats: c.Once(),
+		})
+	})
+}
+
+// Serve serves the runtime stats of the current process on l, e.g. a unix socket
+// created by net.Listen("unix", path). It blocks until l is closed.
+func Serve(l net.Listener) error {
+	return http.Serve(l, Handler())
+}
@@ -0,0 +1,196 @@
+package procgroup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/rmetric"
+)
+
+// GroupStatsHandler represents a handler to handle stats after successfully gathering statistics
+type GroupStatsHandler func(GroupStats)
+
+// Collector implements the periodic collection of the runtime stats of child processes to a GroupStatsHandler.
+type Collector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Timeout is the timeout of collecting the stats of a child. Defaults to 1 second.
+	Timeout time.Duration
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	mu           sync.Mutex
+	endpoints    []string
+	clients      map[string]*http.Client // unix socket path -> client
+	statsHandler GroupStatsHandler
+}
+
+// New creates a new Collector that will periodically collect the stats of the child endpoints and
+// output them to statsHandler. An endpoint is either a unix socket as unix:///path/to/socket,
+// or a http address as http://127.0.0.1:9100.
+func New(statsHandler GroupStatsHandler, endpoints ...string) *Collector {
+	if statsHandler == nil {
+		statsHandler = func(GroupStats) {}
+	}
+
+	return &Collector{
+		CollectInterval: 10 * time.Second,
+		Timeout:         time.Second,
+		endpoints:       endpoints,
+		clients:         make(map[string]*http.Client),
+		statsHandler:    statsHandler,
+	}
+}
+
+// request returns the http client and the url to fetch the stats of endpoint.
+func (c *Collector) request(endpoint string) (*http.Client, string) {
+	path := strings.TrimPrefix(endpoint, "unix://")
+	if path == endpoint {
+		return http.DefaultClient, endpoint
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	client, ok := c.clients[path]
+	if !ok {
+		client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		}
+		c.clients[path] = client
+	}
+	return client, "http://unix/"
+}
+
+// SetEndpoints replaces the endpoints of the children, e.g. after a child is restarted.
+func (c *Collector) SetEndpoints(endpoints ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.endpoints = endpoints
+}
+
+// Run gathers statistics then outputs them to the configured GroupStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *Collector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the stats of the group. It is safe for use from multiple go routines。
+func (c *Collector) Once() GroupStats {
+	return c.collectStats()
+}
+
+func (c *Collector) collectStats() GroupStats {
+	c.mu.Lock()
+	endpoints := c.endpoints
+	c.mu.Unlock()
+
+	stats := GroupStats{
+		Children: make(map[string]rmetric.RuntimeStats, len(endpoints)),
+		Errors:   make(map[string]error),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, endpoint := range endpoints {
+		endpoint := endpoint
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cs, err := c.fetch(endpoint)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				stats.Errors[endpoint] = err
+				return
+			}
+			stats.Children[strconv.Itoa(cs.PID)] = cs.Stats
+		}()
+	}
+	wg.Wait()
+
+	children := make([]rmetric.RuntimeStats, 0, len(stats.Children))
+	for _, s := range stats.Children {
+		children = append(children, s)
+	}
+	stats.Total = rmetric.Combine(children)
+	return stats
+}
+
+func (c *Collector) fetch(endpoint string) (*ChildStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	client, url := c.request(endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("procgroup: %s responded %s", endpoint, resp.Status)
+	}
+
+	var cs ChildStats
+	if err := json.NewDecoder(resp.Body).Decode(&cs); err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// GroupStats represents the runtime stats of the children and their sum.
+type GroupStats struct {
+	// Children are the stats of the children keyed by pid.
+	Children map[string]rmetric.RuntimeStats
+	// Total are the stats of all children combined by rmetric.Combine: the counters and bytes are summed,
+	// the host constants such as cpu.count are not.
+	Total rmetric.RuntimeStats
+	// Errors are the errors of the endpoints which couldn't be collected.
+	Errors map[string]error
+}
+
+// Values returns metrics which you can write into TSDB. The sum of all children is keyed like
+// rmetric.RuntimeStats, the stats of each child are prefixed with child.<pid>.
+func (s *GroupStats) Values() map[string]interface{} {
+	values := s.Total.Values()
+	for pid, stats := range s.Children {
+		for k, v := range stats.Values() {
+			values["child."+pid+"."+k] = v
+		}
+	}
+	values["group.children"] = int64(len(s.Children))
+	values["group.errors"] = int64(len(s.Errors))
+	return values
+}
@@ -0,0 +1,41 @@
+package procgroup
+
+import (
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "child.sock")
+	l, err := net.Listen("unix", sock)
+	assert.Nil(t, err)
+	defer l.Close()
+	go Serve(l)
+
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+
+	c := New(nil, "unix://"+sock, srv.URL, "unix:///nonexistent.sock")
+	stats := c.Once()
+
+	// both endpoints are served by the current process
+	assert.Len(t, stats.Children, 1)
+	assert.Len(t, stats.Errors, 1)
+	assert.Contains(t, stats.Errors, "unix:///nonexistent.sock")
+
+	child := stats.Children[strconv.Itoa(os.Getpid())]
+	assert.True(t, child.NumGoroutine > 0)
+	assert.Equal(t, child.NumGoroutine, stats.Total.NumGoroutine)
+	assert.Equal(t, child.NumCPU, stats.Total.NumCPU)
+
+	values := stats.Values()
+	assert.Contains(t, values, "cpu.goroutines")
+	assert.Contains(t, values, "child."+strconv.Itoa(os.Getpid())+".cpu.goroutines")
+	assert.Equal(t, int64(1), values["group.errors"])
+}
@@ -0,0 +1,198 @@
+package appmetrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Profile selects the fidelity of the collection: which probes run and how often.
+type Profile struct {
+	Name            string
+	CollectInterval time.Duration
+
+	// Probes of the go runtime, see rmetric.Collector.
+	RuntimeCPU bool
+	RuntimeMem bool
+	RuntimeGC  bool
+	RuntimeFD  bool
+
+	// Probes of the system, see system.Collector.
+	SystemDisk bool
+	SystemNet  bool
+
+	// CriticalOnly makes the snapshots export only the critical metrics, see Snapshot.CriticalOnly.
+	CriticalOnly bool
+}
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]Profile{
+		"minimal": {
+			Name:            "minimal",
+			CollectInterval: time.Minute,
+			RuntimeCPU:      true,
+			RuntimeMem:      true,
+			RuntimeFD:       true,
+			SystemDisk:      true,
+			CriticalOnly:    true,
+		},
+		"dev": {
+			Name:            "dev",
+			CollectInterval: time.Minute,
+			RuntimeCPU:      true,
+			RuntimeMem:      true,
+			RuntimeFD:       true,
+		},
+		"prod": {
+			Name:            "prod",
+			CollectInterval: 10 * time.Second,
+			RuntimeCPU:      true,
+			RuntimeMem:      true,
+			RuntimeGC:       true,
+			RuntimeFD:       true,
+			SystemDisk:      true,
+			SystemNet:       true,
+		},
+		"debug": {
+			Name:            "debug",
+			CollectInterval: time.Second,
+			RuntimeCPU:      true,
+			RuntimeMem:      true,
+			RuntimeGC:       true,
+			RuntimeFD:       true,
+			SystemDisk:      true,
+			SystemNet:       true,
+		},
+	}
+)
+
+// RegisterProfile adds p or replaces the profile with the same name. The builtin profiles are
+// "minimal" (every minute, only the critical metrics, see metadata.Critical), "dev" (every minute
+// without GC, disk and network stats), "prod" (every 10 seconds, all probes, the defaults of NewRunner)
+// and "debug" (every second, all probes).
+func RegisterProfile(p Profile) {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles[p.Name] = p
+}
+
+// LookupProfile returns the profile name.
+func LookupProfile(name string) (Profile, bool) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	p, ok := profiles[name]
+	return p, ok
+}
+
+// ProfileNames returns the names of the registered profiles in order.
+func ProfileNames() []string {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetProfile switches the Runner to the profile name. It can be called while Run is running,
+// the new interval takes effect immediately.
+func (r *Runner) SetProfile(name string) error {
+	p, ok := LookupProfile(name)
+	if !ok {
+		return fmt.Errorf("appmetrics: unknown profile %q", name)
+	}
+	r.UseProfile(p)
+	return nil
+}
+
+// UseProfile switches the Runner to p like SetProfile.
+func (r *Runner) UseProfile(p Profile) {
+	r.mu.Lock()
+	r.profile = p.Name
+	if p.CollectInterval > 0 {
+		r.CollectInterval = p.CollectInterval
+	}
+	r.Runtime.EnableCPU = p.RuntimeCPU
+	r.Runtime.EnableMem = p.RuntimeMem
+	r.Runtime.EnableGC = p.RuntimeGC
+	r.Runtime.EnableFD = p.RuntimeFD
+	r.System.EnableDisk = p.SystemDisk
+	r.System.EnableNet = p.SystemNet
+	r.criticalOnly = p.CriticalOnly
+	r.mu.Unlock()
+	r.wake()
+}
+
+// Profile returns the name of the current profile, empty if none has been set.
+func (r *Runner) Profile() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.profile
+}
+
+// Probes are the names of the probes which can be switched by SetProbe.
+var Probes = []string{"runtime.cpu", "runtime.mem", "runtime.gc", "runtime.fd", "system.disk", "system.net"}
+
+// SetProbe enables or disables the probe name, one of Probes. It can be called while Run is running.
+func (r *Runner) SetProbe(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch name {
+	case "runtime.cpu":
+		r.Runtime.EnableCPU = enabled
+	case "runtime.mem":
+		r.Runtime.EnableMem = enabled
+	case "runtime.gc":
+		r.Runtime.EnableGC = enabled
+	case "runtime.fd":
+		r.Runtime.EnableFD = enabled
+	case "system.disk":
+		r.System.EnableDisk = enabled
+	case "system.net":
+		r.System.EnableNet = enabled
+	default:
+		return fmt.Errorf("appmetrics: unknown probe %q", name)
+	}
+	return nil
+}
+
+// EnabledProbes returns whether the probes are enabled keyed by name.
+func (r *Runner) EnabledProbes() map[string]bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return map[string]bool{
+		"runtime.cpu": r.Runtime.EnableCPU,
+		"runtime.mem": r.Runtime.EnableMem,
+		"runtime.gc":  r.Runtime.EnableGC,
+		"runtime.fd":  r.Runtime.EnableFD,
+		"system.disk": r.System.EnableDisk,
+		"system.net":  r.System.EnableNet,
+	}
+}
+
+// SetInterval changes the collection interval. It can be called while Run is running,
+// the new interval takes effect immediately.
+func (r *Runner) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	r.mu.Lock()
+	r.CollectInterval = interval
+	r.mu.Unlock()
+	r.wake()
+}
+
+// wake wakes up the loop to apply the interval.
+func (r *Runner) wake() {
+	select {
+	case r.reconfigured <- struct{}{}:
+	default:
+	}
+}
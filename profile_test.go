@@ -0,0 +1,62 @@
+package appmetrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetProfile(t *testing.T) {
+	assert.Equal(t, []string{"debug", "dev", "minimal", "prod"}, ProfileNames())
+
+	r := NewRunner(nil)
+	assert.NotNil(t, r.SetProfile("nope"))
+
+	assert.Nil(t, r.SetProfile("dev"))
+	assert.Equal(t, "dev", r.Profile())
+	assert.Equal(t, time.Minute, r.Interval())
+	assert.False(t, r.Runtime.EnableGC)
+	assert.False(t, r.System.EnableNet)
+
+	snap := r.Once()
+	assert.Empty(t, snap.System.DiskStat)
+	assert.Equal(t, int64(0), snap.Runtime.NumGC)
+}
+
+func TestMinimalProfile(t *testing.T) {
+	r := NewRunner(nil)
+	assert.Nil(t, r.SetProfile("minimal"))
+	snap := r.Once()
+	assert.True(t, snap.CriticalOnly)
+	assert.True(t, snap.Clone().CriticalOnly)
+	assert.True(t, r.Runtime.EnableFD)
+
+	assert.Nil(t, r.SetProfile("prod"))
+	assert.False(t, r.Once().CriticalOnly)
+}
+
+func TestProfileInterval(t *testing.T) {
+	handled := make(chan struct{}, 10)
+	done := make(chan struct{})
+	defer close(done)
+
+	r := NewRunner(func(*Snapshot) {
+		select {
+		case handled <- struct{}{}:
+		default:
+		}
+	})
+	r.CollectInterval = time.Hour
+	r.Done = done
+	go r.Run()
+	<-handled
+
+	RegisterProfile(Profile{Name: "fast", CollectInterval: 10 * time.Millisecond, RuntimeCPU: true})
+	assert.Nil(t, r.SetProfile("fast"))
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the new interval hasn't taken effect")
+	}
+}
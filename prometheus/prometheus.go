@@ -0,0 +1,105 @@
+// Package prometheus exposes the runtime and system stats as a prometheus.Collector, so they can be
+// served by an existing /metrics endpoint:
+//
+//	prom.MustRegister(prometheus.NewCollector(appmetrics.Default(), "app"))
+//
+// The dotted keys are mapped to Prometheus names, e.g. cpu.goroutines of the runtime becomes
+// app_runtime_cpu_goroutines and disk./var.free of the system becomes app_system_disk_free_bytes{partition="/var"}.
+// Partitions and network interfaces are labels, durations and timestamps are converted into seconds.
+// The scheduler latencies and the GC pauses of the go runtime are the histograms
+// <namespace>_runtime_sched_latencies_seconds and <namespace>_runtime_gc_pauses_seconds.
+package prometheus
+
+import (
+	"math"
+	"runtime/metrics"
+
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/smallnest/go-app-metrics/internal/promfmt"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector of the snapshots of a Runner. It is unchecked, i.e. it doesn't
+// describe its metrics in advance, because the partitions and network interfaces change at runtime.
+type Collector struct {
+	runner    *appmetrics.Runner
+	namespace string
+}
+
+// NewCollector creates a Collector of the snapshots of r, naming the metrics <namespace>_runtime_*
+// and <namespace>_system_*. Every scrape uses r.Demand, so r collects while it is scraped.
+func NewCollector(r *appmetrics.Runner, namespace string) *Collector {
+	return &Collector{runner: r, namespace: namespace}
+}
+
+// Describe implements prometheus.Collector. It sends no descriptions, which makes the Collector unchecked.
+func (c *Collector) Describe(ch chan<- *prom.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	snap := c.runner.Demand()
+	for _, samples := range [][]promfmt.Sample{
+		promfmt.Runtime(c.namespace, &snap.Runtime),
+		promfmt.System(c.namespace, &snap.System),
+	} {
+		promfmt.AddLabels(samples, snap.Tags)
+		for _, s := range samples {
+			names := make([]string, len(s.Labels))
+			values := make([]string, len(s.Labels))
+			for i, l := range s.Labels {
+				names[i], values[i] = l[0], l[1]
+			}
+			help := s.Help
+			if help == "" {
+				help = s.Name
+			}
+			ch <- prom.MustNewConstMetric(prom.NewDesc(s.Name, help, names, nil), prom.GaugeValue, s.Value, values...)
+		}
+	}
+
+	labels := make(prom.Labels, len(snap.Tags))
+	for k, v := range snap.Tags {
+		labels[promfmt.LabelName(k)] = v
+	}
+	for _, h := range []struct {
+		name, help string
+		h          *metrics.Float64Histogram
+	}{
+		{"sched_latencies_seconds", "Distribution of the time goroutines have been runnable before running.", snap.Runtime.SchedLatencies},
+		{"gc_pauses_seconds", "Distribution of the GC stop-the-world pauses.", snap.Runtime.GCPauses},
+	} {
+		if h.h == nil {
+			continue
+		}
+		desc := prom.NewDesc(c.namespace+"_runtime_"+h.name, h.help, nil, labels)
+		count, sum, buckets := histogram(h.h)
+		ch <- prom.MustNewConstHistogram(desc, count, sum, buckets)
+	}
+}
+
+// histogram converts h into the count, the sum and the cumulative counts by upper bound of a Prometheus
+// histogram. The fine buckets of runtime/metrics are merged into buckets growing at least twofold, and
+// the sum is estimated with the middle of every bucket, because runtime/metrics doesn't record it.
+func histogram(h *metrics.Float64Histogram) (count uint64, sum float64, buckets map[float64]uint64) {
+	buckets = make(map[float64]uint64)
+	last := 0.0
+	for i, n := range h.Counts {
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		count += n
+		switch {
+		case math.IsInf(lo, -1):
+			sum += hi * float64(n)
+		case math.IsInf(hi, 1):
+			sum += lo * float64(n)
+		default:
+			sum += (lo + hi) / 2 * float64(n)
+		}
+
+		if !math.IsInf(hi, 1) && hi > 0 && hi >= 2*last {
+			buckets[hi] = count
+			last = hi
+		}
+	}
+	return count, sum, buckets
+}
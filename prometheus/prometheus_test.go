@@ -0,0 +1,42 @@
+package prometheus
+
+import (
+	"math"
+	"runtime/metrics"
+	"testing"
+
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/stretchr/testify/assert"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	reg := prom.NewRegistry()
+	reg.MustRegister(NewCollector(appmetrics.NewRunner(nil), "app"))
+
+	mfs, err := reg.Gather()
+	assert.NoError(t, err)
+
+	names := make(map[string]bool)
+	for _, mf := range mfs {
+		names[mf.GetName()] = true
+	}
+	assert.True(t, names["app_runtime_cpu_goroutines"])
+	assert.True(t, names["app_runtime_info"])
+	assert.True(t, names["app_system_mem_total_bytes"])
+	assert.True(t, names["app_runtime_sched_latencies_seconds"])
+	assert.True(t, names["app_runtime_gc_pauses_seconds"])
+}
+
+func TestHistogram(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{1, 2, 3, 4, 5},
+		Buckets: []float64{math.Inf(-1), 0, 1, 1.5, 3, math.Inf(1)},
+	}
+	count, sum, buckets := histogram(h)
+	assert.Equal(t, uint64(15), count)
+	assert.Equal(t, 0*1+0.5*2+1.25*3+2.25*4+3*5.0, sum)
+	// 1.5 is merged into 3 because it is less than twice 1
+	assert.Equal(t, map[float64]uint64{1: 3, 3: 10}, buckets)
+}
@@ -0,0 +1,203 @@
+// Package queue provides instrumentation of in-process queues and worker pools with consistent metric
+// names: depth, enqueue/dequeue counters, a processing latency histogram and worker utilization.
+//
+//	q := queue.New("mail", 8)
+//
+//	// producer
+//	q.Enqueue()
+//	ch <- job
+//
+//	// worker
+//	job := <-ch
+//	q.Dequeue()
+//	start := q.Begin()
+//	err := send(job)
+//	q.End(start, err)
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are the default upper bounds of the processing latency histogram.
+var DefaultBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Queue instruments a queue and its workers. It is safe for use from multiple go routines.
+type Queue struct {
+	name    string
+	workers int64
+
+	depth     int64
+	enqueued  int64
+	dequeued  int64
+	processed int64
+	failed    int64
+	busy      int64 // number of busy workers
+
+	mu       sync.Mutex
+	buckets  []time.Duration
+	counts   []int64 // counts[len(buckets)] is the +Inf bucket
+	sum      time.Duration
+	busyTime time.Duration // busy time of finished tasks since the previous Stats
+	prevTime time.Time
+}
+
+// New creates a Queue named name, which is used in metric keys, served by the number of workers.
+// workers may be 0 if utilization is not needed.
+func New(name string, workers int) *Queue {
+	return NewWithBuckets(name, workers, DefaultBuckets)
+}
+
+// NewWithBuckets creates a Queue like New with the upper bounds of the latency histogram in ascending order.
+func NewWithBuckets(name string, workers int, buckets []time.Duration) *Queue {
+	return &Queue{
+		name:     name,
+		workers:  int64(workers),
+		buckets:  buckets,
+		counts:   make([]int64, len(buckets)+1),
+		prevTime: time.Now(),
+	}
+}
+
+// Enqueue records that an item has been added to the queue.
+func (q *Queue) Enqueue() {
+	atomic.AddInt64(&q.enqueued, 1)
+	atomic.AddInt64(&q.depth, 1)
+}
+
+// Dequeue records that an item has been removed from the queue.
+func (q *Queue) Dequeue() {
+	atomic.AddInt64(&q.dequeued, 1)
+	atomic.AddInt64(&q.depth, -1)
+}
+
+// SetDepth sets the depth of the queue, for queues whose length is known, e.g. len(ch).
+func (q *Queue) SetDepth(n int) {
+	atomic.StoreInt64(&q.depth, int64(n))
+}
+
+// SetWorkers sets the number of workers, for pools which are resized.
+func (q *Queue) SetWorkers(n int) {
+	atomic.StoreInt64(&q.workers, int64(n))
+}
+
+// Begin records that a worker starts processing an item and returns the start time to pass to End.
+func (q *Queue) Begin() time.Time {
+	atomic.AddInt64(&q.busy, 1)
+	return time.Now()
+}
+
+// End records that a worker finished processing an item started at start, err is the result of the processing.
+func (q *Queue) End(start time.Time, err error) {
+	d := time.Since(start)
+	atomic.AddInt64(&q.busy, -1)
+	atomic.AddInt64(&q.processed, 1)
+	if err != nil {
+		atomic.AddInt64(&q.failed, 1)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := 0
+	for i < len(q.buckets) && d > q.buckets[i] {
+		i++
+	}
+	q.counts[i]++
+	q.sum += d
+	q.busyTime += d
+}
+
+// Stats returns the current stats of the queue. Utilization is calculated since the previous call
+// from the finished items, so long running items are accounted when they finish.
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	stats := QueueStats{
+		Name:      q.name,
+		Depth:     atomic.LoadInt64(&q.depth),
+		Enqueued:  atomic.LoadInt64(&q.enqueued),
+		Dequeued:  atomic.LoadInt64(&q.dequeued),
+		Processed: atomic.LoadInt64(&q.processed),
+		Failed:    atomic.LoadInt64(&q.failed),
+		Workers:   atomic.LoadInt64(&q.workers),
+		Busy:      atomic.LoadInt64(&q.busy),
+		Buckets:   q.buckets,
+		Counts:    make([]int64, len(q.counts)),
+		Sum:       q.sum,
+	}
+	copy(stats.Counts, q.counts)
+
+	if elapsed := now.Sub(q.prevTime); stats.Workers > 0 && elapsed > 0 {
+		stats.Utilization = float64(q.busyTime) / float64(elapsed) / float64(stats.Workers)
+		if stats.Utilization > 1 {
+			stats.Utilization = 1
+		}
+	}
+	q.busyTime = 0
+	q.prevTime = now
+	return stats
+}
+
+// QueueStats represents the stats of a queue.
+type QueueStats struct {
+	Name string
+
+	Depth     int64
+	Enqueued  int64
+	Dequeued  int64
+	Processed int64
+	Failed    int64
+
+	Workers int64
+	Busy    int64
+	// Utilization is the fraction of the time the workers were busy since the previous Stats, in [0, 1].
+	Utilization float64
+
+	// Buckets are the upper bounds of the latency histogram, Counts are the non-cumulative
+	// counts of the buckets with the +Inf bucket at the end, and Sum is the total latency.
+	Buckets []time.Duration
+	Counts  []int64
+	Sum     time.Duration
+}
+
+// Values returns metrics which you can write into TSDB, keyed as queue.<name>.<metric>.
+// The latency histogram is exported cumulatively as queue.<name>.latency.le_<bucket>, e.g. le_10ms and le_inf.
+func (s *QueueStats) Values() map[string]interface{} {
+	prefix := "queue." + s.Name + "."
+	values := make(map[string]interface{}, 10+len(s.Counts))
+	values[prefix+"depth"] = s.Depth
+	values[prefix+"enqueued"] = s.Enqueued
+	values[prefix+"dequeued"] = s.Dequeued
+	values[prefix+"processed"] = s.Processed
+	values[prefix+"failed"] = s.Failed
+	values[prefix+"workers"] = s.Workers
+	values[prefix+"busy"] = s.Busy
+	values[prefix+"utilization"] = s.Utilization
+
+	var count int64
+	for i, n := range s.Counts {
+		count += n
+		if i < len(s.Buckets) {
+			values[prefix+"latency.le_"+s.Buckets[i].String()] = count
+		} else {
+			values[prefix+"latency.le_inf"] = count
+		}
+	}
+	values[prefix+"latency.count"] = count
+	values[prefix+"latency.sum"] = s.Sum.Nanoseconds()
+	return values
+}
@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	q := NewWithBuckets("mail", 2, []time.Duration{10 * time.Millisecond, time.Second})
+	q.Enqueue()
+	q.Enqueue()
+	q.Enqueue()
+	q.Dequeue()
+	q.Dequeue()
+
+	q.End(q.Begin(), nil)
+	q.End(time.Now().Add(-100*time.Millisecond), errors.New("failed"))
+	q.End(time.Now().Add(-2*time.Second), nil)
+
+	stats := q.Stats()
+	assert.Equal(t, int64(1), stats.Depth)
+	assert.Equal(t, int64(3), stats.Enqueued)
+	assert.Equal(t, int64(2), stats.Dequeued)
+	assert.Equal(t, int64(3), stats.Processed)
+	assert.Equal(t, int64(1), stats.Failed)
+	assert.Equal(t, []int64{1, 1, 1}, stats.Counts)
+	assert.True(t, stats.Utilization > 0 && stats.Utilization <= 1)
+
+	values := stats.Values()
+	assert.Equal(t, int64(1), values["queue.mail.latency.le_10ms"])
+	assert.Equal(t, int64(2), values["queue.mail.latency.le_1s"])
+	assert.Equal(t, int64(3), values["queue.mail.latency.le_inf"])
+	assert.Equal(t, int64(1), values["queue.mail.depth"])
+
+	q.SetDepth(5)
+	stats = q.Stats()
+	assert.Equal(t, int64(5), stats.Depth)
+	assert.Equal(t, 0.0, stats.Utilization)
+}
@@ -0,0 +1,126 @@
+// Package ratelimit exposes the state of golang.org/x/time/rate limiters: the configured rate and burst,
+// an estimate of the available tokens and, through the wrapper, the numbers of allowed and throttled events.
+//
+//	l := ratelimit.Wrap("api", rate.NewLimiter(100, 10))
+//	if !l.Allow() {
+//		http.Error(w, "too many requests", http.StatusTooManyRequests)
+//	}
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter wraps a rate.Limiter to count the events. It is safe for use from multiple go routines.
+type Limiter struct {
+	*rate.Limiter
+
+	name      string
+	allowed   int64
+	throttled int64
+	waits     int64
+	waitTime  int64 // nanoseconds
+	waitErrs  int64
+}
+
+// Wrap wraps l as a Limiter named name, which is used in metric keys.
+// Calls of the embedded rate.Limiter which are not overridden, e.g. Reserve, are not counted.
+func Wrap(name string, l *rate.Limiter) *Limiter {
+	return &Limiter{Limiter: l, name: name}
+}
+
+// Allow is like rate.Limiter.Allow and counts the event as allowed or throttled.
+func (l *Limiter) Allow() bool {
+	return l.AllowN(time.Now(), 1)
+}
+
+// AllowN is like rate.Limiter.AllowN and counts the events as allowed or throttled.
+func (l *Limiter) AllowN(t time.Time, n int) bool {
+	ok := l.Limiter.AllowN(t, n)
+	if ok {
+		atomic.AddInt64(&l.allowed, int64(n))
+	} else {
+		atomic.AddInt64(&l.throttled, int64(n))
+	}
+	return ok
+}
+
+// Wait is like rate.Limiter.Wait and records the waiting time.
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN is like rate.Limiter.WaitN and records the waiting time. Events whose wait failed,
+// e.g. because ctx is done, are counted as throttled.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	start := time.Now()
+	err := l.Limiter.WaitN(ctx, n)
+	atomic.AddInt64(&l.waits, 1)
+	atomic.AddInt64(&l.waitTime, int64(time.Since(start)))
+	if err != nil {
+		atomic.AddInt64(&l.waitErrs, 1)
+		atomic.AddInt64(&l.throttled, int64(n))
+	} else {
+		atomic.AddInt64(&l.allowed, int64(n))
+	}
+	return err
+}
+
+// Stats returns the current state of the limiter.
+func (l *Limiter) Stats() LimiterStats {
+	return LimiterStats{
+		Name:       l.name,
+		Limit:      float64(l.Limit()),
+		Burst:      int64(l.Burst()),
+		Tokens:     l.Tokens(),
+		Allowed:    atomic.LoadInt64(&l.allowed),
+		Throttled:  atomic.LoadInt64(&l.throttled),
+		Waits:      atomic.LoadInt64(&l.waits),
+		WaitTime:   time.Duration(atomic.LoadInt64(&l.waitTime)),
+		WaitErrors: atomic.LoadInt64(&l.waitErrs),
+	}
+}
+
+// LimiterStats represents the state of a limiter. The counters are cumulative.
+type LimiterStats struct {
+	Name string
+
+	// Limit is the configured rate in events per second, Burst the configured burst size.
+	Limit float64
+	Burst int64
+	// Tokens is the estimate of the tokens available now.
+	Tokens float64
+
+	Allowed   int64
+	Throttled int64
+	// Waits is the number of calls of Wait and WaitN, WaitTime their total waiting time
+	// and WaitErrors the number of them which failed.
+	Waits      int64
+	WaitTime   time.Duration
+	WaitErrors int64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as ratelimit.<name>.<metric>.
+// An infinite limit is reported as -1.
+func (s *LimiterStats) Values() map[string]interface{} {
+	limit := s.Limit
+	if s.Limit == float64(rate.Inf) {
+		limit = -1
+	}
+
+	prefix := "ratelimit." + s.Name + "."
+	return map[string]interface{}{
+		prefix + "limit":       limit,
+		prefix + "burst":       s.Burst,
+		prefix + "tokens":      s.Tokens,
+		prefix + "allowed":     s.Allowed,
+		prefix + "throttled":   s.Throttled,
+		prefix + "waits":       s.Waits,
+		prefix + "wait_time":   s.WaitTime.Nanoseconds(),
+		prefix + "wait_errors": s.WaitErrors,
+	}
+}
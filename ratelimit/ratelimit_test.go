@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestLimiter(t *testing.T) {
+	l := Wrap("api", rate.NewLimiter(1, 2))
+	assert.True(t, l.Allow())
+	assert.True(t, l.Allow())
+	assert.False(t, l.Allow())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.NotNil(t, l.Wait(ctx))
+
+	stats := l.Stats()
+	assert.Equal(t, 1.0, stats.Limit)
+	assert.Equal(t, int64(2), stats.Burst)
+	assert.True(t, stats.Tokens < 1)
+	assert.Equal(t, int64(2), stats.Allowed)
+	assert.Equal(t, int64(2), stats.Throttled)
+	assert.Equal(t, int64(1), stats.Waits)
+	assert.Equal(t, int64(1), stats.WaitErrors)
+
+	values := stats.Values()
+	assert.Equal(t, int64(2), values["ratelimit.api.throttled"])
+
+	inf := Wrap("inf", rate.NewLimiter(rate.Inf, 0)).Stats()
+	assert.Equal(t, -1.0, inf.Values()["ratelimit.inf.limit"])
+}
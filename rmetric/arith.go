@@ -0,0 +1,185 @@
+package rmetric
+
+import (
+	"math"
+	"strings"
+
+	"github.com/smallnest/go-app-metrics/metadata"
+)
+
+// ints returns pointers to all int64 fields of f.
+func (f *RuntimeStats) ints() []*int64 {
+	return []*int64{
+		&f.NumCPU, &f.NumThread, &f.NumGoroutine, &f.NumCgoCall, &f.GOMAXPROCS, &f.MutexWait,
+		&f.Alloc, &f.TotalAlloc, &f.Sys, &f.Lookups, &f.Mallocs, &f.Frees,
+		&f.HeapAlloc, &f.HeapSys, &f.HeapIdle, &f.HeapInuse, &f.HeapReleased, &f.HeapObjects,
+		&f.StackInuse, &f.StackSys, &f.MSpanInuse, &f.MSpanSys, &f.MCacheInuse, &f.MCacheSys,
+		&f.OtherSys,
+		&f.GCSys, &f.NextGC, &f.LastGC, &f.PauseTotalNs, &f.PauseNs, &f.NumGC,
+		&f.PauseCount, &f.PauseMin, &f.PauseMax, &f.PauseMean, &f.PauseP99,
+		&f.FinalizerBacklog, &f.CleanupBacklog,
+		&f.FDOpen, &f.FDLimit, &f.FDHardLimit,
+	}
+}
+
+// intKeys are the keys in Values of the fields returned by ints, in the same order.
+var intKeys = []string{
+	"cpu.count", "cpu.threads", "cpu.goroutines", "cpu.cgo_calls", "cpu.gomaxprocs", "cpu.mutex_wait",
+	"mem.alloc", "mem.total", "mem.sys", "mem.lookups", "mem.mallocs", "mem.frees",
+	"mem.heap.alloc", "mem.heap.sys", "mem.heap.idle", "mem.heap.inuse", "mem.heap.released", "mem.heap.objects",
+	"mem.stack.inuse", "mem.stack.sys", "mem.stack.mspan_inuse", "mem.stack.mspan_sys", "mem.stack.mcache_inuse", "mem.stack.mcache_sys",
+	"mem.othersys",
+	"mem.gc.sys", "mem.gc.next", "mem.gc.last", "mem.gc.pause_total", "mem.gc.pause", "mem.gc.count",
+	"mem.gc.pause_count", "mem.gc.pause_min", "mem.gc.pause_max", "mem.gc.pause_mean", "mem.gc.pause_p99",
+	"mem.gc.finalizer_backlog", "mem.gc.cleanup_backlog",
+	"fd.open", "fd.limit", "fd.hard_limit",
+}
+
+// floats returns pointers to all float64 fields of f.
+func (f *RuntimeStats) floats() []*float64 {
+	return []*float64{&f.GCCPUFraction, &f.FDUsedPercent}
+}
+
+// floatKeys are the keys in Values of the fields returned by floats, in the same order.
+var floatKeys = []string{"mem.gc.cpu_fraction", "fd.used_percent"}
+
+// unsummed are the metrics Combine doesn't add up although their metadata keeps the last value:
+// the constants of the host and the most recent pause.
+var unsummed = map[string]bool{
+	"cpu.count":      true,
+	"cpu.gomaxprocs": true,
+	"fd.limit":       true,
+	"fd.hard_limit":  true,
+	"mem.gc.pause":   true,
+}
+
+// combineBy returns how Combine merges the values of key of several processes.
+func combineBy(key string) metadata.Aggregation {
+	m, _ := metadata.Runtime.Lookup(key)
+	switch {
+	case unsummed[key] || m.Unit == metadata.Timestamp:
+		return metadata.Max
+	case m.Aggregation == metadata.Min || m.Aggregation == metadata.Max || m.Aggregation == metadata.Mean:
+		return m.Aggregation
+	case m.Unit == metadata.Ratio || strings.HasSuffix(key, "_percent"):
+		return metadata.Mean
+	}
+	return metadata.Sum
+}
+
+// combine merges vs by the aggregation by. Min ignores zero values, which processes without
+// any GC pause report.
+func combine(by metadata.Aggregation, vs []float64) float64 {
+	var r float64
+	switch by {
+	case metadata.Max:
+		r = vs[0]
+		for _, v := range vs[1:] {
+			r = math.Max(r, v)
+		}
+	case metadata.Min:
+		for _, v := range vs {
+			if v != 0 && (r == 0 || v < r) {
+				r = v
+			}
+		}
+	default:
+		for _, v := range vs {
+			r += v
+		}
+		if by == metadata.Mean {
+			r /= float64(len(vs))
+		}
+	}
+	return r
+}
+
+// Combine returns the stats of several processes as the stats of one group: the counters and bytes
+// are summed, the host constants such as cpu.count and fd.limit, the timestamps and the maximums
+// take the max, the minimums the min, and the means, ratios and percentages the mean.
+// The percentiles of SchedLatency take the max. The tags and the histograms are copied from the first stats.
+func Combine(stats []RuntimeStats) RuntimeStats {
+	if len(stats) == 0 {
+		return RuntimeStats{}
+	}
+	r := stats[0].DeepCopy()
+	vs := make([]float64, len(stats))
+	for i, p := range r.ints() {
+		for j := range stats {
+			vs[j] = float64(*stats[j].ints()[i])
+		}
+		*p = int64(math.Round(combine(combineBy(intKeys[i]), vs)))
+	}
+	for i, p := range r.floats() {
+		for j := range stats {
+			vs[j] = *stats[j].floats()[i]
+		}
+		*p = combine(combineBy(floatKeys[i]), vs)
+	}
+	for _, s := range stats[1:] {
+		for p, v := range s.SchedLatency {
+			if r.SchedLatency == nil {
+				r.SchedLatency = make(map[string]int64)
+			}
+			if v > r.SchedLatency[p] {
+				r.SchedLatency[p] = v
+			}
+		}
+	}
+	return r
+}
+
+// DeepCopy returns a copy of f.
+func (f *RuntimeStats) DeepCopy() RuntimeStats {
+	r := *f
+	r.SchedLatencies = copyHistogram(f.SchedLatencies)
+	r.GCPauses = copyHistogram(f.GCPauses)
+	if f.SchedLatency != nil {
+		r.SchedLatency = make(map[string]int64, len(f.SchedLatency))
+		for p, v := range f.SchedLatency {
+			r.SchedLatency[p] = v
+		}
+	}
+	return r
+}
+
+// Add returns the sum of f and o. The tags, the histograms and SchedLatency are copied from f.
+func (f *RuntimeStats) Add(o *RuntimeStats) RuntimeStats {
+	r := f.DeepCopy()
+	ri, oi := r.ints(), o.ints()
+	for i := range ri {
+		*ri[i] += *oi[i]
+	}
+	rf, of := r.floats(), o.floats()
+	for i := range rf {
+		*rf[i] += *of[i]
+	}
+	return r
+}
+
+// Sub returns the difference of f and o. The tags, the histograms and SchedLatency are copied from f.
+func (f *RuntimeStats) Sub(o *RuntimeStats) RuntimeStats {
+	r := f.DeepCopy()
+	ri, oi := r.ints(), o.ints()
+	for i := range ri {
+		*ri[i] -= *oi[i]
+	}
+	rf, of := r.floats(), o.floats()
+	for i := range rf {
+		*rf[i] -= *of[i]
+	}
+	return r
+}
+
+// Scale returns f with all values multiplied by factor, e.g. 1/n to average a sum of n stats.
+// Integer values are rounded to the nearest integer. The histograms and SchedLatency are copied from f.
+func (f *RuntimeStats) Scale(factor float64) RuntimeStats {
+	r := f.DeepCopy()
+	for _, p := range r.ints() {
+		*p = int64(math.Round(float64(*p) * factor))
+	}
+	for _, p := range r.floats() {
+		*p *= factor
+	}
+	return r
+}
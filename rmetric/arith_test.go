@@ -0,0 +1,91 @@
+package rmetric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArith(t *testing.T) {
+	a := RuntimeStats{NumGoroutine: 10, HeapAlloc: 100, GCCPUFraction: 0.5, Goos: "linux"}
+	b := RuntimeStats{NumGoroutine: 5, HeapAlloc: 50, GCCPUFraction: 0.25, Goos: "darwin"}
+
+	sum := a.Add(&b)
+	assert.Equal(t, int64(15), sum.NumGoroutine)
+	assert.Equal(t, int64(150), sum.HeapAlloc)
+	assert.Equal(t, 0.75, sum.GCCPUFraction)
+	assert.Equal(t, "linux", sum.Goos)
+
+	diff := a.Sub(&b)
+	assert.Equal(t, int64(5), diff.NumGoroutine)
+	assert.Equal(t, 0.25, diff.GCCPUFraction)
+
+	avg := sum.Scale(0.5)
+	assert.Equal(t, int64(8), avg.NumGoroutine)
+	assert.Equal(t, int64(75), avg.HeapAlloc)
+	assert.Equal(t, 0.375, avg.GCCPUFraction)
+
+	c := a.DeepCopy()
+	c.HeapAlloc = 1
+	assert.Equal(t, int64(100), a.HeapAlloc)
+}
+
+// TestIntsCoverValues makes sure ints and floats cover every metric of Values.
+func TestIntsCoverValues(t *testing.T) {
+	var f RuntimeStats
+	for i, p := range f.ints() {
+		*p = int64(i + 1)
+	}
+	for _, p := range f.floats() {
+		*p = 1
+	}
+	for k, v := range f.Values() {
+		assert.NotZero(t, v, k)
+	}
+}
+
+// TestKeysMatchValues makes sure intKeys and floatKeys name the fields of ints and floats.
+func TestKeysMatchValues(t *testing.T) {
+	var f RuntimeStats
+	assert.Len(t, intKeys, len(f.ints()))
+	assert.Len(t, floatKeys, len(f.floats()))
+	for i, p := range f.ints() {
+		*p = int64(i + 1)
+	}
+	for i, p := range f.floats() {
+		*p = float64(i) + 0.5
+	}
+	values := f.Values()
+	for i, k := range intKeys {
+		assert.Equal(t, int64(i+1), values[k], k)
+	}
+	for i, k := range floatKeys {
+		assert.Equal(t, float64(i)+0.5, values[k], k)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	a := RuntimeStats{NumCPU: 8, GOMAXPROCS: 8, HeapAlloc: 100, PauseMin: 10, PauseMax: 50, PauseMean: 20,
+		LastGC: 1000, FDLimit: 1024, FDUsedPercent: 10, GCCPUFraction: 0.1, PauseCount: 3,
+		SchedLatency: map[string]int64{"p99": 5}}
+	b := RuntimeStats{NumCPU: 8, GOMAXPROCS: 8, HeapAlloc: 50, PauseMax: 0, PauseMean: 0,
+		LastGC: 2000, FDLimit: 1024, FDUsedPercent: 30, GCCPUFraction: 0.3, PauseCount: 0,
+		SchedLatency: map[string]int64{"p99": 7}}
+
+	r := Combine([]RuntimeStats{a, b})
+	assert.Equal(t, int64(8), r.NumCPU)
+	assert.Equal(t, int64(8), r.GOMAXPROCS)
+	assert.Equal(t, int64(1024), r.FDLimit)
+	assert.Equal(t, int64(150), r.HeapAlloc)
+	assert.Equal(t, int64(3), r.PauseCount)
+	assert.Equal(t, int64(10), r.PauseMin)
+	assert.Equal(t, int64(50), r.PauseMax)
+	assert.Equal(t, int64(10), r.PauseMean)
+	assert.Equal(t, int64(2000), r.LastGC)
+	assert.InDelta(t, 20.0, r.FDUsedPercent, 1e-9)
+	assert.InDelta(t, 0.2, r.GCCPUFraction, 1e-9)
+	assert.Equal(t, int64(7), r.SchedLatency["p99"])
+	assert.Equal(t, int64(5), a.SchedLatency["p99"])
+
+	assert.Equal(t, RuntimeStats{}, Combine(nil))
+}
@@ -2,9 +2,15 @@
 package rmetric
 
 import (
+	"context"
 	"runtime"
+	"runtime/metrics"
 	"runtime/pprof"
+	"sync"
 	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/safe"
+	"github.com/smallnest/go-app-metrics/status"
 )
 
 // threadProfile for getting number of threads
@@ -29,10 +35,43 @@ type Collector struct {
 	// must also be set to true for this to take affect. Defaults to true.
 	EnableGC bool
 
+	// EnableFD determines whether the open file descriptors of the process and their limits will be output.
+	// Defaults to true.
+	EnableFD bool
+
+	// Source is the source of the memory and GC stats. SourceRuntimeMetrics avoids the stop-the-world
+	// of runtime.ReadMemStats. Defaults to SourceMemStats.
+	Source Source
+
+	// SchedLatencyPercentiles are the percentiles of the scheduler latencies since the previous collection
+	// which are extracted into RuntimeStats.SchedLatency, e.g. 99 or 99.9. Defaults to DefaultPercentiles.
+	SchedLatencyPercentiles []float64
+
 	// Done, when closed, is used to signal Collector that is should stop collecting
 	// statistics and the Run function should return.
 	Done <-chan struct{}
 
+	// PanicHandler, if not nil, is called with an error describing the panic when the stats handler
+	// panics. The panic is recovered so the collection continues. Defaults to nil.
+	PanicHandler func(err error)
+
+	// ErrorHandler, if not nil, is called with a *status.ProbeError for every probe which failed
+	// in a collection. The stats of the go runtime are read from the runtime, which doesn't
+	// fail, only the fd probe reads the process from the OS. Defaults to nil.
+	ErrorHandler func(err error)
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	runMu    sync.Mutex // held while running, so Stop can wait
+
+	schedMu   sync.Mutex
+	prevSched *metrics.Float64Histogram
+
+	gcMu       sync.Mutex
+	prevNumGC  uint32
+	prevPauses *metrics.Float64Histogram
+
+	tracker      status.Tracker
 	statsHandler RuntimeStatsHandler
 }
 
@@ -45,28 +84,71 @@ func New(statsHandler RuntimeStatsHandler) *Collector {
 	}
 
 	return &Collector{
-		CollectInterval: 10 * time.Second,
-		EnableCPU:       true,
-		EnableMem:       true,
-		EnableGC:        true,
-		statsHandler:    statsHandler,
+		CollectInterval:         10 * time.Second,
+		EnableCPU:               true,
+		EnableMem:               true,
+		EnableGC:                true,
+		EnableFD:                true,
+		SchedLatencyPercentiles: DefaultPercentiles,
+		stop:                    make(chan struct{}),
+		statsHandler:            statsHandler,
 	}
 }
 
 // Run gathers statistics then outputs them to the configured RuntimeStatsHandler every
-// CollectInterval. Unlike Once, this function will return until Done has been closed
-// (or never if Done is nil), therefore it should be called in its own goroutine.
+// CollectInterval. Unlike Once, this function will return until Done has been closed or Stop
+// has been called (or never), therefore it should be called in its own goroutine.
 func (c *Collector) Run() {
-	c.statsHandler(c.collectStats())
+	c.RunContext(context.Background())
+}
+
+// RunContext is like Run, but it also returns when ctx is done. It returns the errors of the
+// probes which failed at the last collection, see Status, or nil if the last collection succeeded.
+// The cancellation of ctx isn't reported as an error. Concurrent runs of a Collector are serialized.
+func (c *Collector) RunContext(ctx context.Context) error {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	select {
+	case <-c.stop:
+		return nil
+	default:
+	}
+
+	c.tracker.SetRunning(true)
+	defer c.tracker.SetRunning(false)
+
+	c.handle(c.collectStats())
 
 	tick := time.NewTicker(c.CollectInterval)
 	defer tick.Stop()
 	for {
 		select {
 		case <-c.Done:
-			return
+			return c.tracker.Err()
+		case <-ctx.Done():
+			return c.tracker.Err()
+		case <-c.stop:
+			return c.tracker.Err()
 		case <-tick.C:
-			c.statsHandler(c.collectStats())
+			c.handle(c.collectStats())
+		}
+	}
+}
+
+// Stop stops Run and RunContext and waits until they have returned, a Collector can't be run again
+// once it has been stopped. It is safe to call Stop more than once.
+func (c *Collector) Stop() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.runMu.Lock()
+	c.runMu.Unlock()
+}
+
+// handle outputs stats to the handler, recovering its panic.
+func (c *Collector) handle(stats RuntimeStats) {
+	if err := safe.Call(c.statsHandler, stats); err != nil {
+		c.tracker.HandlerPanicked()
+		if c.PanicHandler != nil {
+			c.PanicHandler(err)
 		}
 	}
 }
@@ -76,6 +158,16 @@ func (c *Collector) Once() RuntimeStats {
 	return c.collectStats()
 }
 
+// Status returns the state of the Collector. The probes are cpu, mem, gc and fd.
+func (c *Collector) Status() status.Status {
+	return c.tracker.Status("rmetric", c.CollectInterval, map[string]bool{
+		"cpu": c.EnableCPU,
+		"mem": c.EnableMem,
+		"gc":  c.EnableMem && c.EnableGC,
+		"fd":  c.EnableFD,
+	})
+}
+
 // collectStats collects all configured stats once.
 func (c *Collector) collectStats() RuntimeStats {
 	stats := RuntimeStats{}
@@ -88,8 +180,15 @@ func (c *Collector) collectStats() RuntimeStats {
 			NumCPU:       int64(runtime.NumCPU()),
 		}
 		c.collectCPUStats(&stats, &cStats)
+		c.collectSchedStats(&stats)
 	}
-	if c.EnableMem {
+	if c.EnableMem && c.Source == SourceRuntimeMetrics {
+		c.collectRuntimeMetrics(&stats, c.EnableGC)
+		if c.EnableGC {
+			stats.GCPauses = readGCPauses()
+			c.setPauseStatsFromHistogram(&stats)
+		}
+	} else if c.EnableMem {
 		m := &runtime.MemStats{}
 		runtime.ReadMemStats(m)
 		c.collectMemStats(&stats, m)
@@ -97,14 +196,33 @@ func (c *Collector) collectStats() RuntimeStats {
 			c.collectGCStats(&stats, m)
 		}
 	}
+	if c.EnableMem && c.EnableGC {
+		c.collectFinalizerStats(&stats)
+	}
+	var errs map[string]error
+	if c.EnableFD {
+		errs = map[string]error{"fd": c.collectFDStats(&stats)}
+	}
 
 	stats.Goos = runtime.GOOS
 	stats.Goarch = runtime.GOARCH
 	stats.Version = runtime.Version()
 
+	c.recordCollection(errs)
 	return stats
 }
 
+// recordCollection records a collection and reports the errors of its probes to ErrorHandler.
+func (c *Collector) recordCollection(errs map[string]error) {
+	c.tracker.Collected(errs)
+	if c.ErrorHandler == nil {
+		return
+	}
+	for _, err := range status.ProbeErrors("rmetric", errs) {
+		c.ErrorHandler(err)
+	}
+}
+
 func (*Collector) collectCPUStats(stats *RuntimeStats, s *cpuStats) {
 	stats.NumCPU = s.NumCPU
 	stats.NumGoroutine = s.NumGoroutine
@@ -140,7 +258,7 @@ func (*Collector) collectMemStats(stats *RuntimeStats, m *runtime.MemStats) {
 	stats.OtherSys = int64(m.OtherSys)
 }
 
-func (*Collector) collectGCStats(stats *RuntimeStats, m *runtime.MemStats) {
+func (c *Collector) collectGCStats(stats *RuntimeStats, m *runtime.MemStats) {
 	stats.GCSys = int64(m.GCSys)
 	stats.NextGC = int64(m.NextGC)
 	stats.LastGC = int64(m.LastGC)
@@ -148,6 +266,10 @@ func (*Collector) collectGCStats(stats *RuntimeStats, m *runtime.MemStats) {
 	stats.PauseNs = int64(m.PauseNs[(m.NumGC+255)%256])
 	stats.NumGC = int64(m.NumGC)
 	stats.GCCPUFraction = float64(m.GCCPUFraction)
+
+	pauses, count := c.pauses(m)
+	setPauseStats(stats, pauses, count)
+	stats.GCPauses = readGCPauses()
 }
 
 type cpuStats struct {
@@ -165,6 +287,18 @@ type RuntimeStats struct {
 	NumGoroutine int64 `json:"cpu.goroutines"`
 	NumCgoCall   int64 `json:"cpu.cgo_calls"`
 
+	// GOMAXPROCS, MutexWait and SchedLatencies are read from package runtime/metrics. MutexWait is the
+	// cumulative time goroutines have been blocked on sync.Mutex and sync.RWMutex in nanoseconds, and
+	// SchedLatencies is the distribution of the time goroutines have been runnable before running, in seconds.
+	// They are zero and nil if the go runtime doesn't expose them.
+	GOMAXPROCS     int64                     `json:"cpu.gomaxprocs"`
+	MutexWait      int64                     `json:"cpu.mutex_wait"`
+	SchedLatencies *metrics.Float64Histogram `json:"-"`
+	// SchedLatency are the percentiles of the scheduler latencies since the previous collection, or since
+	// the start of the process for the first one, in nanoseconds keyed by PercentileName, e.g. p99.
+	// They are nil if no goroutine has been scheduled.
+	SchedLatency map[string]int64 `json:"cpu.sched_latency,omitempty"`
+
 	// General
 	Alloc      int64 `json:"mem.alloc"`
 	TotalAlloc int64 `json:"mem.total"`
@@ -192,13 +326,38 @@ type RuntimeStats struct {
 	OtherSys int64 `json:"mem.othersys"`
 
 	// GC
-	GCSys         int64   `json:"mem.gc.sys"`
-	NextGC        int64   `json:"mem.gc.next"`
-	LastGC        int64   `json:"mem.gc.last"`
-	PauseTotalNs  int64   `json:"mem.gc.pause_total"`
-	PauseNs       int64   `json:"mem.gc.pause"`
-	NumGC         int64   `json:"mem.gc.count"`
-	GCCPUFraction float64 `json:"mem.gc.cpu_fraction"`
+	GCSys        int64 `json:"mem.gc.sys"`
+	NextGC       int64 `json:"mem.gc.next"`
+	LastGC       int64 `json:"mem.gc.last"`
+	PauseTotalNs int64 `json:"mem.gc.pause_total"`
+	PauseNs      int64 `json:"mem.gc.pause"`
+	// PauseCount is the number of GC cycles since the previous collection, or since the start of the process
+	// for the first one. PauseMin, PauseMax, PauseMean and PauseP99 are the stats of their pauses in nanoseconds.
+	// With SourceMemStats they are exact for the last 256 cycles. With SourceRuntimeMetrics they are estimated
+	// from the buckets of GCPauses, which is the distribution of the pauses since the start of the process in seconds.
+	PauseCount    int64                     `json:"mem.gc.pause_count"`
+	PauseMin      int64                     `json:"mem.gc.pause_min"`
+	PauseMax      int64                     `json:"mem.gc.pause_max"`
+	PauseMean     int64                     `json:"mem.gc.pause_mean"`
+	PauseP99      int64                     `json:"mem.gc.pause_p99"`
+	GCPauses      *metrics.Float64Histogram `json:"-"`
+	NumGC         int64                     `json:"mem.gc.count"`
+	GCCPUFraction float64                   `json:"mem.gc.cpu_fraction"`
+
+	// FinalizerBacklog and CleanupBacklog are the numbers of objects pending finalization
+	// and cleanup. They are zero if the go runtime doesn't expose them.
+	FinalizerBacklog int64 `json:"mem.gc.finalizer_backlog"`
+	CleanupBacklog   int64 `json:"mem.gc.cleanup_backlog"`
+
+	// FDOpen is the number of open file descriptors of the process. FDLimit and FDHardLimit are the
+	// soft and hard limits of RLIMIT_NOFILE, -1 if unlimited or unknown. FDUsedPercent is FDOpen as a
+	// percentage of FDLimit, 0 if unlimited. They are omitted from Values on the platforms where the
+	// open file descriptors can't be counted, e.g. windows and darwin.
+	FDOpen        int64   `json:"fd.open"`
+	FDLimit       int64   `json:"fd.limit"`
+	FDHardLimit   int64   `json:"fd.hard_limit"`
+	FDUsedPercent float64 `json:"fd.used_percent"`
+	fdUnsupported bool
 
 	Goarch  string `json:"-"`
 	Goos    string `json:"-"`
@@ -215,12 +374,15 @@ func (f *RuntimeStats) Tags() map[string]string {
 }
 
 // Values returns metrics which you can write into TSDB.
+// The percentiles of the scheduler latencies are keyed as cpu.sched_latency.<percentile>, e.g. cpu.sched_latency.p99.
 func (f *RuntimeStats) Values() map[string]interface{} {
-	return map[string]interface{}{
+	values := map[string]interface{}{
 		"cpu.count":      f.NumCPU,
 		"cpu.threads":    f.NumThread,
 		"cpu.goroutines": f.NumGoroutine,
 		"cpu.cgo_calls":  f.NumCgoCall,
+		"cpu.gomaxprocs": f.GOMAXPROCS,
+		"cpu.mutex_wait": f.MutexWait,
 
 		"mem.alloc":   f.Alloc,
 		"mem.total":   f.TotalAlloc,
@@ -249,7 +411,25 @@ func (f *RuntimeStats) Values() map[string]interface{} {
 		"mem.gc.last":         f.LastGC,
 		"mem.gc.pause_total":  f.PauseTotalNs,
 		"mem.gc.pause":        f.PauseNs,
+		"mem.gc.pause_count":  f.PauseCount,
+		"mem.gc.pause_min":    f.PauseMin,
+		"mem.gc.pause_max":    f.PauseMax,
+		"mem.gc.pause_mean":   f.PauseMean,
+		"mem.gc.pause_p99":    f.PauseP99,
 		"mem.gc.count":        f.NumGC,
 		"mem.gc.cpu_fraction": float64(f.GCCPUFraction),
+
+		"mem.gc.finalizer_backlog": f.FinalizerBacklog,
+		"mem.gc.cleanup_backlog":   f.CleanupBacklog,
+	}
+	if !f.fdUnsupported {
+		values["fd.open"] = f.FDOpen
+		values["fd.limit"] = f.FDLimit
+		values["fd.hard_limit"] = f.FDHardLimit
+		values["fd.used_percent"] = f.FDUsedPercent
+	}
+	for p, v := range f.SchedLatency {
+		values["cpu.sched_latency."+p] = v
 	}
+	return values
 }
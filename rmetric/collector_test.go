@@ -1,6 +1,7 @@
 package rmetric
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -70,3 +71,55 @@ func TestCollector(t *testing.T) {
 	}
 
 }
+
+func TestCollectorHandlerPanic(t *testing.T) {
+	var panicErr error
+	c := New(func(RuntimeStats) { panic("boom") })
+	c.PanicHandler = func(err error) { panicErr = err }
+	c.CollectInterval = 10 * time.Millisecond
+
+	done := make(chan struct{})
+	c.Done = done
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(done)
+	}()
+	c.Run()
+
+	if panicErr == nil {
+		t.Error("expected the panic to be reported")
+	}
+	if s := c.Status(); s.HandlerPanics < 2 {
+		t.Errorf("expected the collection to continue after a panic, got %d panics", s.HandlerPanics)
+	}
+}
+
+func TestCollectorRunContext(t *testing.T) {
+	c := New(nil)
+	c.CollectInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.RunContext(ctx); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if s := c.Status(); s.Running || s.Collections < 2 {
+		t.Errorf("expected the collector stopped after collections, got %+v", s)
+	}
+}
+
+func TestCollectorStop(t *testing.T) {
+	c := New(nil)
+	c.CollectInterval = 10 * time.Millisecond
+	go c.Run()
+	time.Sleep(30 * time.Millisecond)
+
+	c.Stop()
+	if c.Status().Running {
+		t.Error("expected Run returned after Stop")
+	}
+	c.Stop()
+	if err := c.RunContext(context.Background()); err != nil {
+		t.Errorf("expected no error from a stopped collector, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package rmetric
+
+import (
+	"os"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// errNotImplemented is the message of the error gopsutil returns for what isn't implemented on the
+// platform, e.g. the open file descriptors on windows, darwin and the BSDs. The error itself is internal.
+const errNotImplemented = "not implemented yet"
+
+// collectFDStats sets the open file descriptors of the current process and its limits. The fd stats
+// are omitted without error on the platforms where the open file descriptors can't be counted.
+func (*Collector) collectFDStats(stats *RuntimeStats) error {
+	stats.FDLimit, stats.FDHardLimit = -1, -1
+
+	p, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return err
+	}
+	open, err := p.NumFDs()
+	if err != nil && err.Error() == errNotImplemented {
+		stats.fdUnsupported = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stats.FDOpen = int64(open)
+
+	soft, hard, err := fdLimits()
+	if err != nil {
+		return err
+	}
+	stats.FDLimit, stats.FDHardLimit = soft, hard
+	if soft > 0 {
+		stats.FDUsedPercent = float64(stats.FDOpen) / float64(soft) * 100
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package rmetric
+
+// fdLimits returns -1 as the limits of the open file descriptors aren't known outside of unix.
+// The handles of a windows process are only limited by the memory of the kernel.
+func fdLimits() (soft, hard int64, err error) {
+	return -1, -1, nil
+}
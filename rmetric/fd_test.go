@@ -0,0 +1,46 @@
+package rmetric
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestFDStats(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Skipping test because the open file descriptors are only counted on linux")
+	}
+	f, err := os.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	c := New(nil)
+	stats := c.Once()
+	if stats.FDOpen <= 0 {
+		t.Errorf("expected open file descriptors, got %d", stats.FDOpen)
+	}
+	if stats.FDLimit != -1 && stats.FDLimit < stats.FDOpen {
+		t.Errorf("expected the limit %d to be at least the open file descriptors %d", stats.FDLimit, stats.FDOpen)
+	}
+	if stats.FDLimit > 0 && stats.FDUsedPercent <= 0 {
+		t.Errorf("expected the used percentage, got %f", stats.FDUsedPercent)
+	}
+	if st := c.Status(); !st.Healthy() {
+		t.Errorf("expected the fd probe to succeed: %+v", st)
+	}
+
+	c = New(nil)
+	c.EnableFD = false
+	if stats := c.Once(); stats.FDOpen != 0 {
+		t.Errorf("expected no fd stats, got %d", stats.FDOpen)
+	}
+}
+
+func TestFDStatsUnsupported(t *testing.T) {
+	stats := RuntimeStats{fdUnsupported: true}
+	if _, ok := stats.Values()["fd.open"]; ok {
+		t.Errorf("unexpected key (fd.open) where the open file descriptors can't be counted")
+	}
+}
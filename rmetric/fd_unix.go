@@ -0,0 +1,21 @@
+//go:build unix
+
+package rmetric
+
+import "syscall"
+
+// fdLimits returns the soft and hard limits of the open file descriptors, -1 if unlimited.
+func fdLimits() (soft, hard int64, err error) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return -1, -1, err
+	}
+	return rlimit(uint64(rlim.Cur)), rlimit(uint64(rlim.Max)), nil
+}
+
+func rlimit(v uint64) int64 {
+	if v > 1<<62 { // RLIM_INFINITY
+		return -1
+	}
+	return int64(v)
+}
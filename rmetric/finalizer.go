@@ -0,0 +1,51 @@
+package rmetric
+
+import "runtime/metrics"
+
+// runtime/metrics names of the finalizer and cleanup queues, available since go 1.25.
+const (
+	finalizersQueued   = "/gc/finalizers/queued:finalizers"
+	finalizersExecuted = "/gc/finalizers/executed:finalizers"
+	cleanupsQueued     = "/gc/cleanups/queued:cleanups"
+	cleanupsExecuted   = "/gc/cleanups/executed:cleanups"
+)
+
+// finalizerSamples are the supported samples of the finalizer and cleanup queues.
+// It is empty if the go runtime doesn't expose them.
+var finalizerSamples = supportedSamples(finalizersQueued, finalizersExecuted, cleanupsQueued, cleanupsExecuted)
+
+// supportedSamples returns samples of the names which are supported by the go runtime.
+func supportedSamples(names ...string) []metrics.Sample {
+	supported := make(map[string]bool)
+	for _, d := range metrics.All() {
+		supported[d.Name] = true
+	}
+
+	var samples []metrics.Sample
+	for _, name := range names {
+		if supported[name] {
+			samples = append(samples, metrics.Sample{Name: name})
+		}
+	}
+	return samples
+}
+
+func (*Collector) collectFinalizerStats(stats *RuntimeStats) {
+	if len(finalizerSamples) == 0 {
+		return
+	}
+
+	samples := make([]metrics.Sample, len(finalizerSamples))
+	copy(samples, finalizerSamples)
+	metrics.Read(samples)
+
+	values := make(map[string]int64, len(samples))
+	for _, s := range samples {
+		if s.Value.Kind() == metrics.KindUint64 {
+			values[s.Name] = int64(s.Value.Uint64())
+		}
+	}
+
+	stats.FinalizerBacklog = values[finalizersQueued] - values[finalizersExecuted]
+	stats.CleanupBacklog = values[cleanupsQueued] - values[cleanupsExecuted]
+}
@@ -0,0 +1,33 @@
+package rmetric
+
+import (
+	"runtime"
+	"testing"
+)
+
+type finalizable struct {
+	_ [16]byte
+}
+
+func TestCollectFinalizerStats(t *testing.T) {
+	if len(finalizerSamples) == 0 {
+		t.Skip("Skipping test because the go runtime doesn't expose finalizer metrics")
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+	for i := 0; i < 10; i++ {
+		// the first finalizer blocks the finalizer goroutine so the others stay queued
+		runtime.SetFinalizer(&finalizable{}, func(*finalizable) { <-block })
+	}
+	runtime.GC()
+	runtime.GC()
+
+	stats := New(nil).Once()
+	if stats.FinalizerBacklog <= 0 {
+		t.Errorf("expected finalizer backlog, got %d", stats.FinalizerBacklog)
+	}
+	if _, ok := stats.Values()["mem.gc.finalizer_backlog"]; !ok {
+		t.Errorf("expected key (mem.gc.finalizer_backlog) not found")
+	}
+}
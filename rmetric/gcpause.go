@@ -0,0 +1,100 @@
+package rmetric
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"time"
+)
+
+// runtime/metrics names of the distribution of the GC pauses, the first one is available since go 1.22
+// and replaces the second one.
+var gcPauseSamples = supportedSamples("/sched/pauses/total/gc:seconds", "/gc/pauses:seconds")
+
+// readGCPauses returns the distribution of the GC pauses since the start of the process, or nil if
+// the go runtime doesn't expose it.
+func readGCPauses() *metrics.Float64Histogram {
+	if len(gcPauseSamples) == 0 {
+		return nil
+	}
+	samples := readSamples(gcPauseSamples[:1])
+	if samples[0].Value.Kind() != metrics.KindFloat64Histogram {
+		return nil
+	}
+	return samples[0].Value.Float64Histogram()
+}
+
+// pauses returns the pauses of the GC cycles since the previous collection from the ring of m, and the
+// number of these cycles, which is larger than the number of pauses if the ring has been overwritten.
+// For the first collection they are the pauses since the start of the process.
+func (c *Collector) pauses(m *runtime.MemStats) ([]uint64, int64) {
+	c.gcMu.Lock()
+	defer c.gcMu.Unlock()
+
+	n := m.NumGC - c.prevNumGC
+	if m.NumGC < c.prevNumGC {
+		n = m.NumGC
+	}
+	c.prevNumGC = m.NumGC
+
+	available := n
+	if available > uint32(len(m.PauseNs)) {
+		available = uint32(len(m.PauseNs))
+	}
+	pauses := make([]uint64, available)
+	for i := uint32(0); i < available; i++ {
+		// the pause of cycle k is at (k+255)%256, the last cycle is NumGC
+		pauses[i] = m.PauseNs[(m.NumGC-i+uint32(len(m.PauseNs))-1)%uint32(len(m.PauseNs))]
+	}
+	return pauses, int64(n)
+}
+
+// setPauseStats sets the count, min, max, mean and p99 of the GC pauses since the previous collection.
+func setPauseStats(stats *RuntimeStats, pauses []uint64, count int64) {
+	stats.PauseCount = count
+	if len(pauses) == 0 {
+		return
+	}
+
+	sorted := append([]uint64(nil), pauses...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum uint64
+	for _, p := range sorted {
+		sum += p
+	}
+	stats.PauseMin = int64(sorted[0])
+	stats.PauseMax = int64(sorted[len(sorted)-1])
+	stats.PauseMean = int64(sum / uint64(len(sorted)))
+	// nearest rank
+	stats.PauseP99 = int64(sorted[int(math.Ceil(0.99*float64(len(sorted))))-1])
+}
+
+// setPauseStatsFromHistogram sets the pause stats like setPauseStats from the distribution of the pauses
+// since the previous collection, which only tells the buckets of the pauses.
+func (c *Collector) setPauseStatsFromHistogram(stats *RuntimeStats) {
+	c.gcMu.Lock()
+	h := histogramDelta(stats.GCPauses, c.prevPauses)
+	c.prevPauses = stats.GCPauses
+	c.gcMu.Unlock()
+	if h == nil {
+		return
+	}
+
+	for _, n := range h.Counts {
+		stats.PauseCount += int64(n)
+	}
+	if stats.PauseCount == 0 {
+		return
+	}
+
+	ns := func(seconds float64) int64 { return int64(seconds * float64(time.Second)) }
+	min, _ := HistogramPercentile(h, 0)
+	max, _ := HistogramPercentile(h, 100)
+	p99, _ := HistogramPercentile(h, 99)
+	stats.PauseMin = ns(min)
+	stats.PauseMax = ns(max)
+	stats.PauseMean = ns(histogramMean(h))
+	stats.PauseP99 = ns(p99)
+}
@@ -0,0 +1,59 @@
+package rmetric
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauses(t *testing.T) {
+	c := New(nil)
+	m := &runtime.MemStats{NumGC: 3}
+	m.PauseNs[0], m.PauseNs[1], m.PauseNs[2] = 100, 300, 200
+	pauses, count := c.pauses(m)
+	assert.Equal(t, []uint64{200, 300, 100}, pauses)
+	assert.Equal(t, int64(3), count)
+
+	// the ring has been overwritten since the previous collection
+	m.NumGC = 300
+	for i := range m.PauseNs {
+		m.PauseNs[i] = uint64(i + 1)
+	}
+	pauses, count = c.pauses(m)
+	assert.Len(t, pauses, 256)
+	assert.Equal(t, uint64(300-1)%256+1, pauses[0])
+	assert.Equal(t, int64(297), count)
+
+	pauses, count = c.pauses(m)
+	assert.Empty(t, pauses)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestPauseStats(t *testing.T) {
+	var stats RuntimeStats
+	pauses := make([]uint64, 100)
+	for i := range pauses {
+		pauses[i] = uint64(100 - i)
+	}
+	setPauseStats(&stats, pauses, 120)
+	assert.Equal(t, int64(120), stats.PauseCount)
+	assert.Equal(t, int64(1), stats.PauseMin)
+	assert.Equal(t, int64(100), stats.PauseMax)
+	assert.Equal(t, int64(50), stats.PauseMean)
+	assert.Equal(t, int64(99), stats.PauseP99)
+}
+
+func TestCollectPauses(t *testing.T) {
+	for _, source := range []Source{SourceMemStats, SourceRuntimeMetrics} {
+		c := NewWithOptions(nil, WithSource(source))
+		c.Once()
+		runtime.GC()
+		runtime.GC()
+		stats := c.Once()
+
+		assert.True(t, stats.PauseCount >= 2, source)
+		assert.True(t, stats.PauseMin <= stats.PauseP99 && stats.PauseP99 <= stats.PauseMax, source)
+		assert.True(t, stats.PauseMax > 0, source)
+	}
+}
@@ -0,0 +1,121 @@
+package rmetric
+
+import (
+	"math"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPercentiles are the default percentiles extracted from the scheduler latencies.
+var DefaultPercentiles = []float64{50, 95, 99}
+
+// PercentileName returns the name of percentile p in metric keys, e.g. p99 or p99_9.
+func PercentileName(p float64) string {
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+}
+
+// histogramDelta returns the histogram of the values observed between prev and cur, or cur if prev is nil
+// or has other buckets. A count which decreased is treated as zero.
+func histogramDelta(cur, prev *metrics.Float64Histogram) *metrics.Float64Histogram {
+	if cur == nil || prev == nil || len(prev.Counts) != len(cur.Counts) {
+		return cur
+	}
+
+	delta := &metrics.Float64Histogram{Counts: make([]uint64, len(cur.Counts)), Buckets: cur.Buckets}
+	for i, n := range cur.Counts {
+		if n > prev.Counts[i] {
+			delta.Counts[i] = n - prev.Counts[i]
+		}
+	}
+	return delta
+}
+
+// HistogramPercentile returns the p-th percentile of the values in h, interpolated linearly inside the
+// bucket containing it. The unbounded first and last buckets are represented by their finite boundary.
+// It returns false if h is empty.
+func HistogramPercentile(h *metrics.Float64Histogram, p float64) (float64, bool) {
+	if h == nil {
+		return 0, false
+	}
+
+	var total uint64
+	for _, n := range h.Counts {
+		total += n
+	}
+	if total == 0 {
+		return 0, false
+	}
+
+	rank := p / 100 * float64(total)
+	var seen float64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		if seen+float64(n) < rank && i < len(h.Counts)-1 {
+			seen += float64(n)
+			continue
+		}
+
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		switch {
+		case math.IsInf(lo, -1):
+			return hi, true
+		case math.IsInf(hi, 1):
+			return lo, true
+		}
+		frac := (rank - seen) / float64(n)
+		if frac < 0 {
+			frac = 0
+		} else if frac > 1 {
+			frac = 1
+		}
+		return lo + (hi-lo)*frac, true
+	}
+	return 0, false
+}
+
+// histogramMean estimates the mean of the values in h by the middle of their buckets, or the finite
+// boundary of the unbounded first and last buckets. It returns 0 if h is empty.
+func histogramMean(h *metrics.Float64Histogram) float64 {
+	var count uint64
+	var sum float64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		switch {
+		case math.IsInf(lo, -1):
+			sum += hi * float64(n)
+		case math.IsInf(hi, 1):
+			sum += lo * float64(n)
+		default:
+			sum += (lo + hi) / 2 * float64(n)
+		}
+		count += n
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// percentiles returns the percentiles ps of h, a histogram in seconds, in nanoseconds keyed by PercentileName.
+// It returns nil if h is empty.
+func percentiles(h *metrics.Float64Histogram, ps []float64) map[string]int64 {
+	var values map[string]int64
+	for _, p := range ps {
+		v, ok := HistogramPercentile(h, p)
+		if !ok {
+			return nil
+		}
+		if values == nil {
+			values = make(map[string]int64, len(ps))
+		}
+		values[PercentileName(p)] = int64(v * float64(time.Second))
+	}
+	return values
+}
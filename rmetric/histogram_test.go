@@ -0,0 +1,56 @@
+package rmetric
+
+import (
+	"math"
+	"runtime/metrics"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{0, 50, 40, 10},
+		Buckets: []float64{math.Inf(-1), 0, 0.001, 0.01, math.Inf(1)},
+	}
+
+	v, ok := HistogramPercentile(h, 50)
+	assert.True(t, ok)
+	assert.Equal(t, 0.001, v)
+	v, _ = HistogramPercentile(h, 70)
+	assert.InDelta(t, 0.0055, v, 1e-12)
+	v, _ = HistogramPercentile(h, 99)
+	assert.Equal(t, 0.01, v)
+
+	_, ok = HistogramPercentile(&metrics.Float64Histogram{Counts: []uint64{0}, Buckets: []float64{0, 1}}, 50)
+	assert.False(t, ok)
+
+	assert.Equal(t, "p99_9", PercentileName(99.9))
+}
+
+func TestSchedLatency(t *testing.T) {
+	c := NewWithOptions(nil, WithSchedLatencyPercentiles(50, 99.9))
+	c.Once()
+	prev := c.prevSched
+	if prev == nil {
+		t.Skip("Skipping test because the go runtime doesn't expose scheduler latencies")
+	}
+
+	cur := copyHistogram(prev)
+	cur.Counts[len(cur.Counts)/2] += 10
+	assert.Equal(t, uint64(10), sum(histogramDelta(cur, prev).Counts))
+
+	stats := c.Once()
+	if stats.SchedLatency != nil {
+		assert.Contains(t, stats.Values(), "cpu.sched_latency.p99_9")
+		assert.True(t, stats.SchedLatency["p50"] <= stats.SchedLatency["p99_9"])
+	}
+}
+
+func sum(counts []uint64) uint64 {
+	var n uint64
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
@@ -0,0 +1,72 @@
+package rmetric
+
+import (
+	"context"
+	"time"
+)
+
+// Option configures a Collector created by NewWithOptions.
+type Option func(*Collector)
+
+// NewWithOptions creates a new Collector like New and applies opts, so the Collector is fully
+// configured before it is shared with another goroutine.
+//
+//	c := rmetric.NewWithOptions(handler, rmetric.WithInterval(time.Minute), rmetric.WithContext(ctx))
+//	go c.Run()
+func NewWithOptions(statsHandler RuntimeStatsHandler, opts ...Option) *Collector {
+	c := New(statsHandler)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithInterval sets CollectInterval.
+func WithInterval(d time.Duration) Option {
+	return func(c *Collector) { c.CollectInterval = d }
+}
+
+// WithCPU sets EnableCPU.
+func WithCPU(enabled bool) Option {
+	return func(c *Collector) { c.EnableCPU = enabled }
+}
+
+// WithMem sets EnableMem.
+func WithMem(enabled bool) Option {
+	return func(c *Collector) { c.EnableMem = enabled }
+}
+
+// WithGC sets EnableGC.
+func WithGC(enabled bool) Option {
+	return func(c *Collector) { c.EnableGC = enabled }
+}
+
+// WithFD sets EnableFD.
+func WithFD(enabled bool) Option {
+	return func(c *Collector) { c.EnableFD = enabled }
+}
+
+// WithSource sets Source.
+func WithSource(source Source) Option {
+	return func(c *Collector) { c.Source = source }
+}
+
+// WithSchedLatencyPercentiles sets SchedLatencyPercentiles.
+func WithSchedLatencyPercentiles(ps ...float64) Option {
+	return func(c *Collector) { c.SchedLatencyPercentiles = ps }
+}
+
+// WithContext makes Run return when ctx is done, it sets Done.
+func WithContext(ctx context.Context) Option {
+	return func(c *Collector) { c.Done = ctx.Done() }
+}
+
+// WithPanicHandler sets PanicHandler.
+func WithPanicHandler(f func(err error)) Option {
+	return func(c *Collector) { c.PanicHandler = f }
+}
+
+// WithErrorHandler sets ErrorHandler.
+func WithErrorHandler(f func(err error)) Option {
+	return func(c *Collector) { c.ErrorHandler = f }
+}
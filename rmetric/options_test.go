@@ -0,0 +1,29 @@
+package rmetric
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewWithOptions(nil, WithInterval(time.Minute), WithCPU(false), WithContext(ctx))
+	assert.Equal(t, time.Minute, c.CollectInterval)
+	assert.False(t, c.EnableCPU)
+	assert.True(t, c.EnableMem)
+
+	stats := c.Once()
+	assert.Equal(t, int64(0), stats.NumGoroutine)
+	assert.True(t, stats.HeapAlloc > 0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run()
+	}()
+	cancel()
+	<-done
+}
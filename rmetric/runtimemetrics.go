@@ -0,0 +1,170 @@
+package rmetric
+
+import (
+	"runtime/metrics"
+	"time"
+)
+
+// Source is the source of the memory and GC stats.
+type Source int
+
+const (
+	// SourceMemStats reads the stats by runtime.ReadMemStats, which stops the world.
+	SourceMemStats Source = iota
+	// SourceRuntimeMetrics reads the stats by package runtime/metrics, which doesn't stop the world.
+	// LastGC, PauseNs, PauseTotalNs and Lookups have no equivalent in runtime/metrics, so they are zero,
+	// and the stats of the pauses since the previous collection are estimated.
+	SourceRuntimeMetrics
+)
+
+// runtime/metrics names of the stats which runtime.MemStats doesn't have.
+const (
+	gomaxprocs     = "/sched/gomaxprocs:threads"
+	mutexWait      = "/sync/mutex/wait/total:seconds"
+	schedLatencies = "/sched/latencies:seconds"
+)
+
+// cpuSamples are the supported samples of the stats read by collectSchedStats.
+var cpuSamples = supportedSamples(gomaxprocs, mutexWait, schedLatencies)
+
+// memSamples are the supported samples of the memory and GC stats read with SourceRuntimeMetrics.
+var memSamples = supportedSamples(
+	"/memory/classes/total:bytes",
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/heap/unused:bytes",
+	"/memory/classes/heap/free:bytes",
+	"/memory/classes/heap/released:bytes",
+	"/memory/classes/heap/stacks:bytes",
+	"/memory/classes/os-stacks:bytes",
+	"/memory/classes/metadata/mspan/inuse:bytes",
+	"/memory/classes/metadata/mspan/free:bytes",
+	"/memory/classes/metadata/mcache/inuse:bytes",
+	"/memory/classes/metadata/mcache/free:bytes",
+	"/memory/classes/metadata/other:bytes",
+	"/memory/classes/other:bytes",
+	"/gc/heap/allocs:bytes",
+	"/gc/heap/allocs:objects",
+	"/gc/heap/frees:objects",
+	"/gc/heap/tiny/allocs:objects",
+	"/gc/heap/objects:objects",
+	"/gc/heap/goal:bytes",
+	"/gc/cycles/total:gc-cycles",
+	"/cpu/classes/gc/total:cpu-seconds",
+	"/cpu/classes/total:cpu-seconds",
+)
+
+// readSamples reads a copy of samples, so the templates can be shared.
+func readSamples(templates []metrics.Sample) []metrics.Sample {
+	samples := make([]metrics.Sample, len(templates))
+	copy(samples, templates)
+	metrics.Read(samples)
+	return samples
+}
+
+// sampleValues holds the values of samples keyed by name.
+type sampleValues map[string]metrics.Value
+
+func newSampleValues(samples []metrics.Sample) sampleValues {
+	values := make(sampleValues, len(samples))
+	for _, s := range samples {
+		values[s.Name] = s.Value
+	}
+	return values
+}
+
+// int returns the value of name as int64, floats are seconds converted to nanoseconds.
+// It returns 0 if name isn't supported.
+func (v sampleValues) int(name string) int64 {
+	switch value := v[name]; value.Kind() {
+	case metrics.KindUint64:
+		return int64(value.Uint64())
+	case metrics.KindFloat64:
+		return int64(value.Float64() * float64(time.Second))
+	default:
+		return 0
+	}
+}
+
+func (v sampleValues) float(name string) float64 {
+	if value := v[name]; value.Kind() == metrics.KindFloat64 {
+		return value.Float64()
+	}
+	return 0
+}
+
+func (v sampleValues) histogram(name string) *metrics.Float64Histogram {
+	if value := v[name]; value.Kind() == metrics.KindFloat64Histogram {
+		return value.Float64Histogram()
+	}
+	return nil
+}
+
+func (c *Collector) collectSchedStats(stats *RuntimeStats) {
+	if len(cpuSamples) == 0 {
+		return
+	}
+
+	v := newSampleValues(readSamples(cpuSamples))
+	stats.GOMAXPROCS = v.int(gomaxprocs)
+	stats.MutexWait = v.int(mutexWait)
+	stats.SchedLatencies = v.histogram(schedLatencies)
+
+	c.schedMu.Lock()
+	defer c.schedMu.Unlock()
+	stats.SchedLatency = percentiles(histogramDelta(stats.SchedLatencies, c.prevSched), c.SchedLatencyPercentiles)
+	c.prevSched = stats.SchedLatencies
+}
+
+// collectRuntimeMetrics sets the stats of runtime.MemStats from their equivalents in runtime/metrics,
+// as documented by package runtime/metrics.
+func (*Collector) collectRuntimeMetrics(stats *RuntimeStats, gc bool) {
+	v := newSampleValues(readSamples(memSamples))
+
+	heapObjects := v.int("/memory/classes/heap/objects:bytes")
+	heapUnused := v.int("/memory/classes/heap/unused:bytes")
+	heapFree := v.int("/memory/classes/heap/free:bytes")
+	heapReleased := v.int("/memory/classes/heap/released:bytes")
+	tinyAllocs := v.int("/gc/heap/tiny/allocs:objects")
+
+	stats.Alloc = heapObjects
+	stats.TotalAlloc = v.int("/gc/heap/allocs:bytes")
+	stats.Sys = v.int("/memory/classes/total:bytes")
+	stats.Mallocs = v.int("/gc/heap/allocs:objects") + tinyAllocs
+	stats.Frees = v.int("/gc/heap/frees:objects") + tinyAllocs
+
+	stats.HeapAlloc = heapObjects
+	stats.HeapSys = heapObjects + heapUnused + heapFree + heapReleased
+	stats.HeapIdle = heapFree + heapReleased
+	stats.HeapInuse = heapObjects + heapUnused
+	stats.HeapReleased = heapReleased
+	stats.HeapObjects = v.int("/gc/heap/objects:objects")
+
+	stats.StackInuse = v.int("/memory/classes/heap/stacks:bytes")
+	stats.StackSys = stats.StackInuse + v.int("/memory/classes/os-stacks:bytes")
+	stats.MSpanInuse = v.int("/memory/classes/metadata/mspan/inuse:bytes")
+	stats.MSpanSys = stats.MSpanInuse + v.int("/memory/classes/metadata/mspan/free:bytes")
+	stats.MCacheInuse = v.int("/memory/classes/metadata/mcache/inuse:bytes")
+	stats.MCacheSys = stats.MCacheInuse + v.int("/memory/classes/metadata/mcache/free:bytes")
+	stats.OtherSys = v.int("/memory/classes/other:bytes")
+
+	if !gc {
+		return
+	}
+	stats.GCSys = v.int("/memory/classes/metadata/other:bytes")
+	stats.NextGC = v.int("/gc/heap/goal:bytes")
+	stats.NumGC = v.int("/gc/cycles/total:gc-cycles")
+	if total := v.float("/cpu/classes/total:cpu-seconds"); total > 0 {
+		stats.GCCPUFraction = v.float("/cpu/classes/gc/total:cpu-seconds") / total
+	}
+}
+
+// copyHistogram returns a copy of h, or nil if h is nil.
+func copyHistogram(h *metrics.Float64Histogram) *metrics.Float64Histogram {
+	if h == nil {
+		return nil
+	}
+	return &metrics.Float64Histogram{
+		Counts:  append([]uint64(nil), h.Counts...),
+		Buckets: append([]float64(nil), h.Buckets...),
+	}
+}
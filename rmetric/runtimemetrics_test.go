@@ -0,0 +1,31 @@
+package rmetric
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestSourceRuntimeMetrics(t *testing.T) {
+	runtime.GC()
+
+	stats := NewWithOptions(nil, WithSource(SourceRuntimeMetrics)).Once()
+	if stats.HeapAlloc <= 0 || stats.HeapSys < stats.HeapInuse || stats.Sys < stats.HeapSys {
+		t.Errorf("unexpected heap stats, alloc %d, inuse %d, sys %d of %d",
+			stats.HeapAlloc, stats.HeapInuse, stats.HeapSys, stats.Sys)
+	}
+	if stats.NumGC <= 0 {
+		t.Errorf("expected GC cycles, got %d", stats.NumGC)
+	}
+	if stats.GOMAXPROCS != int64(runtime.GOMAXPROCS(0)) {
+		t.Errorf("expected GOMAXPROCS %d, got %d", runtime.GOMAXPROCS(0), stats.GOMAXPROCS)
+	}
+	if stats.SchedLatencies == nil || len(stats.SchedLatencies.Buckets) != len(stats.SchedLatencies.Counts)+1 {
+		t.Errorf("expected scheduler latency histogram, got %v", stats.SchedLatencies)
+	}
+
+	copied := stats.DeepCopy()
+	copied.SchedLatencies.Counts[0]++
+	if copied.SchedLatencies.Counts[0] == stats.SchedLatencies.Counts[0] {
+		t.Errorf("expected DeepCopy to copy the histogram")
+	}
+}
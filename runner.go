@@ -0,0 +1,303 @@
+package appmetrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/safe"
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/status"
+	"github.com/smallnest/go-app-metrics/system"
+)
+
+// SnapshotHandler represents a handler to handle a snapshot after successfully gathering statistics.
+// The snapshot is shared by all handlers and Latest, so it must not be modified; use Clone to get
+// a copy which can be modified.
+type SnapshotHandler func(*Snapshot)
+
+// Runner implements the periodic collection of the go runtime stats and the system stats into snapshots.
+// Each snapshot is built completely before it is handed to the handler or returned by Latest,
+// so no observer sees a partially updated set of stats.
+type Runner struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Done, when closed, is used to signal Runner that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	// PanicHandler, if not nil, is called with an error describing the panic when the handler or
+	// a subscriber panics. The panic is recovered so the collection continues. Defaults to nil.
+	PanicHandler func(err error)
+
+	// IdleTimeout is the duration after the last Demand the collection loop started by Demand stops.
+	// Defaults to 1 minute.
+	IdleTimeout time.Duration
+
+	// Runtime and System are the collectors used by the Runner, their options can be changed
+	// before Run is called. Their own handlers are not called.
+	Runtime *rmetric.Collector
+	System  *system.Collector
+
+	mu           sync.Mutex // serializes collections and reconfigurations, the system collector keeps previous samples
+	profile      string
+	criticalOnly bool
+	reconfigured chan struct{}
+	latest       atomic.Pointer[Snapshot]
+	tagsMu       sync.Mutex
+	tags         atomic.Pointer[map[string]string]
+	statsHandler SnapshotHandler
+
+	refMu       sync.Mutex
+	refs        int
+	stop        chan struct{}
+	subscribers map[int]SnapshotHandler
+	nextID      int
+	demanding   bool
+	lastDemand  atomic.Int64 // unix nanoseconds
+	panics      atomic.Int64
+	loops       atomic.Int32 // running collection loops
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultRunner *Runner
+)
+
+// Default returns the Runner shared by all users in the binary, so libraries embedding this package
+// share one collection loop. No goroutine is started until Start or Demand is called.
+//
+//	r := appmetrics.Default()
+//	r.Start()
+//	defer r.Stop()
+//	unsubscribe := r.Subscribe(handler)
+func Default() *Runner {
+	defaultOnce.Do(func() {
+		defaultRunner = NewRunner(nil)
+	})
+	return defaultRunner
+}
+
+// NewRunner creates a new Runner that will periodically output snapshots to statsHandler.
+func NewRunner(statsHandler SnapshotHandler) *Runner {
+	if statsHandler == nil {
+		statsHandler = func(*Snapshot) {}
+	}
+
+	return &Runner{
+		CollectInterval: 10 * time.Second,
+		IdleTimeout:     time.Minute,
+		Runtime:         rmetric.New(nil),
+		System:          system.New(nil),
+		reconfigured:    make(chan struct{}, 1),
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers a snapshot then outputs it to the configured SnapshotHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (r *Runner) Run() {
+	r.run(nil)
+}
+
+func (r *Runner) run(stop <-chan struct{}) {
+	r.loops.Add(1)
+	defer r.loops.Add(-1)
+
+	r.handle(r.Once())
+
+	interval := r.Interval()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-r.Done:
+			return
+		case <-stop:
+			return
+		case <-r.reconfigured:
+			if i := r.Interval(); i != interval {
+				interval = i
+				tick.Reset(interval)
+			}
+		case <-tick.C:
+			r.handle(r.Once())
+		}
+	}
+}
+
+// Interval returns the current collection interval.
+func (r *Runner) Interval() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.CollectInterval
+}
+
+// handle outputs snap to the handler and the subscribers, recovering their panics.
+func (r *Runner) handle(snap *Snapshot) {
+	r.call(r.statsHandler, snap)
+
+	r.refMu.Lock()
+	handlers := make([]SnapshotHandler, 0, len(r.subscribers))
+	for _, h := range r.subscribers {
+		handlers = append(handlers, h)
+	}
+	r.refMu.Unlock()
+
+	for _, h := range handlers {
+		r.call(h, snap)
+	}
+}
+
+func (r *Runner) call(h SnapshotHandler, snap *Snapshot) {
+	if err := safe.Call(h, snap); err != nil {
+		r.panics.Add(1)
+		if r.PanicHandler != nil {
+			r.PanicHandler(err)
+		}
+	}
+}
+
+// HandlerPanics returns the number of panics recovered from the handler and the subscribers.
+func (r *Runner) HandlerPanics() int64 {
+	return r.panics.Load()
+}
+
+// Status returns the states of the runtime and system collectors of the Runner. They are running
+// while the collection loop of the Runner runs, at the interval of the Runner.
+func (r *Runner) Status() []status.Status {
+	interval := r.Interval()
+	statuses := []status.Status{r.Runtime.Status(), r.System.Status()}
+	for i := range statuses {
+		statuses[i].Running = r.loops.Load() > 0
+		statuses[i].Interval = interval
+	}
+	return statuses
+}
+
+// Start starts the collection loop in its own goroutine if it isn't started. Every call must be
+// paired with a call to Stop, the loop stops when all callers have called Stop.
+func (r *Runner) Start() {
+	r.refMu.Lock()
+	defer r.refMu.Unlock()
+
+	r.refs++
+	if r.refs == 1 {
+		r.stop = make(chan struct{})
+		go r.run(r.stop)
+	}
+}
+
+// Stop releases a Start. The collection loop stops after the last Start has been released.
+func (r *Runner) Stop() {
+	r.refMu.Lock()
+	defer r.refMu.Unlock()
+
+	if r.refs == 0 {
+		return
+	}
+	r.refs--
+	if r.refs == 0 {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// Demand returns the latest snapshot for on-demand use, e.g. by an endpoint or a sink of a library
+// which shouldn't run goroutines in every importing binary. The collection loop is started by the
+// first Demand and stops after IdleTimeout without Demand, unless it has also been started by Start.
+// A snapshot is collected synchronously if none has been collected yet.
+func (r *Runner) Demand() *Snapshot {
+	r.lastDemand.Store(time.Now().UnixNano())
+
+	r.refMu.Lock()
+	if !r.demanding {
+		r.demanding = true
+		r.refMu.Unlock()
+		r.Start()
+		go r.idle()
+	} else {
+		r.refMu.Unlock()
+	}
+
+	if snap := r.Latest(); snap != nil {
+		return snap
+	}
+	return r.Once()
+}
+
+// idle releases the Start of Demand after IdleTimeout without Demand.
+func (r *Runner) idle() {
+	timeout := r.IdleTimeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+
+	for {
+		last := time.Unix(0, r.lastDemand.Load())
+		if wait := timeout - time.Since(last); wait > 0 {
+			time.Sleep(wait)
+			continue
+		}
+
+		// a Demand may have seen demanding set since lastDemand was loaded, it stores lastDemand
+		// before taking refMu
+		r.refMu.Lock()
+		if time.Since(time.Unix(0, r.lastDemand.Load())) < timeout {
+			r.refMu.Unlock()
+			continue
+		}
+		r.demanding = false
+		r.refMu.Unlock()
+		r.Stop()
+		return
+	}
+}
+
+// Subscribe adds h to be called with every snapshot collected by the loop, besides the handler of the
+// Runner. It returns the func to remove h.
+func (r *Runner) Subscribe(h SnapshotHandler) (unsubscribe func()) {
+	r.refMu.Lock()
+	defer r.refMu.Unlock()
+
+	if r.subscribers == nil {
+		r.subscribers = make(map[int]SnapshotHandler)
+	}
+	id := r.nextID
+	r.nextID++
+	r.subscribers[id] = h
+
+	return func() {
+		r.refMu.Lock()
+		defer r.refMu.Unlock()
+		delete(r.subscribers, id)
+	}
+}
+
+// Once collects a new snapshot and returns it. It is safe for use from multiple go routines.
+func (r *Runner) Once() *Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snap := NewSnapshot(r.Runtime.Once(), r.System.Once())
+	snap.Tags = r.currentTags()
+	snap.CriticalOnly = r.criticalOnly
+	r.latest.Store(snap)
+	return snap
+}
+
+// Collect collects a new snapshot out of schedule, outputs it to the handler and the subscribers
+// and returns it.
+func (r *Runner) Collect() *Snapshot {
+	snap := r.Once()
+	r.handle(snap)
+	return snap
+}
+
+// Latest returns the last snapshot collected by Run or Once, or nil if none has been collected.
+func (r *Runner) Latest() *Snapshot {
+	return r.latest.Load()
+}
@@ -0,0 +1,137 @@
+package appmetrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/system"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner(t *testing.T) {
+	handled := make(chan *Snapshot, 1)
+	done := make(chan struct{})
+	r := NewRunner(func(snap *Snapshot) {
+		select {
+		case handled <- snap:
+		default:
+		}
+	})
+	r.CollectInterval = time.Hour
+	r.Done = done
+	assert.Nil(t, r.Latest())
+
+	go r.Run()
+	snap := <-handled
+	close(done)
+
+	statuses := r.Status()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "rmetric", statuses[0].Name)
+	assert.Equal(t, "system", statuses[1].Name)
+	assert.Equal(t, time.Hour, statuses[1].Interval)
+	assert.True(t, statuses[0].Collections > 0)
+
+	assert.Same(t, snap, r.Latest())
+	assert.True(t, snap.Runtime.NumGoroutine > 0)
+	assert.True(t, snap.System.MemStat.Total > 0)
+	assert.False(t, snap.Time.IsZero())
+}
+
+func TestClone(t *testing.T) {
+	snap := testSnapshot()
+	c := snap.Clone()
+	c.System.DiskStat["/"] = system.DiskStat{}
+	c.Runtime.HeapAlloc = 0
+
+	assert.Equal(t, uint64(10), snap.System.DiskStat["/"].Total)
+	assert.Equal(t, int64(100), snap.Runtime.HeapAlloc)
+	assert.Equal(t, snap.Time, c.Time)
+}
+
+func TestDefault(t *testing.T) {
+	r := Default()
+	assert.Same(t, r, Default())
+
+	handled := make(chan *Snapshot, 10)
+	unsubscribe := r.Subscribe(func(snap *Snapshot) {
+		select {
+		case handled <- snap:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	r.Start()
+	r.Start()
+	<-handled
+	r.Stop()
+	r.Stop()
+	r.Stop()
+
+	r.refMu.Lock()
+	assert.Equal(t, 0, r.refs)
+	assert.Nil(t, r.stop)
+	r.refMu.Unlock()
+}
+
+func TestDemand(t *testing.T) {
+	r := NewRunner(nil)
+	r.IdleTimeout = 50 * time.Millisecond
+
+	snap := r.Demand()
+	assert.NotNil(t, snap)
+	assert.NotNil(t, r.Demand())
+
+	r.refMu.Lock()
+	assert.Equal(t, 1, r.refs)
+	r.refMu.Unlock()
+
+	time.Sleep(200 * time.Millisecond)
+	r.refMu.Lock()
+	assert.Equal(t, 0, r.refs)
+	assert.False(t, r.demanding)
+	r.refMu.Unlock()
+}
+
+func TestDemandWhileIdling(t *testing.T) {
+	r := NewRunner(nil)
+	r.IdleTimeout = 50 * time.Millisecond
+	r.Start()
+	r.demanding = true
+	r.lastDemand.Store(time.Now().Add(-time.Hour).UnixNano())
+
+	// a Demand arrives while idle waits for refMu to release the Start of the expired demand
+	r.refMu.Lock()
+	done := make(chan struct{})
+	go func() {
+		r.idle()
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	r.lastDemand.Store(time.Now().UnixNano())
+	r.refMu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+	r.refMu.Lock()
+	assert.Equal(t, 1, r.refs)
+	assert.True(t, r.demanding)
+	r.refMu.Unlock()
+
+	<-done
+	r.refMu.Lock()
+	assert.Equal(t, 0, r.refs)
+	assert.False(t, r.demanding)
+	r.refMu.Unlock()
+}
+
+func TestRunnerHandlerPanic(t *testing.T) {
+	var errs []error
+	r := NewRunner(func(*Snapshot) { panic("boom") })
+	r.PanicHandler = func(err error) { errs = append(errs, err) }
+	r.Subscribe(func(*Snapshot) { panic("boom") })
+
+	r.handle(r.Once())
+	assert.Equal(t, int64(2), r.HandlerPanics())
+	assert.Len(t, errs, 2)
+}
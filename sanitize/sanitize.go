@@ -0,0 +1,89 @@
+// Package sanitize provides sanitizers for names embedded in metric keys, such as mountpoints
+// and network interfaces, which may contain characters that are special to a backend.
+package sanitize
+
+import "strings"
+
+// Func sanitizes a name embedded in metric keys.
+type Func func(name string) string
+
+// Raw returns the name as is.
+func Raw(name string) string {
+	return name
+}
+
+var graphiteReplacer = strings.NewReplacer("/", "_", ".", "_", " ", "_", ":", "_", "\t", "_", "\n", "_")
+
+// Graphite makes the name a single node of a graphite path. The root mountpoint "/" becomes "_root",
+// which doesn't collide with "/root", the leading slash of other mountpoints is removed and '/', '.',
+// ':' and spaces are replaced with '_', e.g. "/var/lib" becomes "var_lib" and "eth0:1" becomes "eth0_1".
+func Graphite(name string) string {
+	if name == "/" {
+		return "_root"
+	}
+	return graphiteReplacer.Replace(strings.TrimPrefix(name, "/"))
+}
+
+var prometheusLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// PrometheusLabel escapes the name as a label value of the Prometheus text format.
+func PrometheusLabel(name string) string {
+	return prometheusLabelReplacer.Replace(name)
+}
+
+// PrometheusName replaces characters which are not allowed in Prometheus metric names with '_'.
+func PrometheusName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || c >= '0' && c <= '9' && i > 0) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var influxTagReplacer = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// InfluxDB escapes commas, equal signs and spaces as required by tag values of the line protocol.
+func InfluxDB(name string) string {
+	return influxTagReplacer.Replace(name)
+}
+
+// OpenTSDB replaces characters which are not allowed in OpenTSDB metric names and tag values with '_'.
+// Letters, digits, '-', '_', '.' and '/' are allowed.
+func OpenTSDB(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-', r == '_', r == '.', r == '/':
+			return r
+		case r > 127:
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// backends maps backend names to their default sanitizers.
+var backends = map[string]Func{
+	"graphite":   Graphite,
+	"prometheus": PrometheusLabel,
+	"influxdb":   InfluxDB,
+	"opentsdb":   OpenTSDB,
+}
+
+// ForBackend returns the default sanitizer of the backend, or Raw if the backend is unknown.
+func ForBackend(backend string) Func {
+	if f, ok := backends[backend]; ok {
+		return f
+	}
+	return Raw
+}
+
+// Register registers or replaces the default sanitizer of the backend.
+// It is not safe for use concurrently with ForBackend, so call it during initialization.
+func Register(backend string, f Func) {
+	backends[backend] = f
+}
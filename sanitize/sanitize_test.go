@@ -0,0 +1,38 @@
+package sanitize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizers(t *testing.T) {
+	cases := []struct {
+		f    Func
+		in   string
+		want string
+	}{
+		{Raw, "/var/lib", "/var/lib"},
+		{Graphite, "/", "_root"},
+		{Graphite, "/root", "root"},
+		{Graphite, "/var/lib", "var_lib"},
+		{Graphite, "/mnt/my disk.v2", "mnt_my_disk_v2"},
+		{Graphite, "eth0:1", "eth0_1"},
+		{PrometheusLabel, `C:\ "x"`, `C:\\ \"x\"`},
+		{PrometheusName, "disk./.total", "disk___total"},
+		{PrometheusName, "0cpu", "_cpu"},
+		{InfluxDB, "my disk,a=b", `my\ disk\,a\=b`},
+		{OpenTSDB, "/mnt/my disk:1", "/mnt/my_disk_1"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, c.f(c.in), c.in)
+	}
+}
+
+func TestForBackend(t *testing.T) {
+	assert.Equal(t, "_root", ForBackend("graphite")("/"))
+	assert.Equal(t, "/", ForBackend("unknown")("/"))
+
+	Register("custom", func(string) string { return "x" })
+	assert.Equal(t, "x", ForBackend("custom")("/"))
+}
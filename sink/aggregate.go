@@ -0,0 +1,78 @@
+package sink
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/smallnest/go-app-metrics/metadata"
+)
+
+// describe returns the description of the metric of the points named name, see Points.
+func describe(name string) metadata.Metric {
+	var m metadata.Metric
+	switch {
+	case strings.HasPrefix(name, "runtime."):
+		m, _ = metadata.Runtime.Lookup(strings.TrimPrefix(name, "runtime."))
+	case strings.HasPrefix(name, "system."):
+		m, _ = metadata.System.Lookup(strings.TrimPrefix(name, "system."))
+	}
+	return m
+}
+
+// aggregated is a point combining the points of several snapshots.
+type aggregated struct {
+	Point
+	aggregation metadata.Aggregation
+	count       int
+}
+
+// aggregator combines the points of the snapshots between two flushes into one point per name,
+// according to the aggregation of their metric. The combined points have the time and tags of the
+// latest snapshot.
+type aggregator struct {
+	points map[string]*aggregated
+}
+
+func (a *aggregator) add(points []Point) {
+	if a.points == nil {
+		a.points = make(map[string]*aggregated, len(points))
+	}
+	for _, p := range points {
+		agg, ok := a.points[p.Name]
+		if !ok {
+			a.points[p.Name] = &aggregated{Point: p, aggregation: describe(p.Name).Aggregation, count: 1}
+			continue
+		}
+
+		switch agg.aggregation {
+		case metadata.Sum, metadata.Mean:
+			agg.Value += p.Value
+		case metadata.Min:
+			agg.Value = math.Min(agg.Value, p.Value)
+		case metadata.Max:
+			agg.Value = math.Max(agg.Value, p.Value)
+		default:
+			agg.Value = p.Value
+		}
+		agg.Tags = p.Tags
+		agg.Time = p.Time
+		agg.count++
+	}
+}
+
+// flush returns the combined points sorted by name and resets a.
+func (a *aggregator) flush() []Point {
+	points := make([]Point, 0, len(a.points))
+	for _, agg := range a.points {
+		p := agg.Point
+		if agg.aggregation == metadata.Mean {
+			p.Value /= float64(agg.count)
+		}
+		points = append(points, p)
+	}
+	a.points = nil
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Name < points[j].Name })
+	return points
+}
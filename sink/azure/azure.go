@@ -0,0 +1,306 @@
+// Package azure provides a sink submitting custom metrics to Azure Monitor. On Azure VMs and AKS nodes
+// the region and the resource ID are detected from the instance metadata service, and the token can be
+// obtained from the managed identity of the machine:
+//
+//	s := azure.New("", "", azure.ManagedIdentityToken(""))
+//
+// The points are submitted with their tags as dimensions. Azure Monitor takes one metric per request and
+// aggregates it per minute, so the points of a metric within the same minute are submitted in one request,
+// those with the same tags combined into one series of their min, max, sum and count. Azure Monitor only
+// accepts points of the last 20 minutes.
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/sink"
+)
+
+// MaxSeries is the maximum number of series of a request, the series of a metric beyond are split
+// into several requests to keep the requests small.
+const MaxSeries = 100
+
+// IMDSEndpoint is the address of the Azure instance metadata service.
+var IMDSEndpoint = "http://169.254.169.254"
+
+// TokenFunc returns a bearer token for the resource https://monitoring.azure.com/.
+type TokenFunc func(ctx context.Context) (string, error)
+
+// Sink submits points to the custom metrics API of Azure Monitor.
+type Sink struct {
+	// Namespace is the namespace of the custom metrics. Defaults to "appmetrics".
+	Namespace string
+	// Client is the HTTP client used to send requests. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	token     TokenFunc
+	transport *sink.Transport
+
+	mu         sync.Mutex
+	region     string
+	resourceID string
+}
+
+// New creates a Sink submitting the metrics of the resource resourceID in region, e.g. "westeurope",
+// authenticated by token. If region or resourceID is empty, they are detected on the first write.
+func New(region, resourceID string, token TokenFunc) *Sink {
+	return &Sink{
+		Namespace:  "appmetrics",
+		Client:     http.DefaultClient,
+		token:      token,
+		region:     region,
+		resourceID: resourceID,
+	}
+}
+
+// MaxAge returns the maximum age of points accepted by Azure Monitor, it implements sink.AgeLimiter.
+func (s *Sink) MaxAge() time.Duration {
+	return 20 * time.Minute
+}
+
+type metricBody struct {
+	Time string     `json:"time"`
+	Data metricData `json:"data"`
+}
+
+type metricData struct {
+	BaseData baseData `json:"baseData"`
+}
+
+type baseData struct {
+	Metric    string   `json:"metric"`
+	Namespace string   `json:"namespace"`
+	DimNames  []string `json:"dimNames,omitempty"`
+	Series    []series `json:"series"`
+}
+
+type series struct {
+	DimValues []string `json:"dimValues,omitempty"`
+	Min       float64  `json:"min"`
+	Max       float64  `json:"max"`
+	Sum       float64  `json:"sum"`
+	Count     int64    `json:"count"`
+}
+
+// Write submits the points, one request per metric and minute of at most MaxSeries series.
+// A failed request doesn't stop the following ones, the errors of all failed requests are joined.
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	endpoint, err := s.endpoint(ctx)
+	if err != nil {
+		return err
+	}
+	token, err := s.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, body := range encode(points, s.Namespace) {
+		if err := s.post(ctx, endpoint, token, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// encode groups the points into the bodies of the requests, in the order the metrics first appear.
+// The points of a metric within the same minute and with the same tag names share a body, and the
+// points with the same tags a series.
+func encode(points []sink.Point, namespace string) []metricBody {
+	var bodies []*metricBody
+	byKey := make(map[string]*metricBody)
+	type seriesRef struct {
+		body  *metricBody
+		index int
+	}
+	seriesByKey := make(map[string]seriesRef)
+	for _, p := range points {
+		names := make([]string, 0, len(p.Tags))
+		for k := range p.Tags {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		values := make([]string, len(names))
+		for i, k := range names {
+			values[i] = p.Tags[k]
+		}
+
+		t := p.Time.UTC().Truncate(time.Minute).Format(time.RFC3339)
+		key := p.Name + "\x00" + t + "\x00" + strings.Join(names, "\x00")
+		skey := key + "\x01" + strings.Join(values, "\x00")
+		if ref, ok := seriesByKey[skey]; ok {
+			sr := &ref.body.Data.BaseData.Series[ref.index]
+			sr.Min = math.Min(sr.Min, p.Value)
+			sr.Max = math.Max(sr.Max, p.Value)
+			sr.Sum += p.Value
+			sr.Count++
+			continue
+		}
+
+		b := byKey[key]
+		if b == nil || len(b.Data.BaseData.Series) >= MaxSeries {
+			b = &metricBody{
+				Time: t,
+				Data: metricData{BaseData: baseData{Metric: p.Name, Namespace: namespace, DimNames: names}},
+			}
+			byKey[key] = b
+			bodies = append(bodies, b)
+		}
+		bd := &b.Data.BaseData
+		bd.Series = append(bd.Series, series{DimValues: values, Min: p.Value, Max: p.Value, Sum: p.Value, Count: 1})
+		seriesByKey[skey] = seriesRef{body: b, index: len(bd.Series) - 1}
+	}
+
+	r := make([]metricBody, len(bodies))
+	for i, b := range bodies {
+		r[i] = *b
+	}
+	return r
+}
+
+// endpoint returns the URL of the custom metrics of the resource, detecting the region and the
+// resource ID if they are unknown.
+func (s *Sink) endpoint(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.region == "" || s.resourceID == "" {
+		region, resourceID, err := Detect(ctx)
+		if err != nil {
+			return "", err
+		}
+		if s.region == "" {
+			s.region = region
+		}
+		if s.resourceID == "" {
+			s.resourceID = resourceID
+		}
+	}
+	return "https://" + s.region + ".monitoring.azure.com" + s.resourceID + "/metrics", nil
+}
+
+// SetTransport sets the TLS, auth and proxy config of the requests, it implements sink.Transporter.
+// It replaces Client.
+func (s *Sink) SetTransport(t *sink.Transport) error {
+	client, err := t.HTTPClient()
+	if err != nil {
+		return err
+	}
+	s.Client = client
+	s.transport = t
+	return nil
+}
+
+func (s *Sink) post(ctx context.Context, endpoint, token string, body metricBody) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	s.transport.Authorize(req)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &sink.StatusError{Code: resp.StatusCode, Msg: fmt.Sprintf("azure: %s: %s", resp.Status, bytes.TrimSpace(msg))}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Detect returns the region and the resource ID of the Azure VM, or the VM scale set instance of
+// an AKS node, from the instance metadata service.
+func Detect(ctx context.Context) (region, resourceID string, err error) {
+	var instance struct {
+		Compute struct {
+			Location   string `json:"location"`
+			ResourceID string `json:"resourceId"`
+		} `json:"compute"`
+	}
+	if err := getIMDS(ctx, "/metadata/instance?api-version=2021-02-01", &instance); err != nil {
+		return "", "", err
+	}
+	if instance.Compute.Location == "" || instance.Compute.ResourceID == "" {
+		return "", "", fmt.Errorf("azure: no location or resource ID in instance metadata")
+	}
+	return instance.Compute.Location, instance.Compute.ResourceID, nil
+}
+
+// ManagedIdentityToken returns a TokenFunc which obtains tokens of the managed identity of the
+// machine from the instance metadata service. clientID selects a user-assigned identity, leave it
+// empty for the system-assigned one. Tokens are cached until shortly before they expire.
+func ManagedIdentityToken(clientID string) TokenFunc {
+	var (
+		mu      sync.Mutex
+		token   string
+		expires time.Time
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && time.Until(expires) > time.Minute {
+			return token, nil
+		}
+
+		q := url.Values{
+			"api-version": {"2018-02-01"},
+			"resource":    {"https://monitoring.azure.com/"},
+		}
+		if clientID != "" {
+			q.Set("client_id", clientID)
+		}
+		var resp struct {
+			AccessToken string `json:"access_token"`
+			ExpiresOn   string `json:"expires_on"`
+		}
+		if err := getIMDS(ctx, "/metadata/identity/oauth2/token?"+q.Encode(), &resp); err != nil {
+			return "", err
+		}
+		sec, _ := strconv.ParseInt(resp.ExpiresOn, 10, 64)
+		token, expires = resp.AccessToken, time.Unix(sec, 0)
+		return token, nil
+	}
+}
+
+func getIMDS(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, IMDSEndpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("azure: instance metadata: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,77 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectAndToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.Header.Get("Metadata"))
+		switch r.URL.Path {
+		case "/metadata/instance":
+			w.Write([]byte(`{"compute": {"location": "westeurope", "resourceId": "/subscriptions/s/resourceGroups/g/providers/Microsoft.Compute/virtualMachines/vm"}}`))
+		case "/metadata/identity/oauth2/token":
+			assert.Equal(t, "https://monitoring.azure.com/", r.FormValue("resource"))
+			w.Write([]byte(`{"access_token": "tok", "expires_on": "9999999999"}`))
+		}
+	}))
+	defer srv.Close()
+	IMDSEndpoint = srv.URL
+
+	region, id, err := Detect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "westeurope", region)
+	assert.True(t, strings.HasSuffix(id, "/virtualMachines/vm"))
+
+	token, err := ManagedIdentityToken("")(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "tok", token)
+}
+
+func TestEncode(t *testing.T) {
+	ts := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	tags := map[string]string{"go.os": "linux", "go.arch": "amd64"}
+	points := []sink.Point{
+		{Name: "system.cpu.user", Value: 12.5, Tags: tags, Time: ts},
+		{Name: "system.mem.used", Value: 100, Tags: tags, Time: ts},
+		{Name: "system.cpu.user", Value: 7.5, Tags: tags, Time: ts.Add(30 * time.Second)},
+		{Name: "system.cpu.user", Value: 1, Tags: map[string]string{"go.os": "linux", "go.arch": "arm64"}, Time: ts},
+		{Name: "system.cpu.user", Value: 2, Tags: tags, Time: ts.Add(time.Minute)},
+	}
+	data, err := json.Marshal(encode(points, "appmetrics"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"time": "2023-11-14T22:13:00Z", "data": {"baseData": {
+			"metric": "system.cpu.user", "namespace": "appmetrics", "dimNames": ["go.arch", "go.os"],
+			"series": [
+				{"dimValues": ["amd64", "linux"], "min": 7.5, "max": 12.5, "sum": 20, "count": 2},
+				{"dimValues": ["arm64", "linux"], "min": 1, "max": 1, "sum": 1, "count": 1}]}}},
+		{"time": "2023-11-14T22:13:00Z", "data": {"baseData": {
+			"metric": "system.mem.used", "namespace": "appmetrics", "dimNames": ["go.arch", "go.os"],
+			"series": [{"dimValues": ["amd64", "linux"], "min": 100, "max": 100, "sum": 100, "count": 1}]}}},
+		{"time": "2023-11-14T22:14:00Z", "data": {"baseData": {
+			"metric": "system.cpu.user", "namespace": "appmetrics", "dimNames": ["go.arch", "go.os"],
+			"series": [{"dimValues": ["amd64", "linux"], "min": 2, "max": 2, "sum": 2, "count": 1}]}}}
+	]`, string(data))
+}
+
+func TestEncodeMaxSeries(t *testing.T) {
+	points := make([]sink.Point, MaxSeries+1)
+	for i := range points {
+		points[i] = sink.Point{Name: "system.disk.total", Tags: map[string]string{"mountpoints": strconv.Itoa(i)}}
+	}
+	bodies := encode(points, "appmetrics")
+	assert.Len(t, bodies, 2)
+	assert.Len(t, bodies[0].Data.BaseData.Series, MaxSeries)
+	assert.Len(t, bodies[1].Data.BaseData.Series, 1)
+}
@@ -0,0 +1,96 @@
+package sink
+
+import (
+	"path"
+	"sort"
+)
+
+// Budget limits the points a Pusher writes to a paid backend, which usually charges by series or by point.
+// Beyond the budget the points of the lowest priority are dropped first, and the dropped series are
+// reported by PusherStats.
+type Budget struct {
+	// MaxSeries is the maximum number of distinct series written, 0 for no limit. Series are admitted
+	// by priority and stay admitted, so the series written don't flap between writes.
+	MaxSeries int
+	// MaxPoints is the maximum number of points written per snapshot, or per flush if FlushInterval
+	// is set, 0 for no limit.
+	MaxPoints int
+	// Priorities maps glob patterns of point names, see path.Match, to priorities, e.g.
+	// {"runtime.*": 10, "system.disk_io.*": -1}. The points of higher priority are kept first, points
+	// matching no pattern have the rank of the priority of their metric, see metadata.Priority.Rank,
+	// e.g. 1 for critical metrics. The longest matching pattern wins.
+	Priorities map[string]int
+}
+
+// priority returns the priority of the points named name.
+func (b *Budget) priority(name string) int {
+	var priority, longest int
+	matched := false
+	for pattern, p := range b.Priorities {
+		if len(pattern) < longest {
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok && (!matched || len(pattern) > longest || p > priority) {
+			priority, longest, matched = p, len(pattern), true
+		}
+	}
+	if !matched {
+		return describe(name).Priority.Rank()
+	}
+	return priority
+}
+
+// budgetState is the state of the budget of a Pusher.
+type budgetState struct {
+	admitted map[string]struct{}
+	dropped  map[string]struct{}
+	points   int64
+}
+
+// apply returns the points within budget b, highest priorities first, and records the dropped ones.
+func (s *budgetState) apply(b *Budget, points []Point) []Point {
+	if b.MaxSeries <= 0 && (b.MaxPoints <= 0 || len(points) <= b.MaxPoints) {
+		return points
+	}
+
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	priorities := make(map[string]int, len(points))
+	for _, p := range points {
+		priorities[p.Name] = b.priority(p.Name)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return priorities[sorted[i].Name] > priorities[sorted[j].Name] })
+
+	if s.admitted == nil {
+		s.admitted = make(map[string]struct{})
+		s.dropped = make(map[string]struct{})
+	}
+	kept := make([]Point, 0, len(sorted))
+	for _, p := range sorted {
+		_, admitted := s.admitted[p.Name]
+		full := b.MaxSeries > 0 && len(s.admitted) >= b.MaxSeries
+		if (!admitted && full) || (b.MaxPoints > 0 && len(kept) >= b.MaxPoints) {
+			s.dropped[p.Name] = struct{}{}
+			s.points++
+			continue
+		}
+		s.admitted[p.Name] = struct{}{}
+		kept = append(kept, p)
+	}
+
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Name < kept[j].Name })
+	return kept
+}
+
+// droppedSeries returns the sorted names of the series dropped at least once.
+func (s *budgetState) droppedSeries() []string {
+	if len(s.dropped) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(s.dropped))
+	for name := range s.dropped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
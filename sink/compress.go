@@ -0,0 +1,65 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Compression is the compression of the payloads of a sink, it cuts the egress of large fleets at the
+// cost of some CPU. Only sinks whose backend accepts compressed payloads have a Compression option.
+type Compression string
+
+// Compressions supported by Encode. snappy and zstd are not supported, as none of the sinks
+// has a protocol using them.
+const (
+	None Compression = ""
+	Gzip Compression = "gzip"
+)
+
+// ErrUnsupportedCompression is returned for a compression other than None and Gzip.
+// It is not retryable, see Retryable.
+var ErrUnsupportedCompression = errors.New("sink: unsupported compression")
+
+// ParseCompression parses "" (or "none") and "gzip", e.g. from a configuration file, and returns
+// an error wrapping ErrUnsupportedCompression for any other value.
+func ParseCompression(s string) (Compression, error) {
+	switch s {
+	case "", "none":
+		return None, nil
+	case "gzip":
+		return Gzip, nil
+	default:
+		return None, fmt.Errorf("%w %q, expected none or gzip", ErrUnsupportedCompression, s)
+	}
+}
+
+// Encode compresses data. It returns data as is if c is None, and an error wrapping
+// ErrUnsupportedCompression if c is neither None nor Gzip.
+func (c Compression) Encode(data []byte) ([]byte, error) {
+	switch c {
+	case None:
+		return data, nil
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedCompression, string(c))
+	}
+}
+
+// SetHeader sets the Content-Encoding header of a request whose body has been encoded by c.
+func (c Compression) SetHeader(h http.Header) {
+	if c != None {
+		h.Set("Content-Encoding", string(c))
+	}
+}
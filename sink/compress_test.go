@@ -0,0 +1,50 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"metric":"system.cpu.user","value":1.5}`), 100)
+
+	out, err := None.Encode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, data, out)
+
+	out, err = Gzip.Encode(data)
+	assert.NoError(t, err)
+	assert.True(t, len(out) < len(data))
+	r, err := gzip.NewReader(bytes.NewReader(out))
+	assert.NoError(t, err)
+	decoded, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decoded)
+
+	h := make(http.Header)
+	None.SetHeader(h)
+	assert.Empty(t, h.Get("Content-Encoding"))
+	Gzip.SetHeader(h)
+	assert.Equal(t, "gzip", h.Get("Content-Encoding"))
+
+	_, err = Compression("zstd").Encode(data)
+	assert.ErrorIs(t, err, ErrUnsupportedCompression)
+	assert.False(t, Retryable(err))
+}
+
+func TestParseCompression(t *testing.T) {
+	for s, want := range map[string]Compression{"": None, "none": None, "gzip": Gzip} {
+		c, err := ParseCompression(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, c, s)
+	}
+
+	_, err := ParseCompression("snappy")
+	assert.ErrorIs(t, err, ErrUnsupportedCompression)
+	assert.EqualError(t, err, `sink: unsupported compression "snappy", expected none or gzip`)
+}
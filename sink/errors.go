@@ -0,0 +1,31 @@
+package sink
+
+import (
+	"errors"
+	"net/http"
+)
+
+// StatusError is the error of a request which failed with an HTTP status. HTTP sinks return it,
+// so Retryable tells the permanent failures, e.g. points rejected as malformed, from the temporary ones.
+type StatusError struct {
+	Code int
+	Msg  string
+}
+
+func (e *StatusError) Error() string {
+	return e.Msg
+}
+
+// Retryable reports whether err is a network error or a status which may succeed later,
+// i.e. 429 Too Many Requests or a 5xx. Errors without a status are retryable, except
+// ErrUnsupportedCompression.
+func Retryable(err error) bool {
+	if errors.Is(err, ErrUnsupportedCompression) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code == http.StatusTooManyRequests || se.Code/100 == 5
+	}
+	return true
+}
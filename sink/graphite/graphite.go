@@ -0,0 +1,118 @@
+// Package graphite provides a sink writing to Graphite carbon (or M3 and other carbon compatible
+// receivers) with the plaintext protocol, one line per point, or with the pickle protocol, which
+// sends the points in batches and is much cheaper for high-volume fleets.
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/smallnest/go-app-metrics/sink"
+)
+
+// Protocol is the protocol used to write to carbon.
+type Protocol int
+
+const (
+	// Plaintext writes `<path> <value> <timestamp>` lines, usually to port 2003.
+	Plaintext Protocol = iota
+	// Pickle writes batches of pickled points, usually to port 2004.
+	Pickle
+)
+
+// Sink writes points to carbon over TCP. The connection is kept open between writes and reopened after an error.
+type Sink struct {
+	// Prefix is prepended to the metric paths, e.g. "servers.web-1.". Defaults to "".
+	Prefix string
+	// BatchSize is the maximum number of points per pickle message or plaintext write. Defaults to 500.
+	BatchSize int
+
+	addr      string
+	protocol  Protocol
+	conn      net.Conn
+	transport *sink.Transport
+}
+
+// New creates a Sink writing to carbon at addr, e.g. "carbon:2004", with protocol.
+func New(addr string, protocol Protocol) *Sink {
+	return &Sink{
+		BatchSize: 500,
+		addr:      addr,
+		protocol:  protocol,
+	}
+}
+
+// Write writes the points in batches of BatchSize, stopping at the first failed batch. The tags of the points are ignored.
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	if s.conn == nil {
+		conn, err := s.transport.Dial(ctx, s.addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+
+	size := s.BatchSize
+	if size <= 0 {
+		size = len(points)
+	}
+	var buf bytes.Buffer
+	for len(points) > 0 {
+		n := size
+		if n > len(points) {
+			n = len(points)
+		}
+
+		buf.Reset()
+		if s.protocol == Pickle {
+			appendPickle(&buf, s.Prefix, points[:n])
+		} else {
+			appendPlaintext(&buf, s.Prefix, points[:n])
+		}
+		if _, err := s.conn.Write(buf.Bytes()); err != nil {
+			s.Close()
+			return err
+		}
+		points = points[n:]
+	}
+	return nil
+}
+
+// SetTransport sets the TLS and proxy config of the connection, it implements sink.Transporter.
+func (s *Sink) SetTransport(t *sink.Transport) error {
+	if _, err := t.TLSConfig(); err != nil {
+		return err
+	}
+	s.Close()
+	s.transport = t
+	return nil
+}
+
+// Close closes the connection to carbon.
+func (s *Sink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+var pathReplacer = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_")
+
+func appendPlaintext(buf *bytes.Buffer, prefix string, points []sink.Point) {
+	for _, p := range points {
+		buf.WriteString(pathReplacer.Replace(prefix + p.Name))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(p.Value, 'g', -1, 64))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(p.Time.Unix(), 10))
+		buf.WriteByte('\n')
+	}
+}
@@ -0,0 +1,63 @@
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+var testPoints = []sink.Point{
+	{Name: "system.cpu.user", Value: 12.5, Time: time.Unix(1700000000, 0)},
+	{Name: "runtime.cpu.goroutines", Value: 8, Time: time.Unix(1700000000, 0)},
+}
+
+func TestPlaintext(t *testing.T) {
+	var buf bytes.Buffer
+	appendPlaintext(&buf, "web 1.", testPoints)
+	assert.Equal(t, "web_1.system.cpu.user 12.5 1700000000\nweb_1.runtime.cpu.goroutines 8 1700000000\n", buf.String())
+}
+
+func TestPickle(t *testing.T) {
+	var buf bytes.Buffer
+	appendPickle(&buf, "", testPoints[:1])
+
+	// pickle.dumps([("system.cpu.user", (1700000000, 12.5))], protocol=2) with the list appended by APPENDS
+	want := []byte("\x80\x02](X\x0f\x00\x00\x00system.cpu.userJ\x00\xf1\x53\x65G\x40\x29\x00\x00\x00\x00\x00\x00\x86\x86e.")
+	data := buf.Bytes()
+	assert.Equal(t, uint32(len(want)), binary.BigEndian.Uint32(data))
+	assert.Equal(t, want, data[4:])
+}
+
+func TestSink(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan []byte)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	s := New(l.Addr().String(), Pickle)
+	s.BatchSize = 1
+	assert.NoError(t, s.Write(context.Background(), testPoints))
+	s.Close()
+
+	data := <-received
+	n := binary.BigEndian.Uint32(data)
+	second := data[4+n:]
+	assert.Equal(t, uint32(len(second)-4), binary.BigEndian.Uint32(second))
+	assert.Contains(t, string(second), "runtime.cpu.goroutines")
+}
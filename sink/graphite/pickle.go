@@ -0,0 +1,52 @@
+package graphite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/smallnest/go-app-metrics/sink"
+)
+
+// pickle opcodes of protocol 2 used to encode a list of (path, (timestamp, value)) tuples.
+const (
+	opProto      = 0x80
+	opEmptyList  = ']'
+	opMark       = '('
+	opAppends    = 'e'
+	opBinUnicode = 'X'
+	opBinInt     = 'J'
+	opBinFloat   = 'G'
+	opTuple2     = 0x86
+	opStop       = '.'
+)
+
+// appendPickle appends a pickle message of the points: a 4-byte big-endian length header followed by
+// the pickled list [(path, (timestamp, value)), ...] as expected by carbon's pickle receiver.
+func appendPickle(buf *bytes.Buffer, prefix string, points []sink.Point) {
+	start := buf.Len()
+	buf.Write([]byte{0, 0, 0, 0}) // length, filled in below
+
+	var b [8]byte
+	buf.Write([]byte{opProto, 2, opEmptyList, opMark})
+	for _, p := range points {
+		path := pathReplacer.Replace(prefix + p.Name)
+		buf.WriteByte(opBinUnicode)
+		binary.LittleEndian.PutUint32(b[:4], uint32(len(path)))
+		buf.Write(b[:4])
+		buf.WriteString(path)
+
+		buf.WriteByte(opBinInt)
+		binary.LittleEndian.PutUint32(b[:4], uint32(int32(p.Time.Unix())))
+		buf.Write(b[:4])
+
+		buf.WriteByte(opBinFloat)
+		binary.BigEndian.PutUint64(b[:], math.Float64bits(p.Value))
+		buf.Write(b[:])
+
+		buf.Write([]byte{opTuple2, opTuple2})
+	}
+	buf.Write([]byte{opAppends, opStop})
+
+	binary.BigEndian.PutUint32(buf.Bytes()[start:], uint32(buf.Len()-start-4))
+}
@@ -0,0 +1,248 @@
+// Package influxdb provides a sink writing the InfluxDB line protocol to the HTTP write API of
+// InfluxDB 1.x or 2.x. The points of a snapshot become the fields of one line of the measurement,
+// with the tags of the points as tags:
+//
+//	appmetrics,go.os=linux runtime.cpu.goroutines=8,system.cpu.user=1.5 1700000000000000000
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/sink"
+)
+
+// Sink writes points to InfluxDB over HTTP.
+type Sink struct {
+	// Measurement is the measurement of the lines. Defaults to "appmetrics".
+	Measurement string
+	// Tags are added to the tags of every point, overriding the tags of the points.
+	Tags map[string]string
+	// BatchSize is the maximum number of points per request. Defaults to 5000.
+	BatchSize int
+	// MaxRetries is the number of retries of a request which failed with a network error, a 5xx or
+	// 429 status. Defaults to 3.
+	MaxRetries int
+	// Backoff is the wait before the first retry, it is doubled for each further retry. Defaults to 1 second.
+	Backoff time.Duration
+	// Compression compresses the request bodies, InfluxDB accepts sink.Gzip. Defaults to sink.None.
+	Compression sink.Compression
+	// Client is the HTTP client used to send requests. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	// Username and Password are the credentials of InfluxDB 1.x with authentication enabled.
+	Username string
+	Password string
+
+	url       string
+	token     string
+	transport *sink.Transport
+}
+
+func newSink(u string) *Sink {
+	return &Sink{
+		Measurement: "appmetrics",
+		BatchSize:   5000,
+		MaxRetries:  3,
+		Backoff:     time.Second,
+		Client:      http.DefaultClient,
+		url:         u,
+	}
+}
+
+// NewV1 creates a Sink writing to database of the InfluxDB 1.x at addr, e.g. "http://influxdb:8086".
+func NewV1(addr, database string) *Sink {
+	q := url.Values{"db": {database}, "precision": {"ns"}}
+	return newSink(strings.TrimSuffix(addr, "/") + "/write?" + q.Encode())
+}
+
+// NewV2 creates a Sink writing to bucket of org of the InfluxDB 2.x at addr, authenticating with token.
+func NewV2(addr, org, bucket, token string) *Sink {
+	q := url.Values{"org": {org}, "bucket": {bucket}, "precision": {"ns"}}
+	s := newSink(strings.TrimSuffix(addr, "/") + "/api/v2/write?" + q.Encode())
+	s.token = token
+	return s
+}
+
+// Write writes the points in batches of BatchSize, stopping at the first failed batch.
+// Points whose value is NaN or infinite are skipped because the line protocol can't represent them.
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	size := s.BatchSize
+	if size <= 0 {
+		size = len(points)
+	}
+	for len(points) > 0 {
+		n := size
+		if n > len(points) {
+			n = len(points)
+		}
+		if err := s.send(ctx, s.encode(points[:n])); err != nil {
+			return err
+		}
+		points = points[n:]
+	}
+	return nil
+}
+
+// encode encodes points as lines, points with the same tags and time are fields of the same line.
+func (s *Sink) encode(points []sink.Point) []byte {
+	type line struct {
+		series string
+		fields []string
+		time   int64
+	}
+	var lines []*line
+	index := make(map[string]*line)
+
+	for _, p := range points {
+		if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+			continue
+		}
+
+		series := s.series(p.Tags)
+		ts := p.Time.UnixNano()
+		key := series + " " + strconv.FormatInt(ts, 10)
+		l := index[key]
+		if l == nil {
+			l = &line{series: series, time: ts}
+			index[key] = l
+			lines = append(lines, l)
+		}
+		l.fields = append(l.fields, escape(p.Name, ",= ")+"="+strconv.FormatFloat(p.Value, 'g', -1, 64))
+	}
+
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.WriteString(l.series)
+		buf.WriteByte(' ')
+		buf.WriteString(strings.Join(l.fields, ","))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(l.time, 10))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// series returns the measurement with the tags sorted by key as the line protocol recommends.
+func (s *Sink) series(tags map[string]string) string {
+	merged := make(map[string]string, len(tags)+len(s.Tags))
+	for _, m := range []map[string]string{tags, s.Tags} {
+		for k, v := range m {
+			if v != "" {
+				merged[k] = v
+			}
+		}
+	}
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(escape(s.Measurement, ", "))
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(escape(k, ",= "))
+		b.WriteByte('=')
+		b.WriteString(escape(merged[k], ",= "))
+	}
+	return b.String()
+}
+
+// escape escapes the special characters chars and newlines, which can't be escaped, are replaced by spaces.
+func escape(s, chars string) string {
+	if !strings.ContainsAny(s, chars+"\n\\") {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\n' {
+			r = ' '
+		}
+		if r == '\\' || strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// SetTransport sets the TLS, auth and proxy config of the requests, it implements sink.Transporter.
+// It replaces Client.
+func (s *Sink) SetTransport(t *sink.Transport) error {
+	client, err := t.HTTPClient()
+	if err != nil {
+		return err
+	}
+	s.Client = client
+	s.transport = t
+	return nil
+}
+
+// send posts data, retrying temporary failures with exponential backoff.
+func (s *Sink) send(ctx context.Context, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	data, err := s.Compression.Encode(data)
+	if err != nil {
+		return err
+	}
+
+	backoff := s.Backoff
+	for attempt := 0; ; attempt++ {
+		err := s.post(ctx, data)
+		if err == nil || attempt >= s.MaxRetries || !sink.Retryable(err) {
+			return err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+func (s *Sink) post(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	s.Compression.SetHeader(req.Header)
+	switch {
+	case s.token != "":
+		req.Header.Set("Authorization", "Token "+s.token)
+	case s.Username != "":
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	s.transport.Authorize(req)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &sink.StatusError{Code: resp.StatusCode, Msg: fmt.Sprintf("influxdb: %s: %s", resp.Status, bytes.TrimSpace(msg))}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
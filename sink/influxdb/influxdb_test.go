@@ -0,0 +1,100 @@
+package influxdb
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSinkV2(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/write", r.URL.Path)
+		assert.Equal(t, "my-org", r.URL.Query().Get("org"))
+		assert.Equal(t, "metrics", r.URL.Query().Get("bucket"))
+		assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s := NewV2(srv.URL, "my-org", "metrics", "secret")
+	s.BatchSize = 3
+	s.Tags = map[string]string{"host": "web-1"}
+
+	ts := time.Unix(1700000000, 0)
+	tags := map[string]string{"go.version": "go1.21 rc", "empty": ""}
+	err := s.Write(context.Background(), []sink.Point{
+		{Name: "runtime.cpu.goroutines", Value: 8, Tags: tags, Time: ts},
+		{Name: "system.cpu.user", Value: 1.5, Tags: tags, Time: ts},
+		{Name: "system.cpu.idle", Value: math.NaN(), Tags: tags, Time: ts},
+		{Name: "system.disk.var_lib.total", Value: 10, Tags: tags, Time: ts.Add(time.Second)},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"appmetrics,go.version=go1.21\\ rc,host=web-1 runtime.cpu.goroutines=8,system.cpu.user=1.5 1700000000000000000\n",
+		"appmetrics,go.version=go1.21\\ rc,host=web-1 system.disk.var_lib.total=10 1700000001000000000\n",
+	}, bodies)
+}
+
+func TestSinkV1(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/write", r.URL.Path)
+		assert.Equal(t, "telegraf", r.URL.Query().Get("db"))
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "admin:pw", user+":"+pass)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s := NewV1(srv.URL+"/", "telegraf")
+	s.Username, s.Password = "admin", "pw"
+	err := s.Write(context.Background(), []sink.Point{{Name: "x", Value: 1, Time: time.Now()}})
+	assert.NoError(t, err)
+}
+
+func TestSinkRetry(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Query().Get("bucket") == "bad":
+			http.Error(w, `{"code":"invalid"}`, http.StatusBadRequest)
+		case requests < 3:
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	points := []sink.Point{{Name: "x", Value: 1, Time: time.Now()}}
+
+	s := NewV2(srv.URL, "org", "metrics", "")
+	s.Backoff = time.Millisecond
+	assert.NoError(t, s.Write(context.Background(), points))
+	assert.Equal(t, 3, requests)
+
+	// client errors are not retried
+	requests = 0
+	s = NewV2(srv.URL, "org", "bad", "")
+	s.Backoff = time.Millisecond
+	assert.Error(t, s.Write(context.Background(), points))
+	assert.Equal(t, 1, requests)
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, `a\,b\=c\ d`, escape("a,b=c d", ",= "))
+	assert.Equal(t, `a=b\ c`, escape("a=b c", ", "))
+	assert.Equal(t, `x\\\ y`, escape("x\\\ny", ", "))
+}
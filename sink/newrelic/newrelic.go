@@ -0,0 +1,169 @@
+// Package newrelic provides a sink submitting dimensional metrics to the New Relic Metric API.
+// The points are sent as gauges in batches, with the tags shared by the batch as common attributes.
+package newrelic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/smallnest/go-app-metrics/sink"
+)
+
+// Endpoints of the Metric API in the US and EU data centers.
+const (
+	USEndpoint = "https://metric-api.newrelic.com/metric/v1"
+	EUEndpoint = "https://metric-api.eu.newrelic.com/metric/v1"
+)
+
+// Sink submits points to the New Relic Metric API.
+type Sink struct {
+	// Endpoint is the URL of the Metric API. Defaults to USEndpoint.
+	Endpoint string
+	// Attributes are added to the common attributes of every batch, e.g. service.name or host.name.
+	Attributes map[string]string
+	// BatchSize is the maximum number of points per request. Defaults to 1000.
+	BatchSize int
+	// Compression compresses the request bodies, the Metric API accepts sink.Gzip. Defaults to sink.None.
+	Compression sink.Compression
+	// Client is the HTTP client used to send requests. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	apiKey    string
+	transport *sink.Transport
+}
+
+// New creates a Sink authenticating with the license or insert key apiKey.
+func New(apiKey string) *Sink {
+	return &Sink{
+		Endpoint:  USEndpoint,
+		BatchSize: 1000,
+		Client:    http.DefaultClient,
+		apiKey:    apiKey,
+	}
+}
+
+type payload struct {
+	Common  common   `json:"common"`
+	Metrics []metric `json:"metrics"`
+}
+
+type common struct {
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type metric struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Value      float64           `json:"value"`
+	Timestamp  int64             `json:"timestamp"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Write submits the points in batches of BatchSize, stopping at the first failed batch.
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	size := s.BatchSize
+	if size <= 0 {
+		size = len(points)
+	}
+	for len(points) > 0 {
+		n := size
+		if n > len(points) {
+			n = len(points)
+		}
+		if err := s.post(ctx, encode(points[:n], s.Attributes)); err != nil {
+			return err
+		}
+		points = points[n:]
+	}
+	return nil
+}
+
+// encode encodes points as a payload. The tags shared by all points and attrs are the common attributes,
+// metrics only carry the tags which differ from them.
+func encode(points []sink.Point, attrs map[string]string) []payload {
+	c := common{Attributes: make(map[string]string)}
+	for k, v := range points[0].Tags {
+		shared := true
+		for _, pt := range points[1:] {
+			if w, ok := pt.Tags[k]; !ok || w != v {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			c.Attributes[k] = v
+		}
+	}
+	for k, v := range attrs {
+		c.Attributes[k] = v
+	}
+
+	p := payload{Common: c, Metrics: make([]metric, 0, len(points))}
+	for _, pt := range points {
+		m := metric{
+			Name:      pt.Name,
+			Type:      "gauge",
+			Value:     pt.Value,
+			Timestamp: pt.Time.UnixMilli(),
+		}
+		for k, v := range pt.Tags {
+			if c.Attributes[k] != v {
+				if m.Attributes == nil {
+					m.Attributes = make(map[string]string)
+				}
+				m.Attributes[k] = v
+			}
+		}
+		p.Metrics = append(p.Metrics, m)
+	}
+	return []payload{p}
+}
+
+// SetTransport sets the TLS, auth and proxy config of the requests, it implements sink.Transporter.
+// It replaces Client.
+func (s *Sink) SetTransport(t *sink.Transport) error {
+	client, err := t.HTTPClient()
+	if err != nil {
+		return err
+	}
+	s.Client = client
+	s.transport = t
+	return nil
+}
+
+func (s *Sink) post(ctx context.Context, body []payload) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	if data, err = s.Compression.Encode(data); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.Compression.SetHeader(req.Header)
+	req.Header.Set("Api-Key", s.apiKey)
+
+	s.transport.Authorize(req)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &sink.StatusError{Code: resp.StatusCode, Msg: fmt.Sprintf("newrelic: %s: %s", resp.Status, bytes.TrimSpace(msg))}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
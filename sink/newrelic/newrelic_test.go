@@ -0,0 +1,73 @@
+package newrelic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSink(t *testing.T) {
+	var batches [][]payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("Api-Key"))
+		var body []payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		batches = append(batches, body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	s := New("secret")
+	s.Endpoint = srv.URL
+	s.BatchSize = 2
+	s.Attributes = map[string]string{"service.name": "web"}
+
+	ts := time.UnixMilli(1700000000123)
+	tags := map[string]string{"go.os": "linux"}
+	err := s.Write(context.Background(), []sink.Point{
+		{Name: "runtime.cpu.goroutines", Value: 8, Tags: tags, Time: ts},
+		{Name: "system.cpu.user", Value: 1.5, Tags: map[string]string{"go.os": "darwin"}, Time: ts},
+		{Name: "system.cpu.idle", Value: 90, Tags: tags, Time: ts},
+	})
+	assert.NoError(t, err)
+
+	assert.Len(t, batches, 2)
+	first := batches[0][0]
+	assert.Equal(t, map[string]string{"service.name": "web"}, first.Common.Attributes)
+	assert.Len(t, first.Metrics, 2)
+	assert.Equal(t, "gauge", first.Metrics[0].Type)
+	assert.Equal(t, int64(1700000000123), first.Metrics[0].Timestamp)
+	assert.Equal(t, map[string]string{"go.os": "linux"}, first.Metrics[0].Attributes)
+	assert.Equal(t, map[string]string{"go.os": "darwin"}, first.Metrics[1].Attributes)
+}
+
+func TestEncodeCommonAttributes(t *testing.T) {
+	ts := time.Now()
+	p := encode([]sink.Point{
+		{Name: "system.disk._root.total", Tags: map[string]string{"go.os": "linux", "mountpoints": "/"}, Time: ts},
+		{Name: "system.mem.total", Tags: map[string]string{"go.os": "linux"}, Time: ts},
+	}, nil)[0]
+
+	// the tags of the first point aren't inherited by points without them
+	assert.Equal(t, map[string]string{"go.os": "linux"}, p.Common.Attributes)
+	assert.Equal(t, map[string]string{"mountpoints": "/"}, p.Metrics[0].Attributes)
+	assert.Nil(t, p.Metrics[1].Attributes)
+}
+
+func TestSinkError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid key", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	s := New("bad")
+	s.Endpoint = srv.URL
+	err := s.Write(context.Background(), []sink.Point{{Name: "x", Value: 1, Time: time.Now()}})
+	assert.EqualError(t, err, "newrelic: 403 Forbidden: invalid key")
+}
@@ -0,0 +1,137 @@
+// Package opentsdb provides a sink writing to the /api/put endpoint of OpenTSDB. The dotted metric
+// names map naturally to OpenTSDB metrics and the tags of the points become OpenTSDB tags.
+package opentsdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/smallnest/go-app-metrics/sanitize"
+	"github.com/smallnest/go-app-metrics/sink"
+)
+
+// Sink writes points to OpenTSDB over HTTP.
+type Sink struct {
+	// Tags are added to the tags of every point, overriding the tags of the points. OpenTSDB requires
+	// at least one tag per data point, so New sets host to the host name.
+	Tags map[string]string
+	// BatchSize is the maximum number of data points per request. Defaults to 50, larger requests
+	// need tsd.http.request.enable_chunked to be enabled in OpenTSDB.
+	BatchSize int
+	// Compression compresses the request bodies, OpenTSDB accepts sink.Gzip. Defaults to sink.None.
+	Compression sink.Compression
+	// Client is the HTTP client used to send requests. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	url       string
+	transport *sink.Transport
+}
+
+// New creates a Sink writing to the OpenTSDB at addr, e.g. "http://opentsdb:4242".
+func New(addr string) *Sink {
+	host, _ := os.Hostname()
+	return &Sink{
+		Tags:      map[string]string{"host": host},
+		BatchSize: 50,
+		Client:    http.DefaultClient,
+		url:       strings.TrimSuffix(addr, "/") + "/api/put",
+	}
+}
+
+type dataPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     float64           `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// Write writes the points in batches of BatchSize, stopping at the first failed batch.
+// Metric names and tags are sanitized by sanitize.OpenTSDB, and empty tags are omitted.
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	size := s.BatchSize
+	if size <= 0 {
+		size = len(points)
+	}
+	for len(points) > 0 {
+		n := size
+		if n > len(points) {
+			n = len(points)
+		}
+		if err := s.post(ctx, s.encode(points[:n])); err != nil {
+			return err
+		}
+		points = points[n:]
+	}
+	return nil
+}
+
+func (s *Sink) encode(points []sink.Point) []dataPoint {
+	dps := make([]dataPoint, 0, len(points))
+	for _, p := range points {
+		dp := dataPoint{
+			Metric:    sanitize.OpenTSDB(p.Name),
+			Timestamp: p.Time.Unix(),
+			Value:     p.Value,
+			Tags:      make(map[string]string, len(p.Tags)+len(s.Tags)),
+		}
+		for _, tags := range []map[string]string{p.Tags, s.Tags} {
+			for k, v := range tags {
+				if v != "" {
+					dp.Tags[sanitize.OpenTSDB(k)] = sanitize.OpenTSDB(v)
+				}
+			}
+		}
+		dps = append(dps, dp)
+	}
+	return dps
+}
+
+// SetTransport sets the TLS, auth and proxy config of the requests, it implements sink.Transporter.
+// It replaces Client.
+func (s *Sink) SetTransport(t *sink.Transport) error {
+	client, err := t.HTTPClient()
+	if err != nil {
+		return err
+	}
+	s.Client = client
+	s.transport = t
+	return nil
+}
+
+func (s *Sink) post(ctx context.Context, dps []dataPoint) error {
+	data, err := json.Marshal(dps)
+	if err != nil {
+		return err
+	}
+	if data, err = s.Compression.Encode(data); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.Compression.SetHeader(req.Header)
+
+	s.transport.Authorize(req)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &sink.StatusError{Code: resp.StatusCode, Msg: fmt.Sprintf("opentsdb: %s: %s", resp.Status, bytes.TrimSpace(msg))}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
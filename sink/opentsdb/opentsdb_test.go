@@ -0,0 +1,76 @@
+package opentsdb
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSink(t *testing.T) {
+	var batches [][]dataPoint
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/put", r.URL.Path)
+		var dps []dataPoint
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&dps))
+		batches = append(batches, dps)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s := New(srv.URL + "/")
+	s.BatchSize = 2
+	s.Tags = map[string]string{"host": "web-1"}
+
+	ts := time.Unix(1700000000, 0)
+	tags := map[string]string{"go.version": "go1.21 rc", "empty": ""}
+	err := s.Write(context.Background(), []sink.Point{
+		{Name: "system.disk.var_lib.total", Value: 10, Tags: tags, Time: ts},
+		{Name: "system.cpu.user", Value: 1.5, Tags: tags, Time: ts},
+		{Name: "runtime.cpu.goroutines", Value: 8, Tags: tags, Time: ts},
+	})
+	assert.NoError(t, err)
+
+	assert.Len(t, batches, 2)
+	assert.Len(t, batches[1], 1)
+	assert.Equal(t, dataPoint{
+		Metric:    "system.disk.var_lib.total",
+		Timestamp: 1700000000,
+		Value:     10,
+		Tags:      map[string]string{"go.version": "go1.21_rc", "host": "web-1"},
+	}, batches[0][0])
+}
+
+func TestSinkError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"code": 400}}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := New(srv.URL).Write(context.Background(), []sink.Point{{Name: "x", Value: 1, Time: time.Now()}})
+	assert.Error(t, err)
+}
+
+func TestSinkGzip(t *testing.T) {
+	var dps []dataPoint
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		zr, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, json.NewDecoder(zr).Decode(&dps))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s := New(srv.URL)
+	s.Compression = sink.Gzip
+	err := s.Write(context.Background(), []sink.Point{{Name: "system.cpu.user", Value: 1.5, Time: time.Now()}})
+	assert.NoError(t, err)
+	assert.Len(t, dps, 1)
+}
@@ -0,0 +1,454 @@
+// Package sink writes the snapshots of an appmetrics.Runner to push-based backends. A Sink encodes
+// and sends points to a backend, and a Pusher feeds it with snapshots from its own goroutine,
+// so a slow or unavailable backend can't delay the collection:
+//
+//	p := sink.NewPusher("wavefront", wavefront.New("proxy:2878", "web-1"))
+//	defer p.Close()
+//	status.Register(p)
+//	unsubscribe := runner.Subscribe(p.Handle)
+//
+// Attach pushes at an interval of its own instead, while the pull-based endpoints serve the same snapshots.
+// A sink can also flush at its own interval, e.g. because its backend charges by request, see Flusher.
+//
+// The subpackages implement sinks for specific backends. Wrap a sink in a Spool to buffer the points
+// on disk during backend outages.
+package sink
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/smallnest/go-app-metrics/dispatch"
+	"github.com/smallnest/go-app-metrics/internal/value"
+	"github.com/smallnest/go-app-metrics/metadata"
+	"github.com/smallnest/go-app-metrics/sanitize"
+	"github.com/smallnest/go-app-metrics/status"
+	"github.com/smallnest/go-app-metrics/units"
+)
+
+// Point is a numeric metric at a time.
+type Point struct {
+	Name  string
+	Value float64
+	Tags  map[string]string
+	Time  time.Time
+}
+
+// Sink writes points to a backend. Write is called from one goroutine at a time.
+// Sinks write the points with their own time, so historical points can be backfilled.
+type Sink interface {
+	Write(ctx context.Context, points []Point) error
+}
+
+// AgeLimiter is implemented by sinks whose backend rejects points older than MaxAge.
+type AgeLimiter interface {
+	MaxAge() time.Duration
+}
+
+// Flusher is implemented by sinks which declare their own flush interval and batch size, e.g. because
+// their backend charges by request or limits the size of a request. See Pusher.FlushInterval and
+// Pusher.BatchSize.
+type Flusher interface {
+	FlushInterval() time.Duration
+	BatchSize() int
+}
+
+// Points converts a snapshot to points sorted by name. The metrics of the go runtime are named
+// runtime.<key> and the metrics of the system system.<key>, so keys existing in both, like mem.total,
+// don't collide. Partitions and network interfaces are sanitized by sf. All points share the tags
+// of the snapshot, see Snapshot.AllTags, and the time of the snapshot, the points of a partition
+// are also tagged with its comma separated mountpoints as mountpoints. Only the points of critical
+// metrics are returned if Snapshot.CriticalOnly is set.
+func Points(snap *appmetrics.Snapshot, sf sanitize.Func) []Point {
+	tags := snap.AllTags()
+	rvalues := snap.Runtime.Values()
+	svalues := snap.System.SanitizedValues(sf)
+
+	// the tags of the points of the partitions keyed by the prefix of their keys, e.g. disk._root
+	diskTags := make(map[string]map[string]string, len(snap.System.DiskStat))
+	for partition, stat := range snap.System.DiskStat {
+		if len(stat.Mountpoints) == 0 {
+			continue
+		}
+		t := make(map[string]string, len(tags)+1)
+		for k, v := range tags {
+			t[k] = v
+		}
+		t["mountpoints"] = strings.Join(stat.Mountpoints, ",")
+		diskTags["disk."+sf(partition)] = t
+	}
+
+	points := make([]Point, 0, len(rvalues)+len(svalues))
+	add := func(prefix string, values map[string]interface{}, r *metadata.Registry) {
+		for k, v := range values {
+			if snap.CriticalOnly && !r.Keep(k, metadata.Critical) {
+				continue
+			}
+			f, ok := value.Float64(v)
+			if !ok {
+				continue
+			}
+			p := Point{Name: prefix + k, Value: f, Tags: tags, Time: snap.Time}
+			if i := strings.LastIndexByte(k, '.'); prefix == "system." && i > 0 && diskTags[k[:i]] != nil {
+				p.Tags = diskTags[k[:i]]
+			}
+			points = append(points, p)
+		}
+	}
+	add("runtime.", rvalues, metadata.Runtime)
+	add("system.", svalues, metadata.System)
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Name < points[j].Name })
+	return points
+}
+
+// Pusher writes snapshots to a Sink in its own goroutine. Snapshots are queued while a write is in
+// progress and the oldest ones are dropped when the queue is full. It is safe for use from multiple go routines.
+type Pusher struct {
+	// Timeout is the maximum duration of a write. Defaults to 10 seconds.
+	Timeout time.Duration
+	// Sanitize sanitizes partitions and network interfaces embedded in metric names.
+	// Defaults to sanitize.Graphite.
+	Sanitize sanitize.Func
+	// FlushInterval, if positive, decouples the writes from the collection: the snapshots handled
+	// in between are aggregated and written every FlushInterval. Metrics since the previous collection
+	// are combined according to their metadata.Aggregation, e.g. summed, and the other metrics keep
+	// their last value. It must be set before the first snapshot is handled. Defaults to the interval
+	// of a sink implementing Flusher, otherwise to 0, which writes every snapshot.
+	FlushInterval time.Duration
+	// BatchSize, if positive, is the maximum number of points of a write, more points are split into
+	// several writes. Defaults to the batch size of a sink implementing Flusher, otherwise to 0,
+	// which writes all points of a snapshot at once.
+	BatchSize int
+	// Budget, if not nil, limits the series and points written, e.g. to a backend which charges by
+	// series. It must be set before the first snapshot is handled. Defaults to nil.
+	Budget *Budget
+	// Scale converts memory, disk and duration values before they are written. It must be set before
+	// the first snapshot is handled. Defaults to raw bytes and nanoseconds.
+	Scale units.Scale
+
+	name       string
+	sink       Sink
+	dispatcher *dispatch.Dispatcher[*appmetrics.Snapshot]
+
+	flushOnce sync.Once
+	flushStop chan struct{}
+	flushDone chan struct{}
+	aggMu     sync.Mutex
+	pending   aggregator
+	closed    bool
+
+	budgetMu sync.Mutex
+	budget   budgetState
+
+	mu        sync.Mutex
+	writes    int64
+	failures  int64
+	points    int64
+	lastWrite time.Time
+	lastErr   error
+}
+
+// NewPusher creates a Pusher named name, which is used in metric keys and its status, writing to s.
+// Call Close to stop it.
+func NewPusher(name string, s Sink) *Pusher {
+	p := &Pusher{
+		Timeout:  10 * time.Second,
+		Sanitize: sanitize.Graphite,
+		name:     name,
+		sink:     s,
+	}
+	if f, ok := s.(Flusher); ok {
+		p.FlushInterval = f.FlushInterval()
+		p.BatchSize = f.BatchSize()
+	}
+	p.dispatcher = dispatch.New(name, p.write, 4, dispatch.DropOldest)
+	return p
+}
+
+// Handle queues snap to be written, or aggregates it until the next flush if FlushInterval is set.
+// It can be used as the handler or a subscriber of a Runner.
+func (p *Pusher) Handle(snap *appmetrics.Snapshot) {
+	if p.FlushInterval <= 0 {
+		p.dispatcher.Handle(snap)
+		return
+	}
+
+	p.flushOnce.Do(p.startFlushing)
+	points := p.snapshotPoints(snap)
+
+	p.aggMu.Lock()
+	defer p.aggMu.Unlock()
+	if !p.closed {
+		p.pending.add(points)
+	}
+}
+
+// Close stops accepting snapshots and waits until the queued ones, and the aggregated ones
+// if FlushInterval is set, have been written.
+func (p *Pusher) Close() {
+	p.aggMu.Lock()
+	closed := p.closed
+	p.closed = true
+	p.aggMu.Unlock()
+	if closed {
+		return
+	}
+
+	// the flush loop can't be started after Close
+	p.flushOnce.Do(func() {})
+	if p.flushStop != nil {
+		close(p.flushStop)
+		<-p.flushDone
+		p.flush()
+	}
+	p.dispatcher.Close()
+}
+
+func (p *Pusher) startFlushing() {
+	p.flushStop = make(chan struct{})
+	p.flushDone = make(chan struct{})
+	go p.flushLoop(p.FlushInterval, p.flushStop, p.flushDone)
+}
+
+func (p *Pusher) flushLoop(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			p.flush()
+		}
+	}
+}
+
+// flush writes the points aggregated since the previous flush, if any.
+func (p *Pusher) flush() {
+	p.aggMu.Lock()
+	points := p.pending.flush()
+	p.aggMu.Unlock()
+	if len(points) > 0 {
+		p.writePoints(context.Background(), points)
+	}
+}
+
+// Attach makes p push the snapshots of r and starts the collection loop of r until detach is called.
+// The same loop serves the pull-based endpoints, such as stat.Stats and prometheus.Collector, from its
+// latest snapshot, so pulling and pushing don't collect twice. With interval 0 every snapshot collected
+// by r is pushed. Otherwise the latest snapshot is pushed every interval, independent of the collection
+// interval of r, and a snapshot which has been pushed already isn't pushed again. The snapshots pushed
+// are aggregated if FlushInterval is set.
+//
+//	r := appmetrics.Default()
+//	r.SetInterval(10 * time.Second)
+//	detach := pusher.Attach(r, time.Minute)
+//	defer detach()
+func (p *Pusher) Attach(r *appmetrics.Runner, interval time.Duration) (detach func()) {
+	r.Start()
+	if interval <= 0 {
+		unsubscribe := r.Subscribe(p.Handle)
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				unsubscribe()
+				r.Stop()
+			})
+		}
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+
+		var last *appmetrics.Snapshot
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+				if snap := r.Latest(); snap != nil && snap != last {
+					p.Handle(snap)
+					last = snap
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-stopped
+			r.Stop()
+		})
+	}
+}
+
+func (p *Pusher) write(snap *appmetrics.Snapshot) {
+	p.writePoints(context.Background(), p.snapshotPoints(snap))
+}
+
+// snapshotPoints converts snap to points with Sanitize and Scale.
+func (p *Pusher) snapshotPoints(snap *appmetrics.Snapshot) []Point {
+	points := Points(snap, p.Sanitize)
+	if p.Scale.IsZero() {
+		return points
+	}
+	for i := range points {
+		points[i].Value /= p.Scale.Divisor(describe(points[i].Name))
+	}
+	return points
+}
+
+// Backfill writes historical snapshots, e.g. replayed from files, to the sink in chronological order.
+// Unlike Handle it writes synchronously without dropping snapshots, and it stops after the first snapshot
+// which failed to be written. Snapshots older than the MaxAge of a sink implementing AgeLimiter are skipped, and their
+// number is returned.
+func (p *Pusher) Backfill(ctx context.Context, snaps []*appmetrics.Snapshot) (skipped int, err error) {
+	snaps = append([]*appmetrics.Snapshot(nil), snaps...)
+	sort.SliceStable(snaps, func(i, j int) bool { return snaps[i].Time.Before(snaps[j].Time) })
+
+	var oldest time.Time
+	if l, ok := p.sink.(AgeLimiter); ok && l.MaxAge() > 0 {
+		oldest = time.Now().Add(-l.MaxAge())
+	}
+	for _, snap := range snaps {
+		if snap.Time.Before(oldest) {
+			skipped++
+			continue
+		}
+		if err = p.writePoints(ctx, p.snapshotPoints(snap)); err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, nil
+}
+
+// writePoints writes the points within Budget in batches of BatchSize, each within Timeout.
+// A failed batch doesn't stop the following ones, the errors of all failed batches are joined.
+func (p *Pusher) writePoints(ctx context.Context, points []Point) error {
+	if p.Budget != nil {
+		p.budgetMu.Lock()
+		points = p.budget.apply(p.Budget, points)
+		p.budgetMu.Unlock()
+	}
+
+	var errs []error
+	for _, batch := range batches(points, p.BatchSize) {
+		wctx, cancel := context.WithTimeout(ctx, p.Timeout)
+		err := p.sink.Write(wctx, batch)
+		cancel()
+		if err = p.recordWrite(len(batch), err); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// batches splits points into batches of at most size points, or returns one batch if size isn't positive.
+func batches(points []Point, size int) [][]Point {
+	if size <= 0 || len(points) <= size {
+		return [][]Point{points}
+	}
+	bs := make([][]Point, 0, (len(points)+size-1)/size)
+	for len(points) > size {
+		bs = append(bs, points[:size:size])
+		points = points[size:]
+	}
+	return append(bs, points)
+}
+
+func (p *Pusher) recordWrite(n int, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writes++
+	p.lastErr = err
+	if err != nil {
+		p.failures++
+		return err
+	}
+	p.points += int64(n)
+	p.lastWrite = time.Now()
+	return nil
+}
+
+// Status returns the state of the Pusher with its sink.
+func (p *Pusher) Status() status.Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := status.Sink{
+		Name:      p.name,
+		Healthy:   p.lastErr == nil,
+		LastWrite: p.lastWrite,
+	}
+	if p.lastErr != nil {
+		s.LastError = p.lastErr.Error()
+	}
+	return status.Status{
+		Name:    "sink." + p.name,
+		Running: true,
+		Sinks:   []status.Sink{s},
+	}
+}
+
+// Stats returns the current stats of the Pusher.
+func (p *Pusher) Stats() PusherStats {
+	p.budgetMu.Lock()
+	budgetDropped := p.budget.points
+	droppedSeries := p.budget.droppedSeries()
+	p.budgetMu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PusherStats{
+		Name:          p.name,
+		Writes:        p.writes,
+		Failures:      p.failures,
+		Points:        p.points,
+		Dropped:       p.dispatcher.Stats().Dropped,
+		BudgetDropped: budgetDropped,
+		DroppedSeries: droppedSeries,
+	}
+}
+
+// PusherStats represents the stats of a Pusher. The counters are cumulative.
+type PusherStats struct {
+	Name     string
+	Writes   int64
+	Failures int64
+	// Points is the number of points written successfully.
+	Points int64
+	// Dropped is the number of snapshots dropped because the queue was full.
+	Dropped int64
+	// BudgetDropped is the number of points dropped because they were beyond the Budget.
+	BudgetDropped int64
+	// DroppedSeries are the sorted names of the series dropped at least once by the Budget.
+	DroppedSeries []string
+}
+
+// Values returns metrics which you can write into TSDB, keyed as sink.<name>.<metric>.
+func (s *PusherStats) Values() map[string]interface{} {
+	prefix := "sink." + s.Name + "."
+	return map[string]interface{}{
+		prefix + "writes":   s.Writes,
+		prefix + "failures": s.Failures,
+		prefix + "points":   s.Points,
+		prefix + "dropped":  s.Dropped,
+
+		prefix + "budget.dropped_points": s.BudgetDropped,
+		prefix + "budget.dropped_series": int64(len(s.DroppedSeries)),
+	}
+}
@@ -0,0 +1,314 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/sanitize"
+	"github.com/smallnest/go-app-metrics/system"
+	"github.com/smallnest/go-app-metrics/units"
+	"github.com/stretchr/testify/assert"
+)
+
+type memorySink struct {
+	mu     sync.Mutex
+	points []Point
+	err    error
+}
+
+func (s *memorySink) Write(ctx context.Context, points []Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.points = append(s.points, points...)
+	return nil
+}
+
+func testSnapshot() *appmetrics.Snapshot {
+	sstats := system.SystemStats{DiskStat: map[string]system.DiskStat{"/": {Total: 10}}}
+	sstats.MemStat.Total = 1000
+	return appmetrics.NewSnapshot(rmetric.RuntimeStats{NumGoroutine: 8, TotalAlloc: 100, Goos: "linux"}, sstats)
+}
+
+func TestPoints(t *testing.T) {
+	points := Points(testSnapshot(), sanitize.Graphite)
+
+	byName := make(map[string]Point)
+	for _, p := range points {
+		byName[p.Name] = p
+	}
+	assert.Equal(t, 100.0, byName["runtime.mem.total"].Value)
+	assert.Equal(t, 1000.0, byName["system.mem.total"].Value)
+	assert.Equal(t, 10.0, byName["system.disk._root.total"].Value)
+	assert.Equal(t, "linux", byName["runtime.cpu.goroutines"].Tags["go.os"])
+	assert.Empty(t, byName["system.mem.total"].Tags["warmup"])
+	assert.Empty(t, byName["system.disk._root.total"].Tags["mountpoints"])
+
+	snap := testSnapshot()
+	snap.System.DiskStat["/"] = system.DiskStat{Total: 10, Mountpoints: []string{"/", "/mnt"}}
+	byName = make(map[string]Point)
+	for _, p := range Points(snap, sanitize.Graphite) {
+		byName[p.Name] = p
+	}
+	assert.Equal(t, "/,/mnt", byName["system.disk._root.total"].Tags["mountpoints"])
+	assert.Equal(t, "linux", byName["system.disk._root.total"].Tags["go.os"])
+	assert.Empty(t, byName["system.mem.total"].Tags["mountpoints"])
+
+	snap = testSnapshot()
+	snap.CriticalOnly = true
+	byName = make(map[string]Point)
+	for _, p := range Points(snap, sanitize.Graphite) {
+		byName[p.Name] = p
+	}
+	assert.Contains(t, byName, "runtime.cpu.goroutines")
+	assert.Contains(t, byName, "system.mem.total")
+	assert.NotContains(t, byName, "runtime.mem.total")
+	assert.NotContains(t, byName, "system.disk._root.total")
+
+	snap = testSnapshot()
+	snap.System.Warmup = true
+	for _, p := range Points(snap, sanitize.Graphite) {
+		assert.Equal(t, "true", p.Tags["warmup"], p.Name)
+	}
+}
+
+func TestPusher(t *testing.T) {
+	s := &memorySink{}
+	p := NewPusher("memory", s)
+	p.Handle(testSnapshot())
+	p.Close()
+
+	stats := p.Stats()
+	assert.Equal(t, int64(1), stats.Writes)
+	assert.Equal(t, int64(len(s.points)), stats.Points)
+	assert.True(t, p.Status().Sinks[0].Healthy)
+
+	s.err = errors.New("unavailable")
+	p = NewPusher("memory", s)
+	p.Handle(testSnapshot())
+	p.Close()
+
+	stats = p.Stats()
+	assert.Equal(t, int64(1), stats.Values()["sink.memory.failures"])
+	assert.Equal(t, "unavailable", p.Status().Sinks[0].LastError)
+}
+
+type limitedSink struct {
+	memorySink
+}
+
+func (s *limitedSink) MaxAge() time.Duration {
+	return time.Hour
+}
+
+func TestBackfill(t *testing.T) {
+	now := time.Now()
+	snapAt := func(t time.Time) *appmetrics.Snapshot {
+		return appmetrics.NewSnapshotAt(rmetric.RuntimeStats{NumGoroutine: 8}, system.SystemStats{}, t)
+	}
+	snaps := []*appmetrics.Snapshot{snapAt(now.Add(-time.Minute)), snapAt(now.Add(-2 * time.Hour)), snapAt(now.Add(-2 * time.Minute))}
+
+	s := &limitedSink{}
+	p := NewPusher("memory", s)
+	defer p.Close()
+	skipped, err := p.Backfill(context.Background(), snaps)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, skipped)
+	assert.Equal(t, int64(2), p.Stats().Writes)
+
+	// written in chronological order with the time of the snapshots
+	assert.True(t, s.points[0].Time.Equal(now.Add(-2*time.Minute)))
+	assert.True(t, s.points[len(s.points)-1].Time.Equal(now.Add(-time.Minute)))
+
+	s.err = errors.New("unavailable")
+	_, err = p.Backfill(context.Background(), snaps)
+	assert.Error(t, err)
+	assert.Equal(t, int64(3), p.Stats().Writes)
+}
+
+func TestAttach(t *testing.T) {
+	r := appmetrics.NewRunner(nil)
+	r.CollectInterval = 10 * time.Millisecond
+	r.System.EnableDisk = false
+	r.System.EnableNet = false
+
+	s := &memorySink{}
+	p := NewPusher("memory", s)
+	detach := p.Attach(r, 100*time.Millisecond)
+	time.Sleep(350 * time.Millisecond)
+
+	// the loop collects every 10ms, and pull-based users get its latest snapshot
+	snap := r.Demand()
+	assert.False(t, snap.Time.IsZero())
+	detach()
+	detach()
+	p.Close()
+
+	writes := p.Stats().Writes
+	assert.True(t, writes >= 2 && writes <= 4, writes)
+}
+
+type batchingSink struct {
+	memorySink
+	writes []int
+}
+
+func (s *batchingSink) Write(ctx context.Context, points []Point) error {
+	s.mu.Lock()
+	s.writes = append(s.writes, len(points))
+	s.mu.Unlock()
+	return s.memorySink.Write(ctx, points)
+}
+
+func (s *batchingSink) FlushInterval() time.Duration {
+	return time.Hour
+}
+
+func (s *batchingSink) BatchSize() int {
+	return 10
+}
+
+func TestFlushInterval(t *testing.T) {
+	s := &batchingSink{}
+	p := NewPusher("memory", s)
+	assert.Equal(t, time.Hour, p.FlushInterval)
+	assert.Equal(t, 10, p.BatchSize)
+
+	for i := 1; i <= 3; i++ {
+		sstats := system.SystemStats{BandwidthStat: map[string]system.BandwidthStat{"eth0": {BytesSent: uint64(i * 100)}}}
+		sstats.MemStat.Used = uint64(i)
+		sstats.CPUPercent = float64(i * 10)
+		p.Handle(appmetrics.NewSnapshot(rmetric.RuntimeStats{NumGoroutine: int64(i)}, sstats))
+	}
+	assert.Empty(t, s.points)
+	p.Close()
+
+	byName := make(map[string]Point)
+	for _, p := range s.points {
+		byName[p.Name] = p
+	}
+	assert.Equal(t, 600.0, byName["system.net.eth0.bytes_sent"].Value)
+	assert.Equal(t, 20.0, byName["system.cpu.percent"].Value)
+	assert.Equal(t, 3.0, byName["system.mem.used"].Value)
+	assert.Equal(t, 3.0, byName["runtime.cpu.goroutines"].Value)
+
+	// the points of one flush are written in batches
+	assert.True(t, len(s.writes) > 1)
+	for _, n := range s.writes {
+		assert.True(t, n <= 10, n)
+	}
+	assert.Equal(t, int64(len(s.writes)), p.Stats().Writes)
+	assert.Equal(t, int64(len(s.points)), p.Stats().Points)
+
+	// dropped after Close
+	p.Handle(testSnapshot())
+	p.Close()
+	assert.Equal(t, int64(len(s.writes)), p.Stats().Writes)
+}
+
+func TestBatches(t *testing.T) {
+	points := make([]Point, 5)
+	assert.Len(t, batches(points, 0), 1)
+	assert.Len(t, batches(points, 5), 1)
+	bs := batches(points, 2)
+	assert.Len(t, bs, 3)
+	assert.Len(t, bs[2], 1)
+}
+
+// failingSink fails the writes numbered in fail, counting from 1.
+type failingSink struct {
+	memorySink
+	writes int
+	fail   map[int]bool
+}
+
+func (s *failingSink) Write(ctx context.Context, points []Point) error {
+	s.writes++
+	if s.fail[s.writes] {
+		return errors.New("unavailable")
+	}
+	return s.memorySink.Write(ctx, points)
+}
+
+func TestWriteFailedBatch(t *testing.T) {
+	s := &failingSink{fail: map[int]bool{2: true}}
+	p := NewPusher("failing", s)
+	p.BatchSize = 2
+
+	points := make([]Point, 5)
+	for i := range points {
+		points[i] = Point{Name: "p", Value: float64(i)}
+	}
+	err := p.writePoints(context.Background(), points)
+	assert.EqualError(t, err, "unavailable")
+	assert.Equal(t, 3, s.writes)
+	assert.Len(t, s.points, 3)
+	assert.Equal(t, 4.0, s.points[2].Value)
+
+	stats := p.Stats()
+	assert.Equal(t, int64(3), stats.Writes)
+	assert.Equal(t, int64(1), stats.Failures)
+}
+
+func TestPusherScale(t *testing.T) {
+	s := &memorySink{}
+	p := NewPusher("memory", s)
+	p.Scale = units.Scale{Bytes: units.KiB}
+	snap := testSnapshot()
+	snap.System.MemStat.Total = 2048
+	_, err := p.Backfill(context.Background(), []*appmetrics.Snapshot{snap})
+	assert.Nil(t, err)
+
+	values := make(map[string]float64, len(s.points))
+	for _, point := range s.points {
+		values[point.Name] = point.Value
+	}
+	assert.Equal(t, 2.0, values["system.mem.total"])
+	assert.Equal(t, 100.0/1024, values["runtime.mem.total"])
+	assert.Equal(t, 8.0, values["runtime.cpu.goroutines"])
+}
+
+func TestBudget(t *testing.T) {
+	b := &Budget{Priorities: map[string]int{"runtime.*": 10, "runtime.mem.gc.*": -1, "system.disk.*": 5}}
+	assert.Equal(t, 10, b.priority("runtime.cpu.goroutines"))
+	assert.Equal(t, -1, b.priority("runtime.mem.gc.count"))
+	// the points matching no pattern have the priority of their metric
+	assert.Equal(t, 0, b.priority("system.swap.total"))
+	assert.Equal(t, 1, b.priority("system.mem.total"))
+	assert.Equal(t, -1, b.priority("system.cpu.core0.user"))
+
+	s := &memorySink{}
+	p := NewPusher("memory", s)
+	b.MaxPoints = 3
+	p.Budget = b
+	snap := appmetrics.NewSnapshot(rmetric.RuntimeStats{NumGoroutine: 8},
+		system.SystemStats{DiskStat: map[string]system.DiskStat{"/": {Total: 10}}})
+	p.Handle(snap)
+	p.Close()
+
+	// the runtime points of priority 10 are kept first
+	assert.Len(t, s.points, 3)
+	for _, point := range s.points {
+		assert.Equal(t, 10, b.priority(point.Name), point.Name)
+	}
+	stats := p.Stats()
+	assert.Equal(t, int64(len(Points(snap, sanitize.Graphite))-3), stats.BudgetDropped)
+	assert.Contains(t, stats.DroppedSeries, "system.disk._root.total")
+	assert.Equal(t, int64(len(stats.DroppedSeries)), stats.Values()["sink.memory.budget.dropped_series"])
+
+	// admitted series stay admitted, even if a series of higher priority appears
+	var state budgetState
+	b = &Budget{MaxSeries: 2, Priorities: map[string]int{"c": 1}}
+	kept := state.apply(b, []Point{{Name: "a"}, {Name: "b"}})
+	assert.Len(t, kept, 2)
+	kept = state.apply(b, []Point{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+	assert.Equal(t, []Point{{Name: "a"}, {Name: "b"}}, kept)
+	assert.Equal(t, []string{"c"}, state.droppedSeries())
+}
@@ -0,0 +1,262 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spool is a Sink which buffers the points on disk while the underlying sink fails, e.g. during a
+// backend outage, and writes them in order once the sink recovers. The spool is capped by size and
+// the oldest points are dropped beyond it. Spooled points survive restarts when the same directory is used.
+// Points which the sink rejects permanently, see Retryable, and spooled points older than the MaxAge of
+// a sink implementing AgeLimiter are dropped, so they can't block the spool.
+type Spool struct {
+	name     string
+	dir      string
+	maxBytes int64
+	sink     Sink
+
+	mu       sync.Mutex
+	seq      int64
+	spooled  int64
+	drained  int64
+	dropped  int64
+	rejected int64
+	expired  int64
+}
+
+// NewSpool creates a Spool named name, which is used in metric keys, buffering the points which
+// couldn't be written to s in dir, up to maxBytes. The directory is created if it doesn't exist.
+func NewSpool(name, dir string, s Sink, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Spool{
+		name:     name,
+		dir:      dir,
+		maxBytes: maxBytes,
+		sink:     s,
+	}, nil
+}
+
+// Write drains the spooled points, then writes points to the underlying sink. If the sink fails,
+// the points are spooled and the error is returned. Points rejected permanently aren't spooled.
+func (s *Spool) Write(ctx context.Context, points []Point) error {
+	err := s.drain(ctx)
+	if err == nil {
+		err = s.sink.Write(ctx, points)
+		if err != nil && !Retryable(err) {
+			s.count(&s.rejected, int64(len(points)))
+			return err
+		}
+	}
+	if err != nil {
+		if serr := s.spool(points); serr != nil {
+			return fmt.Errorf("%w (spool: %v)", err, serr)
+		}
+	}
+	return err
+}
+
+// spoolFile is a file of spooled points, named <sequence>-<points>.json so the oldest ones sort first.
+type spoolFile struct {
+	name   string
+	points int64
+	size   int64
+}
+
+func (s *Spool) files() ([]spoolFile, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []spoolFile
+	for _, e := range entries {
+		var seq, n int64
+		if _, err := fmt.Sscanf(e.Name(), "%d-%d.json", &seq, &n); err != nil || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, spoolFile{name: e.Name(), points: n, size: info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+func (s *Spool) drain(ctx context.Context) error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		path := filepath.Join(s.dir, f.name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var points []Point
+		if err := json.Unmarshal(data, &points); err != nil {
+			// a corrupted file can never be written, drop it
+			os.Remove(path)
+			s.count(&s.dropped, f.points)
+			continue
+		}
+		points = s.unexpired(points)
+		if len(points) == 0 {
+			os.Remove(path)
+			continue
+		}
+		if err := s.sink.Write(ctx, points); err != nil {
+			if Retryable(err) {
+				return err
+			}
+			// retrying a rejected file would fail every following write
+			os.Remove(path)
+			s.count(&s.rejected, int64(len(points)))
+			continue
+		}
+		os.Remove(path)
+		s.count(&s.drained, int64(len(points)))
+	}
+	return nil
+}
+
+// unexpired returns the points which aren't older than the MaxAge of a sink implementing AgeLimiter,
+// and counts the others.
+func (s *Spool) unexpired(points []Point) []Point {
+	l, ok := s.sink.(AgeLimiter)
+	if !ok || l.MaxAge() <= 0 {
+		return points
+	}
+
+	oldest := time.Now().Add(-l.MaxAge())
+	kept := points[:0]
+	for _, p := range points {
+		if !p.Time.Before(oldest) {
+			kept = append(kept, p)
+		}
+	}
+	s.count(&s.expired, int64(len(points)-len(kept)))
+	return kept
+}
+
+func (s *Spool) spool(points []Point) error {
+	data, err := json.Marshal(points)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.seq == 0 {
+		s.seq = time.Now().UnixNano()
+	}
+	s.seq++
+	name := fmt.Sprintf("%020d-%d.json", s.seq, len(points))
+	s.mu.Unlock()
+
+	// write to a temporary file first, so a crash doesn't leave a partial file behind
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	s.count(&s.spooled, int64(len(points)))
+	return s.trim()
+}
+
+// trim removes the oldest files until the spool fits in maxBytes.
+func (s *Spool) trim() error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	for _, f := range files {
+		if total <= s.maxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(s.dir, f.name)); err != nil {
+			return err
+		}
+		total -= f.size
+		s.count(&s.dropped, f.points)
+	}
+	return nil
+}
+
+func (s *Spool) count(counter *int64, n int64) {
+	s.mu.Lock()
+	*counter += n
+	s.mu.Unlock()
+}
+
+// Stats returns the current stats of the Spool.
+func (s *Spool) Stats() SpoolStats {
+	stats := SpoolStats{Name: s.name}
+	if files, err := s.files(); err == nil {
+		for _, f := range files {
+			stats.Pending += f.points
+			stats.Bytes += f.size
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.Spooled = s.spooled
+	stats.Drained = s.drained
+	stats.Dropped = s.dropped
+	stats.Rejected = s.rejected
+	stats.Expired = s.expired
+	return stats
+}
+
+// SpoolStats represents the stats of a Spool.
+type SpoolStats struct {
+	Name string
+	// Pending and Bytes are the number of points and the bytes in the spool.
+	Pending int64
+	Bytes   int64
+
+	// Spooled, Drained and Dropped are the cumulative numbers of points spooled, written to the
+	// sink from the spool and dropped because the spool was full.
+	Spooled int64
+	Drained int64
+	Dropped int64
+	// Rejected and Expired are the cumulative numbers of points dropped because the sink rejected
+	// them permanently and because they were older than the MaxAge of the sink.
+	Rejected int64
+	Expired  int64
+}
+
+// Values returns metrics which you can write into TSDB, keyed as spool.<name>.<metric>.
+func (s *SpoolStats) Values() map[string]interface{} {
+	prefix := "spool." + s.Name + "."
+	return map[string]interface{}{
+		prefix + "pending": s.Pending,
+		prefix + "bytes":   s.Bytes,
+		prefix + "spooled": s.Spooled,
+		prefix + "drained": s.Drained,
+		prefix + "dropped": s.Dropped,
+
+		prefix + "rejected": s.Rejected,
+		prefix + "expired":  s.Expired,
+	}
+}
@@ -0,0 +1,108 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpool(t *testing.T) {
+	backend := &memorySink{err: errors.New("unavailable")}
+	s, err := NewSpool("graphite", t.TempDir(), backend, 1<<20)
+	assert.NoError(t, err)
+
+	ts := time.Unix(1700000000, 0).UTC()
+	batch := func(name string) []Point {
+		return []Point{{Name: name, Value: 1, Tags: map[string]string{"go.os": "linux"}, Time: ts}}
+	}
+
+	assert.Error(t, s.Write(context.Background(), batch("a")))
+	assert.Error(t, s.Write(context.Background(), batch("b")))
+	stats := s.Stats()
+	assert.Equal(t, int64(2), stats.Pending)
+	assert.Equal(t, int64(2), stats.Spooled)
+
+	backend.err = nil
+	assert.NoError(t, s.Write(context.Background(), batch("c")))
+
+	var names []string
+	for _, p := range backend.points {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+	assert.True(t, backend.points[0].Time.Equal(ts))
+
+	stats = s.Stats()
+	assert.Equal(t, int64(0), stats.Pending)
+	assert.Equal(t, int64(2), stats.Values()["spool.graphite.drained"])
+}
+
+func TestSpoolCap(t *testing.T) {
+	backend := &memorySink{err: errors.New("unavailable")}
+	s, err := NewSpool("graphite", t.TempDir(), backend, 150)
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		s.Write(context.Background(), []Point{{Name: "a", Value: float64(i), Time: time.Now()}})
+	}
+
+	stats := s.Stats()
+	assert.True(t, stats.Bytes <= 150)
+	assert.True(t, stats.Dropped > 0)
+	assert.Equal(t, stats.Spooled, stats.Pending+stats.Dropped)
+
+	backend.err = nil
+	assert.NoError(t, s.Write(context.Background(), nil))
+	assert.Equal(t, 4.0, backend.points[len(backend.points)-1].Value)
+}
+
+// rejectingSink rejects the points named bad permanently.
+type rejectingSink struct {
+	limitedSink
+}
+
+func (s *rejectingSink) Write(ctx context.Context, points []Point) error {
+	for _, p := range points {
+		if p.Name == "bad" && s.err == nil {
+			return &StatusError{Code: 400, Msg: "malformed"}
+		}
+	}
+	return s.limitedSink.Write(ctx, points)
+}
+
+func TestSpoolRejected(t *testing.T) {
+	backend := &rejectingSink{}
+	backend.err = &StatusError{Code: 503, Msg: "unavailable"}
+	s, err := NewSpool("influxdb", t.TempDir(), backend, 1<<20)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	assert.Error(t, s.Write(context.Background(), []Point{{Name: "bad", Time: now}}))
+	assert.Error(t, s.Write(context.Background(), []Point{{Name: "old", Time: now.Add(-2 * time.Hour)}, {Name: "a", Time: now}}))
+	assert.Equal(t, int64(3), s.Stats().Pending)
+
+	// the rejected and expired points are dropped instead of blocking the spool
+	backend.err = nil
+	assert.NoError(t, s.Write(context.Background(), []Point{{Name: "b", Time: now}}))
+	assert.Len(t, backend.points, 2)
+	stats := s.Stats()
+	assert.Equal(t, int64(0), stats.Pending)
+	assert.Equal(t, int64(1), stats.Rejected)
+	assert.Equal(t, int64(1), stats.Expired)
+
+	// a new rejected write isn't spooled
+	assert.Error(t, s.Write(context.Background(), []Point{{Name: "bad", Time: now}}))
+	stats = s.Stats()
+	assert.Equal(t, int64(0), stats.Pending)
+	assert.Equal(t, int64(2), stats.Values()["spool.influxdb.rejected"])
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, Retryable(errors.New("connection refused")))
+	assert.True(t, Retryable(&StatusError{Code: 429}))
+	assert.True(t, Retryable(&StatusError{Code: 502}))
+	assert.False(t, Retryable(&StatusError{Code: 400}))
+}
@@ -0,0 +1,219 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Transport is the connection config of push sinks: TLS with client certificates and a CA override,
+// bearer or basic auth and a proxy. Configure it once and apply it to all sinks:
+//
+//	t := &sink.Transport{CAFile: "/etc/ssl/metrics-ca.pem", BearerToken: token}
+//	if err := t.Apply(opentsdbSink, graphiteSink); err != nil { ... }
+//
+// The methods accept a nil Transport, which means plain connections without auth.
+type Transport struct {
+	// TLS enables TLS. It is implied by https URLs of HTTP sinks.
+	TLS bool
+	// CertFile and KeyFile are the client certificate and key, CAFile overrides the system roots.
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	// ServerName overrides the name used to verify the server certificate.
+	ServerName         string
+	InsecureSkipVerify bool
+
+	// BearerToken, or Username and Password for basic auth, authorize the requests of HTTP sinks.
+	// They override the auth of the sink, e.g. an API key sent as bearer token.
+	BearerToken string
+	Username    string
+	Password    string
+
+	// Proxy is the URL of an HTTP proxy. TCP sinks tunnel through it with CONNECT.
+	// HTTP sinks use the proxy of the environment if it is empty.
+	Proxy string
+}
+
+// Transporter is implemented by sinks whose connections are configured by a Transport.
+type Transporter interface {
+	SetTransport(t *Transport) error
+}
+
+// Apply sets t as the transport of the sinks. It fails if a sink doesn't implement Transporter.
+func (t *Transport) Apply(sinks ...Sink) error {
+	for _, s := range sinks {
+		ts, ok := s.(Transporter)
+		if !ok {
+			return fmt.Errorf("sink: %T doesn't support transports", s)
+		}
+		if err := ts.SetTransport(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TLSConfig returns the TLS config, or nil if TLS isn't configured.
+func (t *Transport) TLSConfig() (*tls.Config, error) {
+	if t == nil || !t.TLS && t.CertFile == "" && t.CAFile == "" && t.ServerName == "" && !t.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("sink: no certificates in %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// HTTPClient returns a client of HTTP sinks using the TLS config and the proxy.
+func (t *Transport) HTTPClient() (*http.Client, error) {
+	if t == nil {
+		return http.DefaultClient, nil
+	}
+
+	cfg, err := t.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = cfg
+	if t.Proxy != "" {
+		u, err := url.Parse(t.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+	return &http.Client{Transport: tr}, nil
+}
+
+// Authorize sets the Authorization header of req if bearer or basic auth is configured.
+func (t *Transport) Authorize(req *http.Request) {
+	switch {
+	case t == nil:
+	case t.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+t.BearerToken)
+	case t.Username != "":
+		req.SetBasicAuth(t.Username, t.Password)
+	}
+}
+
+// Dial connects to addr over TCP for TCP sinks, through the proxy and with TLS if they are configured.
+func (t *Transport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	if t == nil {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+
+	cfg, err := t.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if t.Proxy != "" {
+		conn, err = t.dialProxy(ctx, &d, addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil || cfg == nil {
+		return conn, err
+	}
+
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tc := tls.Client(conn, cfg)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// dialProxy opens a tunnel to addr through the HTTP proxy with CONNECT.
+func (t *Transport) dialProxy(ctx context.Context, d *net.Dialer, addr string) (net.Conn, error) {
+	u, err := url.Parse(t.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("sink: proxy %s: %s", u.Host, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// the server already sent data through the tunnel
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose first bytes have been read into r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,87 @@
+package sink
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportHTTP(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		w.Write([]byte(user + ":" + password))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, pemData, 0o644))
+
+	tr := &Transport{CAFile: caFile, Username: "user", Password: "secret"}
+	client, err := tr.HTTPClient()
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	tr.Authorize(req)
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "user:secret", string(body))
+
+	_, err = (&Transport{CAFile: filepath.Join(t.TempDir(), "missing.pem")}).HTTPClient()
+	assert.Error(t, err)
+}
+
+func TestTransportDialProxy(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer backend.Close()
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("hello"))
+		conn.Close()
+	}()
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodConnect, r.Method)
+		assert.Equal(t, "Basic dTpw", r.Header.Get("Proxy-Authorization"))
+		conn, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		client, _, _ := w.(http.Hijacker).Hijack()
+		client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		io.Copy(client, conn)
+		client.Close()
+	}))
+	defer proxy.Close()
+
+	tr := &Transport{Proxy: "http://u:p@" + proxy.Listener.Addr().String()}
+	conn, err := tr.Dial(context.Background(), backend.Addr().String())
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(conn)
+	conn.Close()
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestTransportApply(t *testing.T) {
+	assert.Error(t, (&Transport{}).Apply(&memorySink{}))
+
+	var nilTransport *Transport
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	nilTransport.Authorize(req)
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
@@ -0,0 +1,137 @@
+// Package wavefront provides a sink writing the Wavefront data format to the proxy port of a
+// Wavefront (VMware Aria Operations for Applications) proxy, 2878 by default:
+//
+//	<metricName> <metricValue> <timestamp> source=<source> [pointTags]
+package wavefront
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/smallnest/go-app-metrics/sink"
+)
+
+// Sink writes points to a Wavefront proxy over TCP. The connection is kept open between writes
+// and reopened after an error.
+type Sink struct {
+	// Prefix is prepended to the metric names, e.g. "myapp.". Defaults to "".
+	Prefix string
+	// Tags are added to the point tags of every point, overriding the tags of the points.
+	Tags map[string]string
+
+	addr      string
+	source    string
+	conn      net.Conn
+	transport *sink.Transport
+}
+
+// New creates a Sink writing to the proxy at addr, e.g. "wavefront-proxy:2878". The points are
+// reported from source, which defaults to the host name if it is empty.
+func New(addr, source string) *Sink {
+	if source == "" {
+		source, _ = os.Hostname()
+	}
+	return &Sink{addr: addr, source: source}
+}
+
+// Write writes the points in one batch.
+func (s *Sink) Write(ctx context.Context, points []sink.Point) error {
+	var buf bytes.Buffer
+	for _, p := range points {
+		s.appendPoint(&buf, p)
+	}
+
+	if s.conn == nil {
+		conn, err := s.transport.Dial(ctx, s.addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+// SetTransport sets the TLS and proxy config of the connection, it implements sink.Transporter.
+func (s *Sink) SetTransport(t *sink.Transport) error {
+	if _, err := t.TLSConfig(); err != nil {
+		return err
+	}
+	s.Close()
+	s.transport = t
+	return nil
+}
+
+// Close closes the connection to the proxy.
+func (s *Sink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Sink) appendPoint(buf *bytes.Buffer, p sink.Point) {
+	buf.WriteString(quote(s.Prefix + p.Name))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(p.Value, 'g', -1, 64))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(p.Time.Unix(), 10))
+	buf.WriteString(" source=")
+	buf.WriteString(quote(s.source))
+
+	tags := make(map[string]string, len(p.Tags)+len(s.Tags))
+	for k, v := range p.Tags {
+		tags[k] = v
+	}
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		// wavefront rejects empty tag values
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.WriteByte(' ')
+		buf.WriteString(tagKey(k))
+		buf.WriteByte('=')
+		buf.WriteString(quote(tags[k]))
+	}
+	buf.WriteByte('\n')
+}
+
+var quoteReplacer = strings.NewReplacer(`"`, `\"`, "\n", " ")
+
+func quote(s string) string {
+	return `"` + quoteReplacer.Replace(s) + `"`
+}
+
+// tagKey replaces the characters which are not allowed in point tag keys with '_'.
+func tagKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, k)
+}
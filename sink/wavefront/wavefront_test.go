@@ -0,0 +1,46 @@
+package wavefront
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSink(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	lines := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	s := New(l.Addr().String(), "web-1")
+	s.Prefix = "app."
+	s.Tags = map[string]string{"env": "prod"}
+	defer s.Close()
+
+	ts := time.Unix(1700000000, 0)
+	err = s.Write(context.Background(), []sink.Point{
+		{Name: "system.cpu.user", Value: 12.5, Tags: map[string]string{"go.os": "linux", "empty": ""}, Time: ts},
+		{Name: "runtime.cpu.goroutines", Value: 8, Time: ts},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, `"app.system.cpu.user" 12.5 1700000000 source="web-1" env="prod" go.os="linux"`, <-lines)
+	assert.Equal(t, `"app.runtime.cpu.goroutines" 8 1700000000 source="web-1" env="prod"`, <-lines)
+}
@@ -0,0 +1,216 @@
+// Package slo provides method to calculate SLO burn rates from collected metrics.
+//
+// An SLI is defined over the Values() of collected stats. Every sample is fed into an SLO, which
+// keeps the history needed for the burn rates of multiple windows and evaluates multiwindow alert rules.
+package slo
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/value"
+)
+
+// SLI returns the cumulative number of good events and total events from a sample of metrics.
+// It returns false if the sample doesn't contain the metrics of the SLI.
+type SLI func(values map[string]interface{}) (good, total float64, ok bool)
+
+// ErrorRatio returns an SLI from cumulative counters of errors and total requests.
+func ErrorRatio(errorsKey, totalKey string) SLI {
+	return func(values map[string]interface{}) (float64, float64, bool) {
+		errs, ok := value.Float64(values[errorsKey])
+		if !ok {
+			return 0, 0, false
+		}
+		total, ok := value.Float64(values[totalKey])
+		if !ok {
+			return 0, 0, false
+		}
+		return total - errs, total, true
+	}
+}
+
+// Threshold returns an SLI which treats each sample as an event, which is good if the value of key
+// is not greater than max, e.g. a latency percentile. The returned SLI must be used by one SLO only.
+func Threshold(key string, max float64) SLI {
+	var mu sync.Mutex
+	var good, total float64
+	return func(values map[string]interface{}) (float64, float64, bool) {
+		v, ok := value.Float64(values[key])
+		if !ok {
+			return 0, 0, false
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		total++
+		if v <= max {
+			good++
+		}
+		return good, total, true
+	}
+}
+
+// Rule is a multiwindow burn rate alert rule. It fires if the burn rates of both
+// the long and the short window exceed Factor.
+type Rule struct {
+	Name   string
+	Long   time.Duration
+	Short  time.Duration
+	Factor float64
+}
+
+// DefaultWindows are the default windows of burn rates.
+var DefaultWindows = []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour}
+
+// DefaultRules are the default alert rules: page on a fast burn and open a ticket on a slow burn.
+var DefaultRules = []Rule{
+	{Name: "page", Long: time.Hour, Short: 5 * time.Minute, Factor: 14.4},
+	{Name: "ticket", Long: 6 * time.Hour, Short: time.Hour, Factor: 6},
+}
+
+// SLO calculates burn rates of an SLI against an objective. It is safe for use from multiple go routines.
+type SLO struct {
+	// Name is used in metric keys.
+	Name string
+	// Objective is the target ratio of good events, e.g. 0.999.
+	Objective float64
+	// Windows are the windows to calculate burn rates. Defaults to DefaultWindows.
+	Windows []time.Duration
+	// Rules are the alert rules. Defaults to DefaultRules.
+	Rules []Rule
+
+	sli     SLI
+	mu      sync.Mutex
+	samples []sample
+}
+
+type sample struct {
+	t           time.Time
+	good, total float64
+}
+
+// New creates an SLO with the default windows and rules.
+func New(name string, objective float64, sli SLI) *SLO {
+	return &SLO{
+		Name:      name,
+		Objective: objective,
+		Windows:   DefaultWindows,
+		Rules:     DefaultRules,
+		sli:       sli,
+	}
+}
+
+// Observe feeds a sample of metrics collected at t. Samples which don't contain the SLI are ignored.
+func (s *SLO) Observe(t time.Time, values map[string]interface{}) {
+	good, total, ok := s.sli(values)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples = append(s.samples, sample{t: t, good: good, total: total})
+
+	retention := s.retention()
+	i := 0
+	for i < len(s.samples) && t.Sub(s.samples[i].t) > retention {
+		i++
+	}
+	s.samples = s.samples[i:]
+}
+
+func (s *SLO) retention() time.Duration {
+	var retention time.Duration
+	for _, w := range s.Windows {
+		if w > retention {
+			retention = w
+		}
+	}
+	for _, r := range s.Rules {
+		if r.Long > retention {
+			retention = r.Long
+		}
+	}
+	return retention
+}
+
+// burnRate returns the burn rate of window w. It must be called with s.mu held.
+func (s *SLO) burnRate(w time.Duration) float64 {
+	if len(s.samples) < 2 || s.Objective >= 1 {
+		return 0
+	}
+
+	last := s.samples[len(s.samples)-1]
+	first := last
+	for _, smp := range s.samples {
+		if last.t.Sub(smp.t) <= w {
+			first = smp
+			break
+		}
+	}
+
+	total := last.total - first.total
+	if total <= 0 {
+		return 0
+	}
+	bad := total - (last.good - first.good)
+	return bad / total / (1 - s.Objective)
+}
+
+// Status returns the current burn rates and alert states.
+func (s *SLO) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Status{
+		Name:      s.Name,
+		BurnRates: make(map[time.Duration]float64, len(s.Windows)),
+		Alerts:    make(map[string]bool, len(s.Rules)),
+	}
+	for _, w := range s.Windows {
+		st.BurnRates[w] = s.burnRate(w)
+	}
+	for _, r := range s.Rules {
+		st.Alerts[r.Name] = s.burnRate(r.Long) > r.Factor && s.burnRate(r.Short) > r.Factor
+	}
+	return st
+}
+
+// Status represents burn rates and alert states of an SLO.
+type Status struct {
+	Name      string
+	BurnRates map[time.Duration]float64
+	Alerts    map[string]bool
+}
+
+// Values returns metrics which you can write into TSDB,
+// keyed as slo.<name>.burn_rate.<window> and slo.<name>.alert.<rule>.
+func (st *Status) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(st.BurnRates)+len(st.Alerts))
+	for w, r := range st.BurnRates {
+		values["slo."+st.Name+".burn_rate."+windowName(w)] = r
+	}
+	for name, firing := range st.Alerts {
+		var v int64
+		if firing {
+			v = 1
+		}
+		values["slo."+st.Name+".alert."+name] = v
+	}
+	return values
+}
+
+// windowName formats durations like 5m, 1h and 1h30m.
+func windowName(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+package slo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorRatio(t *testing.T) {
+	s := New("api", 0.99, ErrorRatio("http.errors", "http.requests"))
+
+	start := time.Now()
+	var errs, total int64
+	for i := 0; i <= 60; i++ {
+		s.Observe(start.Add(time.Duration(i)*time.Minute), map[string]interface{}{
+			"http.errors":   errs,
+			"http.requests": total,
+		})
+		total += 100
+		if i >= 55 {
+			// 20% errors in the last 5 minutes
+			errs += 20
+		} else {
+			errs++
+		}
+	}
+
+	st := s.Status()
+	assert.InDelta(t, 20.0, st.BurnRates[5*time.Minute], 1e-9)
+	assert.InDelta(t, (55+100)/6000.0/0.01, st.BurnRates[time.Hour], 1e-9)
+	assert.False(t, st.Alerts["page"])
+
+	values := st.Values()
+	assert.Contains(t, values, "slo.api.burn_rate.5m")
+	assert.Contains(t, values, "slo.api.burn_rate.6h")
+	assert.Equal(t, int64(0), values["slo.api.alert.page"])
+}
+
+func TestThresholdAlert(t *testing.T) {
+	s := New("latency", 0.9, Threshold("http.p99", 0.5))
+
+	start := time.Now()
+	for i := 0; i <= 120; i++ {
+		s.Observe(start.Add(time.Duration(i)*time.Minute), map[string]interface{}{"http.p99": 1.0})
+	}
+	s.Observe(start, map[string]interface{}{"other": 1.0})
+
+	st := s.Status()
+	assert.InDelta(t, 10.0, st.BurnRates[time.Hour], 1e-9)
+	assert.False(t, st.Alerts["page"])
+	assert.True(t, st.Alerts["ticket"])
+}
+
+func TestWindowName(t *testing.T) {
+	assert.Equal(t, "5m", windowName(5*time.Minute))
+	assert.Equal(t, "1h", windowName(time.Hour))
+	assert.Equal(t, "1h30m", windowName(90*time.Minute))
+	assert.Equal(t, "30s", windowName(30*time.Second))
+}
@@ -0,0 +1,252 @@
+// Package appmetrics combines the go runtime stats and the system stats into snapshots.
+package appmetrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/system"
+)
+
+// Snapshot represents the go runtime stats and the system stats collected at the same time.
+// A snapshot delivered by a Runner is immutable, use Clone to get a copy which can be modified.
+type Snapshot struct {
+	Runtime rmetric.RuntimeStats
+	System  system.SystemStats
+	// Time is when the stats were collected.
+	Time time.Time
+	// Elapsed is the time since the previous collection, which the stats since the previous collection,
+	// such as the bandwidth, cover. It is the Elapsed of the system stats, zero for the first collection.
+	Elapsed time.Duration
+	// Tags are the dynamic tags set by Runner.SetTag when the stats were collected, e.g. role=leader.
+	// They are nil if no tag has been set.
+	Tags map[string]string
+	// CriticalOnly reports whether only the critical metrics of the snapshot are exported, see
+	// metadata.Critical. It is set by the "minimal" profile. It is honored by sink.Points, the full
+	// stats stay available to the code reading the snapshot.
+	CriticalOnly bool
+
+	once          sync.Once
+	runtimeValues map[string]interface{}
+	systemValues  map[string]interface{}
+}
+
+// NewSnapshot creates a Snapshot of runtime stats and system stats collected now.
+func NewSnapshot(rstats rmetric.RuntimeStats, sstats system.SystemStats) *Snapshot {
+	return NewSnapshotAt(rstats, sstats, time.Now())
+}
+
+// NewSnapshotAt creates a Snapshot of runtime stats and system stats collected at t, e.g. when
+// replaying stats recorded earlier. Sinks write the points of the snapshot with t as their time.
+func NewSnapshotAt(rstats rmetric.RuntimeStats, sstats system.SystemStats, t time.Time) *Snapshot {
+	return &Snapshot{
+		Runtime: rstats,
+		System:  sstats,
+		Time:    t,
+		Elapsed: sstats.Elapsed,
+	}
+}
+
+// Clone returns a deep copy of the snapshot.
+func (s *Snapshot) Clone() *Snapshot {
+	return &Snapshot{
+		Runtime: s.Runtime.DeepCopy(),
+		System:  s.System.DeepCopy(),
+		Time:    s.Time,
+		Elapsed: s.Elapsed,
+		Tags:    copyTags(s.Tags),
+
+		CriticalOnly: s.CriticalOnly,
+	}
+}
+
+// AllTags returns the tags of the runtime stats, such as go.os, the tags of the system stats and
+// the dynamic Tags, which take precedence.
+func (s *Snapshot) AllTags() map[string]string {
+	tags := s.Runtime.Tags()
+	for k, v := range s.System.Tags() {
+		tags[k] = v
+	}
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// Age returns the time since the stats were collected.
+func (s *Snapshot) Age() time.Duration {
+	return time.Since(s.Time)
+}
+
+// Stale reports whether the stats are older than maxAge, e.g. because the collection has stalled.
+// It always returns false if maxAge is not positive.
+func (s *Snapshot) Stale(maxAge time.Duration) bool {
+	return maxAge > 0 && s.Age() > maxAge
+}
+
+func (s *Snapshot) values() (map[string]interface{}, map[string]interface{}) {
+	s.once.Do(func() {
+		s.runtimeValues = s.Runtime.Values()
+		s.systemValues = s.System.Values()
+	})
+	return s.runtimeValues, s.systemValues
+}
+
+// lookup returns the value of key, runtime stats take precedence over system stats.
+func (s *Snapshot) lookup(key string) (interface{}, bool) {
+	rv, sv := s.values()
+	if v, ok := rv[key]; ok {
+		return v, true
+	}
+	v, ok := sv[key]
+	return v, ok
+}
+
+// Number is the constraint of the types Get can convert values to.
+type Number interface {
+	~int | ~int64 | ~uint64 | ~float64
+}
+
+// Get returns the value of key converted to T, so callers don't need to type-assert the values
+// of Values(). It returns false if key doesn't exist or isn't numeric. Keys of the runtime stats
+// take precedence, so mem.total is the cumulative allocation of the go runtime;
+// use Mem().HostTotal for the physical memory.
+func Get[T Number](s *Snapshot, key string) (T, bool) {
+	v, ok := s.lookup(key)
+	if !ok {
+		return 0, false
+	}
+
+	switch n := v.(type) {
+	case int64:
+		return T(n), true
+	case uint64:
+		return T(n), true
+	case float64:
+		return T(n), true
+	case int:
+		return T(n), true
+	default:
+		return 0, false
+	}
+}
+
+// Rate returns the value of key, a stat since the previous collection such as net.total.bytes_sent,
+// per second of Elapsed. It returns false if key doesn't exist or isn't numeric, or Elapsed is zero.
+func (s *Snapshot) Rate(key string) (float64, bool) {
+	v, ok := Get[float64](s, key)
+	if !ok || s.Elapsed <= 0 {
+		return 0, false
+	}
+	return v / s.Elapsed.Seconds(), true
+}
+
+// CPUView represents CPU stats of the go runtime and the host.
+type CPUView struct {
+	NumCPU       int64
+	NumThread    int64
+	NumGoroutine int64
+	NumCgoCall   int64
+
+	User   float64
+	System float64
+	Idle   float64
+	Iowait float64
+}
+
+// CPU returns CPU stats of the go runtime and the host.
+func (s *Snapshot) CPU() CPUView {
+	return CPUView{
+		NumCPU:       s.Runtime.NumCPU,
+		NumThread:    s.Runtime.NumThread,
+		NumGoroutine: s.Runtime.NumGoroutine,
+		NumCgoCall:   s.Runtime.NumCgoCall,
+		User:         s.System.CPUStat.User,
+		System:       s.System.CPUStat.System,
+		Idle:         s.System.CPUStat.Idle,
+		Iowait:       s.System.CPUStat.Iowait,
+	}
+}
+
+// MemView represents memory stats of the go runtime and the host.
+type MemView struct {
+	Alloc        int64
+	TotalAlloc   int64
+	Sys          int64
+	HeapAlloc    int64
+	HeapSys      int64
+	HeapIdle     int64
+	HeapInuse    int64
+	HeapReleased int64
+	HeapObjects  int64
+	StackInuse   int64
+	StackSys     int64
+
+	HostTotal     uint64
+	HostAvailable uint64
+	HostUsed      uint64
+	SwapTotal     uint64
+	SwapFree      uint64
+	SwapUsed      uint64
+}
+
+// Mem returns memory stats of the go runtime and the host.
+func (s *Snapshot) Mem() MemView {
+	return MemView{
+		Alloc:         s.Runtime.Alloc,
+		TotalAlloc:    s.Runtime.TotalAlloc,
+		Sys:           s.Runtime.Sys,
+		HeapAlloc:     s.Runtime.HeapAlloc,
+		HeapSys:       s.Runtime.HeapSys,
+		HeapIdle:      s.Runtime.HeapIdle,
+		HeapInuse:     s.Runtime.HeapInuse,
+		HeapReleased:  s.Runtime.HeapReleased,
+		HeapObjects:   s.Runtime.HeapObjects,
+		StackInuse:    s.Runtime.StackInuse,
+		StackSys:      s.Runtime.StackSys,
+		HostTotal:     s.System.MemStat.Total,
+		HostAvailable: s.System.MemStat.Available,
+		HostUsed:      s.System.MemStat.Used,
+		SwapTotal:     s.System.SwapMemStat.Total,
+		SwapFree:      s.System.SwapMemStat.Free,
+		SwapUsed:      s.System.SwapMemStat.Used,
+	}
+}
+
+// GCView represents garbage collection stats of the go runtime.
+type GCView struct {
+	Sys          int64
+	NextGC       int64
+	LastGC       int64
+	PauseTotalNs int64
+	PauseNs      int64
+	NumGC        int64
+	CPUFraction  float64
+}
+
+// GC returns garbage collection stats of the go runtime.
+func (s *Snapshot) GC() GCView {
+	return GCView{
+		Sys:          s.Runtime.GCSys,
+		NextGC:       s.Runtime.NextGC,
+		LastGC:       s.Runtime.LastGC,
+		PauseTotalNs: s.Runtime.PauseTotalNs,
+		PauseNs:      s.Runtime.PauseNs,
+		NumGC:        s.Runtime.NumGC,
+		CPUFraction:  s.Runtime.GCCPUFraction,
+	}
+}
+
+// Disk returns the stats of the partition, which is a mountpoint or a device
+// if system.Collector.GroupDiskByDevice is enabled.
+func (s *Snapshot) Disk(partition string) (system.DiskStat, bool) {
+	stat, ok := s.System.DiskStat[partition]
+	return stat, ok
+}
+
+// Net returns the bandwidth stats of the network interface.
+func (s *Snapshot) Net(iface string) (system.BandwidthStat, bool) {
+	stat, ok := s.System.BandwidthStat[iface]
+	return stat, ok
+}
@@ -0,0 +1,93 @@
+package appmetrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/system"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSnapshot() *Snapshot {
+	rstats := rmetric.RuntimeStats{HeapAlloc: 100, TotalAlloc: 1000, NumGC: 3, GCCPUFraction: 0.5}
+	sstats := system.SystemStats{
+		DiskStat:      map[string]system.DiskStat{"/": {Total: 10, Free: 5}},
+		BandwidthStat: map[string]system.BandwidthStat{"eth0": {BytesSent: 7}},
+	}
+	sstats.MemStat.Total = 2000
+	return NewSnapshot(rstats, sstats)
+}
+
+func TestGet(t *testing.T) {
+	snap := testSnapshot()
+
+	heap, ok := Get[int64](snap, "mem.heap.alloc")
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), heap)
+
+	// conversions between numeric kinds
+	free, ok := Get[float64](snap, "disk./.free")
+	assert.True(t, ok)
+	assert.Equal(t, 5.0, free)
+	frac, ok := Get[float64](snap, "mem.gc.cpu_fraction")
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, frac)
+	sent, ok := Get[int](snap, "net.eth0.bytes_sent")
+	assert.True(t, ok)
+	assert.Equal(t, 7, sent)
+
+	// runtime stats take precedence
+	total, ok := Get[uint64](snap, "mem.total")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1000), total)
+
+	_, ok = Get[int64](snap, "unknown")
+	assert.False(t, ok)
+}
+
+func TestViews(t *testing.T) {
+	snap := testSnapshot()
+
+	assert.Equal(t, int64(100), snap.Mem().HeapAlloc)
+	assert.Equal(t, uint64(2000), snap.Mem().HostTotal)
+	assert.Equal(t, int64(3), snap.GC().NumGC)
+
+	disk, ok := snap.Disk("/")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(10), disk.Total)
+	_, ok = snap.Disk("/data")
+	assert.False(t, ok)
+
+	net, ok := snap.Net("eth0")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(7), net.BytesSent)
+}
+
+func TestStale(t *testing.T) {
+	snap := testSnapshot()
+	assert.False(t, snap.Stale(time.Minute))
+	assert.False(t, snap.Stale(0))
+
+	snap.Time = time.Now().Add(-2 * time.Minute)
+	assert.True(t, snap.Stale(time.Minute))
+	assert.True(t, snap.Age() >= 2*time.Minute)
+}
+
+func TestRate(t *testing.T) {
+	sstats := system.SystemStats{
+		BandwidthStat: map[string]system.BandwidthStat{"eth0": {BytesSent: 3000}},
+		Elapsed:       1500 * time.Millisecond,
+	}
+	s := NewSnapshot(rmetric.RuntimeStats{}, sstats)
+	assert.Equal(t, 1500*time.Millisecond, s.Elapsed)
+
+	rate, ok := s.Rate("net.eth0.bytes_sent")
+	assert.True(t, ok)
+	assert.Equal(t, 2000.0, rate)
+	assert.Equal(t, 2000.0, sstats.Rate(sstats.BandwidthStat["eth0"].BytesSent))
+
+	s.Elapsed = 0
+	_, ok = s.Rate("net.eth0.bytes_sent")
+	assert.False(t, ok)
+}
@@ -1,45 +1,167 @@
 package stat
 
 import (
+	"encoding/json"
 	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/smallnest/go-app-metrics/rmetric"
-	"github.com/smallnest/go-app-metrics/system"
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/smallnest/go-app-metrics/internal/promfmt"
+	"github.com/smallnest/go-app-metrics/status"
+	"github.com/smallnest/go-app-metrics/units"
 )
 
 func init() {
 	http.HandleFunc("/debug/stats/", Stats)
+	http.HandleFunc("/debug/stats/status", Status)
+	http.Handle("/debug/stats/prometheus", PrometheusHandler())
 }
 
-// Stats responds with system stats and go runtime stats.
+// Start starts sampling the stats of appmetrics.Default every interval in the background, so Stats
+// responds with the latest snapshot immediately. Every call must be paired with a call to Stop.
+// Without Start, the sampling is started by the first request and stops when there are no requests.
+func Start(interval time.Duration) {
+	r := appmetrics.Default()
+	r.SetInterval(interval)
+	r.Start()
+}
+
+// Stop releases a Start.
+func Stop() {
+	appmetrics.Default().Stop()
+}
+
+// Stats responds with system stats and go runtime stats of the latest snapshot of appmetrics.Default.
 // Each metric is a line and has key=value format.
+// The optional parameter seconds is the max staleness, a snapshot older than that is collected anew
+// without being handed to the handlers of the runner. It is at least the collection interval, so
+// requests can't make the stats collected more often than configured.
+// The optional parameters bytes (B, KiB, MiB, GiB) and durations (ns, us, ms, s) scale the values.
+//
+// With format=json, or an Accept header of application/json, it responds with the stats as a JSON
+// document instead, encoded like appmetrics.Snapshot with the runtime and system stats and their tags.
+// The JSON stats are structured and not scaled.
 func Stats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
-	sec, err := strconv.ParseInt(r.FormValue("seconds"), 10, 64)
-	if sec <= 0 || err != nil {
-		sec = 30
+	asJSON, err := wantsJSON(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	c := rmetric.New(nil)
-	sc := system.New(nil)
+	var scale units.Scale
+	if scale.Bytes, err = units.ParseByteUnit(r.FormValue("bytes")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if scale.Durations, err = units.ParseDurationUnit(r.FormValue("durations")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	time.Sleep(time.Duration(sec) * time.Second)
+	var maxAge time.Duration
+	if sec, err := strconv.ParseInt(r.FormValue("seconds"), 10, 64); err == nil && sec > 0 {
+		maxAge = time.Duration(sec) * time.Second
+	}
 
-	rstats := c.Once()
-	sstats := sc.Once()
+	runner := appmetrics.Default()
+	if interval := runner.Interval(); maxAge > 0 && maxAge < interval {
+		maxAge = interval
+	}
+	snap := runner.Demand()
+	if snap.Stale(maxAge) {
+		snap = runner.Once()
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(snap, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(data)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rvalues := snap.Runtime.Values()
+	scale.Apply(rvalues)
+	svalues := snap.System.Values()
+	scale.Apply(svalues)
 
 	var buf strings.Builder
-	for k, v := range rstats.Values() {
+	for k, v := range rvalues {
 		buf.WriteString(fmt.Sprintf("%s=%v\n", k, v))
 	}
-	for k, v := range sstats.Values() {
+	for k, v := range svalues {
 		buf.WriteString(fmt.Sprintf("%s=%v\n", k, v))
 	}
 	w.Write([]byte(buf.String()))
 }
+
+// wantsJSON reports whether r asks for JSON by the format parameter, which takes precedence,
+// or by the Accept header.
+func wantsJSON(r *http.Request) (bool, error) {
+	switch format := r.FormValue("format"); format {
+	case "json":
+		return true, nil
+	case "text":
+		return false, nil
+	case "":
+	default:
+		return false, fmt.Errorf("unknown format %q, expected json or text", format)
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accept); err == nil && mediaType == "application/json" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Status responds with the states of the collectors of appmetrics.Default, which Stats serves,
+// and of the collectors registered to package status in JSON.
+func Status(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	all := append(appmetrics.Default().Status(), status.All()...)
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+// PrometheusNamespace is the namespace of the metrics served by PrometheusHandler.
+const PrometheusNamespace = "app"
+
+// PrometheusHandler returns a handler responding with the stats of appmetrics.Default in the Prometheus
+// text exposition format, so services can be scraped without the Prometheus client library.
+// The metrics are named like package prometheus does, e.g. app_runtime_cpu_goroutines and
+// app_system_disk_free_bytes{partition="/var"}.
+func PrometheusHandler() http.Handler {
+	return NewPrometheusHandler(appmetrics.Default(), PrometheusNamespace)
+}
+
+// NewPrometheusHandler returns a handler responding with the stats of r in the Prometheus text exposition
+// format, naming the metrics <namespace>_runtime_* and <namespace>_system_*. Every request uses r.Demand,
+// so r collects while it is scraped. The dynamic tags of the snapshot, see Runner.SetTag, label all metrics.
+func NewPrometheusHandler(r *appmetrics.Runner, namespace string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		snap := r.Demand()
+		samples := append(promfmt.Runtime(namespace, &snap.Runtime), promfmt.System(namespace, &snap.System)...)
+		promfmt.AddLabels(samples, snap.Tags)
+
+		w.Header().Set("Content-Type", promfmt.ContentType)
+		promfmt.WriteText(w, samples)
+	})
+}
@@ -1,11 +1,16 @@
 package stat
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	appmetrics "github.com/smallnest/go-app-metrics"
+	"github.com/smallnest/go-app-metrics/rmetric"
+	"github.com/smallnest/go-app-metrics/status"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,3 +40,102 @@ func TestStats(t *testing.T) {
 		assert.Contains(t, stats, k)
 	}
 }
+
+func TestStatsJSON(t *testing.T) {
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/debug/stats?seconds=1&format=json", nil),
+		httptest.NewRequest("GET", "/debug/stats?seconds=1", nil),
+	} {
+		if r.URL.Query().Get("format") == "" {
+			r.Header.Set("Accept", "text/html;q=0.9, application/json")
+		}
+
+		w := httptest.NewRecorder()
+		Stats(w, r)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+		var snap appmetrics.Snapshot
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &snap))
+		assert.NotZero(t, snap.Runtime.NumGoroutine)
+		assert.NotZero(t, snap.System.MemStat.Total)
+		assert.Contains(t, w.Body.String(), `"tags"`)
+	}
+}
+
+func TestStatsCached(t *testing.T) {
+	Start(time.Hour)
+	defer Stop()
+
+	get := func(url string) *appmetrics.Snapshot {
+		w := httptest.NewRecorder()
+		Stats(w, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		var snap appmetrics.Snapshot
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &snap))
+		return &snap
+	}
+
+	start := time.Now()
+	first := get("/debug/stats?format=json")
+	assert.True(t, time.Since(start) < time.Second)
+	assert.True(t, first.Time.Equal(get("/debug/stats?format=json").Time))
+
+	// the staleness is at least the interval, so requests don't collect more often
+	time.Sleep(1100 * time.Millisecond)
+	assert.True(t, time.Since(get("/debug/stats?format=json&seconds=1").Time) > time.Second)
+}
+
+func TestStatsInvalidFormat(t *testing.T) {
+	w := httptest.NewRecorder()
+	Stats(w, httptest.NewRequest("GET", "/debug/stats?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
+
+func TestStatsInvalidUnit(t *testing.T) {
+	r, err := http.NewRequest("GET", "http://localhost:8000/debug/stats?bytes=GB", nil)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	Stats(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
+
+func TestStatus(t *testing.T) {
+	c := rmetric.New(nil)
+	c.Once()
+	status.Register(c)
+	defer status.Unregister(c)
+
+	w := httptest.NewRecorder()
+	Status(w, httptest.NewRequest("GET", "/debug/stats/status", nil))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var all []status.Status
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &all))
+	assert.Len(t, all, 3)
+	// the collectors of the default runner come first
+	assert.Equal(t, "rmetric", all[0].Name)
+	assert.Equal(t, "system", all[1].Name)
+	assert.Equal(t, appmetrics.Default().Interval(), all[1].Interval)
+	assert.Equal(t, "rmetric", all[2].Name)
+	assert.Equal(t, int64(1), all[2].Collections)
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	r := appmetrics.NewRunner(nil)
+	r.System.EnableDisk = false
+	r.System.EnableNet = false
+
+	w := httptest.NewRecorder()
+	NewPrometheusHandler(r, "test").ServeHTTP(w, httptest.NewRequest("GET", "/debug/stats/prometheus", nil))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	assert.Contains(t, body, "# HELP test_runtime_cpu_goroutines Number of goroutines that currently exist.\n")
+	assert.Contains(t, body, "# TYPE test_runtime_cpu_goroutines gauge\n")
+	assert.Contains(t, body, "test_system_mem_total_bytes ")
+	assert.Contains(t, body, `test_runtime_info{go_arch="`)
+}
@@ -0,0 +1,214 @@
+// Package status describes the state of collectors and sinks, so operators can tell whether
+// collection is alive or silently failing. Collectors expose it by a Status method, and the
+// collectors registered by Register are rendered by the /debug/stats/status endpoint of package stat.
+package status
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status represents the state of a collector.
+type Status struct {
+	Name string `json:"name"`
+	// Running reports whether Run is running.
+	Running     bool          `json:"running"`
+	Interval    time.Duration `json:"interval"`
+	LastCollect time.Time     `json:"last_collect"`
+	Collections int64         `json:"collections"`
+	// HandlerPanics is the number of panics recovered from the stats handler.
+	HandlerPanics int64   `json:"handler_panics"`
+	Probes        []Probe `json:"probes,omitempty"`
+	Sinks         []Sink  `json:"sinks,omitempty"`
+}
+
+// Healthy reports whether no enabled probe and no sink failed at the last attempt.
+func (s *Status) Healthy() bool {
+	for _, p := range s.Probes {
+		if p.Enabled && p.LastError != "" {
+			return false
+		}
+	}
+	for _, sink := range s.Sinks {
+		if !sink.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// Probe represents the state of a group of stats of a collector, e.g. cpu or disk.
+type Probe struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// LastError is the error of the last collection, empty if it succeeded.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ProbeError is the error of a probe of a collector, it is reported to the ErrorHandler of the collector.
+type ProbeError struct {
+	Collector string
+	Probe     string
+	Err       error
+}
+
+func (e *ProbeError) Error() string {
+	return e.Collector + ": " + e.Probe + ": " + e.Err.Error()
+}
+
+func (e *ProbeError) Unwrap() error {
+	return e.Err
+}
+
+// ProbeErrors returns the non-nil errors of the probes of collector as ProbeErrors sorted by probe.
+func ProbeErrors(collector string, errs map[string]error) []error {
+	var r []error
+	for probe, err := range errs {
+		if err != nil {
+			r = append(r, &ProbeError{Collector: collector, Probe: probe, Err: err})
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].(*ProbeError).Probe < r[j].(*ProbeError).Probe })
+	return r
+}
+
+// Sink represents the state of a destination the stats are written to.
+type Sink struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	LastWrite time.Time `json:"last_write"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Tracker records the state of a collector. The zero value is ready to use and it is safe
+// for use from multiple go routines.
+type Tracker struct {
+	mu          sync.Mutex
+	running     bool
+	lastCollect time.Time
+	collections int64
+	panics      int64
+	errs        map[string]error
+}
+
+// SetRunning records whether Run is running.
+func (t *Tracker) SetRunning(running bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running = running
+}
+
+// Collected records a collection and the errors of its probes, a nil error clears the previous error.
+func (t *Tracker) Collected(errs map[string]error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastCollect = time.Now()
+	t.collections++
+	if t.errs == nil {
+		t.errs = make(map[string]error)
+	}
+	for probe, err := range errs {
+		t.errs[probe] = err
+	}
+}
+
+// Err returns the errors of the probes which failed at their last collection joined, each prefixed
+// with the name of the probe, or nil if none failed.
+func (t *Tracker) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	probes := make([]string, 0, len(t.errs))
+	for probe, err := range t.errs {
+		if err != nil {
+			probes = append(probes, probe)
+		}
+	}
+	sort.Strings(probes)
+
+	errs := make([]error, len(probes))
+	for i, probe := range probes {
+		errs[i] = fmt.Errorf("%s: %w", probe, t.errs[probe])
+	}
+	return errors.Join(errs...)
+}
+
+// HandlerPanicked records a panic recovered from the stats handler.
+func (t *Tracker) HandlerPanicked() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.panics++
+}
+
+// Status returns the state of the collector name collecting every interval, probes are the names
+// of the probes of the collector and whether they are enabled.
+func (t *Tracker) Status(name string, interval time.Duration, probes map[string]bool) Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Status{
+		Name:          name,
+		Running:       t.running,
+		Interval:      interval,
+		LastCollect:   t.lastCollect,
+		Collections:   t.collections,
+		HandlerPanics: t.panics,
+		Probes:        make([]Probe, 0, len(probes)),
+	}
+	for probe, enabled := range probes {
+		p := Probe{Name: probe, Enabled: enabled}
+		if err := t.errs[probe]; err != nil {
+			p.LastError = err.Error()
+		}
+		s.Probes = append(s.Probes, p)
+	}
+	sort.Slice(s.Probes, func(i, j int) bool { return s.Probes[i].Name < s.Probes[j].Name })
+	return s
+}
+
+// Provider is implemented by collectors which report their state.
+type Provider interface {
+	Status() Status
+}
+
+var (
+	mu        sync.Mutex
+	providers []Provider
+)
+
+// Register registers p to be reported by All.
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers = append(providers, p)
+}
+
+// Unregister removes p registered by Register.
+func Unregister(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, r := range providers {
+		if r == p {
+			providers = append(providers[:i], providers[i+1:]...)
+			return
+		}
+	}
+}
+
+// All returns the states of the registered providers in the order they were registered.
+func All() []Status {
+	mu.Lock()
+	ps := make([]Provider, len(providers))
+	copy(ps, providers)
+	mu.Unlock()
+
+	all := make([]Status, 0, len(ps))
+	for _, p := range ps {
+		all = append(all, p.Status())
+	}
+	return all
+}
@@ -0,0 +1,58 @@
+package status
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type collector struct {
+	t Tracker
+}
+
+func (c *collector) Status() Status {
+	return c.t.Status("test", time.Second, map[string]bool{"disk": true, "cpu": true, "gc": false})
+}
+
+func TestTracker(t *testing.T) {
+	c := &collector{}
+	s := c.Status()
+	assert.True(t, s.LastCollect.IsZero())
+	assert.True(t, s.Healthy())
+
+	c.t.SetRunning(true)
+	c.t.Collected(map[string]error{"disk": errors.New("permission denied"), "cpu": nil})
+	s = c.Status()
+	assert.True(t, s.Running)
+	assert.Equal(t, int64(1), s.Collections)
+	assert.Equal(t, []Probe{
+		{Name: "cpu", Enabled: true},
+		{Name: "disk", Enabled: true, LastError: "permission denied"},
+		{Name: "gc", Enabled: false},
+	}, s.Probes)
+	assert.False(t, s.Healthy())
+	assert.EqualError(t, c.t.Err(), "disk: permission denied")
+
+	c.t.Collected(map[string]error{"disk": nil})
+	s = c.Status()
+	assert.True(t, s.Healthy())
+	assert.NoError(t, c.t.Err())
+}
+
+func TestRegister(t *testing.T) {
+	c := &collector{}
+	Register(c)
+	assert.Len(t, All(), 1)
+	Unregister(c)
+	assert.Len(t, All(), 0)
+}
+
+func TestProbeErrors(t *testing.T) {
+	denied := errors.New("permission denied")
+	errs := ProbeErrors("system", map[string]error{"net": denied, "cpu": nil, "disk": denied})
+	assert.Len(t, errs, 2)
+	assert.EqualError(t, errs[0], "system: disk: permission denied")
+	assert.ErrorIs(t, errs[1], denied)
+}
@@ -0,0 +1,239 @@
+package system
+
+import (
+	"math"
+	"time"
+
+	"github.com/smallnest/go-app-metrics/internal/counter"
+)
+
+// scaleUint returns v multiplied by factor, rounded to the nearest integer.
+func scaleUint(v uint64, factor float64) uint64 {
+	f := math.Round(float64(v) * factor)
+	switch {
+	case f <= 0 || math.IsNaN(f):
+		return 0
+	case f >= math.MaxUint64:
+		return math.MaxUint64
+	default:
+		return uint64(f)
+	}
+}
+
+// uints returns pointers to all uint64 fields of ss except the ones in maps.
+func (ss *SystemStats) uints() []*uint64 {
+	return []*uint64{
+		&ss.MemStat.Total, &ss.MemStat.Available, &ss.MemStat.Used,
+		&ss.SwapMemStat.Total, &ss.SwapMemStat.Free, &ss.SwapMemStat.Used, &ss.SwapMemStat.In, &ss.SwapMemStat.Out,
+		&ss.CounterResets,
+	}
+}
+
+// floats returns pointers to all float64 fields of ss.
+func (ss *SystemStats) floats() []*float64 {
+	return []*float64{
+		&ss.CPUStat.User, &ss.CPUStat.System, &ss.CPUStat.Idle, &ss.CPUStat.Iowait, &ss.CPUPercent, &ss.IOWaitPercent,
+		&ss.LoadStat.Load1, &ss.LoadStat.Load5, &ss.LoadStat.Load15,
+	}
+}
+
+func (s *CPUStat) floats() []*float64 {
+	return []*float64{&s.User, &s.System, &s.Idle, &s.Iowait}
+}
+
+func (s *DiskStat) uints() []*uint64 {
+	return []*uint64{&s.Total, &s.Free, &s.InodesTotal, &s.InodesFree}
+}
+
+func (s *DiskStat) floats() []*float64 {
+	return []*float64{&s.InodesUsedPercent}
+}
+
+func (s *DiskIOStat) uints() []*uint64 {
+	return []*uint64{&s.ReadBytes, &s.WriteBytes, &s.ReadCount, &s.WriteCount, &s.ReadTime, &s.WriteTime,
+		&s.IOTime, &s.WeightedIOTime}
+}
+
+func (s *DiskIOStat) floats() []*float64 {
+	return []*float64{&s.Pressure}
+}
+
+func (s *BandwidthStat) uints() []*uint64 {
+	return []*uint64{&s.BytesSent, &s.BytesRecv, &s.PacketsSent, &s.PacketsRecv}
+}
+
+// DeepCopy returns a copy of ss which doesn't share maps or slices with ss.
+func (ss *SystemStats) DeepCopy() SystemStats {
+	r := *ss
+	if ss.CPUCoreStat != nil {
+		r.CPUCoreStat = make(map[string]CPUStat, len(ss.CPUCoreStat))
+		for k, v := range ss.CPUCoreStat {
+			r.CPUCoreStat[k] = v
+		}
+	}
+	r.DiskStat = make(map[string]DiskStat, len(ss.DiskStat))
+	for k, v := range ss.DiskStat {
+		v.Mountpoints = append([]string(nil), v.Mountpoints...)
+		r.DiskStat[k] = v
+	}
+	r.DiskIOStat = make(map[string]DiskIOStat, len(ss.DiskIOStat))
+	for k, v := range ss.DiskIOStat {
+		r.DiskIOStat[k] = v
+	}
+	r.BandwidthStat = make(map[string]BandwidthStat, len(ss.BandwidthStat))
+	for k, v := range ss.BandwidthStat {
+		r.BandwidthStat[k] = v
+	}
+	return r
+}
+
+// Add returns the sum of ss and o. Cores, partitions, disk devices and network interfaces which exist
+// in only one of them are copied as is.
+func (ss *SystemStats) Add(o *SystemStats) SystemStats {
+	r := ss.combine(o, func(a, b uint64) uint64 { return a + b }, func(a, b float64) float64 { return a + b })
+	for k, s := range o.CPUCoreStat {
+		if _, ok := r.CPUCoreStat[k]; !ok {
+			if r.CPUCoreStat == nil {
+				r.CPUCoreStat = make(map[string]CPUStat, len(o.CPUCoreStat))
+			}
+			r.CPUCoreStat[k] = s
+		}
+	}
+	for k, s := range o.DiskStat {
+		if _, ok := r.DiskStat[k]; !ok {
+			s.Mountpoints = append([]string(nil), s.Mountpoints...)
+			r.DiskStat[k] = s
+		}
+	}
+	for k, s := range o.DiskIOStat {
+		if _, ok := r.DiskIOStat[k]; !ok {
+			r.DiskIOStat[k] = s
+		}
+	}
+	for k, s := range o.BandwidthStat {
+		if _, ok := r.BandwidthStat[k]; !ok {
+			r.BandwidthStat[k] = s
+		}
+	}
+	return r
+}
+
+// Sub returns the difference of ss and o. Unsigned values saturate at zero.
+// Cores, partitions, disk devices and network interfaces which exist only in ss are copied as is.
+func (ss *SystemStats) Sub(o *SystemStats) SystemStats {
+	return ss.combine(o, counter.Sub, func(a, b float64) float64 { return a - b })
+}
+
+// Scale returns ss with all values multiplied by factor, e.g. 1/n to average a sum of n stats.
+// Unsigned values are rounded to the nearest integer.
+func (ss *SystemStats) Scale(factor float64) SystemStats {
+	r := ss.DeepCopy()
+	for _, p := range r.uints() {
+		*p = scaleUint(*p, factor)
+	}
+	r.Elapsed = time.Duration(scaleUint(uint64(r.Elapsed), factor))
+	for _, p := range r.floats() {
+		*p *= factor
+	}
+	for k, s := range r.CPUCoreStat {
+		for _, p := range s.floats() {
+			*p *= factor
+		}
+		r.CPUCoreStat[k] = s
+	}
+	for k, s := range r.DiskStat {
+		for _, p := range s.uints() {
+			*p = scaleUint(*p, factor)
+		}
+		for _, p := range s.floats() {
+			*p *= factor
+		}
+		r.DiskStat[k] = s
+	}
+	for k, s := range r.DiskIOStat {
+		for _, p := range s.uints() {
+			*p = scaleUint(*p, factor)
+		}
+		for _, p := range s.floats() {
+			*p *= factor
+		}
+		r.DiskIOStat[k] = s
+	}
+	for k, s := range r.BandwidthStat {
+		for _, p := range s.uints() {
+			*p = scaleUint(*p, factor)
+		}
+		r.BandwidthStat[k] = s
+	}
+	return r
+}
+
+// combine applies the operations to the values of ss and o, including the cores, partitions, disk devices
+// and network interfaces which exist in both of them.
+func (ss *SystemStats) combine(o *SystemStats, uop func(a, b uint64) uint64, fop func(a, b float64) float64) SystemStats {
+	r := ss.DeepCopy()
+	ru, ou := r.uints(), o.uints()
+	for i := range ru {
+		*ru[i] = uop(*ru[i], *ou[i])
+	}
+	rf, of := r.floats(), o.floats()
+	for i := range rf {
+		*rf[i] = fop(*rf[i], *of[i])
+	}
+	r.Elapsed = time.Duration(uop(uint64(r.Elapsed), uint64(o.Elapsed)))
+
+	for k, s := range r.CPUCoreStat {
+		os, ok := o.CPUCoreStat[k]
+		if !ok {
+			continue
+		}
+		sf, osf := s.floats(), os.floats()
+		for i := range sf {
+			*sf[i] = fop(*sf[i], *osf[i])
+		}
+		r.CPUCoreStat[k] = s
+	}
+
+	for k, s := range r.DiskStat {
+		os, ok := o.DiskStat[k]
+		if !ok {
+			continue
+		}
+		su, osu := s.uints(), os.uints()
+		for i := range su {
+			*su[i] = uop(*su[i], *osu[i])
+		}
+		sf, osf := s.floats(), os.floats()
+		for i := range sf {
+			*sf[i] = fop(*sf[i], *osf[i])
+		}
+		r.DiskStat[k] = s
+	}
+	for k, s := range r.DiskIOStat {
+		os, ok := o.DiskIOStat[k]
+		if !ok {
+			continue
+		}
+		su, osu := s.uints(), os.uints()
+		for i := range su {
+			*su[i] = uop(*su[i], *osu[i])
+		}
+		sf, osf := s.floats(), os.floats()
+		for i := range sf {
+			*sf[i] = fop(*sf[i], *osf[i])
+		}
+		r.DiskIOStat[k] = s
+	}
+	for k, s := range r.BandwidthStat {
+		os, ok := o.BandwidthStat[k]
+		if !ok {
+			continue
+		}
+		su, osu := s.uints(), os.uints()
+		for i := range su {
+			*su[i] = uop(*su[i], *osu[i])
+		}
+		r.BandwidthStat[k] = s
+	}
+	return r
+}
@@ -0,0 +1,70 @@
+package system
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArith(t *testing.T) {
+	a := SystemStats{
+		DiskStat:      map[string]DiskStat{"/": {Total: 10, Free: 4, Mountpoints: []string{"/"}}},
+		BandwidthStat: map[string]BandwidthStat{"eth0": {BytesSent: 100}},
+	}
+	a.MemStat.Used = 30
+	a.Elapsed = 10 * time.Second
+	a.LoadStat.Load1 = 1.5
+	a.CPUCoreStat = map[string]CPUStat{"core0": {User: 4}}
+
+	b := SystemStats{
+		DiskStat:      map[string]DiskStat{"/": {Total: 10, Free: 6}, "/data": {Total: 20}},
+		DiskIOStat:    map[string]DiskIOStat{"sda": {ReadBytes: 64}},
+		BandwidthStat: map[string]BandwidthStat{"eth0": {BytesSent: 150}},
+	}
+	b.MemStat.Used = 10
+	b.Elapsed = 12 * time.Second
+	b.LoadStat.Load1 = 0.5
+	b.CPUCoreStat = map[string]CPUStat{"core0": {User: 2}, "core1": {Idle: 8}}
+
+	sum := a.Add(&b)
+	assert.Equal(t, uint64(40), sum.MemStat.Used)
+	assert.Equal(t, 22*time.Second, sum.Elapsed)
+	assert.Equal(t, 2.0, sum.LoadStat.Load1)
+	assert.Equal(t, 6.0, sum.CPUCoreStat["core0"].User)
+	assert.Equal(t, 8.0, sum.CPUCoreStat["core1"].Idle)
+	assert.Equal(t, uint64(10), sum.DiskStat["/"].Free)
+	assert.Equal(t, uint64(20), sum.DiskStat["/data"].Total)
+	assert.Equal(t, uint64(250), sum.BandwidthStat["eth0"].BytesSent)
+	assert.Equal(t, uint64(64), sum.DiskIOStat["sda"].ReadBytes)
+
+	diff := a.Sub(&b)
+	assert.Equal(t, uint64(20), diff.MemStat.Used)
+	assert.Equal(t, 2.0, diff.CPUCoreStat["core0"].User)
+	assert.Equal(t, uint64(0), diff.DiskStat["/"].Free) // saturated
+	assert.Equal(t, uint64(0), diff.BandwidthStat["eth0"].BytesSent)
+	assert.NotContains(t, diff.DiskStat, "/data")
+
+	avg := sum.Scale(0.5)
+	assert.Equal(t, sum.Elapsed/2, avg.Elapsed)
+	assert.Equal(t, uint64(20), avg.MemStat.Used)
+	assert.Equal(t, 1.0, avg.LoadStat.Load1)
+	assert.Equal(t, 3.0, avg.CPUCoreStat["core0"].User)
+	assert.Equal(t, uint64(125), avg.BandwidthStat["eth0"].BytesSent)
+	assert.Equal(t, uint64(32), avg.DiskIOStat["sda"].ReadBytes)
+
+	c := a.DeepCopy()
+	c.DiskStat["/"] = DiskStat{}
+	c.BandwidthStat["eth1"] = BandwidthStat{}
+	c.CPUCoreStat["core0"] = CPUStat{}
+	assert.Equal(t, uint64(10), a.DiskStat["/"].Total)
+	assert.NotContains(t, a.BandwidthStat, "eth1")
+	assert.Equal(t, 4.0, a.CPUCoreStat["core0"].User)
+}
+
+func TestScaleUint(t *testing.T) {
+	assert.Equal(t, uint64(0), scaleUint(10, -1))
+	assert.Equal(t, uint64(math.MaxUint64), scaleUint(math.MaxUint64, 2))
+	assert.Equal(t, uint64(3), scaleUint(5, 0.5))
+}
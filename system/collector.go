@@ -2,6 +2,13 @@
 package system
 
 import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -9,6 +16,47 @@ import (
 	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
+	"github.com/smallnest/go-app-metrics/internal/counter"
+	"github.com/smallnest/go-app-metrics/internal/rollup"
+	"github.com/smallnest/go-app-metrics/internal/safe"
+	"github.com/smallnest/go-app-metrics/sanitize"
+	"github.com/smallnest/go-app-metrics/status"
+)
+
+// Rollup is the name used in keys of the series summing all partitions, disk devices and network interfaces,
+// e.g. disk.total.free and net.total.bytes_sent. The rollup of the partitions counts every device once and
+// skips pseudo and in-memory filesystems, see PhysicalFilesystems, the rollup of the disk devices only
+// counts whole disks, not their partitions or stacked devices such as dm-0, and the rollup of the network
+// interfaces skips the loopback interface.
+const Rollup = rollup.Name
+
+// FirstSample is how the first collection outputs the stats since the previous collection, i.e. swap in/out,
+// disk IO and bandwidth, which have no previous sample to be computed from.
+type FirstSample int
+
+const (
+	// FirstSampleZero outputs them as zeros.
+	FirstSampleZero FirstSample = iota
+	// FirstSampleSuppress omits them. Disk devices and network interfaces which appear later are also
+	// omitted from their first collection.
+	FirstSampleSuppress
+	// FirstSampleWarmup outputs them as zeros and sets SystemStats.Warmup, so the points written by sinks
+	// are tagged warmup=true.
+	FirstSampleWarmup
+)
+
+// CPUSource is how SystemStats.CPUPercent is computed.
+type CPUSource int
+
+const (
+	// CPUAuto selects CPUPercentSampler on windows, where the fields of the cpu times are not
+	// reliable, and CPUTimes on other platforms.
+	CPUAuto CPUSource = iota
+	// CPUTimes computes the utilization from the delta of the cpu times since the previous collection.
+	CPUTimes
+	// CPUPercentSampler uses cpu.Percent of gopsutil, which samples the utilization since its previous
+	// call in the process.
+	CPUPercentSampler
 )
 
 // SystemStatsHandler represents a handler to handle stats after successfully gathering statistics
@@ -20,14 +68,74 @@ type Collector struct {
 	// Defaults to 10 seconds.
 	CollectInterval time.Duration
 
+	// EnableDisk determines whether disk statistics, including the IO of the devices, will be output.
+	// Defaults to true.
+	EnableDisk bool
+
+	// EnableNet determines whether network statistics will be output. Defaults to true.
+	EnableNet bool
+
+	// GroupDiskByDevice determines whether disk stats are keyed by the underlying device (e.g. sda1)
+	// instead of the mountpoint, so bind mounts and multiple mounts of the same device are reported once.
+	// Partitions which are not backed by a device in /dev, such as tmpfs, are still keyed by mountpoint.
+	// Defaults to false.
+	GroupDiskByDevice bool
+
+	// PerCPU determines whether the CPU utilization of every core is also output, keyed as cpu.core<n>.<metric>.
+	// Defaults to false.
+	PerCPU bool
+
+	// InterfaceFilter, if not nil, selects the network interfaces to collect,
+	// e.g. PhysicalInterfaces or GlobFilter("eth*"). Defaults to nil which collects all interfaces.
+	InterfaceFilter Filter
+
+	// PartitionFilter, if not nil, selects the partitions to collect by mountpoint,
+	// e.g. Not(RegexpFilter(regexp.MustCompile(`^/var/lib/(docker|kubelet)/`))).
+	// Defaults to nil which collects all partitions.
+	PartitionFilter Filter
+
+	// FSTypeFilter, if not nil, selects the partitions to collect by filesystem type,
+	// e.g. PhysicalFilesystems. Defaults to nil which collects all filesystem types.
+	FSTypeFilter Filter
+
+	// FirstSample is how the first collection outputs the stats since the previous collection.
+	// Defaults to FirstSampleZero.
+	FirstSample FirstSample
+
+	// CPUSource is how the CPU utilization is computed. Defaults to CPUAuto.
+	CPUSource CPUSource
+
+	mu         sync.Mutex // guards the previous samples below, so Once can be called while Run is running
+	collected  bool
+	lastTime   time.Time
 	cpuStat    *cpu.TimesStat
+	coreStats  map[string]cpu.TimesStat // core -> previous sample
 	partitions []string
+	devices    map[string]string // mountpoint -> device
+	fstypes    map[string]string // mountpoint -> filesystem type
 	netStats   map[string]*net.IOCountersStat
+	ioStats    map[string]disk.IOCountersStat
+	swapStat   *mem.SwapMemoryStat
+	resets     uint64
 
 	// Done, when closed, is used to signal Collector that is should stop collecting
 	// statistics and the Run function should return.
 	Done <-chan struct{}
 
+	// PanicHandler, if not nil, is called with an error describing the panic when the stats handler
+	// panics. The panic is recovered so the collection continues. Defaults to nil.
+	PanicHandler func(err error)
+
+	// ErrorHandler, if not nil, is called with a *status.ProbeError for every probe which failed
+	// in a collection, e.g. disk when a partition can't be read after permissions were lost.
+	// Defaults to nil.
+	ErrorHandler func(err error)
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	runMu    sync.Mutex // held while running, so Stop can wait
+
+	tracker      status.Tracker
 	statsHandler SystemStatsHandler
 }
 
@@ -40,33 +148,83 @@ func New(statsHandler SystemStatsHandler) *Collector {
 	}
 
 	var partitions []string
+	devices := make(map[string]string)
+	fstypes := make(map[string]string)
 	stats, _ := disk.Partitions(true)
 	for _, s := range stats {
 		partitions = append(partitions, s.Mountpoint)
+		devices[s.Mountpoint] = s.Device
+		fstypes[s.Mountpoint] = s.Fstype
 	}
 
 	return &Collector{
 		CollectInterval: 10 * time.Second,
+		EnableDisk:      true,
+		EnableNet:       true,
 		partitions:      partitions,
+		devices:         devices,
+		fstypes:         fstypes,
 		netStats:        make(map[string]*net.IOCountersStat),
+		ioStats:         make(map[string]disk.IOCountersStat),
+		stop:            make(chan struct{}),
 		statsHandler:    statsHandler,
 	}
 }
 
 // Run gathers statistics then outputs them to the configured SystemStatsHandler every
-// CollectInterval. Unlike Once, this function will return until Done has been closed
-// (or never if Done is nil), therefore it should be called in its own goroutine.
+// CollectInterval. Unlike Once, this function will return until Done has been closed or Stop
+// has been called (or never), therefore it should be called in its own goroutine.
 func (c *Collector) Run() {
-	c.statsHandler(c.collectStats())
+	c.RunContext(context.Background())
+}
+
+// RunContext is like Run, but it also returns when ctx is done. It returns the errors of the
+// probes which failed at the last collection, see Status, or nil if the last collection succeeded.
+// The cancellation of ctx isn't reported as an error. Concurrent runs of a Collector are serialized.
+func (c *Collector) RunContext(ctx context.Context) error {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	select {
+	case <-c.stop:
+		return nil
+	default:
+	}
+
+	c.tracker.SetRunning(true)
+	defer c.tracker.SetRunning(false)
+
+	c.handle(c.collectStats())
 
 	tick := time.NewTicker(c.CollectInterval)
 	defer tick.Stop()
 	for {
 		select {
 		case <-c.Done:
-			return
+			return c.tracker.Err()
+		case <-ctx.Done():
+			return c.tracker.Err()
+		case <-c.stop:
+			return c.tracker.Err()
 		case <-tick.C:
-			c.statsHandler(c.collectStats())
+			c.handle(c.collectStats())
+		}
+	}
+}
+
+// Stop stops Run and RunContext and waits until they have returned, a Collector can't be run again
+// once it has been stopped. It is safe to call Stop more than once.
+func (c *Collector) Stop() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.runMu.Lock()
+	c.runMu.Unlock()
+}
+
+// handle outputs stats to the handler, recovering its panic.
+func (c *Collector) handle(stats SystemStats) {
+	if err := safe.Call(c.statsHandler, stats); err != nil {
+		c.tracker.HandlerPanicked()
+		if c.PanicHandler != nil {
+			c.PanicHandler(err)
 		}
 	}
 }
@@ -76,27 +234,75 @@ func (c *Collector) Once() SystemStats {
 	return c.collectStats()
 }
 
+// Status returns the state of the Collector. The probes are cpu, load, mem, swap, disk, disk_io and net,
+// the error of disk is the last error of the partitions.
+func (c *Collector) Status() status.Status {
+	return c.tracker.Status("system", c.CollectInterval, map[string]bool{
+		"cpu":     true,
+		"load":    true,
+		"mem":     true,
+		"swap":    true,
+		"disk":    c.EnableDisk,
+		"disk_io": c.EnableDisk,
+		"net":     c.EnableNet,
+	})
+}
+
 // collectStats collects all configured stats once.
 func (c *Collector) collectStats() SystemStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	stats := SystemStats{
 		DiskStat:      make(map[string]DiskStat),
+		DiskIOStat:    make(map[string]DiskIOStat),
 		BandwidthStat: make(map[string]BandwidthStat),
 	}
+	errs := make(map[string]error, 7)
+	defer c.recordCollection(errs)
+
+	now := time.Now()
+	if !c.collected {
+		c.collected = true
+		stats.Warmup = c.FirstSample == FirstSampleWarmup
+		stats.DeltasOmitted = c.FirstSample == FirstSampleSuppress
+	} else {
+		stats.Elapsed = now.Sub(c.lastTime)
+	}
+	c.lastTime = now
 
 	//cpu * 100
+	// the first percents are since boot, so they are only reported from the second collection on
+	first := c.cpuStat == nil
 	cpustats, err := cpu.Times(false)
+	errs["cpu"] = err
 	if err == nil && len(cpustats) > 0 {
 		cpustat := cpustats[0]
-		stats.CPUStat.User = cpustat.User * 100
-		stats.CPUStat.System = cpustat.System * 100
-		stats.CPUStat.Iowait = cpustat.Iowait * 100
-		stats.CPUStat.Idle = cpustat.Idle * 100
+		stats.CPUStat = newCPUStat(&cpustat)
 
+		if !first {
+			if c.cpuSource() == CPUTimes {
+				stats.CPUPercent = busyPercent(c.cpuStat, &cpustat)
+			}
+			stats.IOWaitPercent = iowaitPercent(c.cpuStat, &cpustat)
+		}
 		c.cpuStat = &cpustat
 	}
+	if c.cpuSource() == CPUPercentSampler {
+		percents, err := cpu.Percent(0, false)
+		if err != nil {
+			errs["cpu"] = err
+		} else if len(percents) > 0 && !first {
+			stats.CPUPercent = percents[0]
+		}
+	}
+	if c.PerCPU {
+		c.collectCPUCoreStats(&stats, errs)
+	}
 
 	//load * 100
 	avg, err := load.Avg()
+	errs["load"] = err
 	if err == nil {
 		stats.LoadStat.Load1 = avg.Load1
 		stats.LoadStat.Load5 = avg.Load5
@@ -105,63 +311,367 @@ func (c *Collector) collectStats() SystemStats {
 
 	//mem
 	vmem, err := mem.VirtualMemory()
+	errs["mem"] = err
 	if err == nil {
 		stats.MemStat.Total = vmem.Total
 		stats.MemStat.Available = vmem.Available
 		stats.MemStat.Used = vmem.Used
 	}
-	swapmem, err := mem.SwapMemory()
+	swapmem, err := swapMemory()
+	errs["swap"] = err
 	if err == nil {
 		stats.SwapMemStat.Total = swapmem.Total
 		stats.SwapMemStat.Free = swapmem.Free
 		stats.SwapMemStat.Used = swapmem.Used
+
+		if c.swapStat != nil {
+			stats.SwapMemStat.In = c.delta(swapmem.Sin, c.swapStat.Sin)
+			stats.SwapMemStat.Out = c.delta(swapmem.Sout, c.swapStat.Sout)
+		}
+		c.swapStat = swapmem
+	}
+
+	if c.EnableDisk {
+		c.collectDiskStats(&stats, errs)
+		c.collectDiskIOStats(&stats, errs)
+	}
+	if c.EnableNet {
+		c.collectNetStats(&stats, errs)
+	}
+	stats.CounterResets = c.resets
+
+	return stats
+}
+
+// recordCollection records a collection and reports the errors of its probes to ErrorHandler.
+func (c *Collector) recordCollection(errs map[string]error) {
+	c.tracker.Collected(errs)
+	if c.ErrorHandler == nil {
+		return
+	}
+	for _, err := range status.ProbeErrors("system", errs) {
+		c.ErrorHandler(err)
+	}
+}
+
+// delta returns the increase of a cumulative counter since the previous sample, see counter.Delta
+// for how wraps and resets are handled. The resets are counted.
+func (c *Collector) delta(cur, prev uint64) uint64 {
+	d, reset := counter.Delta(cur, prev)
+	if reset {
+		c.resets++
+	}
+	return d
+}
+
+func (c *Collector) collectCPUCoreStats(stats *SystemStats, errs map[string]error) {
+	cpustats, err := cpu.Times(true)
+	if err != nil {
+		errs["cpu"] = err
+		return
+	}
+	stats.CPUCoreStat = make(map[string]CPUStat, len(cpustats))
+	coreStats := make(map[string]cpu.TimesStat, len(cpustats))
+	for i := range cpustats {
+		core := "core" + strings.TrimPrefix(cpustats[i].CPU, "cpu")
+		var stat CPUStat
+		if prev, ok := c.coreStats[core]; ok {
+			stat = cpuPercents(&prev, &cpustats[i])
+		}
+		stats.CPUCoreStat[core] = stat
+		coreStats[core] = cpustats[i]
+	}
+	c.coreStats = coreStats
+}
+
+// isLoopback reports whether the network interface name is the loopback interface, e.g. lo or lo0.
+func isLoopback(name string) bool {
+	if !strings.HasPrefix(name, "lo") {
+		return false
+	}
+	for i := 2; i < len(name); i++ {
+		if !isDigit(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// cpuSource returns the CPUSource resolved for the platform.
+func (c *Collector) cpuSource() CPUSource {
+	if c.CPUSource != CPUAuto {
+		return c.CPUSource
+	}
+	if runtime.GOOS == "windows" {
+		return CPUPercentSampler
+	}
+	return CPUTimes
+}
+
+// cpuTotal returns the total and the busy cpu time of t. Like cpu.Percent, it excludes the guest times
+// which linux also counts in the user times.
+func cpuTotal(t *cpu.TimesStat) (all, busy float64) {
+	all = t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+	if runtime.GOOS != "linux" {
+		all += t.Guest + t.GuestNice
+	}
+	return all, all - t.Idle - t.Iowait
+}
+
+// busyPercent returns the percentage of the cpu time spent busy between prev and cur.
+func busyPercent(prev, cur *cpu.TimesStat) float64 {
+	prevAll, prevBusy := cpuTotal(prev)
+	curAll, curBusy := cpuTotal(cur)
+	if curBusy <= prevBusy {
+		return 0
+	}
+	if curAll <= prevAll {
+		return 100
+	}
+	return math.Min(100, (curBusy-prevBusy)/(curAll-prevAll)*100)
+}
+
+// iowaitPercent returns the percentage of the cpu time spent waiting for IO between prev and cur.
+func iowaitPercent(prev, cur *cpu.TimesStat) float64 {
+	prevAll, _ := cpuTotal(prev)
+	curAll, _ := cpuTotal(cur)
+	if curAll <= prevAll || cur.Iowait <= prev.Iowait {
+		return 0
+	}
+	return math.Min(100, (cur.Iowait-prev.Iowait)/(curAll-prevAll)*100)
+}
+
+// cpuPercents returns the percentages of the cpu time spent in every mode between prev and cur.
+func cpuPercents(prev, cur *cpu.TimesStat) CPUStat {
+	prevAll, _ := cpuTotal(prev)
+	curAll, _ := cpuTotal(cur)
+	if curAll <= prevAll {
+		return CPUStat{}
+	}
+	percent := func(prev, cur float64) float64 {
+		if cur <= prev {
+			return 0
+		}
+		return math.Min(100, (cur-prev)/(curAll-prevAll)*100)
+	}
+	return CPUStat{
+		User:   percent(prev.User, cur.User),
+		System: percent(prev.System, cur.System),
+		Idle:   percent(prev.Idle, cur.Idle),
+		Iowait: percent(prev.Iowait, cur.Iowait),
+	}
+}
+
+// newCPUStat returns the stat of cpu times multiplied by 100.
+func newCPUStat(t *cpu.TimesStat) CPUStat {
+	return CPUStat{
+		User:   t.User * 100,
+		System: t.System * 100,
+		Idle:   t.Idle * 100,
+		Iowait: t.Iowait * 100,
 	}
+}
 
+func (c *Collector) collectDiskStats(stats *SystemStats, errs map[string]error) {
 	//disk
+	errs["disk"] = nil
 	for _, p := range c.partitions {
+		if c.PartitionFilter != nil && !c.PartitionFilter(p) {
+			continue
+		}
+		if c.FSTypeFilter != nil && !c.FSTypeFilter(c.fstypes[p]) {
+			continue
+		}
+
+		device := c.devices[p]
+		key := p
+		if c.GroupDiskByDevice && strings.HasPrefix(device, "/dev/") {
+			key = strings.TrimPrefix(device, "/dev/")
+			if diskStat, ok := stats.DiskStat[key]; ok {
+				diskStat.Mountpoints = append(diskStat.Mountpoints, p)
+				stats.DiskStat[key] = diskStat
+				continue
+			}
+		}
+
 		s, err := disk.Usage(p)
 		if err != nil {
+			errs["disk"] = err
 			continue
 		}
 
 		var diskStat DiskStat
+		diskStat.Device = device
+		diskStat.Fstype = c.fstypes[p]
+		diskStat.Mountpoints = []string{p}
 		diskStat.Total = s.Total
 		diskStat.Free = s.Free
-		stats.DiskStat[p] = diskStat
+		diskStat.InodesTotal = s.InodesTotal
+		diskStat.InodesFree = s.InodesFree
+		diskStat.InodesUsedPercent = s.InodesUsedPercent
+		stats.DiskStat[key] = diskStat
+	}
+}
+
+func (c *Collector) collectDiskIOStats(stats *SystemStats, errs map[string]error) {
+	counters, err := disk.IOCounters()
+	errs["disk_io"] = err
+	if err != nil {
+		return
+	}
+	for dev, s := range counters {
+		prev, ok := c.ioStats[dev]
+		if !ok {
+			prev = s
+			if c.FirstSample == FirstSampleSuppress {
+				c.ioStats[dev] = s
+				continue
+			}
+		}
+
+		var ioStat DiskIOStat
+		ioStat.ReadBytes = c.delta(s.ReadBytes, prev.ReadBytes)
+		ioStat.WriteBytes = c.delta(s.WriteBytes, prev.WriteBytes)
+		ioStat.ReadCount = c.delta(s.ReadCount, prev.ReadCount)
+		ioStat.WriteCount = c.delta(s.WriteCount, prev.WriteCount)
+		ioStat.ReadTime = c.delta(s.ReadTime, prev.ReadTime) * uint64(time.Millisecond)
+		ioStat.WriteTime = c.delta(s.WriteTime, prev.WriteTime) * uint64(time.Millisecond)
+		ioStat.IOTime = c.delta(s.IoTime, prev.IoTime) * uint64(time.Millisecond)
+		ioStat.WeightedIOTime = c.delta(s.WeightedIO, prev.WeightedIO) * uint64(time.Millisecond)
+		stats.DiskIOStat[dev] = ioStat
+		c.ioStats[dev] = s
+	}
+	attributeIOWait(stats.IOWaitPercent, stats.DiskIOStat)
+}
+
+// attributeIOWait sets the Pressure of the devices, the share of iowait of the device weighted by the time
+// the requests to it were queued or in flight. Partitions, e.g. sda1 of sda and nvme0n1p1 of nvme0n1,
+// are not counted in the total, so the pressure of the whole disks sums up to iowait.
+func attributeIOWait(iowait float64, devices map[string]DiskIOStat) {
+	var total uint64
+	for dev, s := range devices {
+		if !isPartition(dev, devices) {
+			total += s.WeightedIOTime
+		}
 	}
+	if total == 0 {
+		return
+	}
+	for dev, s := range devices {
+		s.Pressure = iowait * float64(s.WeightedIOTime) / float64(total)
+		devices[dev] = s
+	}
+}
 
+// swapMemory returns the swap stats, including the cumulative bytes swapped in and out.
+var swapMemory = mem.SwapMemory
+
+// sysBlock is the directory of the block devices in sysfs, a partition is a subdirectory of its disk.
+var sysBlock = "/sys/block"
+
+// isPartition reports whether dev is a partition of another device in devices.
+func isPartition(dev string, devices map[string]DiskIOStat) bool {
+	for d := range devices {
+		if d != dev && partitionOf(dev, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// partitionOf reports whether dev is a partition of the disk d. It asks sysfs if it knows d,
+// otherwise a partition is named by digits after the disk, e.g. sda1, or by p and digits after
+// a disk ending with a digit, e.g. nvme0n1p1, mmcblk0p1 or loop1p1, so sdaa, loop10 and dm-10
+// are disks of their own.
+func partitionOf(dev, d string) bool {
+	if !strings.HasPrefix(dev, d) {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(sysBlock, d)); err == nil {
+		_, err := os.Stat(filepath.Join(sysBlock, d, dev))
+		return err == nil
+	}
+
+	suffix := dev[len(d):]
+	if isDigit(d[len(d)-1]) {
+		if !strings.HasPrefix(suffix, "p") {
+			return false
+		}
+		suffix = suffix[1:]
+	}
+	if suffix == "" {
+		return false
+	}
+	for i := 0; i < len(suffix); i++ {
+		if !isDigit(suffix[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// stackedDevicePrefixes are the name prefixes of the block devices whose IO is also counted by
+// the devices they are backed by, i.e. device mapper, software RAID, loop and RAM devices.
+var stackedDevicePrefixes = []string{"dm-", "md", "loop", "zram", "ram"}
+
+// isPhysicalDisk reports whether dev is a whole disk, neither a partition of another device in
+// devices nor a stacked device, so the IO of the disks adds up to the IO of the host.
+func isPhysicalDisk(dev string, devices map[string]DiskIOStat) bool {
+	for _, p := range stackedDevicePrefixes {
+		if strings.HasPrefix(dev, p) {
+			return false
+		}
+	}
+	return !isPartition(dev, devices)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (c *Collector) collectNetStats(stats *SystemStats, errs map[string]error) {
 	//bandwidth
 	netstats, err := net.IOCounters(true)
+	errs["net"] = err
 	netStats := c.netStats
 	if err == nil {
 		for _, s := range netstats {
 			s := s
+			if c.InterfaceFilter != nil && !c.InterfaceFilter(s.Name) {
+				continue
+			}
 			if netStats[s.Name] == nil {
 				netStats[s.Name] = &s
+				if c.FirstSample == FirstSampleSuppress {
+					continue
+				}
 			}
 			s2 := netStats[s.Name]
 
 			var bandwidthStat BandwidthStat
-			bandwidthStat.BytesSent = s.BytesSent - s2.BytesSent
-			bandwidthStat.BytesRecv = s.BytesRecv - s2.BytesRecv
-			bandwidthStat.PacketsSent = s.PacketsSent - s2.PacketsSent
-			bandwidthStat.PacketsRecv = s.PacketsRecv - s2.PacketsRecv
+			bandwidthStat.BytesSent = c.delta(s.BytesSent, s2.BytesSent)
+			bandwidthStat.BytesRecv = c.delta(s.BytesRecv, s2.BytesRecv)
+			bandwidthStat.PacketsSent = c.delta(s.PacketsSent, s2.PacketsSent)
+			bandwidthStat.PacketsRecv = c.delta(s.PacketsRecv, s2.PacketsRecv)
 			stats.BandwidthStat[s.Name] = bandwidthStat
 			netStats[s.Name] = &s
 		}
 	}
-
-	return stats
 }
 
 type SystemStats struct {
-	CPUStat struct {
-		User   float64
-		System float64
-		Idle   float64
-		Iowait float64
-	}
-	LoadStat struct {
+	CPUStat CPUStat
+	// IOWaitPercent is the percentage of the CPU time spent waiting for IO since the previous collection,
+	// see DiskIOStat.Pressure for the devices responsible. It is zero for the first collection.
+	IOWaitPercent float64
+	// CPUPercent is the CPU utilization of all cores since the previous collection, between 0 and 100,
+	// see Collector.CPUSource. It is zero for the first collection.
+	CPUPercent float64
+	// CPUCoreStat is the percentages of the time every core spent in user mode, kernel mode, idle and waiting
+	// for IO since the previous collection, keyed as core<n>. They are zero for the first collection and
+	// nil unless Collector.PerCPU is enabled.
+	CPUCoreStat map[string]CPUStat
+	LoadStat    struct {
 		Load1  float64
 		Load5  float64
 		Load15 float64
@@ -175,14 +685,80 @@ type SystemStats struct {
 		Total uint64
 		Free  uint64
 		Used  uint64
+		// In and Out are the bytes swapped in and out since the previous collection.
+		In  uint64
+		Out uint64
 	}
-	DiskStat      map[string]DiskStat
+	DiskStat map[string]DiskStat
+	// DiskIOStat is the IO of the block devices keyed by device name, e.g. sda.
+	DiskIOStat    map[string]DiskIOStat
 	BandwidthStat map[string]BandwidthStat
+
+	// CounterResets is the cumulative number of counters found reset when computing the stats
+	// since the previous collection, such as the bytes sent by a network interface.
+	CounterResets uint64
+
+	// Elapsed is the time since the previous collection measured by the monotonic clock, which the stats
+	// since the previous collection cover. It differs from CollectInterval when the ticker drifts, ticks
+	// are dropped or the machine is suspended, so rates must be computed with it, see Rate.
+	// It is zero for the first collection.
+	Elapsed time.Duration
+
+	// Warmup reports whether the stats are the first collected with FirstSampleWarmup, so the stats
+	// since the previous collection are zeros.
+	Warmup bool
+	// DeltasOmitted reports whether the stats since the previous collection are omitted from Values,
+	// it is set for the first collection with FirstSampleSuppress.
+	DeltasOmitted bool
+}
+
+// CPUStat represents the CPU times in hundredths of a second.
+type CPUStat struct {
+	User   float64
+	System float64
+	Idle   float64
+	Iowait float64
 }
 
 type DiskStat struct {
+	// Device is the device of the partition, e.g. /dev/sda1.
+	Device string
+	// Fstype is the filesystem type of the partition, e.g. ext4.
+	Fstype string
+	// Mountpoints are the mountpoints of the partition. It contains more than one
+	// mountpoint only if Collector.GroupDiskByDevice is enabled. The exporters label
+	// the metrics of the partition with them as mountpoints, they aren't in Values.
+	Mountpoints []string
+
 	Total uint64
 	Free  uint64
+
+	// InodesTotal and InodesFree are the number of inodes of the filesystem, they are zero for
+	// filesystems without a fixed number of inodes, e.g. btrfs.
+	InodesTotal uint64
+	InodesFree  uint64
+	// InodesUsedPercent is the percentage of the inodes in use, between 0 and 100.
+	InodesUsedPercent float64
+}
+
+// DiskIOStat represents the IO of a device since the previous collection.
+type DiskIOStat struct {
+	ReadBytes  uint64
+	WriteBytes uint64
+	// ReadCount and WriteCount are the number of completed operations.
+	ReadCount  uint64
+	WriteCount uint64
+	// ReadTime and WriteTime are the time spent on the operations in nanoseconds, with millisecond precision.
+	ReadTime  uint64
+	WriteTime uint64
+	// IOTime is the time the device was busy, and WeightedIOTime the time the requests were queued or
+	// in flight summed over the requests, both in nanoseconds.
+	IOTime         uint64
+	WeightedIOTime uint64
+
+	// Pressure is the part of SystemStats.IOWaitPercent attributed to the device by its share of
+	// WeightedIOTime, so the device responsible for an iowait spike has the highest pressure.
+	Pressure float64
 }
 
 type BandwidthStat struct {
@@ -192,8 +768,32 @@ type BandwidthStat struct {
 	PacketsRecv uint64
 }
 
+// Rate returns v, a stat since the previous collection such as BandwidthStat.BytesSent, per second
+// of Elapsed. It returns 0 if Elapsed is zero.
+func (ss *SystemStats) Rate(v uint64) float64 {
+	if ss.Elapsed <= 0 {
+		return 0
+	}
+	return float64(v) / ss.Elapsed.Seconds()
+}
+
+// Tags returns the tags of the stats, i.e. warmup=true if Warmup is set, or nil.
+func (ss *SystemStats) Tags() map[string]string {
+	if !ss.Warmup {
+		return nil
+	}
+	return map[string]string{"warmup": "true"}
+}
+
 // Values returns metrics which you can write into TSDB.
+// Partitions and network interfaces are embedded in keys as is, see SanitizedValues.
 func (ss *SystemStats) Values() map[string]interface{} {
+	return ss.SanitizedValues(sanitize.Raw)
+}
+
+// SanitizedValues returns metrics like Values, but partitions and network interfaces embedded in keys
+// are sanitized by s, e.g. sanitize.Graphite turns "disk./.total" into "disk._root.total".
+func (ss *SystemStats) SanitizedValues(s sanitize.Func) map[string]interface{} {
 	values := map[string]interface{}{
 		"cpu.user":   ss.CPUStat.User,
 		"cpu.system": ss.CPUStat.System,
@@ -210,19 +810,114 @@ func (ss *SystemStats) Values() map[string]interface{} {
 		"swap.total":    ss.SwapMemStat.Total,
 		"swap.free":     ss.SwapMemStat.Free,
 		"swap.used":     ss.SwapMemStat.Used,
+
+		"counter_resets": ss.CounterResets,
+		"elapsed":        uint64(ss.Elapsed),
+	}
+
+	for core, stat := range ss.CPUCoreStat {
+		values["cpu."+core+".user"] = stat.User
+		values["cpu."+core+".system"] = stat.System
+		values["cpu."+core+".idle"] = stat.Idle
+		values["cpu."+core+".iowait"] = stat.Iowait
 	}
 
+	var diskTotal DiskStat
+	counted := make(map[string]bool, len(ss.DiskStat)) // devices in diskTotal
 	for partition, stat := range ss.DiskStat {
+		partition = s(partition)
 		values["disk."+partition+".total"] = stat.Total
 		values["disk."+partition+".free"] = stat.Free
-	}
+		values["disk."+partition+".inodes_total"] = stat.InodesTotal
+		values["disk."+partition+".inodes_free"] = stat.InodesFree
+		values["disk."+partition+".inodes_used_percent"] = stat.InodesUsedPercent
 
-	for n, stat := range ss.BandwidthStat {
+		if stat.Fstype != "" && !PhysicalFilesystems(stat.Fstype) {
+			continue
+		}
+		// bind mounts and multiple mounts of a device are counted once
+		if strings.HasPrefix(stat.Device, "/dev/") {
+			if counted[stat.Device] {
+				continue
+			}
+			counted[stat.Device] = true
+		}
+		diskTotal.Total += stat.Total
+		diskTotal.Free += stat.Free
+		diskTotal.InodesTotal += stat.InodesTotal
+		diskTotal.InodesFree += stat.InodesFree
+	}
+	if diskTotal.InodesTotal > 0 && diskTotal.InodesFree <= diskTotal.InodesTotal {
+		diskTotal.InodesUsedPercent = float64(diskTotal.InodesTotal-diskTotal.InodesFree) / float64(diskTotal.InodesTotal) * 100
+	}
+	values["disk."+Rollup+".total"] = diskTotal.Total
+	values["disk."+Rollup+".free"] = diskTotal.Free
+	values["disk."+Rollup+".inodes_total"] = diskTotal.InodesTotal
+	values["disk."+Rollup+".inodes_free"] = diskTotal.InodesFree
+	values["disk."+Rollup+".inodes_used_percent"] = diskTotal.InodesUsedPercent
+
+	if ss.DeltasOmitted {
+		return values
+	}
+	values["cpu.percent"] = ss.CPUPercent
+	values["cpu.iowait_percent"] = ss.IOWaitPercent
+	values["swap.in"] = ss.SwapMemStat.In
+	values["swap.out"] = ss.SwapMemStat.Out
+
+	var ioTotal DiskIOStat
+	for name, stat := range ss.DiskIOStat {
+		dev := s(name)
+		values["disk_io."+dev+".read_bytes"] = stat.ReadBytes
+		values["disk_io."+dev+".write_bytes"] = stat.WriteBytes
+		values["disk_io."+dev+".read_count"] = stat.ReadCount
+		values["disk_io."+dev+".write_count"] = stat.WriteCount
+		values["disk_io."+dev+".read_time"] = stat.ReadTime
+		values["disk_io."+dev+".write_time"] = stat.WriteTime
+		values["disk_io."+dev+".io_time"] = stat.IOTime
+		values["disk_io."+dev+".weighted_io_time"] = stat.WeightedIOTime
+		values["disk_io."+dev+".pressure"] = stat.Pressure
+
+		if !isPhysicalDisk(name, ss.DiskIOStat) {
+			continue
+		}
+		ioTotal.ReadBytes += stat.ReadBytes
+		ioTotal.WriteBytes += stat.WriteBytes
+		ioTotal.ReadCount += stat.ReadCount
+		ioTotal.WriteCount += stat.WriteCount
+		ioTotal.ReadTime += stat.ReadTime
+		ioTotal.WriteTime += stat.WriteTime
+		ioTotal.IOTime += stat.IOTime
+		ioTotal.WeightedIOTime += stat.WeightedIOTime
+	}
+	values["disk_io."+Rollup+".read_bytes"] = ioTotal.ReadBytes
+	values["disk_io."+Rollup+".write_bytes"] = ioTotal.WriteBytes
+	values["disk_io."+Rollup+".read_count"] = ioTotal.ReadCount
+	values["disk_io."+Rollup+".write_count"] = ioTotal.WriteCount
+	values["disk_io."+Rollup+".read_time"] = ioTotal.ReadTime
+	values["disk_io."+Rollup+".write_time"] = ioTotal.WriteTime
+	values["disk_io."+Rollup+".io_time"] = ioTotal.IOTime
+	values["disk_io."+Rollup+".weighted_io_time"] = ioTotal.WeightedIOTime
+
+	var netTotal BandwidthStat
+	for name, stat := range ss.BandwidthStat {
+		n := s(name)
 		values["net."+n+".bytes_sent"] = stat.BytesSent
 		values["net."+n+".bytes_recv"] = stat.BytesRecv
 		values["net."+n+".packets_sent"] = stat.PacketsSent
 		values["net."+n+".packets_recv"] = stat.PacketsRecv
+
+		if isLoopback(name) {
+			continue
+		}
+		netTotal.BytesSent += stat.BytesSent
+		netTotal.BytesRecv += stat.BytesRecv
+		netTotal.PacketsSent += stat.PacketsSent
+		netTotal.PacketsRecv += stat.PacketsRecv
 	}
+	values["net."+Rollup+".bytes_sent"] = netTotal.BytesSent
+	values["net."+Rollup+".bytes_recv"] = netTotal.BytesRecv
+	values["net."+Rollup+".packets_sent"] = netTotal.PacketsSent
+	values["net."+Rollup+".packets_recv"] = netTotal.PacketsRecv
 
 	return values
 }
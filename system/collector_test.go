@@ -1,8 +1,19 @@
 package system
 
 import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/smallnest/go-app-metrics/sanitize"
+	"github.com/smallnest/go-app-metrics/status"
 )
 
 func TestCollectorOnce(t *testing.T) {
@@ -72,3 +83,433 @@ func TestCollector(t *testing.T) {
 	}
 
 }
+
+func TestSanitizedValues(t *testing.T) {
+	stats := SystemStats{
+		DiskStat:      map[string]DiskStat{"/": {Total: 10}, "/var/lib": {Total: 20}},
+		BandwidthStat: map[string]BandwidthStat{"eth0:1": {BytesSent: 30}},
+	}
+
+	values := stats.SanitizedValues(sanitize.Graphite)
+	expValues := map[string]interface{}{
+		"disk._root.total":      uint64(10),
+		"disk.var_lib.total":    uint64(20),
+		"net.eth0_1.bytes_sent": uint64(30),
+	}
+	for k, v := range expValues {
+		if values[k] != v {
+			t.Errorf("expected key (%s) = %v, got %v", k, v, values[k])
+		}
+	}
+
+	if _, ok := stats.Values()["disk./.total"]; !ok {
+		t.Errorf("expected key (disk./.total) not found")
+	}
+}
+
+func TestGroupDiskByDevice(t *testing.T) {
+	c := New(nil)
+	c.partitions = []string{"/", "/", "/proc"}
+	c.devices = map[string]string{"/": "/dev/fake0", "/proc": "proc"}
+	c.GroupDiskByDevice = true
+
+	stats := c.Once()
+	if _, ok := stats.DiskStat["fake0"]; !ok {
+		t.Fatalf("expected disk (fake0) not found")
+	}
+	if mps := stats.DiskStat["fake0"].Mountpoints; len(mps) != 2 {
+		t.Errorf("expected 2 mountpoints of fake0, got %v", mps)
+	}
+	if _, ok := stats.DiskStat["/"]; ok {
+		t.Errorf("unexpected disk (/) keyed by mountpoint")
+	}
+	if _, ok := stats.DiskStat["/proc"]; !ok {
+		t.Errorf("expected disk (/proc) not found")
+	}
+}
+
+func TestPartitionFilter(t *testing.T) {
+	c := NewWithOptions(nil, WithNet(false),
+		WithPartitionFilter(Not(GlobFilter("/dev"))), WithFSTypeFilter(PhysicalFilesystems))
+	c.partitions = []string{"/", "/dev", "/proc"}
+	c.fstypes = map[string]string{"/": "ext4", "/dev": "ext4", "/proc": "proc"}
+
+	stats := c.Once()
+	if _, ok := stats.DiskStat["/"]; !ok {
+		t.Errorf("expected disk (/) not found")
+	}
+	for _, p := range []string{"/dev", "/proc"} {
+		if _, ok := stats.DiskStat[p]; ok {
+			t.Errorf("unexpected disk (%s) not filtered", p)
+		}
+	}
+}
+
+func TestInterfaceFilter(t *testing.T) {
+	c := New(nil)
+	c.InterfaceFilter = Not(GlobFilter("lo"))
+
+	stats := c.Once()
+	if _, ok := stats.BandwidthStat["lo"]; ok {
+		t.Errorf("unexpected interface (lo)")
+	}
+}
+
+func TestRollupValues(t *testing.T) {
+	stats := SystemStats{
+		DiskStat: map[string]DiskStat{
+			"/":         {Device: "/dev/sda1", Fstype: "ext4", Total: 10, Free: 1, InodesTotal: 100, InodesFree: 10, InodesUsedPercent: 90},
+			"/data":     {Device: "/dev/sdb1", Total: 20, Free: 2, InodesTotal: 300, InodesFree: 290, InodesUsedPercent: 10 / 3.0},
+			"/mnt/bind": {Device: "/dev/sdb1", Total: 20, Free: 2, InodesTotal: 300, InodesFree: 290},
+			"/run":      {Device: "tmpfs", Fstype: "tmpfs", Total: 5, Free: 5},
+		},
+		BandwidthStat: map[string]BandwidthStat{"eth0": {BytesSent: 30}, "eth1": {BytesSent: 12}, "lo": {BytesSent: 100}},
+	}
+
+	values := stats.Values()
+	expValues := map[string]interface{}{
+		"disk.total.total":               uint64(30),
+		"disk.total.free":                uint64(3),
+		"disk./.inodes_free":             uint64(10),
+		"disk.total.inodes_total":        uint64(400),
+		"disk.total.inodes_used_percent": 25.0,
+		"net.total.bytes_sent":           uint64(42),
+		"net.total.bytes_recv":           uint64(0),
+		"net.lo.bytes_sent":              uint64(100),
+		"disk./run.total":                uint64(5),
+	}
+	for k, v := range expValues {
+		if values[k] != v {
+			t.Errorf("expected key (%s) = %v, got %v", k, v, values[k])
+		}
+	}
+}
+
+func TestDiskIORollup(t *testing.T) {
+	sysBlock = t.TempDir()
+	defer func() { sysBlock = "/sys/block" }()
+
+	stats := SystemStats{DiskIOStat: map[string]DiskIOStat{
+		"sda":       {ReadBytes: 10},
+		"sda1":      {ReadBytes: 10},
+		"nvme0n1":   {ReadBytes: 5},
+		"nvme0n1p1": {ReadBytes: 4},
+		"dm-0":      {ReadBytes: 4},
+		"md0":       {ReadBytes: 10},
+	}}
+	if v := stats.Values()["disk_io.total.read_bytes"]; v != uint64(15) {
+		t.Errorf("expected the read bytes of the whole disks, got %v", v)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for name, loopback := range map[string]bool{"lo": true, "lo0": true, "eth0": false, "lowpan0": false} {
+		if isLoopback(name) != loopback {
+			t.Errorf("expected isLoopback(%s) = %v", name, loopback)
+		}
+	}
+}
+
+func TestPerCPU(t *testing.T) {
+	c := New(nil)
+	c.EnableDisk = false
+	c.EnableNet = false
+	c.PerCPU = true
+
+	stats := c.Once()
+	if len(stats.CPUCoreStat) == 0 {
+		t.Fatalf("expected per core stats")
+	}
+	if _, ok := stats.Values()["cpu.core0.user"]; !ok {
+		t.Errorf("expected key (cpu.core0.user) not found")
+	}
+	if stats.CPUCoreStat["core0"] != (CPUStat{}) {
+		t.Errorf("expected zero per core stats for the first collection, got %+v", stats.CPUCoreStat["core0"])
+	}
+	stats = c.Once()
+	for core, stat := range stats.CPUCoreStat {
+		if sum := stat.User + stat.System + stat.Idle + stat.Iowait; sum > 100.01 {
+			t.Errorf("expected percentages of %s, got %+v", core, stat)
+		}
+	}
+
+	c.PerCPU = false
+	stats = c.Once()
+	if stats.CPUCoreStat != nil {
+		t.Errorf("unexpected per core stats")
+	}
+}
+
+func TestDiskIO(t *testing.T) {
+	c := New(nil)
+	c.partitions = nil
+	c.EnableNet = false
+
+	c.Once()
+	stats := c.Once()
+	values := stats.Values()
+	for dev := range stats.DiskIOStat {
+		if _, ok := values["disk_io."+dev+".read_bytes"]; !ok {
+			t.Errorf("expected key (disk_io.%s.read_bytes) not found", dev)
+		}
+	}
+	if _, ok := values["disk_io.total.write_time"]; !ok {
+		t.Errorf("expected key (disk_io.total.write_time) not found")
+	}
+}
+
+func TestFirstSample(t *testing.T) {
+	c := NewWithOptions(nil, WithFirstSample(FirstSampleSuppress))
+	c.partitions = nil
+
+	stats := c.Once()
+	if !stats.DeltasOmitted || len(stats.DiskIOStat) != 0 || len(stats.BandwidthStat) != 0 {
+		t.Errorf("expected the stats since the previous collection omitted from the first collection")
+	}
+	values := stats.Values()
+	for _, key := range []string{"swap.in", "disk_io.total.read_bytes", "net.total.bytes_sent"} {
+		if _, ok := values[key]; ok {
+			t.Errorf("unexpected key (%s) in the first collection", key)
+		}
+	}
+	stats = c.Once()
+	if _, ok := stats.Values()["swap.in"]; !ok {
+		t.Errorf("expected key (swap.in) not found in the second collection")
+	}
+	if stats.Elapsed <= 0 {
+		t.Errorf("expected the elapsed time of the second collection, got %v", stats.Elapsed)
+	}
+
+	c = NewWithOptions(nil, WithFirstSample(FirstSampleWarmup))
+	c.partitions = nil
+	stats = c.Once()
+	if !stats.Warmup || stats.Tags()["warmup"] != "true" {
+		t.Errorf("expected the first collection tagged warmup")
+	}
+	if _, ok := stats.Values()["swap.in"]; !ok {
+		t.Errorf("expected key (swap.in) not found")
+	}
+	stats = c.Once()
+	if stats.Warmup || stats.Tags() != nil {
+		t.Errorf("expected the second collection not tagged warmup")
+	}
+}
+
+func TestCounterReset(t *testing.T) {
+	c := New(nil)
+	if d := c.delta(150, 100); d != 50 {
+		t.Errorf("expected delta 50, got %d", d)
+	}
+	// the counter has been reset and counted 30 since
+	if d := c.delta(30, 100); d != 30 {
+		t.Errorf("expected delta 30, got %d", d)
+	}
+	if c.resets != 1 {
+		t.Errorf("expected 1 reset, got %d", c.resets)
+	}
+}
+
+func TestSwapDelta(t *testing.T) {
+	var sin, sout uint64
+	swapMemory = func() (*mem.SwapMemoryStat, error) {
+		return &mem.SwapMemoryStat{Total: 1000, Sin: sin, Sout: sout}, nil
+	}
+	defer func() { swapMemory = mem.SwapMemory }()
+
+	c := NewWithOptions(nil, WithDisk(false), WithNet(false))
+	sin, sout = 100, 200
+	stats := c.Once()
+	if stats.SwapMemStat.In != 0 || stats.SwapMemStat.Out != 0 {
+		t.Errorf("expected no swap in/out on the first collection, got %+v", stats.SwapMemStat)
+	}
+
+	sin, sout = 150, 260
+	stats = c.Once()
+	if stats.SwapMemStat.In != 50 || stats.SwapMemStat.Out != 60 {
+		t.Errorf("expected swap in 50 and out 60, got %+v", stats.SwapMemStat)
+	}
+
+	// the counters have been reset, e.g. by a swapoff and swapon, and counted 10 and 20 since
+	sin, sout = 10, 20
+	stats = c.Once()
+	if stats.SwapMemStat.In != 10 || stats.SwapMemStat.Out != 20 {
+		t.Errorf("expected swap in 10 and out 20 after a reset, got %+v", stats.SwapMemStat)
+	}
+	if stats.CounterResets != 2 {
+		t.Errorf("expected 2 counter resets, got %d", stats.CounterResets)
+	}
+}
+
+func TestCounterWrap(t *testing.T) {
+	c := New(nil)
+	// a 32-bit counter wrapped
+	if d := c.delta(10, math.MaxUint32-9); d != 20 {
+		t.Errorf("expected delta 20 for a 32-bit wrap, got %d", d)
+	}
+	// a 64-bit counter wrapped
+	if d := c.delta(10, math.MaxUint64-9); d != 20 {
+		t.Errorf("expected delta 20 for a 64-bit wrap, got %d", d)
+	}
+	if c.resets != 0 {
+		t.Errorf("expected wraps not counted as resets, got %d", c.resets)
+	}
+}
+
+func TestCollectorStop(t *testing.T) {
+	c := New(nil)
+	c.partitions = nil
+	c.CollectInterval = 10 * time.Millisecond
+
+	done := make(chan error)
+	go func() { done <- c.RunContext(context.Background()) }()
+	time.Sleep(30 * time.Millisecond)
+	c.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Logf("collection errors: %v", err)
+		}
+	default:
+		t.Error("expected RunContext returned after Stop")
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	var errs []error
+	c := NewWithOptions(nil, WithPartitions("/nonexistent/partition"), WithNet(false),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }))
+	c.Once()
+
+	var disk *status.ProbeError
+	for _, err := range errs {
+		var pe *status.ProbeError
+		if errors.As(err, &pe) && pe.Probe == "disk" {
+			disk = pe
+		}
+	}
+	if disk == nil || disk.Collector != "system" {
+		t.Fatalf("expected the error of the disk probe reported, got %v", errs)
+	}
+}
+
+func TestCPUPercent(t *testing.T) {
+	prev := &cpu.TimesStat{User: 10, System: 10, Idle: 70, Iowait: 10}
+	cur := &cpu.TimesStat{User: 25, System: 15, Idle: 120, Iowait: 20}
+	if p := busyPercent(prev, cur); p != 25 {
+		t.Errorf("expected 25 percent busy, got %v", p)
+	}
+	if p := busyPercent(cur, prev); p != 0 {
+		t.Errorf("expected 0 percent busy for decreased times, got %v", p)
+	}
+	if p := cpuPercents(prev, cur); p != (CPUStat{User: 18.75, System: 6.25, Idle: 62.5, Iowait: 12.5}) {
+		t.Errorf("expected the percentages of every mode, got %+v", p)
+	}
+
+	for _, source := range []CPUSource{CPUTimes, CPUPercentSampler} {
+		c := NewWithOptions(nil, WithCPUSource(source), WithDisk(false), WithNet(false))
+		if stats := c.Once(); stats.CPUPercent != 0 {
+			t.Errorf("expected no percentage on the first collection with source %d, got %v", source, stats.CPUPercent)
+		}
+		time.Sleep(50 * time.Millisecond)
+		stats := c.Once()
+		if stats.CPUPercent < 0 || stats.CPUPercent > 100 {
+			t.Errorf("expected a percentage with source %d, got %v", source, stats.CPUPercent)
+		}
+		if _, ok := stats.Values()["cpu.percent"]; !ok {
+			t.Errorf("expected key (cpu.percent) not found")
+		}
+	}
+}
+
+func TestIOWaitAttribution(t *testing.T) {
+	prev := &cpu.TimesStat{User: 10, Idle: 80, Iowait: 10}
+	cur := &cpu.TimesStat{User: 20, Idle: 140, Iowait: 40}
+	iowait := iowaitPercent(prev, cur)
+	if iowait != 30 {
+		t.Fatalf("expected 30 percent iowait, got %v", iowait)
+	}
+
+	sysBlock = t.TempDir()
+	defer func() { sysBlock = "/sys/block" }()
+
+	devices := map[string]DiskIOStat{
+		"sda":       {WeightedIOTime: 300},
+		"sda1":      {WeightedIOTime: 300},
+		"nvme0n1":   {WeightedIOTime: 100},
+		"nvme0n1p1": {WeightedIOTime: 60},
+	}
+	attributeIOWait(iowait, devices)
+	expected := map[string]float64{"sda": 22.5, "sda1": 22.5, "nvme0n1": 7.5, "nvme0n1p1": 4.5}
+	for dev, p := range expected {
+		if got := devices[dev].Pressure; math.Abs(got-p) > 1e-9 {
+			t.Errorf("expected pressure %v of %s, got %v", p, dev, got)
+		}
+	}
+}
+
+func TestPartitionOf(t *testing.T) {
+	sysBlock = t.TempDir()
+	defer func() { sysBlock = "/sys/block" }()
+
+	for _, c := range []struct {
+		dev, disk string
+		partition bool
+	}{
+		{"sda1", "sda", true},
+		{"sdaa", "sda", false},
+		{"sdaa1", "sda", false},
+		{"vdb2", "vdb", true},
+		{"nvme0n1p1", "nvme0n1", true},
+		{"nvme0n10", "nvme0n1", false},
+		{"mmcblk0p2", "mmcblk0", true},
+		{"loop1p1", "loop1", true},
+		{"loop10", "loop1", false},
+		{"dm-10", "dm-1", false},
+		{"sda", "sda", false},
+	} {
+		if got := partitionOf(c.dev, c.disk); got != c.partition {
+			t.Errorf("expected partitionOf(%s, %s) = %v, got %v", c.dev, c.disk, c.partition, got)
+		}
+	}
+
+	// sysfs knows the partitions of a disk
+	if err := os.MkdirAll(filepath.Join(sysBlock, "loop1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if partitionOf("loop1p1", "loop1") {
+		t.Errorf("expected loop1p1 not to be a partition of loop1 without its sysfs directory")
+	}
+	if err := os.MkdirAll(filepath.Join(sysBlock, "loop1", "loop1p1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if !partitionOf("loop1p1", "loop1") {
+		t.Errorf("expected loop1p1 to be a partition of loop1")
+	}
+
+	devices := map[string]DiskIOStat{
+		"loop1": {WeightedIOTime: 100}, "loop10": {WeightedIOTime: 100},
+		"dm-1": {WeightedIOTime: 100}, "dm-10": {WeightedIOTime: 100},
+	}
+	attributeIOWait(40, devices)
+	for dev, s := range devices {
+		if math.Abs(s.Pressure-10) > 1e-9 {
+			t.Errorf("expected pressure 10 of %s, got %v", dev, s.Pressure)
+		}
+	}
+}
+
+func TestOnceConcurrent(t *testing.T) {
+	c := New(nil)
+	c.EnableDisk = false
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Once()
+		}()
+	}
+	wg.Wait()
+}
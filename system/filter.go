@@ -0,0 +1,86 @@
+package system
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Filter reports whether a name, such as a network interface or a mountpoint, should be collected.
+type Filter func(name string) bool
+
+// GlobFilter returns a Filter which matches names against glob patterns, see path.Match for the syntax.
+func GlobFilter(patterns ...string) Filter {
+	return func(name string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RegexpFilter returns a Filter which matches names against regular expressions.
+func RegexpFilter(exprs ...*regexp.Regexp) Filter {
+	return func(name string) bool {
+		for _, re := range exprs {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// virtualInterfacePrefixes are the name prefixes of loopback and virtual network interfaces
+// created by container runtimes, bridges, CNI plugins and VPNs.
+var virtualInterfacePrefixes = []string{
+	"lo", "veth", "docker", "br-", "virbr", "cni", "flannel", "cali", "vxlan", "kube-", "tun", "tap", "dummy",
+}
+
+// PhysicalInterfaces is a Filter which drops loopback and well known virtual interfaces,
+// such as lo, veth*, docker*, br-*, cni*, flannel* and cali*.
+func PhysicalInterfaces(name string) bool {
+	for _, p := range virtualInterfacePrefixes {
+		if strings.HasPrefix(name, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// virtualFilesystems are the types of pseudo and in-memory filesystems, and of the overlay
+// filesystems of containers.
+var virtualFilesystems = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true, "ramfs": true,
+	"cgroup": true, "cgroup2": true, "mqueue": true, "debugfs": true, "tracefs": true, "securityfs": true,
+	"pstore": true, "bpf": true, "autofs": true, "hugetlbfs": true, "configfs": true, "fusectl": true,
+	"nsfs": true, "binfmt_misc": true, "rpc_pipefs": true, "overlay": true, "aufs": true, "squashfs": true,
+}
+
+// PhysicalFilesystems is a Filter of filesystem types which drops pseudo filesystems, such as proc
+// and cgroup, in-memory filesystems, such as tmpfs, and the overlay and squashfs mounts of
+// containers and snaps.
+func PhysicalFilesystems(fstype string) bool {
+	return !virtualFilesystems[fstype]
+}
+
+// And returns a Filter which matches names matched by all filters.
+func And(filters ...Filter) Filter {
+	return func(name string) bool {
+		for _, f := range filters {
+			if !f(name) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Not returns a Filter which matches names not matched by f.
+func Not(f Filter) Filter {
+	return func(name string) bool {
+		return !f(name)
+	}
+}
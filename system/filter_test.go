@@ -0,0 +1,38 @@
+package system
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilters(t *testing.T) {
+	glob := GlobFilter("eth*", "en?0")
+	assert.True(t, glob("eth0"))
+	assert.True(t, glob("ens0"))
+	assert.False(t, glob("wlan0"))
+
+	re := RegexpFilter(regexp.MustCompile(`^bond\d+$`))
+	assert.True(t, re("bond0"))
+	assert.False(t, re("bond0.100"))
+
+	for _, name := range []string{"lo", "veth1234", "docker0", "br-1a2b", "cni0", "flannel.1", "cali123"} {
+		assert.False(t, PhysicalInterfaces(name), name)
+	}
+	for _, name := range []string{"eth0", "ens5", "enp0s3", "wlan0", "bond0"} {
+		assert.True(t, PhysicalInterfaces(name), name)
+	}
+
+	f := And(PhysicalInterfaces, Not(GlobFilter("wlan*")))
+	assert.True(t, f("eth0"))
+	assert.False(t, f("wlan0"))
+	assert.False(t, f("lo"))
+
+	for _, fstype := range []string{"tmpfs", "overlay", "proc", "cgroup2"} {
+		assert.False(t, PhysicalFilesystems(fstype), fstype)
+	}
+	for _, fstype := range []string{"ext4", "xfs", "btrfs", "nfs"} {
+		assert.True(t, PhysicalFilesystems(fstype), fstype)
+	}
+}
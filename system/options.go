@@ -0,0 +1,102 @@
+package system
+
+import (
+	"context"
+	"time"
+)
+
+// Option configures a Collector created by NewWithOptions.
+type Option func(*Collector)
+
+// NewWithOptions creates a new Collector like New and applies opts, so the Collector is fully
+// configured before it is shared with another goroutine.
+//
+//	c := system.NewWithOptions(handler, system.WithInterfaces("eth*"), system.WithContext(ctx))
+//	go c.Run()
+func NewWithOptions(statsHandler SystemStatsHandler, opts ...Option) *Collector {
+	c := New(statsHandler)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithInterval sets CollectInterval.
+func WithInterval(d time.Duration) Option {
+	return func(c *Collector) { c.CollectInterval = d }
+}
+
+// WithDisk sets EnableDisk.
+func WithDisk(enabled bool) Option {
+	return func(c *Collector) { c.EnableDisk = enabled }
+}
+
+// WithNet sets EnableNet.
+func WithNet(enabled bool) Option {
+	return func(c *Collector) { c.EnableNet = enabled }
+}
+
+// WithPerCPU sets PerCPU.
+func WithPerCPU(enabled bool) Option {
+	return func(c *Collector) { c.PerCPU = enabled }
+}
+
+// WithGroupDiskByDevice sets GroupDiskByDevice.
+func WithGroupDiskByDevice(enabled bool) Option {
+	return func(c *Collector) { c.GroupDiskByDevice = enabled }
+}
+
+// WithPartitions collects only the partitions mounted at mountpoints instead of all partitions.
+func WithPartitions(mountpoints ...string) Option {
+	return func(c *Collector) { c.partitions = append([]string(nil), mountpoints...) }
+}
+
+// WithInterfaces collects only the network interfaces matching the glob patterns, it sets InterfaceFilter.
+func WithInterfaces(patterns ...string) Option {
+	return func(c *Collector) { c.InterfaceFilter = GlobFilter(patterns...) }
+}
+
+// WithInterfaceFilter sets InterfaceFilter.
+func WithInterfaceFilter(f Filter) Option {
+	return func(c *Collector) { c.InterfaceFilter = f }
+}
+
+// WithFirstSample sets FirstSample.
+func WithFirstSample(f FirstSample) Option {
+	return func(c *Collector) { c.FirstSample = f }
+}
+
+// WithCPUSource sets CPUSource.
+func WithCPUSource(s CPUSource) Option {
+	return func(c *Collector) { c.CPUSource = s }
+}
+
+// WithPartitionFilter sets PartitionFilter.
+func WithPartitionFilter(f Filter) Option {
+	return func(c *Collector) { c.PartitionFilter = f }
+}
+
+// WithFSTypeFilter sets FSTypeFilter.
+func WithFSTypeFilter(f Filter) Option {
+	return func(c *Collector) { c.FSTypeFilter = f }
+}
+
+// WithExcludeInterfaces drops the network interfaces matching the glob patterns, it sets InterfaceFilter.
+func WithExcludeInterfaces(patterns ...string) Option {
+	return func(c *Collector) { c.InterfaceFilter = Not(GlobFilter(patterns...)) }
+}
+
+// WithContext makes Run return when ctx is done, it sets Done.
+func WithContext(ctx context.Context) Option {
+	return func(c *Collector) { c.Done = ctx.Done() }
+}
+
+// WithPanicHandler sets PanicHandler.
+func WithPanicHandler(f func(err error)) Option {
+	return func(c *Collector) { c.PanicHandler = f }
+}
+
+// WithErrorHandler sets ErrorHandler.
+func WithErrorHandler(f func(err error)) Option {
+	return func(c *Collector) { c.ErrorHandler = f }
+}
@@ -0,0 +1,21 @@
+package system
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	c := NewWithOptions(nil, WithInterval(time.Minute), WithNet(false), WithPartitions("/"), WithInterfaces("eth*"))
+	assert.Equal(t, time.Minute, c.CollectInterval)
+	assert.False(t, c.EnableNet)
+	assert.True(t, c.InterfaceFilter("eth0"))
+	assert.False(t, c.InterfaceFilter("lo"))
+
+	stats := c.Once()
+	assert.Len(t, stats.DiskStat, 1)
+	assert.Contains(t, stats.DiskStat, "/")
+	assert.Empty(t, stats.BandwidthStat)
+}
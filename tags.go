@@ -0,0 +1,53 @@
+package appmetrics
+
+// SetTag sets a dynamic tag, e.g. role=leader or shard=3, which is added to the snapshots collected
+// from now on, so exporters can tell apart the metrics of a node by its current role during failovers.
+// It is safe to call while the Runner is running.
+func (r *Runner) SetTag(key, value string) {
+	r.updateTags(func(tags map[string]string) { tags[key] = value })
+}
+
+// DeleteTag removes a dynamic tag set by SetTag from the snapshots collected from now on.
+func (r *Runner) DeleteTag(key string) {
+	r.updateTags(func(tags map[string]string) { delete(tags, key) })
+}
+
+// Tags returns a copy of the dynamic tags set by SetTag.
+func (r *Runner) Tags() map[string]string {
+	return copyTags(r.currentTags())
+}
+
+// currentTags returns the dynamic tags, the map is shared by the snapshots and must not be modified.
+func (r *Runner) currentTags() map[string]string {
+	if tags := r.tags.Load(); tags != nil {
+		return *tags
+	}
+	return nil
+}
+
+// updateTags replaces the dynamic tags by a copy modified by f, so the tags of collected snapshots don't change.
+func (r *Runner) updateTags(f func(map[string]string)) {
+	r.tagsMu.Lock()
+	defer r.tagsMu.Unlock()
+
+	tags := copyTags(r.currentTags())
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	f(tags)
+	if len(tags) == 0 {
+		tags = nil
+	}
+	r.tags.Store(&tags)
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return nil
+	}
+	c := make(map[string]string, len(tags))
+	for k, v := range tags {
+		c[k] = v
+	}
+	return c
+}
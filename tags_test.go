@@ -0,0 +1,35 @@
+package appmetrics
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTags(t *testing.T) {
+	r := NewRunner(nil)
+	r.System.EnableDisk = false
+	r.System.EnableNet = false
+	assert.Nil(t, r.Once().Tags)
+
+	r.SetTag("role", "leader")
+	r.SetTag("shard", "3")
+	leader := r.Once()
+	r.SetTag("role", "follower")
+	r.DeleteTag("shard")
+	follower := r.Once()
+
+	assert.Equal(t, map[string]string{"role": "leader", "shard": "3"}, leader.Tags)
+	assert.Equal(t, map[string]string{"role": "follower"}, follower.Tags)
+	assert.Equal(t, map[string]string{"role": "follower"}, r.Tags())
+	assert.Equal(t, "follower", follower.AllTags()["role"])
+	assert.NotEmpty(t, follower.AllTags()["go.version"])
+
+	data, err := json.Marshal(leader)
+	assert.NoError(t, err)
+	var decoded Snapshot
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, leader.Tags, decoded.Tags)
+	assert.Equal(t, leader.Runtime.Version, decoded.Runtime.Version)
+}
@@ -0,0 +1,280 @@
+// Package textfile provides a collector, like the textfile collector of node_exporter, which reads
+// metrics from files in a directory every interval, so cron jobs and other tools can drop metrics to export.
+//
+// Files named *.prom are in the Prometheus text format:
+//
+//	# HELP backup_last_success_seconds Time of the last successful backup.
+//	backup_last_success_seconds 1.6981e+09
+//	backup_size_bytes{db="users"} 52428800
+//
+// Files named *.txt contain key=value lines:
+//
+//	backup.last_success=1698100000
+//	backup.users.size=52428800
+//
+// Files should be written to a temporary name and renamed to avoid reading them partially written.
+// Hidden files are ignored.
+package textfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TextfileStatsHandler represents a handler to handle stats after successfully gathering statistics
+type TextfileStatsHandler func(TextfileStats)
+
+// Collector implements the periodic reading of metric files in a directory to a TextfileStatsHandler.
+type Collector struct {
+	// CollectInterval represents the interval in-between each set of stats output.
+	// Defaults to 10 seconds.
+	CollectInterval time.Duration
+
+	// Done, when closed, is used to signal Collector that is should stop collecting
+	// statistics and the Run function should return.
+	Done <-chan struct{}
+
+	dir          string
+	statsHandler TextfileStatsHandler
+}
+
+// New creates a new Collector that will periodically read the metric files in dir and output statistics to statsHandler.
+func New(statsHandler TextfileStatsHandler, dir string) *Collector {
+	if statsHandler == nil {
+		statsHandler = func(TextfileStats) {}
+	}
+
+	return &Collector{
+		CollectInterval: 10 * time.Second,
+		dir:             dir,
+		statsHandler:    statsHandler,
+	}
+}
+
+// Run gathers statistics then outputs them to the configured TextfileStatsHandler every
+// CollectInterval. Unlike Once, this function will return until Done has been closed
+// (or never if Done is nil), therefore it should be called in its own goroutine.
+func (c *Collector) Run() {
+	c.statsHandler(c.collectStats())
+
+	tick := time.NewTicker(c.CollectInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-tick.C:
+			c.statsHandler(c.collectStats())
+		}
+	}
+}
+
+// Once returns the metrics of the files. It is safe for use from multiple go routines.
+func (c *Collector) Once() TextfileStats {
+	return c.collectStats()
+}
+
+func (c *Collector) collectStats() TextfileStats {
+	stats := TextfileStats{
+		Metrics: make(map[string]float64),
+		Files:   make(map[string]FileStat),
+	}
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		stats.Err = err
+		return stats
+	}
+
+	// entries are sorted by name, metrics of a later file override the same metrics of an earlier file
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		var parse func(line string) (string, float64, error)
+		switch filepath.Ext(name) {
+		case ".prom":
+			parse = parsePrometheus
+		case ".txt":
+			parse = parseKeyValue
+		default:
+			continue
+		}
+
+		var stat FileStat
+		if info, err := entry.Info(); err == nil {
+			stat.ModTime = info.ModTime()
+		}
+		stat.Err = readFile(filepath.Join(c.dir, name), parse, stats.Metrics)
+		stats.Files[name] = stat
+	}
+
+	return stats
+}
+
+// readFile adds the metrics of the file into metrics. Nothing is added if the file has an invalid line.
+func readFile(path string, parse func(line string) (string, float64, error), metrics map[string]float64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		key, v, err := parse(line)
+		if err != nil {
+			return fmt.Errorf("textfile: %s:%d: %w", filepath.Base(path), n, err)
+		}
+		values[key] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for k, v := range values {
+		metrics[k] = v
+	}
+	return nil
+}
+
+// parseKeyValue parses a key=value line.
+func parseKeyValue(line string) (string, float64, error) {
+	key, v, ok := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return "", 0, fmt.Errorf("invalid line %q", line)
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return key, f, nil
+}
+
+// parsePrometheus parses a sample line of the Prometheus text format. The key is the metric name
+// followed by its labels sorted by name, e.g. backup_size_bytes{db="users"}. The timestamp is ignored.
+func parsePrometheus(line string) (string, float64, error) {
+	key := line
+	rest := ""
+	if i := strings.IndexByte(line, '{'); i >= 0 {
+		j := strings.LastIndexByte(line, '}')
+		if j < i {
+			return "", 0, fmt.Errorf("invalid line %q", line)
+		}
+		labels, err := parseLabels(line[i+1 : j])
+		if err != nil {
+			return "", 0, err
+		}
+		key = strings.TrimSpace(line[:i]) + labels
+		rest = line[j+1:]
+	} else {
+		fields := strings.Fields(line)
+		key = fields[0]
+		rest = strings.TrimPrefix(line, fields[0])
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", 0, fmt.Errorf("invalid line %q", line)
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return key, v, nil
+}
+
+// parseLabels parses `name="value",...` and returns them sorted by name in braces, or an empty string if there is no label.
+func parseLabels(s string) (string, error) {
+	var labels []string
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			break
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return "", fmt.Errorf("invalid labels %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimSpace(s[eq+1:])
+		if !strings.HasPrefix(s, `"`) {
+			return "", fmt.Errorf("invalid label value of %s", name)
+		}
+
+		// find the closing quote, skipping escaped characters
+		end := -1
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return "", fmt.Errorf("unterminated label value of %s", name)
+		}
+		labels = append(labels, name+"="+s[:end+1])
+		s = s[end+1:]
+	}
+
+	if len(labels) == 0 {
+		return "", nil
+	}
+	sort.Strings(labels)
+	return "{" + strings.Join(labels, ",") + "}", nil
+}
+
+// TextfileStats represents the metrics read from the files.
+type TextfileStats struct {
+	Metrics map[string]float64
+	// Files are the stats of the files keyed by file name.
+	Files map[string]FileStat
+	// Err is the error of reading the directory.
+	Err error
+}
+
+// FileStat represents the stats of a metric file.
+type FileStat struct {
+	ModTime time.Time
+	// Err is the error of reading or parsing the file, its metrics are ignored if it is not nil.
+	Err error
+}
+
+// Values returns metrics which you can write into TSDB. Besides the metrics read from the files,
+// textfile.<file>.mtime is the modification time of every file in unix seconds and
+// textfile.errors is the number of files which couldn't be read.
+func (s *TextfileStats) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Metrics)+len(s.Files)+1)
+	for k, v := range s.Metrics {
+		values[k] = v
+	}
+
+	var errors int64
+	if s.Err != nil {
+		errors++
+	}
+	for name, stat := range s.Files {
+		if stat.Err != nil {
+			errors++
+		}
+		values["textfile."+name+".mtime"] = stat.ModTime.Unix()
+	}
+	values["textfile.errors"] = errors
+	return values
+}
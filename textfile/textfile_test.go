@@ -0,0 +1,47 @@
+package textfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrometheus(t *testing.T) {
+	key, v, err := parsePrometheus(`backup_size_bytes{type="full", db="users"} 52428800 1698100000000`)
+	assert.Nil(t, err)
+	assert.Equal(t, `backup_size_bytes{db="users",type="full"}`, key)
+	assert.Equal(t, 52428800.0, v)
+
+	key, v, err = parsePrometheus(`backup_last_success_seconds 1.5e+09`)
+	assert.Nil(t, err)
+	assert.Equal(t, "backup_last_success_seconds", key)
+	assert.Equal(t, 1.5e+09, v)
+
+	_, _, err = parsePrometheus(`backup_size_bytes{db="users} 1`)
+	assert.NotNil(t, err)
+	_, _, err = parsePrometheus(`backup_size_bytes`)
+	assert.NotNil(t, err)
+}
+
+func TestCollectorOnce(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "backup.prom"), []byte("# HELP backup_size_bytes Size.\nbackup_size_bytes{db=\"users\"} 1024\n"), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "job.txt"), []byte("job.last_success = 1698100000\n"), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "broken.txt"), []byte("job.failed 1\n"), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, ".tmp.prom"), []byte("partial"), 0o644))
+
+	stats := New(nil, dir).Once()
+	assert.Nil(t, stats.Err)
+	assert.Equal(t, map[string]float64{`backup_size_bytes{db="users"}`: 1024, "job.last_success": 1698100000}, stats.Metrics)
+	assert.Len(t, stats.Files, 3)
+	assert.NotNil(t, stats.Files["broken.txt"].Err)
+
+	values := stats.Values()
+	assert.Equal(t, int64(1), values["textfile.errors"])
+	assert.Contains(t, values, "textfile.job.txt.mtime")
+
+	stats = New(nil, filepath.Join(dir, "missing")).Once()
+	assert.NotNil(t, stats.Err)
+}
@@ -0,0 +1,110 @@
+// Package units provides scaling of exported values, e.g. memory in MiB and durations in milliseconds
+// instead of raw bytes and nanoseconds. Units of metrics are looked up in the metadata package.
+package units
+
+import (
+	"fmt"
+
+	"github.com/smallnest/go-app-metrics/internal/value"
+	"github.com/smallnest/go-app-metrics/metadata"
+)
+
+// ByteUnit is the unit of memory and disk values. Zero means bytes.
+type ByteUnit int64
+
+// Byte units.
+const (
+	B   ByteUnit = 1
+	KiB ByteUnit = 1 << 10
+	MiB ByteUnit = 1 << 20
+	GiB ByteUnit = 1 << 30
+)
+
+// DurationUnit is the unit of durations. Zero means nanoseconds.
+type DurationUnit int64
+
+// Duration units.
+const (
+	Nanosecond  DurationUnit = 1
+	Microsecond DurationUnit = 1e3
+	Millisecond DurationUnit = 1e6
+	Second      DurationUnit = 1e9
+)
+
+// ParseByteUnit parses B, KiB, MiB and GiB.
+func ParseByteUnit(s string) (ByteUnit, error) {
+	switch s {
+	case "", "B":
+		return B, nil
+	case "KiB":
+		return KiB, nil
+	case "MiB":
+		return MiB, nil
+	case "GiB":
+		return GiB, nil
+	default:
+		return 0, fmt.Errorf("units: unknown byte unit %q", s)
+	}
+}
+
+// ParseDurationUnit parses ns, us, ms and s.
+func ParseDurationUnit(s string) (DurationUnit, error) {
+	switch s {
+	case "", "ns":
+		return Nanosecond, nil
+	case "us":
+		return Microsecond, nil
+	case "ms":
+		return Millisecond, nil
+	case "s":
+		return Second, nil
+	default:
+		return 0, fmt.Errorf("units: unknown duration unit %q", s)
+	}
+}
+
+// Scale converts values in bytes and nanoseconds into the configured units.
+// The zero value doesn't convert anything.
+type Scale struct {
+	Bytes     ByteUnit
+	Durations DurationUnit
+}
+
+// IsZero reports whether s doesn't convert anything.
+func (s Scale) IsZero() bool {
+	return s.Bytes <= B && s.Durations <= Nanosecond
+}
+
+// Apply converts values in place. Converted values become float64, the others are kept as is.
+func (s Scale) Apply(values map[string]interface{}) {
+	if s.IsZero() {
+		return
+	}
+
+	for k, v := range values {
+		m, ok := metadata.Lookup(k)
+		if !ok {
+			continue
+		}
+
+		div := s.Divisor(m)
+		if div == 1 {
+			continue
+		}
+		if f, ok := value.Float64(v); ok {
+			values[k] = f / div
+		}
+	}
+}
+
+// Divisor returns the number values of m are divided by to convert them, 1 if they aren't converted.
+func (s Scale) Divisor(m metadata.Metric) float64 {
+	switch {
+	case m.Unit == metadata.Bytes && s.Bytes > B:
+		return float64(s.Bytes)
+	case m.Unit == metadata.Nanoseconds && s.Durations > Nanosecond:
+		return float64(s.Durations)
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,48 @@
+package units
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScale(t *testing.T) {
+	values := map[string]interface{}{
+		"mem.heap.alloc":     int64(3 << 20),
+		"disk./.free":        uint64(1 << 30),
+		"mem.gc.pause_total": int64(2500000),
+		"mem.gc.last":        int64(1700000000000000000),
+		"cpu.goroutines":     int64(10),
+	}
+
+	s := Scale{Bytes: MiB, Durations: Millisecond}
+	s.Apply(values)
+	assert.Equal(t, map[string]interface{}{
+		"mem.heap.alloc":     3.0,
+		"disk./.free":        1024.0,
+		"mem.gc.pause_total": 2.5,
+		"mem.gc.last":        int64(1700000000000000000),
+		"cpu.goroutines":     int64(10),
+	}, values)
+}
+
+func TestZeroScale(t *testing.T) {
+	values := map[string]interface{}{"mem.heap.alloc": int64(1)}
+	Scale{}.Apply(values)
+	assert.Equal(t, int64(1), values["mem.heap.alloc"])
+	assert.True(t, Scale{Bytes: B, Durations: Nanosecond}.IsZero())
+}
+
+func TestParse(t *testing.T) {
+	b, err := ParseByteUnit("GiB")
+	assert.Nil(t, err)
+	assert.Equal(t, GiB, b)
+	_, err = ParseByteUnit("GB")
+	assert.NotNil(t, err)
+
+	d, err := ParseDurationUnit("ms")
+	assert.Nil(t, err)
+	assert.Equal(t, Millisecond, d)
+	_, err = ParseDurationUnit("m")
+	assert.NotNil(t, err)
+}